@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxDebugDelay is the longest that the /delay endpoint of the debug handler will sleep for.
+const MaxDebugDelay = 10
+
+// Debug returns a handler that serves httpbin like debugging endpoints under the prefix, and passes every other
+// request on to next:
+//
+//	<prefix>/headers    responds with the request headers as JSON
+//	<prefix>/ip         responds with the client's IP address as JSON
+//	<prefix>/delay/<n>  responds after sleeping for n seconds (up to MaxDebugDelay)
+//	<prefix>/status/<n> responds with the status code n
+func Debug(prefix string, next http.Handler) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if !strings.HasPrefix(path, prefix+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path = path[len(prefix):]
+
+		switch {
+		case path == "/headers":
+			debugHeaders(w, r)
+		case path == "/ip":
+			debugIP(w, r)
+		case strings.HasPrefix(path, "/delay/"):
+			debugDelay(w, r, path[len("/delay/"):])
+		case strings.HasPrefix(path, "/status/"):
+			debugStatus(w, path[len("/status/"):])
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func debugHeaders(w http.ResponseWriter, r *http.Request) {
+	headers := make(map[string]string, len(r.Header)+1)
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ",")
+	}
+
+	// The Host header is moved out of the headers and into the request by the parser
+	if r.Host != "" {
+		headers["Host"] = r.Host
+	}
+	writeJSON(w, map[string]interface{}{"headers": headers})
+}
+
+func debugIP(w http.ResponseWriter, r *http.Request) {
+	origin := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(origin); err == nil {
+		origin = host
+	}
+	writeJSON(w, map[string]string{"origin": origin})
+}
+
+func debugDelay(w http.ResponseWriter, r *http.Request, n string) {
+	seconds, err := strconv.Atoi(n)
+	if err != nil || seconds < 0 || seconds > MaxDebugDelay {
+		http.Error(w, "delay must be a whole number of seconds between 0 and "+strconv.Itoa(MaxDebugDelay), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case <-time.After(time.Duration(seconds) * time.Second):
+	case <-r.Context().Done():
+		return
+	}
+	writeJSON(w, map[string]int{"delay": seconds})
+}
+
+func debugStatus(w http.ResponseWriter, n string) {
+	status, err := strconv.Atoi(n)
+	if err != nil || status < 100 || status > 999 {
+		http.Error(w, "invalid status code", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(status)
+}
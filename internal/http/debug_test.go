@@ -0,0 +1,102 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDebug(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+
+	testCases := []struct {
+		header         http.Header
+		desc           string
+		path           string
+		expectedBody   string
+		expectedStatus int
+		expectedDelay  time.Duration
+	}{
+		{
+			desc:           "headers",
+			path:           "/debug/headers",
+			header:         http.Header{"Accept": {"*/*"}, "X-Forwarded-For": {"10.0.0.1", "10.0.0.2"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"headers":{"Accept":"*/*","Host":"example.com","X-Forwarded-For":"10.0.0.1,10.0.0.2"}}`,
+		},
+		{
+			desc:           "ip",
+			path:           "/debug/ip",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"origin":"192.0.2.1"}`,
+		},
+		{
+			desc:           "delay",
+			path:           "/debug/delay/1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"delay":1}`,
+			expectedDelay:  time.Second,
+		},
+		{
+			desc:           "delay over the maximum",
+			path:           "/debug/delay/11",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "delay must be a whole number of seconds between 0 and 10\n",
+		},
+		{
+			desc:           "invalid delay",
+			path:           "/debug/delay/soon",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "delay must be a whole number of seconds between 0 and 10\n",
+		},
+		{
+			desc:           "status",
+			path:           "/debug/status/418",
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			desc:           "invalid status",
+			path:           "/debug/status/42",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid status code\n",
+		},
+		{
+			desc:           "unknown debug endpoint",
+			path:           "/debug/unknown",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "next",
+		},
+		{
+			desc:           "outside of the prefix",
+			path:           "/headers",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "next",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// httptest.NewRequest sets the Host to example.com and the RemoteAddr to 192.0.2.1:1234
+			req := httptest.NewRequest(http.MethodGet, tC.path, nil)
+			for k, v := range tC.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+
+			start := time.Now()
+			Debug("/debug/", next).ServeHTTP(rec, req)
+			if elapsed := time.Since(start); elapsed < tC.expectedDelay {
+				subT.Errorf("responded after %v, want at least %v", elapsed, tC.expectedDelay)
+			}
+
+			if rec.Code != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", rec.Code, tC.expectedStatus)
+			}
+			if got := rec.Body.String(); got != tC.expectedBody {
+				subT.Errorf("body = %q, want %q", got, tC.expectedBody)
+			}
+		})
+	}
+}
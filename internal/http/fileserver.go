@@ -0,0 +1,159 @@
+package http
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// fileServerAllow is the Allow header of the OPTIONS responses of the file server.
+const fileServerAllow = "GET, HEAD, OPTIONS"
+
+// FileServer returns a handler that serves the files under root like http.FileServer, except that when a
+// precompressed sidecar file (e.g. foo.js.gz next to foo.js) exists and the client accepts gzip, the sidecar
+// is served as is with Content-Encoding: gzip, saving the cost of compressing the file on every request. OPTIONS
+// requests are answered with the methods that the file can be requested with, and Accept-Ranges: bytes for files.
+func FileServer(root http.FileSystem) http.Handler {
+	return &fileServer{
+		root:     root,
+		fallback: http.FileServer(root),
+	}
+}
+
+// FileServerFS returns a FileServer that serves the files of the fsys, e.g. an embed.FS, so that a single binary can
+// serve its assets without them being on disk. The paths of the requests are looked up relative to the root of the
+// fsys, so assets embedded under a directory should be served from fs.Sub of it.
+func FileServerFS(fsys fs.FS) http.Handler {
+	return FileServer(http.FS(fsys))
+}
+
+type fileServer struct {
+	root     http.FileSystem
+	fallback http.Handler
+}
+
+func (fs *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	if r.Method == http.MethodOptions {
+		fs.serveOptions(w, r, name)
+		return
+	}
+
+	if fs.serveSidecar(w, r, name) {
+		return
+	}
+	fs.fallback.ServeHTTP(w, r)
+}
+
+// serveOptions answers an OPTIONS request for the named path, or a 404 when there is nothing to serve there. Files
+// (including the index.html of a directory) are served with http.ServeContent, which supports byte ranges, so they
+// advertise Accept-Ranges, while directory listings don't.
+func (fs *fileServer) serveOptions(w http.ResponseWriter, r *http.Request, name string) {
+	info, err := fs.stat(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if info.IsDir() {
+		if index, err := fs.stat(path.Join(name, "index.html")); err == nil && !index.IsDir() {
+			info = index
+		}
+	}
+
+	w.Header().Set("Allow", fileServerAllow)
+	if !info.IsDir() {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// stat returns the file info of the named file.
+func (fs *fileServer) stat(name string) (os.FileInfo, error) {
+	f, err := fs.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// serveSidecar serves the gzip sidecar of the named file, and reports whether it did.
+func (fs *fileServer) serveSidecar(w http.ResponseWriter, r *http.Request, name string) bool {
+	// The sidecar is served with the Content-Type of the original file, so if we can't
+	// tell what that is from the extension, we let the fallback sniff the original.
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" || strings.HasSuffix(name, "/") {
+		return false
+	}
+
+	f, err := fs.root.Open(name + ".gz")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	// Whether the sidecar exists or not, the response depends on the Accept-Encoding of the request from now on
+	AddVary(w.Header(), "Accept-Encoding")
+	if !acceptsGzip(r) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", "gzip")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return true
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of the request allows a gzip encoded response. An explicit
+// gzip coding takes precedence over a "*" anywhere in the header (RFC 7231 section 5.3.4), so "*, gzip;q=0" refuses it.
+func acceptsGzip(r *http.Request) bool {
+	gzipFound, wildcardFound := false, false
+	var gzipQ, wildcardQ float64
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			coding, params := coding, ""
+			if idx := strings.IndexByte(coding, ';'); idx >= 0 {
+				coding, params = coding[:idx], coding[idx+1:]
+			}
+
+			coding = strings.TrimSpace(coding)
+			switch {
+			case strings.EqualFold(coding, "gzip"):
+				gzipFound, gzipQ = true, codingQuality(params)
+			case coding == "*":
+				wildcardFound, wildcardQ = true, codingQuality(params)
+			}
+		}
+	}
+
+	if gzipFound {
+		return gzipQ > 0
+	}
+	return wildcardFound && wildcardQ > 0
+}
+
+// codingQuality returns the quality value in the parameters of an Accept-Encoding coding, which defaults to 1.
+// A zero quality value explicitly refuses the coding, and so does one that can't be parsed.
+func codingQuality(params string) float64 {
+	params = strings.TrimSpace(params)
+	if !strings.HasPrefix(params, "q=") {
+		return 1
+	}
+
+	q, err := strconv.ParseFloat(params[len("q="):], 64)
+	if err != nil {
+		return 0
+	}
+	return q
+}
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileServer_GzipSidecarVary(t *testing.T) {
+	files := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log('plain')")},
+		"app.js.gz": {Data: []byte("\x1f\x8bprecompressed")},
+	}
+
+	// A handler in front of the file server already varies the response on the origin
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Origin")
+		FileServer(http.FS(files)).ServeHTTP(w, r)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Values("Vary"); len(got) != 1 || got[0] != "Origin, Accept-Encoding" {
+		t.Errorf("Vary = %q, want %q", got, []string{"Origin, Accept-Encoding"})
+	}
+}
+
+func TestFileServer_GzipSidecar(t *testing.T) {
+	files := fstest.MapFS{
+		"app.js":     {Data: []byte("console.log('plain')")},
+		"app.js.gz":  {Data: []byte("\x1f\x8bprecompressed")},
+		"style.css":  {Data: []byte("body {}")},
+		"index.html": {Data: []byte("<html></html>")},
+	}
+
+	testCases := []struct {
+		desc             string
+		path             string
+		acceptEncoding   string
+		expectedBody     string
+		expectedType     string
+		expectedEncoding string
+	}{
+		{
+			desc:             "gzip accepting client gets the sidecar",
+			path:             "/app.js",
+			acceptEncoding:   "gzip, deflate, br",
+			expectedBody:     "\x1f\x8bprecompressed",
+			expectedType:     mime.TypeByExtension(".js"),
+			expectedEncoding: "gzip",
+		},
+		{
+			desc:           "client without gzip gets the original",
+			path:           "/app.js",
+			acceptEncoding: "br",
+			expectedBody:   "console.log('plain')",
+			expectedType:   mime.TypeByExtension(".js"),
+		},
+		{
+			desc:           "client refusing gzip gets the original",
+			path:           "/app.js",
+			acceptEncoding: "gzip;q=0, br",
+			expectedBody:   "console.log('plain')",
+			expectedType:   mime.TypeByExtension(".js"),
+		},
+		{
+			desc:             "client accepting any coding gets the sidecar",
+			path:             "/app.js",
+			acceptEncoding:   "br, *",
+			expectedBody:     "\x1f\x8bprecompressed",
+			expectedType:     mime.TypeByExtension(".js"),
+			expectedEncoding: "gzip",
+		},
+		{
+			desc:           "client refusing gzip after accepting any coding gets the original",
+			path:           "/app.js",
+			acceptEncoding: "*, gzip;q=0",
+			expectedBody:   "console.log('plain')",
+			expectedType:   mime.TypeByExtension(".js"),
+		},
+		{
+			desc:             "client accepting gzip after refusing any coding gets the sidecar",
+			path:             "/app.js",
+			acceptEncoding:   "*;q=0, gzip",
+			expectedBody:     "\x1f\x8bprecompressed",
+			expectedType:     mime.TypeByExtension(".js"),
+			expectedEncoding: "gzip",
+		},
+		{
+			desc:           "file without a sidecar",
+			path:           "/style.css",
+			acceptEncoding: "gzip",
+			expectedBody:   "body {}",
+			expectedType:   mime.TypeByExtension(".css"),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tC.path, nil)
+			if tC.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tC.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			FileServer(http.FS(files)).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				subT.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Body.String(); got != tC.expectedBody {
+				subT.Errorf("body = %q, want %q", got, tC.expectedBody)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tC.expectedType {
+				subT.Errorf("Content-Type = %q, want %q", got, tC.expectedType)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tC.expectedEncoding {
+				subT.Errorf("Content-Encoding = %q, want %q", got, tC.expectedEncoding)
+			}
+		})
+	}
+}
+
+func TestFileServer_Options(t *testing.T) {
+	files := fstest.MapFS{
+		"app.js":           {Data: []byte("console.log('plain')")},
+		"app.js.gz":        {Data: []byte("\x1f\x8bprecompressed")},
+		"docs/index.html":  {Data: []byte("<html></html>")},
+		"assets/style.css": {Data: []byte("body {}")},
+		"assets/script.js": {Data: []byte("console.log('asset')")},
+	}
+
+	testCases := []struct {
+		desc                 string
+		path                 string
+		expectedAllow        string
+		expectedAcceptRanges string
+		expectedStatus       int
+	}{
+		{
+			desc:                 "file",
+			path:                 "/assets/style.css",
+			expectedStatus:       http.StatusOK,
+			expectedAllow:        "GET, HEAD, OPTIONS",
+			expectedAcceptRanges: "bytes",
+		},
+		{
+			desc:                 "file with a gzip sidecar",
+			path:                 "/app.js",
+			expectedStatus:       http.StatusOK,
+			expectedAllow:        "GET, HEAD, OPTIONS",
+			expectedAcceptRanges: "bytes",
+		},
+		{
+			desc:                 "directory with an index",
+			path:                 "/docs/",
+			expectedStatus:       http.StatusOK,
+			expectedAllow:        "GET, HEAD, OPTIONS",
+			expectedAcceptRanges: "bytes",
+		},
+		{
+			desc:           "directory listing",
+			path:           "/assets/",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			desc:           "missing file",
+			path:           "/missing.css",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tC.path, nil)
+			rec := httptest.NewRecorder()
+
+			FileServer(http.FS(files)).ServeHTTP(rec, req)
+
+			if rec.Code != tC.expectedStatus {
+				subT.Fatalf("status = %d, want %d", rec.Code, tC.expectedStatus)
+			}
+			if got := rec.Header().Get("Allow"); got != tC.expectedAllow {
+				subT.Errorf("Allow = %q, want %q", got, tC.expectedAllow)
+			}
+			if got := rec.Header().Get("Accept-Ranges"); got != tC.expectedAcceptRanges {
+				subT.Errorf("Accept-Ranges = %q, want %q", got, tC.expectedAcceptRanges)
+			}
+			if tC.expectedStatus == http.StatusOK && rec.Body.Len() != 0 {
+				subT.Errorf("body = %q, want it empty", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFileServerFS(t *testing.T) {
+	files := fstest.MapFS{
+		"public/index.html": {Data: []byte("<html></html>")},
+		"public/style.css":  {Data: []byte("body { margin: 0; }")},
+		"public/app.js":     {Data: []byte("console.log('plain')")},
+		"public/app.js.gz":  {Data: []byte("\x1f\x8bprecompressed")},
+	}
+	public, err := fs.Sub(files, "public")
+	if err != nil {
+		t.Fatalf("unable to get the public directory: %v", err)
+	}
+
+	testCases := []struct {
+		desc                 string
+		path                 string
+		rangeHeader          string
+		acceptEncoding       string
+		expectedBody         string
+		expectedType         string
+		expectedContentRange string
+		expectedEncoding     string
+		expectedStatus       int
+	}{
+		{
+			desc:           "file",
+			path:           "/style.css",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "body { margin: 0; }",
+			expectedType:   mime.TypeByExtension(".css"),
+		},
+		{
+			desc:                 "range of a file",
+			path:                 "/style.css",
+			rangeHeader:          "bytes=7-12",
+			expectedStatus:       http.StatusPartialContent,
+			expectedBody:         "margin",
+			expectedType:         mime.TypeByExtension(".css"),
+			expectedContentRange: "bytes 7-12/19",
+		},
+		{
+			desc:           "directory index",
+			path:           "/",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "<html></html>",
+			expectedType:   "text/html; charset=utf-8",
+		},
+		{
+			desc:             "gzip sidecar",
+			path:             "/app.js",
+			acceptEncoding:   "gzip",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "\x1f\x8bprecompressed",
+			expectedType:     mime.TypeByExtension(".js"),
+			expectedEncoding: "gzip",
+		},
+		{
+			desc:           "missing file",
+			path:           "/missing.css",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "404 page not found\n",
+			expectedType:   "text/plain; charset=utf-8",
+		},
+		{
+			desc:           "file outside of the sub directory",
+			path:           "/public/style.css",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "404 page not found\n",
+			expectedType:   "text/plain; charset=utf-8",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tC.path, nil)
+			if tC.rangeHeader != "" {
+				req.Header.Set("Range", tC.rangeHeader)
+			}
+			if tC.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tC.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			FileServerFS(public).ServeHTTP(rec, req)
+
+			if rec.Code != tC.expectedStatus {
+				subT.Fatalf("status = %d, want %d", rec.Code, tC.expectedStatus)
+			}
+			if got := rec.Body.String(); got != tC.expectedBody {
+				subT.Errorf("body = %q, want %q", got, tC.expectedBody)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tC.expectedType {
+				subT.Errorf("Content-Type = %q, want %q", got, tC.expectedType)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tC.expectedContentRange {
+				subT.Errorf("Content-Range = %q, want %q", got, tC.expectedContentRange)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tC.expectedEncoding {
+				subT.Errorf("Content-Encoding = %q, want %q", got, tC.expectedEncoding)
+			}
+		})
+	}
+}
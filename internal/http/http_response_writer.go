@@ -2,18 +2,40 @@ package http
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/probably-not/server-scratch/internal/ioutil"
 )
 
+// ErrInvalidHeader is returned when serializing a response with a header that would corrupt it, and the response must
+// be replaced with a 500 Internal Server Error.
+var ErrInvalidHeader = errors.New("invalid response header")
+
 // A very basic naive http.ResponseWriter implementation that attempts to write to an underlying http.Response.
 // This should be further extended in the future to ensure we are writing the correct Headers, protocols, and flags
 // to the http.Response.
 type ResponseWriter struct {
 	*http.Response
-	buf []byte
+	// written holds the headers as they were when the handler wrote the header, which are the ones that are sent.
+	written http.Header
+	// superfluous is where the handler first called WriteHeader after the header was written, when it did.
+	superfluous string
+	buf         []byte
+	// head is set for responses to HEAD requests, which are written with the Content-Length of their body but without it.
+	head bool
+	// trailersRefused is set for responses to requests without TE: trailers, whose trailers are dropped.
+	trailersRefused bool
+	// wroteHeader is set once the handler has written the header, explicitly or with its first Write.
+	wroteHeader bool
+	// handlerDone is set once the handler has returned, after which the server can change the response freely.
+	handlerDone bool
 }
 
 func NewResponseWriter() *ResponseWriter {
@@ -26,6 +48,37 @@ func NewResponseWriter() *ResponseWriter {
 	}
 }
 
+// SetProto sets the HTTP version that the response will be written with.
+func (rw *ResponseWriter) SetProto(major, minor int) {
+	if rw == nil {
+		return
+	}
+
+	rw.Proto = fmt.Sprintf("HTTP/%d.%d", major, minor)
+	rw.ProtoMajor = major
+	rw.ProtoMinor = minor
+}
+
+// SetHead marks the response as the answer to a HEAD request, so that it is written without its body.
+// The headers, including the Content-Length, are still written as if the body was sent.
+func (rw *ResponseWriter) SetHead() {
+	if rw == nil {
+		return
+	}
+
+	rw.head = true
+}
+
+// RefuseTrailers marks the response as the answer to a request that didn't advertise TE: trailers, so that it is
+// written without the trailers that the handler declared, as if it never had any.
+func (rw *ResponseWriter) RefuseTrailers() {
+	if rw == nil {
+		return
+	}
+
+	rw.trailersRefused = true
+}
+
 func (rw *ResponseWriter) Header() http.Header {
 	return rw.Response.Header
 }
@@ -43,20 +96,291 @@ func (rw *ResponseWriter) Write(data []byte) (int, error) {
 	return len(data), nil
 }
 
+// Bytes returns the body that has been written to the response so far.
+func (rw *ResponseWriter) Bytes() []byte {
+	if rw == nil {
+		return nil
+	}
+
+	return rw.buf
+}
+
+// SetBody replaces the body that has been written to the response so far.
+func (rw *ResponseWriter) SetBody(body []byte) {
+	if rw == nil {
+		return
+	}
+
+	rw.buf = body
+}
+
+// WriteHeader follows the semantics of http.ResponseWriter: the handler only gets to write the header once, and any
+// later call is ignored (see SuperfluousWriteHeader). The headers are written along with it, so the ones that the
+// handler sets afterwards aren't sent, apart from trailers (see HandlerDone).
 func (rw *ResponseWriter) WriteHeader(statusCode int) {
 	if rw == nil {
 		return
 	}
 
+	if !rw.handlerDone {
+		if rw.wroteHeader {
+			if rw.superfluous == "" {
+				rw.superfluous = "unknown"
+				if _, file, line, ok := runtime.Caller(1); ok {
+					rw.superfluous = file + ":" + strconv.Itoa(line)
+				}
+			}
+			return
+		}
+
+		// Setting or adding a header replaces its values, so a shallow copy is enough to keep the written ones
+		rw.wroteHeader = true
+		rw.written = make(http.Header, len(rw.Response.Header))
+		for name, values := range rw.Response.Header {
+			rw.written[name] = values
+		}
+	}
 	rw.StatusCode = statusCode
 }
 
+// SuperfluousWriteHeader returns the file and line of the first WriteHeader call that the handler made after the header
+// had already been written, which was ignored, or an empty string when it made none.
+func (rw *ResponseWriter) SuperfluousWriteHeader() string {
+	if rw == nil {
+		return ""
+	}
+
+	return rw.superfluous
+}
+
+// HandlerDone hands the response back from the handler to the server once the handler has returned. The headers that
+// the handler set after it wrote the header are dropped, like the standard library does, except for the trailers:
+// the values of the ones that were declared in the Trailer header, and the headers set with the http.TrailerPrefix,
+// which are only known once the body has been written. From then on, the status and headers can be changed freely,
+// e.g. by ApplyRange. WriteToBuf and Buffers call it, so it only needs to be called when the response is changed in
+// between.
+func (rw *ResponseWriter) HandlerDone() {
+	if rw == nil || rw.handlerDone {
+		return
+	}
+
+	rw.handlerDone = true
+	if rw.written == nil {
+		return
+	}
+
+	header := rw.Response.Header
+	for _, names := range rw.written["Trailer"] {
+		for _, name := range strings.Split(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if values, ok := header[name]; ok {
+				rw.written[name] = values
+			}
+		}
+	}
+
+	for name, values := range header {
+		if strings.HasPrefix(name, http.TrailerPrefix) {
+			rw.written[name] = values
+		}
+	}
+
+	rw.Response.Header = rw.written
+	rw.written = nil
+}
+
 func (rw *ResponseWriter) WriteToBuf(w io.Writer) error {
 	if rw == nil {
 		return nil
 	}
+	rw.HandlerDone()
+
+	if err := rw.validateHeaders(); err != nil {
+		return err
+	}
+	rw.defaultStatus()
+
+	if !bodyAllowedForStatus(rw.StatusCode) {
+		// Responses with these statuses must not have a body, nor a Content-Length or Transfer-Encoding header
+		// (RFC 7230 section 3.3), so anything that the handler wrote is dropped.
+		rw.buf = nil
+		return rw.writeHead(w)
+	}
+
+	rw.sniffContentType()
+	if rw.head && len(rw.buf) > 0 {
+		return rw.writeHead(w)
+	}
 
 	rw.Body = ioutil.NopCloser(bytes.NewReader(rw.buf))
+	if rw.prepareTrailers() {
+		// Trailers can only be sent after the final chunk of a chunked body
+		rw.TransferEncoding = []string{"chunked"}
+		rw.ContentLength = -1
+		return rw.Response.Write(w)
+	}
 	rw.ContentLength = int64(len(rw.buf))
 	return rw.Response.Write(w)
 }
+
+// Buffers serializes the response into its head (the status line and headers) and its body without copying the body,
+// so that large responses can be sent with a single vectored write (writev), e.g. with net.Buffers.WriteTo, instead
+// of being concatenated into one buffer first. The result is byte for byte the same as what WriteToBuf writes.
+// Note that gnet v1.5.3 has no vectored write on its connections (only v2 adds Conn.Writev), and evio returns a single
+// buffer from its events, so the event loop engines still send WriteToBuf's output. Buffers is meant for net.Conn writers.
+func (rw *ResponseWriter) Buffers() (net.Buffers, error) {
+	if rw == nil {
+		return nil, nil
+	}
+	rw.HandlerDone()
+
+	if err := rw.validateHeaders(); err != nil {
+		return nil, err
+	}
+	rw.defaultStatus()
+
+	head := bytes.NewBuffer(nil)
+	if len(rw.buf) == 0 || rw.hasTrailers() || !bodyAllowedForStatus(rw.StatusCode) {
+		if err := rw.WriteToBuf(head); err != nil {
+			return nil, err
+		}
+		return net.Buffers{head.Bytes()}, nil
+	}
+
+	rw.sniffContentType()
+	if err := rw.writeHead(head); err != nil {
+		return nil, err
+	}
+
+	if rw.head {
+		return net.Buffers{head.Bytes()}, nil
+	}
+	return net.Buffers{head.Bytes(), rw.buf}, nil
+}
+
+// writeHead writes the status line and headers of a response, including the Content-Length of a non empty body,
+// without the body itself. It does so by writing the response as if it answers a HEAD request.
+func (rw *ResponseWriter) writeHead(w io.Writer) error {
+	req := rw.Request
+	rw.Request = &http.Request{Method: http.MethodHead}
+	rw.Body = nil
+	rw.ContentLength = int64(len(rw.buf))
+	err := rw.Response.Write(w)
+	rw.Request = req
+	return err
+}
+
+// defaultStatus makes a response whose handler never wrote its header or body a 200, like the standard library does,
+// so that it still goes out with a valid status line and a Content-Length: 0 that keeps the connection alive.
+func (rw *ResponseWriter) defaultStatus() {
+	if rw.StatusCode == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+}
+
+// validateHeaders rejects header names that aren't valid tokens and header values that contain a CR or LF, since
+// handlers that copy untrusted input into headers could otherwise inject headers of their own or split the response.
+// The standard library would quietly skip or rewrite them instead, so a broken response would still go out.
+func (rw *ResponseWriter) validateHeaders() error {
+	for name, values := range rw.Response.Header {
+		if token := strings.TrimPrefix(name, http.TrailerPrefix); token == "" || !isToken([]byte(token)) {
+			return fmt.Errorf("%w: name %q", ErrInvalidHeader, name)
+		}
+
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("%w: value of %s contains a CR or LF", ErrInvalidHeader, name)
+			}
+		}
+	}
+	return nil
+}
+
+// hasTrailers reports whether the handler has declared any trailers, either in the Trailer header
+// or by setting headers with the http.TrailerPrefix.
+func (rw *ResponseWriter) hasTrailers() bool {
+	if len(rw.Response.Header["Trailer"]) > 0 {
+		return true
+	}
+
+	for key := range rw.Response.Header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareTrailers moves the trailers that the handler has declared (like the standard library, names listed in the
+// Trailer header before the body is written, or headers set with the http.TrailerPrefix) from the headers to the
+// response's Trailer, and reports whether there are any. Since only chunked bodies can carry trailers, and HTTP/1.0
+// doesn't support chunking, the trailers of HTTP/1.0 responses are dropped, and so are the trailers of responses to
+// clients that didn't ask for them (see RefuseTrailers).
+func (rw *ResponseWriter) prepareTrailers() bool {
+	if !rw.hasTrailers() {
+		return false
+	}
+
+	header := rw.Response.Header
+	trailer := make(http.Header)
+	for _, names := range header["Trailer"] {
+		for _, name := range strings.Split(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+
+			// A declared trailer that was never set is still announced, with an empty value
+			trailer[name] = header[name]
+			if trailer[name] == nil {
+				trailer[name] = []string{}
+			}
+			delete(header, name)
+		}
+	}
+	delete(header, "Trailer")
+
+	for key, values := range header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			trailer[http.CanonicalHeaderKey(key[len(http.TrailerPrefix):])] = values
+			delete(header, key)
+		}
+	}
+
+	if !rw.ProtoAtLeast(1, 1) || rw.trailersRefused {
+		return false
+	}
+
+	rw.Trailer = trailer
+	return true
+}
+
+// sniffContentType sets the Content-Type of a response with a body that the handler didn't set one for,
+// using the same detection algorithm as the standard library (http.DetectContentType on the first 512 bytes).
+// Like the standard library, a Content-Type header that was explicitly set to nil disables sniffing.
+func (rw *ResponseWriter) sniffContentType() {
+	if len(rw.buf) == 0 || !bodyAllowedForStatus(rw.StatusCode) {
+		return
+	}
+
+	if _, ok := rw.Response.Header["Content-Type"]; ok {
+		return
+	}
+
+	if rw.Response.Header.Get("Transfer-Encoding") != "" {
+		return
+	}
+
+	rw.Response.Header.Set("Content-Type", http.DetectContentType(rw.buf))
+}
+
+// bodyAllowedForStatus reports whether a response with the given status may have a body, as defined in RFC 7230 section 3.3.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,774 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestResponseWriter_ContentTypeSniffing(t *testing.T) {
+	testCases := []struct {
+		header      http.Header
+		desc        string
+		expected    string
+		body        []byte
+		status      int
+		expectedSet bool
+	}{
+		{
+			desc:        "html",
+			body:        []byte("<!DOCTYPE html><html><body>hello</body></html>"),
+			expected:    "text/html; charset=utf-8",
+			expectedSet: true,
+		},
+		{
+			desc:        "png",
+			body:        []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			expected:    "image/png",
+			expectedSet: true,
+		},
+		{
+			desc:        "plain text",
+			body:        []byte("just some text"),
+			expected:    "text/plain; charset=utf-8",
+			expectedSet: true,
+		},
+		{
+			desc:        "binary",
+			body:        []byte{0x00, 0x01, 0x02, 0x03},
+			expected:    "application/octet-stream",
+			expectedSet: true,
+		},
+		{
+			desc:        "explicit content type is kept",
+			header:      http.Header{"Content-Type": {"application/json"}},
+			body:        []byte("<html></html>"),
+			expected:    "application/json",
+			expectedSet: true,
+		},
+		{
+			desc:        "nil content type disables sniffing",
+			header:      http.Header{"Content-Type": nil},
+			body:        []byte("<html></html>"),
+			expectedSet: false,
+		},
+		{
+			desc:        "empty body",
+			expectedSet: false,
+		},
+		{
+			desc:        "no body allowed",
+			body:        []byte("<html></html>"),
+			status:      http.StatusNotModified,
+			expectedSet: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			rw := NewResponseWriter()
+			for k, v := range tC.header {
+				rw.Header()[k] = v
+			}
+
+			if tC.status != 0 {
+				rw.WriteHeader(tC.status)
+			}
+			if len(tC.body) > 0 {
+				rw.Write(tC.body)
+			}
+			if rw.StatusCode == 0 {
+				rw.WriteHeader(http.StatusOK)
+			}
+
+			buf := bytes.NewBuffer(nil)
+			if err := rw.WriteToBuf(buf); err != nil {
+				subT.Fatalf("WriteToBuf() error = %v", err)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response: %v", err)
+			}
+
+			got, ok := res.Header["Content-Type"]
+			if ok != tC.expectedSet {
+				subT.Fatalf("Content-Type set = %v (%q), want set %v", ok, got, tC.expectedSet)
+			}
+			if ok && res.Header.Get("Content-Type") != tC.expected {
+				subT.Errorf("Content-Type = %q, want %q", res.Header.Get("Content-Type"), tC.expected)
+			}
+		})
+	}
+}
+
+func TestResponseWriter_Buffers(t *testing.T) {
+	testCases := []struct {
+		header          http.Header
+		desc            string
+		body            []byte
+		status          int
+		protoMajor      int
+		protoMinor      int
+		expectedBuffers int
+	}{
+		{
+			desc:            "body",
+			body:            []byte(`{"req": 0}`),
+			status:          http.StatusOK,
+			protoMajor:      1,
+			protoMinor:      1,
+			expectedBuffers: 2,
+		},
+		{
+			desc:            "headers and body",
+			header:          http.Header{"Content-Type": {"application/json"}, "X-Custom": {"a", "b"}},
+			body:            bytes.Repeat([]byte("a"), 64<<10),
+			status:          http.StatusCreated,
+			protoMajor:      1,
+			protoMinor:      1,
+			expectedBuffers: 2,
+		},
+		{
+			desc:            "empty body",
+			status:          http.StatusNoContent,
+			protoMajor:      1,
+			protoMinor:      1,
+			expectedBuffers: 1,
+		},
+		{
+			desc:            "HTTP/1.0",
+			body:            []byte("hello"),
+			status:          http.StatusOK,
+			protoMajor:      1,
+			protoMinor:      0,
+			expectedBuffers: 2,
+		},
+	}
+	newResponse := func(status int, header http.Header, body []byte, major, minor int) *ResponseWriter {
+		rw := NewResponseWriter()
+		rw.SetProto(major, minor)
+		for k, v := range header {
+			rw.Header()[k] = v
+		}
+		rw.WriteHeader(status)
+		if len(body) > 0 {
+			rw.Write(body)
+		}
+		return rw
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			expected := bytes.NewBuffer(nil)
+			if err := newResponse(tC.status, tC.header, tC.body, tC.protoMajor, tC.protoMinor).WriteToBuf(expected); err != nil {
+				subT.Fatalf("WriteToBuf() error = %v", err)
+			}
+
+			buffers, err := newResponse(tC.status, tC.header, tC.body, tC.protoMajor, tC.protoMinor).Buffers()
+			if err != nil {
+				subT.Fatalf("Buffers() error = %v", err)
+			}
+
+			if len(buffers) != tC.expectedBuffers {
+				subT.Errorf("Buffers() returned %d buffers, want %d", len(buffers), tC.expectedBuffers)
+			}
+
+			got := bytes.Join(buffers, nil)
+			if !bytes.Equal(got, expected.Bytes()) {
+				subT.Errorf("Buffers() = %q, want %q", got, expected.Bytes())
+			}
+		})
+	}
+}
+
+func TestResponseWriter_Trailers(t *testing.T) {
+	testCases := []struct {
+		declare          func(h http.Header)
+		set              func(h http.Header)
+		expectedTrailers http.Header
+		desc             string
+		expectedSuffix   string
+		protoMinor       int
+		refused          bool
+		expectedChunked  bool
+	}{
+		{
+			desc:             "declared trailer",
+			declare:          func(h http.Header) { h.Set("Trailer", "X-Checksum") },
+			set:              func(h http.Header) { h.Set("X-Checksum", "abc123") },
+			protoMinor:       1,
+			expectedChunked:  true,
+			expectedTrailers: http.Header{"X-Checksum": {"abc123"}},
+			expectedSuffix:   "0\r\nX-Checksum: abc123\r\n\r\n",
+		},
+		{
+			desc:             "multiple declared trailers",
+			declare:          func(h http.Header) { h.Set("Trailer", "X-Checksum, X-Count") },
+			set:              func(h http.Header) { h.Set("X-Checksum", "abc123"); h.Set("X-Count", "12") },
+			protoMinor:       1,
+			expectedChunked:  true,
+			expectedTrailers: http.Header{"X-Checksum": {"abc123"}, "X-Count": {"12"}},
+		},
+		{
+			desc:             "trailer prefix",
+			declare:          func(h http.Header) {},
+			set:              func(h http.Header) { h.Set(http.TrailerPrefix+"X-Checksum", "abc123") },
+			protoMinor:       1,
+			expectedChunked:  true,
+			expectedTrailers: http.Header{"X-Checksum": {"abc123"}},
+		},
+		{
+			desc:            "trailers are dropped in HTTP/1.0",
+			declare:         func(h http.Header) { h.Set("Trailer", "X-Checksum") },
+			set:             func(h http.Header) { h.Set("X-Checksum", "abc123") },
+			protoMinor:      0,
+			expectedChunked: false,
+		},
+		{
+			desc:            "trailers are dropped when the client didn't ask for them",
+			declare:         func(h http.Header) { h.Set("Trailer", "X-Checksum") },
+			set:             func(h http.Header) { h.Set(http.TrailerPrefix+"X-Count", "12"); h.Set("X-Checksum", "abc123") },
+			protoMinor:      1,
+			refused:         true,
+			expectedChunked: false,
+		},
+		{
+			desc:            "no trailers",
+			declare:         func(h http.Header) {},
+			set:             func(h http.Header) {},
+			protoMinor:      1,
+			expectedChunked: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			rw := NewResponseWriter()
+			rw.SetProto(1, tC.protoMinor)
+			if tC.refused {
+				rw.RefuseTrailers()
+			}
+			tC.declare(rw.Header())
+			rw.Write([]byte("hello, "))
+			rw.Write([]byte("world"))
+			tC.set(rw.Header())
+
+			buf := bytes.NewBuffer(nil)
+			if err := rw.WriteToBuf(buf); err != nil {
+				subT.Fatalf("WriteToBuf() error = %v", err)
+			}
+			raw := buf.String()
+
+			if tC.expectedSuffix != "" && !strings.HasSuffix(raw, tC.expectedSuffix) {
+				subT.Errorf("response %q doesn't end with %q", raw, tC.expectedSuffix)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", raw, err)
+			}
+
+			chunked := len(res.TransferEncoding) > 0 && res.TransferEncoding[0] == "chunked"
+			if chunked != tC.expectedChunked {
+				subT.Errorf("chunked = %v, want %v in %q", chunked, tC.expectedChunked, raw)
+			}
+			if !tC.expectedChunked && strings.Contains(raw, "abc123") {
+				subT.Errorf("dropped trailer was sent in %q", raw)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != "hello, world" {
+				subT.Errorf("body = %q, want %q", body, "hello, world")
+			}
+
+			// The trailer values are only known once the body has been read
+			for name := range tC.expectedTrailers {
+				if got := res.Trailer.Get(name); got != tC.expectedTrailers.Get(name) {
+					subT.Errorf("trailer %s = %q, want %q", name, got, tC.expectedTrailers.Get(name))
+				}
+				if res.Header.Get(name) != "" {
+					subT.Errorf("trailer %s was also sent as a header", name)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseWriter_BodylessStatus(t *testing.T) {
+	testCases := []struct {
+		header http.Header
+		desc   string
+		body   string
+		status int
+	}{
+		{
+			desc:   "no content without a body",
+			status: http.StatusNoContent,
+		},
+		{
+			desc:   "no content with a body",
+			status: http.StatusNoContent,
+			body:   "accidental body",
+		},
+		{
+			desc:   "no content with explicit framing headers",
+			status: http.StatusNoContent,
+			header: http.Header{"Content-Length": {"15"}, "Transfer-Encoding": {"chunked"}},
+			body:   "accidental body",
+		},
+		{
+			desc:   "no content with a declared trailer",
+			status: http.StatusNoContent,
+			header: http.Header{"Trailer": {"X-Checksum"}},
+			body:   "accidental body",
+		},
+		{
+			desc:   "not modified with a body",
+			status: http.StatusNotModified,
+			header: http.Header{"Etag": {`"v1"`}},
+			body:   "accidental body",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			for _, method := range []string{"WriteToBuf", "Buffers"} {
+				rw := NewResponseWriter()
+				for k, v := range tC.header {
+					rw.Header()[k] = v
+				}
+				rw.WriteHeader(tC.status)
+				rw.Write([]byte(tC.body))
+
+				var raw string
+				if method == "WriteToBuf" {
+					buf := bytes.NewBuffer(nil)
+					if err := rw.WriteToBuf(buf); err != nil {
+						subT.Fatalf("WriteToBuf() error = %v", err)
+					}
+					raw = buf.String()
+				} else {
+					bufs, err := rw.Buffers()
+					if err != nil {
+						subT.Fatalf("Buffers() error = %v", err)
+					}
+					raw = string(bytes.Join(bufs, nil))
+				}
+
+				if !strings.HasSuffix(raw, "\r\n\r\n") {
+					subT.Errorf("%s: response %q doesn't end with its headers", method, raw)
+				}
+
+				lower := strings.ToLower(raw)
+				for _, header := range []string{"content-length", "transfer-encoding", "trailer", "content-type"} {
+					if strings.Contains(lower, header+":") {
+						subT.Errorf("%s: response %q has a %s header", method, raw, header)
+					}
+				}
+
+				res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+				if err != nil {
+					subT.Fatalf("%s: unable to read response %q: %v", method, raw, err)
+				}
+				if res.StatusCode != tC.status {
+					subT.Errorf("%s: status = %d, want %d", method, res.StatusCode, tC.status)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseWriter_EmptyBody(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		status     int
+		protoMinor int
+		head       bool
+	}{
+		{
+			desc:       "ok",
+			status:     http.StatusOK,
+			protoMinor: 1,
+		},
+		{
+			desc:       "header never written",
+			protoMinor: 1,
+		},
+		{
+			desc:       "created",
+			status:     http.StatusCreated,
+			protoMinor: 1,
+		},
+		{
+			desc:       "head",
+			status:     http.StatusOK,
+			protoMinor: 1,
+			head:       true,
+		},
+		{
+			desc:   "http 1.0",
+			status: http.StatusOK,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			for _, method := range []string{"WriteToBuf", "Buffers"} {
+				rw := NewResponseWriter()
+				rw.SetProto(1, tC.protoMinor)
+				if tC.head {
+					rw.SetHead()
+				}
+				if tC.status != 0 {
+					rw.WriteHeader(tC.status)
+				}
+
+				var raw string
+				if method == "WriteToBuf" {
+					buf := bytes.NewBuffer(nil)
+					if err := rw.WriteToBuf(buf); err != nil {
+						subT.Fatalf("WriteToBuf() error = %v", err)
+					}
+					raw = buf.String()
+				} else {
+					bufs, err := rw.Buffers()
+					if err != nil {
+						subT.Fatalf("Buffers() error = %v", err)
+					}
+					raw = string(bytes.Join(bufs, nil))
+				}
+
+				// Without an explicit length, the body could only be delimited by closing the connection
+				if !strings.Contains(raw, "\r\nContent-Length: 0\r\n") {
+					subT.Errorf("%s: response %q doesn't have a Content-Length: 0 header", method, raw)
+				}
+
+				res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+				if err != nil {
+					subT.Fatalf("%s: unable to read response %q: %v", method, raw, err)
+				}
+				// A handler that never writes the header responds with a 200
+				expected := tC.status
+				if expected == 0 {
+					expected = http.StatusOK
+				}
+				if res.StatusCode != expected {
+					subT.Errorf("%s: status = %d, want %d", method, res.StatusCode, expected)
+				}
+				if res.ContentLength != 0 {
+					subT.Errorf("%s: ContentLength = %d, want 0", method, res.ContentLength)
+				}
+				// HTTP/1.0 responses close the connection unless it is explicitly kept alive
+				if tC.protoMinor == 1 && res.Close {
+					subT.Errorf("%s: response %q closes the connection", method, raw)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseWriter_InvalidHeaders(t *testing.T) {
+	testCases := []struct {
+		header      http.Header
+		desc        string
+		expectedErr bool
+	}{
+		{
+			desc:   "valid headers",
+			header: http.Header{"X-Request-Id": {"abc"}, "Set-Cookie": {"a=1", "b=2"}},
+		},
+		{
+			desc:   "trailer prefix",
+			header: http.Header{http.TrailerPrefix + "X-Checksum": {"abc"}},
+		},
+		{
+			desc:        "CRLF in value",
+			header:      http.Header{"X-User": {"bob\r\nSet-Cookie: session=stolen"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "bare LF in value",
+			header:      http.Header{"X-User": {"bob\nSet-Cookie: session=stolen"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "bare CR in one of the values",
+			header:      http.Header{"X-User": {"alice", "bob\r"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "CRLF in name",
+			header:      http.Header{"X-User\r\nSet-Cookie": {"session=stolen"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "colon in name",
+			header:      http.Header{"X-User: bob": {"x"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "empty name",
+			header:      http.Header{"": {"x"}},
+			expectedErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			rw := NewResponseWriter()
+			for k, v := range tC.header {
+				rw.Header()[k] = v
+			}
+			rw.Write([]byte("hello"))
+
+			buf := bytes.NewBuffer(nil)
+			err := rw.WriteToBuf(buf)
+			_, bufsErr := rw.Buffers()
+			if !tC.expectedErr {
+				if err != nil || bufsErr != nil {
+					subT.Fatalf("WriteToBuf() error = %v, Buffers() error = %v, want nil", err, bufsErr)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidHeader) || !errors.Is(bufsErr, ErrInvalidHeader) {
+				subT.Errorf("WriteToBuf() error = %v, Buffers() error = %v, want %v", err, bufsErr, ErrInvalidHeader)
+			}
+			if buf.Len() > 0 {
+				subT.Errorf("WriteToBuf() wrote %q for an invalid response", buf.String())
+			}
+		})
+	}
+}
+
+func TestResponseWriter_MultibyteContentLength(t *testing.T) {
+	testCases := []struct {
+		write func(rw *ResponseWriter, body string)
+		desc  string
+		body  string
+		head  bool
+	}{
+		{
+			desc:  "emoji written with Write",
+			body:  "hello 👋 world 🌍",
+			write: func(rw *ResponseWriter, body string) { _, _ = rw.Write([]byte(body)) },
+		},
+		{
+			desc:  "mixed widths written with fmt.Fprint",
+			body:  "ascii, é, 中文, 🎉",
+			write: func(rw *ResponseWriter, body string) { fmt.Fprint(rw, body) },
+		},
+		{
+			desc: "emoji written in pieces that split a rune",
+			body: "🚀🚀",
+			write: func(rw *ResponseWriter, body string) {
+				_, _ = rw.Write([]byte(body[:2]))
+				_, _ = rw.Write([]byte(body[2:]))
+			},
+		},
+		{
+			desc:  "emoji set with SetBody",
+			body:  "👍",
+			write: func(rw *ResponseWriter, body string) { rw.SetBody([]byte(body)) },
+		},
+		{
+			desc:  "emoji answering a HEAD request",
+			body:  "hello 👋",
+			write: func(rw *ResponseWriter, body string) { _, _ = rw.Write([]byte(body)) },
+			head:  true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if utf8.RuneCountInString(tC.body) == len(tC.body) {
+				subT.Fatalf("body %q has no multibyte characters", tC.body)
+			}
+
+			for _, method := range []string{"WriteToBuf", "Buffers"} {
+				rw := NewResponseWriter()
+				rw.SetProto(1, 1)
+				rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				if tC.head {
+					rw.SetHead()
+				}
+				tC.write(rw, tC.body)
+
+				var raw string
+				if method == "WriteToBuf" {
+					buf := bytes.NewBuffer(nil)
+					if err := rw.WriteToBuf(buf); err != nil {
+						subT.Fatalf("WriteToBuf() error = %v", err)
+					}
+					raw = buf.String()
+				} else {
+					bufs, err := rw.Buffers()
+					if err != nil {
+						subT.Fatalf("Buffers() error = %v", err)
+					}
+					raw = string(bytes.Join(bufs, nil))
+				}
+
+				// The Content-Length counts bytes, not runes
+				if want := fmt.Sprintf("\r\nContent-Length: %d\r\n", len(tC.body)); !strings.Contains(raw, want) {
+					subT.Errorf("%s: response %q doesn't have a Content-Length of %d bytes", method, raw, len(tC.body))
+				}
+
+				req := &http.Request{Method: http.MethodGet}
+				if tC.head {
+					req.Method = http.MethodHead
+				}
+				reader := bufio.NewReader(strings.NewReader(raw))
+				res, err := http.ReadResponse(reader, req)
+				if err != nil {
+					subT.Fatalf("%s: unable to read response %q: %v", method, raw, err)
+				}
+				body, err := ioutil.ReadAll(res.Body)
+				if err != nil {
+					subT.Fatalf("%s: unable to read response body: %v", method, err)
+				}
+
+				expected := tC.body
+				if tC.head {
+					expected = ""
+				}
+				if string(body) != expected {
+					subT.Errorf("%s: body = %q, want %q", method, body, expected)
+				}
+				if reader.Buffered() > 0 {
+					subT.Errorf("%s: %d bytes left after the body, want the Content-Length to cover all of it", method, reader.Buffered())
+				}
+			}
+		})
+	}
+}
+
+func TestResponseWriter_WriteHeaderOrdering(t *testing.T) {
+	testCases := []struct {
+		handle              func(w http.ResponseWriter)
+		desc                string
+		expectedSuperfluous bool
+	}{
+		{
+			desc:   "Write without WriteHeader",
+			handle: func(w http.ResponseWriter) { _, _ = w.Write([]byte("hello")) },
+		},
+		{
+			desc: "WriteHeader before Write",
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("hello"))
+			},
+		},
+		{
+			desc: "WriteHeader after Write",
+			handle: func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte("hello"))
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedSuperfluous: true,
+		},
+		{
+			desc: "WriteHeader twice",
+			handle: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedSuperfluous: true,
+		},
+		{
+			desc: "headers set around the header",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("X-Before", "sent")
+				w.WriteHeader(http.StatusAccepted)
+				w.Header().Set("X-After-WriteHeader", "dropped")
+				_, _ = w.Write([]byte("hello"))
+				w.Header().Set("X-After-Write", "dropped")
+				w.Header().Set("X-Before", "changed")
+			},
+		},
+		{
+			desc: "headers set after the first Write",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte("hello"))
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Add("X-After-Write", "dropped")
+			},
+		},
+		{
+			desc: "headers without any Write",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("X-Late", "sent")
+			},
+		},
+		{
+			desc: "trailers set after the first Write",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("Trailer", "X-Checksum")
+				_, _ = w.Write([]byte("hello"))
+				w.Header().Set("X-Checksum", "abc123")
+				w.Header().Set(http.TrailerPrefix+"X-Count", "1")
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// The recorder doesn't sniff the Content-Type of bodies written after an explicit WriteHeader, so we
+			// compare with what a real server sends instead
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { tC.handle(w) }))
+			defer srv.Close()
+			expected, err := http.Get(srv.URL)
+			if err != nil {
+				subT.Fatalf("unable to get the standard library's response: %v", err)
+			}
+			expectedBody, err := ioutil.ReadAll(expected.Body)
+			expected.Body.Close()
+			if err != nil {
+				subT.Fatalf("unable to read the standard library's response body: %v", err)
+			}
+
+			rw := NewResponseWriter()
+			tC.handle(rw)
+			if got := rw.SuperfluousWriteHeader() != ""; got != tC.expectedSuperfluous {
+				subT.Errorf("superfluous WriteHeader = %q, want one %v", rw.SuperfluousWriteHeader(), tC.expectedSuperfluous)
+			}
+
+			buf := bytes.NewBuffer(nil)
+			if err := rw.WriteToBuf(buf); err != nil {
+				subT.Fatalf("WriteToBuf() error = %v", err)
+			}
+			res, err := http.ReadResponse(bufio.NewReader(buf), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response: %v", err)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+
+			if res.StatusCode != expected.StatusCode {
+				subT.Errorf("status = %d, want the standard library's %d", res.StatusCode, expected.StatusCode)
+			}
+			if !bytes.Equal(body, expectedBody) {
+				subT.Errorf("body = %q, want the standard library's %q", body, expectedBody)
+			}
+
+			// The framing and Date headers are up to the server
+			for _, header := range []http.Header{res.Header, expected.Header} {
+				header.Del("Content-Length")
+				header.Del("Date")
+			}
+			if fmt.Sprint(res.Header) != fmt.Sprint(expected.Header) {
+				subT.Errorf("headers = %v, want the standard library's %v", res.Header, expected.Header)
+			}
+			if fmt.Sprint(res.Trailer) != fmt.Sprint(expected.Trailer) {
+				subT.Errorf("trailers = %v, want the standard library's %v", res.Trailer, expected.Trailer)
+			}
+		})
+	}
+}
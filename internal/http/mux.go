@@ -0,0 +1,150 @@
+package http
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mux is a request router that dispatches requests to the handler that is registered for their path, either for every
+// method (Handle) or for a specific one (Method). Paths are matched exactly, except for patterns that end in a slash,
+// which match their whole subtree like with http.ServeMux, and the longest matching pattern wins. A path that only has
+// handlers for specific methods answers the others with a 405 Method Not Allowed listing them in the Allow header, and
+// HEAD requests fall back to the GET handler. Requests for paths that aren't registered get a 404.
+type Mux struct {
+	routes map[string]*route
+	mu     sync.RWMutex
+}
+
+// route holds the handlers of a single pattern.
+type route struct {
+	methods map[string]http.Handler
+	// any handles the methods that have no handler of their own.
+	any http.Handler
+}
+
+// NewMux returns an empty Mux.
+func NewMux() *Mux {
+	return &Mux{routes: make(map[string]*route)}
+}
+
+// Handle registers the handler for every method of the pattern that has no handler of its own.
+// Like http.ServeMux, it panics if the pattern is empty, the handler is nil or the pattern already has one.
+func (m *Mux) Handle(pattern string, handler http.Handler) {
+	m.register("", pattern, handler)
+}
+
+// HandleFunc registers the handler function for every method of the pattern that has no handler of its own.
+func (m *Mux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.register("", pattern, http.HandlerFunc(handler))
+}
+
+// Method registers the handler for a single method of the pattern. It panics if the method or pattern is empty, the
+// handler is nil or the method of the pattern already has one.
+func (m *Mux) Method(method, pattern string, handler http.Handler) {
+	if method == "" {
+		panic("http: invalid method")
+	}
+	m.register(strings.ToUpper(method), pattern, handler)
+}
+
+func (m *Mux) register(method, pattern string, handler http.Handler) {
+	if pattern == "" {
+		panic("http: invalid pattern")
+	}
+	if handler == nil {
+		panic("http: nil handler")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rt, ok := m.routes[pattern]
+	if !ok {
+		rt = &route{methods: make(map[string]http.Handler)}
+		m.routes[pattern] = rt
+	}
+
+	if method == "" {
+		if rt.any != nil {
+			panic("http: multiple registrations for " + pattern)
+		}
+		rt.any = handler
+		return
+	}
+
+	if _, ok := rt.methods[method]; ok {
+		panic("http: multiple registrations for " + method + " " + pattern)
+	}
+	rt.methods[method] = handler
+}
+
+func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	rt := m.match(r.URL.Path)
+	var handler http.Handler
+	var allow string
+	if rt != nil {
+		if handler = rt.handler(r.Method); handler == nil {
+			allow = rt.allow()
+		}
+	}
+	m.mu.RUnlock()
+
+	switch {
+	case rt == nil:
+		http.NotFound(w, r)
+	case handler == nil:
+		w.Header().Set("Allow", allow)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	default:
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// match returns the route of the longest pattern that matches the path, or nil when there is none.
+func (m *Mux) match(path string) *route {
+	if rt, ok := m.routes[path]; ok {
+		return rt
+	}
+
+	var best string
+	var match *route
+	for pattern, rt := range m.routes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best, match = pattern, rt
+		}
+	}
+	return match
+}
+
+// handler returns the handler of the method, or nil when the route doesn't handle it.
+func (rt *route) handler(method string) http.Handler {
+	if handler, ok := rt.methods[method]; ok {
+		return handler
+	}
+
+	if method == http.MethodHead {
+		if handler, ok := rt.methods[http.MethodGet]; ok {
+			return handler
+		}
+	}
+	return rt.any
+}
+
+// allow returns the value of the Allow header of a route without a handler for every method.
+func (rt *route) allow() string {
+	methods := make([]string, 0, len(rt.methods)+1)
+	for method := range rt.methods {
+		methods = append(methods, method)
+	}
+	if _, ok := rt.methods[http.MethodGet]; ok {
+		if _, ok := rt.methods[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
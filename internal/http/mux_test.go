@@ -0,0 +1,148 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMux(t *testing.T) {
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+
+	mux := NewMux()
+	mux.Method(http.MethodGet, "/users", named("list users"))
+	mux.Method("post", "/users", named("create user"))
+	mux.Method(http.MethodGet, "/health", named("health"))
+	mux.Handle("/echo", named("echo"))
+	mux.Method(http.MethodDelete, "/echo", named("delete echo"))
+	mux.Method(http.MethodGet, "/static/", named("static"))
+
+	testCases := []struct {
+		desc           string
+		method         string
+		path           string
+		expectedBody   string
+		expectedAllow  string
+		expectedStatus int
+	}{
+		{
+			desc:           "get",
+			method:         http.MethodGet,
+			path:           "/users",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "list users",
+		},
+		{
+			desc:           "post",
+			method:         http.MethodPost,
+			path:           "/users",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "create user",
+		},
+		{
+			desc:           "delete on a get only path",
+			method:         http.MethodDelete,
+			path:           "/health",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD",
+		},
+		{
+			desc:           "unregistered method lists every registered one",
+			method:         http.MethodPut,
+			path:           "/users",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD, POST",
+		},
+		{
+			desc:           "head falls back to get",
+			method:         http.MethodHead,
+			path:           "/health",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "health",
+		},
+		{
+			desc:           "any method",
+			method:         http.MethodPatch,
+			path:           "/echo",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "echo",
+		},
+		{
+			desc:           "specific method over any method",
+			method:         http.MethodDelete,
+			path:           "/echo",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "delete echo",
+		},
+		{
+			desc:           "subtree",
+			method:         http.MethodGet,
+			path:           "/static/css/app.css",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "static",
+		},
+		{
+			desc:           "subtree with another method",
+			method:         http.MethodPost,
+			path:           "/static/css/app.css",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD",
+		},
+		{
+			desc:           "unknown path",
+			method:         http.MethodGet,
+			path:           "/users/1",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tC.method, tC.path, nil))
+
+			if rec.Code != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", rec.Code, tC.expectedStatus)
+			}
+			if got := rec.Header().Get("Allow"); got != tC.expectedAllow {
+				subT.Errorf("Allow = %q, want %q", got, tC.expectedAllow)
+			}
+			if tC.expectedBody != "" && rec.Body.String() != tC.expectedBody {
+				subT.Errorf("body = %q, want %q", rec.Body.String(), tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestMux_DuplicateRegistration(t *testing.T) {
+	testCases := []struct {
+		register func(mux *Mux)
+		desc     string
+	}{
+		{
+			desc:     "same method",
+			register: func(mux *Mux) { mux.Method("get", "/users", http.NotFoundHandler()) },
+		},
+		{
+			desc:     "any method",
+			register: func(mux *Mux) { mux.Handle("/echo", http.NotFoundHandler()) },
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			mux := NewMux()
+			mux.Method(http.MethodGet, "/users", http.NotFoundHandler())
+			mux.Handle("/echo", http.NotFoundHandler())
+
+			defer func() {
+				if recover() == nil {
+					subT.Error("registering a pattern twice didn't panic")
+				}
+			}()
+			tC.register(mux)
+		})
+	}
+}
@@ -3,69 +3,474 @@ package http
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"math"
+	"strings"
 )
 
 var (
 	crlf = []byte{'\r', '\n'}
 	// Headers are completed when we have CRLF twice
-	headerTerminator          = append(crlf, crlf...)
-	contentLengthHeader       = []byte("Content-Length: ")
-	contentLengthHeaderLength = len(contentLengthHeader)
-	errBadRequest             = errors.New("bad request")
+	headerTerminator       = append(crlf, crlf...)
+	contentLengthHeader    = []byte("Content-Length")
+	transferEncodingHeader = []byte("Transfer-Encoding")
+	hostHeader             = []byte("Host")
+	optionsMethod          = []byte("OPTIONS")
+	// Lenient parsers also end the headers on an empty line that is terminated by a bare LF, or that follows one
+	bareLFTerminators = [][]byte{[]byte("\n\n"), []byte("\n\r\n")}
+	// ErrBadRequest is returned for requests that are malformed, and must be answered with a 400 Bad Request.
+	// The parser returns one of the more specific errors below, which all wrap it.
+	ErrBadRequest = errors.New("bad request")
+	// ErrInvalidRequestLine is returned for request lines that are blank, hold a bare CR or LF, or have an invalid target.
+	ErrInvalidRequestLine = fmt.Errorf("%w: invalid request line", ErrBadRequest)
+	// ErrMalformedVersion is returned for request lines whose HTTP version is missing or isn't of the form HTTP/x.y.
+	ErrMalformedVersion = fmt.Errorf("%w: malformed HTTP version", ErrBadRequest)
+	// ErrMalformedHeader is returned for header lines that hold a bare CR or LF, are folded, or have an invalid name.
+	ErrMalformedHeader = fmt.Errorf("%w: malformed header line", ErrBadRequest)
+	// ErrBareLFTerminator is returned for headers that end with an empty line terminated by (or following) a bare LF,
+	// like \n\n, which lenient parsers accept as the end of the headers but which would never match the CRLF CRLF that
+	// we wait for, leaving the request to hang until it times out.
+	ErrBareLFTerminator = fmt.Errorf("%w: header terminated with a bare LF", ErrBadRequest)
+	// ErrDuplicateHost is returned for requests with more than one Host header.
+	ErrDuplicateHost = fmt.Errorf("%w: duplicate Host header", ErrBadRequest)
+	// ErrMissingHost is returned for HTTP/1.1 requests without a Host header, which RFC 7230 section 5.4 requires them
+	// to have. HTTP/1.0 requests predate the header, so they may leave it out.
+	ErrMissingHost = fmt.Errorf("%w: missing Host header", ErrBadRequest)
+	// ErrUnsupportedTransferEncoding is returned for requests with a Transfer-Encoding header, which isn't supported yet.
+	ErrUnsupportedTransferEncoding = fmt.Errorf("%w: unsupported Transfer-Encoding", ErrBadRequest)
+	// ErrDuplicateContentLength is returned for requests with more than one Content-Length header.
+	ErrDuplicateContentLength = fmt.Errorf("%w: duplicate Content-Length header", ErrBadRequest)
+	// ErrInvalidContentLength is returned for Content-Length values that aren't a valid non negative integer.
+	ErrInvalidContentLength = fmt.Errorf("%w: invalid Content-Length", ErrBadRequest)
+	// ErrBodyWithoutContentLength is returned for requests that are followed by a body without declaring a Content-Length.
+	ErrBodyWithoutContentLength = fmt.Errorf("%w: body without a Content-Length", ErrBadRequest)
+	// ErrVersionNotSupported is returned for request lines with a well formed HTTP version whose major version isn't 1,
+	// and must be answered with a 505 HTTP Version Not Supported. Unlike the other errors, it doesn't wrap ErrBadRequest.
+	ErrVersionNotSupported = errors.New("HTTP version not supported")
+	// The non alphanumeric characters that are allowed in tokens such as the method
+	tokenSpecials = []byte("!#$%&'*+-.^_`|~")
 )
 
+// IsHeaderComplete reports whether the header terminator has been read into the data stream.
+func IsHeaderComplete(data []byte) bool {
+	return bytes.Contains(data, headerTerminator)
+}
+
+// HeaderLength returns the length of the first request's request line and headers, including the header
+// terminator, or zero if the header terminator hasn't been read into the data stream yet.
+func HeaderLength(data []byte) int {
+	htIdx := bytes.Index(data, headerTerminator)
+	if htIdx < 0 {
+		return 0
+	}
+	return htIdx + len(headerTerminator)
+}
+
 // isRequestComplete is used to determine if the entire request has been read into the data stream.
 // If the entire request has been read, we return true, and if there is still data to be read, we
 // return false. An error is returned if the request is malformed, or if the request is streaming data
 // using the Transfer-Encoding: chunked encoding, which we are not supporting as of this time.
 func IsRequestComplete(data []byte) (bool, error) {
+	n, err := RequestLength(data)
+	return n > 0, err
+}
+
+// RequestLength returns the length of the first request in the data stream once it has been read completely,
+// or zero while there is still data to be read. Only the first request's own headers are considered, so that
+// any pipelined requests that follow it in the stream can't affect how it is framed.
+func RequestLength(data []byte) (int, error) {
+	// An empty (or whitespace only) request line can never turn into a valid request, so there's
+	// no point in waiting for the rest of the headers or handing it off to http.ReadRequest.
+	// A bare CR or LF would make other parsers end the request line early, so it is rejected as well.
+	requireHost := false
+	if rlEndIdx := bytes.Index(data, crlf); rlEndIdx >= 0 {
+		requestLine := data[:rlEndIdx]
+		if isBlank(requestLine) || bytes.ContainsAny(requestLine, "\r\n") || !isValidRequestTarget(requestLine) {
+			return 0, ErrInvalidRequestLine
+		}
+
+		_, minor, err := parseVersion(requestVersion(requestLine))
+		if err != nil {
+			return 0, err
+		}
+		requireHost = minor > 0
+	}
+
 	// If we haven't gotten to the header terminator, then the request hasn't been fully read yet
 	htIdx := bytes.Index(data, headerTerminator)
 	if htIdx < 0 {
-		return false, nil
+		// Until the terminator arrives, all of the data belongs to the headers, where bare LFs are never allowed
+		for _, terminator := range bareLFTerminators {
+			if bytes.Contains(data, terminator) {
+				return 0, ErrBareLFTerminator
+			}
+		}
+		return 0, nil
 	}
 	htEndIdx := htIdx + 4
 
-	clIdx := bytes.Index(data, contentLengthHeader)
-	if clIdx < 0 {
-		// If the end of the header terminator is equal to the length of the data,
-		// then this request has no body, and is complete.
-		if htEndIdx == len(data) {
-			return true, nil
-		}
+	// The header region of this request, up to and including the CRLF of its last header line.
+	// Anything after it is either this request's body or a pipelined request.
+	headers := data[:htIdx+2]
 
-		// If we have not received a Content-Length Header in all of the headers, and there is a body, this is a bad request.
-		// We don't accept Transfer-Encoding: chunked for now, and Content-Length is required for when there is a body.
-		return false, errBadRequest
+	clenbytes, hasContentLength, err := scanHeaders(headers, requireHost)
+	if err != nil {
+		return 0, err
 	}
 
-	clEndIdx := bytes.Index(data[clIdx:], crlf)
-	// If for some reason we don't have the line terminator in the data then this is a problem...
-	if clEndIdx < 0 {
-		return false, errBadRequest
-	}
-	clEndIdx += clIdx
+	if !hasContentLength {
+		// Without a Content-Length the request has no body, so it ends with its headers, and anything after them
+		// must be the beginning of the next pipelined request. If it can't be, then this is a body that was sent
+		// without a Content-Length, which is a bad request since we don't accept Transfer-Encoding: chunked for now.
+		if htEndIdx < len(data) && !isRequestStart(data[htEndIdx:]) {
+			return 0, ErrBodyWithoutContentLength
+		}
 
-	// If the end of the header terminator is equal to the length of the data,
-	// then this request has no body yet, so we wait for the entire body to arrive.
-	if htEndIdx >= len(data) {
-		return false, nil
+		return htEndIdx, nil
 	}
 
 	// Get the Content-Length value as an integer
-	clenbytes := data[clIdx+contentLengthHeaderLength : clEndIdx]
 	clen, err := parseContentLength(clenbytes)
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+
+	// A request whose end lies past the largest int can never be read, and its length would wrap around to a negative one.
+	if clen > int64(math.MaxInt-htEndIdx) {
+		return 0, ErrInvalidContentLength
 	}
 
 	// If the data after the header terminator ending index is less than the Content-Length value, then we are not done reading yet.
 	if len(data)-htEndIdx < int(clen) {
-		return false, nil
+		return 0, nil
+	}
+
+	return htEndIdx + int(clen), nil
+}
+
+// ContentLength returns the Content-Length declared by the first request in the data stream once its headers have
+// been read completely, or -1 while they haven't or when the request doesn't declare one.
+func ContentLength(data []byte) (int64, error) {
+	htIdx := bytes.Index(data, headerTerminator)
+	if htIdx < 0 {
+		return -1, nil
+	}
+
+	clenbytes, hasContentLength, err := scanHeaders(data[:htIdx+2], false)
+	if err != nil || !hasContentLength {
+		return -1, err
+	}
+	return parseContentLength(clenbytes)
+}
+
+// IsCloseDelimited reports whether the first request in the data stream is an HTTP/1.0 POST, PUT or PATCH request
+// whose headers are complete and valid but don't declare a Content-Length, meaning that if it has a body, the body
+// can only be delimited by the client closing its side of the connection. RFC 7230 section 3.3.3 treats such requests
+// as having no body, but HTTP/1.0 clients that predate it may still send one.
+func IsCloseDelimited(data []byte) bool {
+	rlEndIdx := bytes.Index(data, crlf)
+	htIdx := bytes.Index(data, headerTerminator)
+	if rlEndIdx < 0 || htIdx < 0 {
+		return false
+	}
+
+	requestLine := data[:rlEndIdx]
+	if !bytes.HasSuffix(requestLine, http10) {
+		return false
+	}
+
+	spIdx := bytes.IndexByte(requestLine, ' ')
+	if spIdx < 0 {
+		return false
+	}
+	switch string(requestLine[:spIdx]) {
+	case "POST", "PUT", "PATCH":
+	default:
+		return false
+	}
+
+	_, hasContentLength, err := scanHeaders(data[:htIdx+2], false)
+	return err == nil && !hasContentLength
+}
+
+// isRequestStart reports whether the data could be the beginning of a request line, meaning that it
+// starts with a (possibly partial) method token.
+func isRequestStart(data []byte) bool {
+	for i, b := range data {
+		if b == ' ' {
+			return i > 0
+		}
+
+		if !isTokenChar(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar reports whether the byte is a valid tchar as defined in RFC 7230 section 3.2.6.
+func isTokenChar(b byte) bool {
+	if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' {
+		return true
+	}
+	return bytes.IndexByte(tokenSpecials, b) >= 0
+}
+
+// isValidRequestTarget reports whether the request target of the request line is free of raw control characters,
+// which are a common vector for injection and request smuggling attacks, and whether its percent-encoding is valid,
+// meaning that every '%' is followed by two hex digits, so that decoding it can never fail later on. The asterisk-form
+// target ("*") is only valid for OPTIONS requests (RFC 7230 section 5.3.4).
+func isValidRequestTarget(requestLine []byte) bool {
+	spIdx := bytes.IndexByte(requestLine, ' ')
+	if spIdx < 0 {
+		// Without a target there is nothing to validate here, http.ReadRequest will reject the malformed request line
+		return true
+	}
+
+	method, target := requestLine[:spIdx], requestLine[spIdx+1:]
+	if spIdx = bytes.IndexByte(target, ' '); spIdx >= 0 {
+		target = target[:spIdx]
+	}
+
+	if IsAsteriskTarget(target) {
+		return bytes.Equal(method, optionsMethod)
+	}
+
+	for i, b := range target {
+		if b < 0x20 || b == 0x7f {
+			return false
+		}
+
+		if b == '%' && (i+2 >= len(target) || !isHexDigit(target[i+1]) || !isHexDigit(target[i+2])) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestVersion returns the HTTP version of the request line, which follows its second space, or nil when it has none.
+func requestVersion(requestLine []byte) []byte {
+	for i := 0; i < 2; i++ {
+		spIdx := bytes.IndexByte(requestLine, ' ')
+		if spIdx < 0 {
+			return nil
+		}
+		requestLine = requestLine[spIdx+1:]
+	}
+	return requestLine
+}
+
+// parseVersion parses an HTTP version, which RFC 7230 section 2.6 defines as the case sensitive "HTTP/" followed by
+// a single digit major and minor version separated by a dot. Versions that don't have that form are malformed, and
+// well formed versions with a major version other than 1 aren't supported. Minor versions above 1 are accepted, since
+// HTTP/1.x clients may send a later minor version than the server implements.
+func parseVersion(version []byte) (int, int, error) {
+	if len(version) != 8 || !bytes.HasPrefix(version, []byte("HTTP/")) || version[6] != '.' || !isDigit(version[5]) || !isDigit(version[7]) {
+		return 0, 0, ErrMalformedVersion
+	}
+
+	major, minor := int(version[5]-'0'), int(version[7]-'0')
+	if major != 1 {
+		return major, minor, ErrVersionNotSupported
+	}
+	return major, minor, nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// IsAsteriskTarget reports whether the request target is in asterisk-form, which addresses the server as a whole
+// rather than a specific resource.
+func IsAsteriskTarget(target []byte) bool {
+	return len(target) == 1 && target[0] == '*'
+}
+
+func isHexDigit(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
+
+// RequestTargetLength returns the length of the request target (path and query) of the first request line in the
+// data stream. While the request line is still incomplete, it returns the length of the part of the target that
+// has been read so far, so that overly long targets can be rejected without waiting for them to end.
+func RequestTargetLength(data []byte) int {
+	if rlEndIdx := bytes.Index(data, crlf); rlEndIdx >= 0 {
+		data = data[:rlEndIdx]
+	}
+
+	spIdx := bytes.IndexByte(data, ' ')
+	if spIdx < 0 {
+		return 0
+	}
+
+	target := data[spIdx+1:]
+	if spIdx = bytes.IndexByte(target, ' '); spIdx >= 0 {
+		target = target[:spIdx]
+	}
+	return len(target)
+}
+
+// RequestPath returns the path of the request target of the first request line in the data stream, without its query,
+// or nil while the request line is incomplete. The scheme and authority of absolute-form targets are left out, so the
+// result can be matched against the same routes as an origin-form target.
+func RequestPath(data []byte) []byte {
+	rlEndIdx := bytes.Index(data, crlf)
+	if rlEndIdx < 0 {
+		return nil
+	}
+
+	target := data[:rlEndIdx]
+	if spIdx := bytes.IndexByte(target, ' '); spIdx >= 0 {
+		target = target[spIdx+1:]
+	}
+	if spIdx := bytes.IndexByte(target, ' '); spIdx >= 0 {
+		target = target[:spIdx]
+	}
+	if qIdx := bytes.IndexByte(target, '?'); qIdx >= 0 {
+		target = target[:qIdx]
+	}
+
+	if schemeIdx := bytes.Index(target, []byte("://")); schemeIdx >= 0 && target[0] != '/' {
+		authority := target[schemeIdx+3:]
+		if pathIdx := bytes.IndexByte(authority, '/'); pathIdx >= 0 {
+			return authority[pathIdx:]
+		}
+		return []byte("/")
+	}
+	return target
+}
+
+// HasHeader reports whether the complete headers of the first request in the data stream have a header with the (case
+// insensitive) name, without parsing the request.
+func HasHeader(data []byte, name string) bool {
+	rlEndIdx := bytes.Index(data, crlf)
+	hl := HeaderLength(data)
+	if rlEndIdx < 0 || hl == 0 {
+		return false
+	}
+
+	headers := data[rlEndIdx+2 : hl-2]
+	for len(headers) > 0 {
+		var n []byte
+		n, _, headers = nextHeader(headers)
+		if equalFoldString(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// LongestHeaderValue returns the length of the longest header value of the first request in the data stream, without
+// its surrounding whitespace. While the headers are still incomplete, the value being read counts with the part of it
+// that has been read so far, so that overly long values can be rejected without waiting for them to end.
+func LongestHeaderValue(data []byte) int {
+	if htIdx := bytes.Index(data, headerTerminator); htIdx >= 0 {
+		data = data[:htIdx+2]
+	}
+
+	// Skip the request line, which is limited on its own
+	rlEndIdx := bytes.Index(data, crlf)
+	if rlEndIdx < 0 {
+		return 0
+	}
+	data = data[rlEndIdx+2:]
+
+	longest := 0
+	for len(data) > 0 {
+		line := data
+		if lineEndIdx := bytes.Index(data, crlf); lineEndIdx >= 0 {
+			line, data = data[:lineEndIdx], data[lineEndIdx+2:]
+		} else {
+			data = nil
+		}
+
+		// Lines without a colon are either still reading their name, or malformed and rejected by RequestLength
+		colonIdx := bytes.IndexByte(line, ':')
+		if colonIdx < 0 {
+			continue
+		}
+
+		if n := len(bytes.Trim(line[colonIdx+1:], " \t")); n > longest {
+			longest = n
+		}
+	}
+	return longest
+}
+
+// HasEncodedNull reports whether the request target contains a percent-encoded null byte, meaning that it
+// would contain a null byte once decoded.
+func HasEncodedNull(target string) bool {
+	return strings.Contains(target, "%00")
+}
+
+// scanHeaders validates the header lines of the header region, which starts with the request line and ends with the
+// CRLF of the last header line, and returns the value of the Content-Length header if there is one. Since request
+// smuggling relies on two parsers framing the same bytes differently, anything that parsers disagree on is rejected:
+// bare CRs and LFs, obsolete line folding, whitespace in header names, any Transfer-Encoding (which we don't support
+// yet), and duplicate Content-Length headers. RFC 7230 section 5.4 also requires rejecting duplicate Host headers, and
+// with requireHost, missing ones.
+func scanHeaders(headers []byte, requireHost bool) (contentLength []byte, hasContentLength bool, err error) {
+	// Skip the request line, which is validated on its own
+	headers = headers[bytes.Index(headers, crlf)+2:]
+
+	hosts := 0
+	for len(headers) > 0 {
+		// The header region always ends with a CRLF, so every line is terminated within it
+		lineEndIdx := bytes.Index(headers, crlf)
+		line := headers[:lineEndIdx]
+		headers = headers[lineEndIdx+2:]
+
+		if bytes.IndexByte(line, '\r') >= 0 || bytes.IndexByte(line, '\n') >= 0 {
+			return nil, false, ErrMalformedHeader
+		}
+
+		// A header name must be a non empty token, which also rules out folded lines that start with whitespace
+		colonIdx := bytes.IndexByte(line, ':')
+		if colonIdx <= 0 || !isToken(line[:colonIdx]) {
+			return nil, false, ErrMalformedHeader
+		}
+		name, value := line[:colonIdx], bytes.Trim(line[colonIdx+1:], " \t")
+
+		switch {
+		case bytes.EqualFold(name, hostHeader):
+			hosts++
+			if hosts > 1 {
+				return nil, false, ErrDuplicateHost
+			}
+		case bytes.EqualFold(name, transferEncodingHeader):
+			return nil, false, ErrUnsupportedTransferEncoding
+		case bytes.EqualFold(name, contentLengthHeader):
+			if hasContentLength {
+				return nil, false, ErrDuplicateContentLength
+			}
+			contentLength, hasContentLength = value, true
+		}
+	}
+
+	if requireHost && hosts == 0 {
+		return nil, false, ErrMissingHost
+	}
+	return contentLength, hasContentLength, nil
+}
+
+// isToken reports whether the data is made up entirely of tchars as defined in RFC 7230 section 3.2.6.
+func isToken(data []byte) bool {
+	for _, b := range data {
+		if !isTokenChar(b) {
+			return false
+		}
 	}
+	return true
+}
 
-	return true, nil
+// isBlank reports whether the line is empty or made up entirely of spaces and tabs.
+func isBlank(line []byte) bool {
+	for _, b := range line {
+		if b != ' ' && b != '\t' {
+			return false
+		}
+	}
+	return true
 }
 
 func parseContentLength(clen []byte) (int64, error) {
@@ -75,12 +480,17 @@ func parseContentLength(clen []byte) (int64, error) {
 
 	// If we are lower than 0 or greater than 9, then we aren't an integer.
 	if clen[0] < '0' || clen[0] > '9' {
-		return -1, errBadRequest
+		return -1, ErrInvalidContentLength
 	}
 
 	// If we have more than 1 but the first digit is a 0, that's a bad request
 	if len(clen) > 1 && clen[0] == '0' {
-		return -1, errBadRequest
+		return -1, ErrInvalidContentLength
+	}
+
+	// The largest int64 has 19 digits, and without leading zeroes anything longer can't fit in one.
+	if len(clen) > len(pow10LookupTable) {
+		return -1, ErrInvalidContentLength
 	}
 
 	// Start at the highest order of magnitude
@@ -92,29 +502,23 @@ func parseContentLength(clen []byte) (int64, error) {
 
 		// Error possibilities
 		if clen[i] < '0' || clen[i] > '9' {
-			return -1, errBadRequest
+			return -1, ErrInvalidContentLength
 		}
 
 		v := byteToIntSlice[clen[i]]
 
 		// Error possibilities
 		if v < 0 {
-			return -1, errBadRequest
+			return -1, ErrInvalidContentLength
 		}
 
-		// Add the magnitude to the length
-		if zeroes == 0 {
-			length += v
-			continue
-		}
-
-		// The Pow10 can probably be done with a simple lookup table
-		// since 99% of the time we will probably be within 5 zeroes.
-		if zeroes < 19 {
-			length += v * pow10LookupTable[zeroes]
-			continue
+		// Add the magnitude to the length, rejecting values past the largest int64 instead of letting them wrap around.
+		// The length check above keeps the magnitude itself within the lookup table.
+		magnitude := v * pow10LookupTable[zeroes]
+		if length > math.MaxInt64-magnitude {
+			return -1, ErrInvalidContentLength
 		}
-		length += v * int64(math.Pow10(zeroes))
+		length += magnitude
 	}
 
 	return length, nil
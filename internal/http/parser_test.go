@@ -1,6 +1,8 @@
 package http
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -28,6 +30,134 @@ func TestParser_IsRequestComplete(t *testing.T) {
 	}
 }
 
+func TestParser_RequestLength(t *testing.T) {
+	for _, tC := range requestLengthTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			got, err := RequestLength(tC.input)
+			if (err != nil) != tC.wantErr {
+				subT.Errorf("RequestLength() error = %v, wantErr %v", err, tC.wantErr)
+				return
+			}
+
+			if err != nil && err != tC.expectedErr {
+				subT.Errorf("RequestLength() error type mismatch expecting %s and got %s", tC.expectedErr.Error(), err.Error())
+				return
+			}
+
+			if got != tC.expected {
+				subT.Errorf("RequestLength() got = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestParser_SplitRequest(t *testing.T) {
+	for _, tC := range splitRequestTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// The first read is the start of the buffer that the rest of the request is appended to
+			buf := append([]byte(nil), tC.input[:tC.split]...)
+			complete, err := IsRequestComplete(buf)
+			if err != nil || complete {
+				subT.Fatalf("IsRequestComplete() after the first read = %v, %v, want false, nil", complete, err)
+			}
+
+			buf = append(buf, tC.input[tC.split:]...)
+			n, err := RequestLength(buf)
+			if err != nil {
+				subT.Fatalf("RequestLength() after the second read error = %v", err)
+			}
+			if n != len(tC.input) {
+				subT.Errorf("RequestLength() after the second read = %d, want %d", n, len(tC.input))
+			}
+		})
+	}
+}
+
+func TestParser_RequestPath(t *testing.T) {
+	for _, tC := range requestPathTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := RequestPath(tC.input); !bytes.Equal(got, tC.expected) {
+				subT.Errorf("RequestPath() got = %q, want %q", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestParser_HasHeader(t *testing.T) {
+	for _, tC := range hasHeaderTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := HasHeader(tC.input, tC.name); got != tC.expected {
+				subT.Errorf("HasHeader() got = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestParser_HeaderLength(t *testing.T) {
+	for _, tC := range headerLengthTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := HeaderLength(tC.input); got != tC.expected {
+				subT.Errorf("HeaderLength() got = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestParser_ErrorsWrapBadRequest(t *testing.T) {
+	for _, err := range []error{
+		ErrInvalidRequestLine,
+		ErrMalformedVersion,
+		ErrMalformedHeader,
+		ErrDuplicateHost,
+		ErrMissingHost,
+		ErrBareLFTerminator,
+		ErrUnsupportedTransferEncoding,
+		ErrDuplicateContentLength,
+		ErrInvalidContentLength,
+		ErrBodyWithoutContentLength,
+	} {
+		if !errors.Is(err, ErrBadRequest) {
+			t.Errorf("errors.Is(%v, ErrBadRequest) = false, want true", err)
+		}
+	}
+}
+
+func TestParser_RequestTargetLength(t *testing.T) {
+	for _, tC := range requestTargetLengthTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := RequestTargetLength(tC.input); got != tC.expected {
+				subT.Errorf("RequestTargetLength() got = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestParser_LongestHeaderValue(t *testing.T) {
+	for _, tC := range longestHeaderValueTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := LongestHeaderValue(tC.input); got != tC.expected {
+				subT.Errorf("LongestHeaderValue() got = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestParser_ContentLength(t *testing.T) {
+	for _, tC := range contentLengthTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			got, err := ContentLength(tC.input)
+			if (err != nil) != tC.wantErr {
+				subT.Errorf("ContentLength() error = %v, wantErr %v", err, tC.wantErr)
+				return
+			}
+
+			if got != tC.expected {
+				subT.Errorf("ContentLength() got = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
 func TestParser_ParseContentLength(t *testing.T) {
 	for _, tC := range parseContentLengthTestCases {
 		t.Run(tC.desc, func(subT *testing.T) {
@@ -63,3 +193,26 @@ func TestParser_ParseContentLength(t *testing.T) {
 		}
 	}
 }
+
+func TestParser_IsCloseDelimited(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected bool
+	}{
+		{desc: "HTTP/1.0 post without content length", input: "POST /echo HTTP/1.0\r\nHost: 127.0.0.1\r\n\r\nbody", expected: true},
+		{desc: "HTTP/1.0 put without content length", input: "PUT /echo HTTP/1.0\r\n\r\n", expected: true},
+		{desc: "HTTP/1.0 post with content length", input: "POST /echo HTTP/1.0\r\nContent-Length: 4\r\n\r\nbody", expected: false},
+		{desc: "HTTP/1.0 get", input: "GET /echo HTTP/1.0\r\n\r\n", expected: false},
+		{desc: "HTTP/1.1 post", input: "POST /echo HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\nbody", expected: false},
+		{desc: "incomplete headers", input: "POST /echo HTTP/1.0\r\nHost: 127.0.0.1\r\n", expected: false},
+		{desc: "invalid headers", input: "POST /echo HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n", expected: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := IsCloseDelimited([]byte(tC.input)); got != tC.expected {
+				subT.Errorf("IsCloseDelimited() = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errUnsatisfiableRange = errors.New("unsatisfiable range")
+
+// ApplyRange turns a complete 200 response to a GET or HEAD request with a single byte range (as defined in RFC 7233)
+// into a 206 Partial Content response holding only the requested range, or into a 416 Range Not Satisfiable when the
+// range is outside of the body. Responses that the handler has already encoded or ranged are left alone, and so are
+// requests with multiple ranges or an If-Range precondition, which are answered with the whole body instead.
+func (rw *ResponseWriter) ApplyRange(req *http.Request) {
+	if rw == nil || req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return
+	}
+	rw.HandlerDone()
+
+	if rw.StatusCode != 0 && rw.StatusCode != http.StatusOK {
+		return
+	}
+
+	header := rw.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return
+	}
+	header.Set("Accept-Ranges", "bytes")
+
+	if req.Header.Get("If-Range") != "" {
+		return
+	}
+
+	size := int64(len(rw.buf))
+	start, length, ok, err := parseRange(req.Header.Get("Range"), size)
+	if err != nil {
+		header.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		rw.buf = nil
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	header.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+	rw.WriteHeader(http.StatusPartialContent)
+	rw.buf = rw.buf[start : start+length]
+}
+
+// parseRange parses a Range header holding a single byte range against a body of the given size, returning the start
+// and length of the range. It reports false when the header should be ignored, which is when it is missing, isn't a
+// byte range, is malformed, or holds multiple ranges. It returns an error when the range can't be satisfied.
+func parseRange(header string, size int64) (start, length int64, ok bool, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return 0, 0, false, nil
+	}
+
+	spec := strings.TrimSpace(header[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return 0, 0, false, nil
+	}
+	first, last := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	if first == "" {
+		// A suffix range asks for the last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, false, errUnsatisfiableRange
+	}
+	return start, end - start + 1, true, nil
+}
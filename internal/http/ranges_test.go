@@ -0,0 +1,41 @@
+package http
+
+import (
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		header         string
+		size           int64
+		expectedStart  int64
+		expectedLength int64
+		expectedOk     bool
+		expectedErr    bool
+	}{
+		{desc: "no header", header: "", size: 1000},
+		{desc: "first bytes", header: "bytes=0-99", size: 1000, expectedStart: 0, expectedLength: 100, expectedOk: true},
+		{desc: "open ended", header: "bytes=900-", size: 1000, expectedStart: 900, expectedLength: 100, expectedOk: true},
+		{desc: "suffix", header: "bytes=-100", size: 1000, expectedStart: 900, expectedLength: 100, expectedOk: true},
+		{desc: "suffix longer than the body", header: "bytes=-2000", size: 1000, expectedStart: 0, expectedLength: 1000, expectedOk: true},
+		{desc: "end past the body", header: "bytes=990-1999", size: 1000, expectedStart: 990, expectedLength: 10, expectedOk: true},
+		{desc: "start past the body", header: "bytes=1000-1099", size: 1000, expectedErr: true},
+		{desc: "empty suffix", header: "bytes=-0", size: 1000, expectedErr: true},
+		{desc: "multiple ranges are ignored", header: "bytes=0-9,20-29", size: 1000},
+		{desc: "other units are ignored", header: "items=0-9", size: 1000},
+		{desc: "malformed range is ignored", header: "bytes=abc", size: 1000},
+		{desc: "reversed range is ignored", header: "bytes=99-0", size: 1000},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			start, length, ok, err := parseRange(tC.header, tC.size)
+			if (err != nil) != tC.expectedErr {
+				subT.Fatalf("parseRange() error = %v, want error %v", err, tC.expectedErr)
+			}
+			if ok != tC.expectedOk || start != tC.expectedStart || length != tC.expectedLength {
+				subT.Errorf("parseRange() = %d, %d, %v, want %d, %d, %v", start, length, ok, tC.expectedStart, tC.expectedLength, tC.expectedOk)
+			}
+		})
+	}
+}
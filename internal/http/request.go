@@ -0,0 +1,209 @@
+package http
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+var (
+	http10 = []byte("HTTP/1.0")
+	head   = []byte("HEAD")
+)
+
+// Request is a lightweight view of a request that has been parsed straight out of the data stream, for handlers that
+// want to avoid the allocations of building an http.Request. Its fields point into the data that it was parsed from,
+// so it is only valid until the handler returns, and anything that is kept after that must be copied. Headers are
+// never collected into a map, they are looked up in the raw header lines when they are accessed.
+type Request struct {
+	// Method is the request method, e.g. GET.
+	Method []byte
+	// Target is the request target as it was received, e.g. /search?q=1, or * for OPTIONS requests to the whole server.
+	Target []byte
+	// Body is the complete request body.
+	Body []byte
+	// headers holds the raw header lines, each terminated with a CRLF.
+	headers    []byte
+	ProtoMajor int
+	ProtoMinor int
+}
+
+// RawHandler responds to requests that are parsed into a Request instead of an http.Request.
+type RawHandler interface {
+	ServeRaw(req *Request, w *ResponseWriter)
+}
+
+// RawHandlerFunc adapts a function to a RawHandler.
+type RawHandlerFunc func(req *Request, w *ResponseWriter)
+
+// ServeRaw calls f(req, w).
+func (f RawHandlerFunc) ServeRaw(req *Request, w *ResponseWriter) {
+	f(req, w)
+}
+
+// ParseRequest parses a complete request, as framed by RequestLength (which has already validated its headers), into
+// the Request, overwriting anything that it held before so that a Request can be reused between requests.
+func ParseRequest(data []byte, req *Request) error {
+	rlEndIdx := bytes.Index(data, crlf)
+	hl := HeaderLength(data)
+	if rlEndIdx < 0 || hl == 0 {
+		return ErrBadRequest
+	}
+
+	requestLine := data[:rlEndIdx]
+	spIdx := bytes.IndexByte(requestLine, ' ')
+	if spIdx <= 0 || !isToken(requestLine[:spIdx]) {
+		return ErrBadRequest
+	}
+	method, rest := requestLine[:spIdx], requestLine[spIdx+1:]
+
+	spIdx = bytes.IndexByte(rest, ' ')
+	if spIdx <= 0 {
+		return ErrBadRequest
+	}
+	target, proto := rest[:spIdx], rest[spIdx+1:]
+
+	major, minor, err := parseVersion(proto)
+	if err != nil {
+		return err
+	}
+	req.ProtoMajor, req.ProtoMinor = major, minor
+
+	req.Method = method
+	req.Target = target
+	req.headers = data[rlEndIdx+2 : hl-2]
+	req.Body = data[hl:]
+	return nil
+}
+
+// IsHead reports whether the request is a HEAD request, whose response must be written without its body.
+func (r *Request) IsHead() bool {
+	return bytes.Equal(r.Method, head)
+}
+
+// Path returns the path of the request target, without its query.
+func (r *Request) Path() []byte {
+	if qIdx := bytes.IndexByte(r.Target, '?'); qIdx >= 0 {
+		return r.Target[:qIdx]
+	}
+	return r.Target
+}
+
+// RawQuery returns the query of the request target, without the '?', or nil when there is none.
+func (r *Request) RawQuery() []byte {
+	if qIdx := bytes.IndexByte(r.Target, '?'); qIdx >= 0 {
+		return r.Target[qIdx+1:]
+	}
+	return nil
+}
+
+// Header returns the value of the first header with the (case insensitive) name, or nil when there is none.
+func (r *Request) Header(name string) []byte {
+	headers := r.headers
+	for len(headers) > 0 {
+		var n, v []byte
+		n, v, headers = nextHeader(headers)
+		if equalFoldString(n, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// AcceptsTrailers reports whether the request advertised TE: trailers, meaning that the client is willing to accept
+// trailer fields in a chunked response.
+func (r *Request) AcceptsTrailers() bool {
+	accepts := false
+	r.VisitHeaders(func(name, value []byte) bool {
+		if !equalFoldString(name, "TE") {
+			return true
+		}
+
+		for len(value) > 0 {
+			var coding []byte
+			coding, value = value, nil
+			if commaIdx := bytes.IndexByte(coding, ','); commaIdx >= 0 {
+				coding, value = coding[:commaIdx], coding[commaIdx+1:]
+			}
+			if equalFoldString(bytes.Trim(coding, " \t"), "trailers") {
+				accepts = true
+				return false
+			}
+		}
+		return true
+	})
+	return accepts
+}
+
+// MultipartReader returns a reader over the parts of a multipart/form-data or multipart/mixed body, like
+// http.Request.MultipartReader does, for handlers that process uploads one part at a time with mime/multipart. It
+// returns http.ErrNotMultipart for other bodies, and http.ErrMissingBoundary when the Content-Type has no boundary.
+// The parts are read straight out of the Body without being copied, so like the Request itself, the reader is only
+// valid until the handler returns.
+func (r *Request) MultipartReader() (*multipart.Reader, error) {
+	contentType := r.Header("Content-Type")
+	if contentType == nil {
+		return nil, http.ErrNotMultipart
+	}
+
+	mediaType, params, err := mime.ParseMediaType(string(contentType))
+	if err != nil || mediaType != "multipart/form-data" && mediaType != "multipart/mixed" {
+		return nil, http.ErrNotMultipart
+	}
+
+	boundary, ok := params["boundary"]
+	if !ok {
+		return nil, http.ErrMissingBoundary
+	}
+	return multipart.NewReader(bytes.NewReader(r.Body), boundary), nil
+}
+
+// VisitHeaders calls fn with the name and value of every header in the order that they were received, until fn
+// returns false. The values are trimmed of their surrounding whitespace.
+func (r *Request) VisitHeaders(fn func(name, value []byte) bool) {
+	headers := r.headers
+	for len(headers) > 0 {
+		var n, v []byte
+		n, v, headers = nextHeader(headers)
+		if !fn(n, v) {
+			return
+		}
+	}
+}
+
+// nextHeader splits the first header line off of the CRLF terminated header lines, and returns its name and its
+// trimmed value, along with the remaining lines.
+func nextHeader(headers []byte) (name, value, rest []byte) {
+	line := headers
+	if lineEndIdx := bytes.Index(headers, crlf); lineEndIdx >= 0 {
+		line, rest = headers[:lineEndIdx], headers[lineEndIdx+2:]
+	}
+
+	colonIdx := bytes.IndexByte(line, ':')
+	if colonIdx < 0 {
+		return nil, nil, rest
+	}
+	return line[:colonIdx], bytes.Trim(line[colonIdx+1:], " \t"), rest
+}
+
+// equalFoldString reports whether the ASCII bytes and string are equal under case folding, without converting either.
+func equalFoldString(b []byte, s string) bool {
+	if len(b) != len(s) {
+		return false
+	}
+
+	for i := 0; i < len(b); i++ {
+		x, y := b[i], s[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,259 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	testCases := []struct {
+		expectedErr     error
+		headers         map[string]string
+		desc            string
+		input           string
+		expectedMethod  string
+		expectedPath    string
+		expectedQuery   string
+		expectedBody    string
+		expectedVisited []string
+		protoMinor      int
+		expectedHead    bool
+	}{
+		{
+			desc:            "get with query",
+			input:           "GET /search?q=1&page=2 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nAccept:  */* \r\n\r\n",
+			expectedMethod:  "GET",
+			expectedPath:    "/search",
+			expectedQuery:   "q=1&page=2",
+			protoMinor:      1,
+			headers:         map[string]string{"host": "127.0.0.1:8080", "ACCEPT": "*/*", "X-Missing": ""},
+			expectedVisited: []string{"Host", "Accept"},
+		},
+		{
+			desc:            "post with body",
+			input:           "POST /echo HTTP/1.0\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedMethod:  "POST",
+			expectedPath:    "/echo",
+			expectedBody:    `{"req": 0}`,
+			protoMinor:      0,
+			headers:         map[string]string{"Content-Length": "10"},
+			expectedVisited: []string{"Content-Length"},
+		},
+		{
+			desc:           "head without headers",
+			input:          "HEAD / HTTP/1.1\r\n\r\n",
+			expectedMethod: "HEAD",
+			expectedPath:   "/",
+			protoMinor:     1,
+			expectedHead:   true,
+		},
+		{
+			desc:        "unsupported protocol",
+			input:       "GET / HTTP/2.0\r\n\r\n",
+			expectedErr: ErrVersionNotSupported,
+		},
+		{
+			desc:        "missing target",
+			input:       "GET HTTP/1.1\r\n\r\n",
+			expectedErr: ErrBadRequest,
+		},
+		{
+			desc:        "incomplete headers",
+			input:       "GET / HTTP/1.1\r\nHost: 127.0.0.1",
+			expectedErr: ErrBadRequest,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// Start with a used request, to make sure that nothing leaks between requests
+			req := Request{Method: []byte("PUT"), Body: []byte("stale"), ProtoMinor: 7}
+			err := ParseRequest([]byte(tC.input), &req)
+			if tC.expectedErr != nil {
+				if !errors.Is(err, tC.expectedErr) {
+					subT.Fatalf("ParseRequest() error = %v, want %v", err, tC.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				subT.Fatalf("ParseRequest() error = %v", err)
+			}
+
+			if string(req.Method) != tC.expectedMethod {
+				subT.Errorf("Method = %q, want %q", req.Method, tC.expectedMethod)
+			}
+			if string(req.Path()) != tC.expectedPath {
+				subT.Errorf("Path() = %q, want %q", req.Path(), tC.expectedPath)
+			}
+			if string(req.RawQuery()) != tC.expectedQuery {
+				subT.Errorf("RawQuery() = %q, want %q", req.RawQuery(), tC.expectedQuery)
+			}
+			if string(req.Body) != tC.expectedBody {
+				subT.Errorf("Body = %q, want %q", req.Body, tC.expectedBody)
+			}
+			if req.ProtoMajor != 1 || req.ProtoMinor != tC.protoMinor {
+				subT.Errorf("proto = %d.%d, want 1.%d", req.ProtoMajor, req.ProtoMinor, tC.protoMinor)
+			}
+			if req.IsHead() != tC.expectedHead {
+				subT.Errorf("IsHead() = %v, want %v", req.IsHead(), tC.expectedHead)
+			}
+
+			for name, expected := range tC.headers {
+				if got := req.Header(name); string(got) != expected {
+					subT.Errorf("Header(%q) = %q, want %q", name, got, expected)
+				}
+			}
+
+			var visited []string
+			req.VisitHeaders(func(name, value []byte) bool {
+				visited = append(visited, string(name))
+				return true
+			})
+			if len(visited) != len(tC.expectedVisited) {
+				subT.Fatalf("VisitHeaders() visited %v, want %v", visited, tC.expectedVisited)
+			}
+			for i := range visited {
+				if visited[i] != tC.expectedVisited[i] {
+					subT.Errorf("VisitHeaders() visited %v, want %v", visited, tC.expectedVisited)
+				}
+			}
+		})
+	}
+}
+
+func TestRequest_AcceptsTrailers(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		headers  string
+		expected bool
+	}{
+		{
+			desc:     "TE trailers",
+			headers:  "TE: trailers\r\n",
+			expected: true,
+		},
+		{
+			desc:     "trailers among transfer codings",
+			headers:  "te: deflate;q=0.5, Trailers\r\n",
+			expected: true,
+		},
+		{
+			desc:     "trailers in a later TE header",
+			headers:  "TE: deflate\r\nTE: trailers\r\n",
+			expected: true,
+		},
+		{
+			desc:     "TE without trailers",
+			headers:  "TE: deflate, gzip;q=0.3\r\n",
+			expected: false,
+		},
+		{
+			desc:     "trailers in another header",
+			headers:  "X-TE: trailers\r\nAccept: trailers\r\n",
+			expected: false,
+		},
+		{
+			desc:     "no TE",
+			expected: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var req Request
+			if err := ParseRequest([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"+tC.headers+"\r\n"), &req); err != nil {
+				subT.Fatalf("ParseRequest() error = %v", err)
+			}
+
+			if got := req.AcceptsTrailers(); got != tC.expected {
+				subT.Errorf("AcceptsTrailers() = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestRequest_MultipartReader(t *testing.T) {
+	body := "--xyz\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nholiday\r\n" +
+		"--xyz\r\nContent-Disposition: form-data; name=\"photo\"; filename=\"beach.jpg\"\r\nContent-Type: image/jpeg\r\n\r\n\xff\xd8\xff\xe0\r\n" +
+		"--xyz--\r\n"
+
+	testCases := []struct {
+		expectedErr   error
+		desc          string
+		contentType   string
+		expectedParts []string
+	}{
+		{
+			desc:          "form data",
+			contentType:   "multipart/form-data; boundary=xyz",
+			expectedParts: []string{"title=holiday", "photo=\xff\xd8\xff\xe0"},
+		},
+		{
+			desc:          "mixed with a quoted boundary",
+			contentType:   `Multipart/Mixed; boundary="xyz"`,
+			expectedParts: []string{"title=holiday", "photo=\xff\xd8\xff\xe0"},
+		},
+		{
+			desc:        "missing boundary",
+			contentType: "multipart/form-data",
+			expectedErr: http.ErrMissingBoundary,
+		},
+		{
+			desc:        "not multipart",
+			contentType: "application/x-www-form-urlencoded",
+			expectedErr: http.ErrNotMultipart,
+		},
+		{
+			desc:        "no Content-Type",
+			expectedErr: http.ErrNotMultipart,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			headers := "Content-Length: " + strconv.Itoa(len(body)) + "\r\n"
+			if tC.contentType != "" {
+				headers += "Content-Type: " + tC.contentType + "\r\n"
+			}
+
+			var req Request
+			if err := ParseRequest([]byte("POST /upload HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"+headers+"\r\n"+body), &req); err != nil {
+				subT.Fatalf("ParseRequest() error = %v", err)
+			}
+
+			mr, err := req.MultipartReader()
+			if tC.expectedErr != nil {
+				if err != tC.expectedErr {
+					subT.Fatalf("MultipartReader() error = %v, want %v", err, tC.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				subT.Fatalf("MultipartReader() error = %v", err)
+			}
+
+			var parts []string
+			for {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					subT.Fatalf("NextPart() error = %v", err)
+				}
+
+				content, err := ioutil.ReadAll(part)
+				if err != nil {
+					subT.Fatalf("unable to read part %s: %v", part.FormName(), err)
+				}
+				parts = append(parts, part.FormName()+"="+string(content))
+			}
+
+			if strings.Join(parts, "&") != strings.Join(tC.expectedParts, "&") {
+				subT.Errorf("parts = %q, want %q", parts, tC.expectedParts)
+			}
+		})
+	}
+}
@@ -43,7 +43,7 @@ var isRequestCompleteTestCases = []struct {
 		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUser-Agent: Go-http-client/1.1\r\nAccept-Encoding: gzip\r\n\r\n{\"req\": 0}"),
 		expected:    false,
 		wantErr:     true,
-		expectedErr: errBadRequest,
+		expectedErr: ErrBodyWithoutContentLength,
 	},
 	{
 		desc:        "complete headers with content length no body yet",
@@ -71,7 +71,231 @@ var isRequestCompleteTestCases = []struct {
 		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUser-Agent: Go-http-client/1.1\r\nContent-Length: 123abc\r\nContent-Type: application/json\r\nAccept-Encoding: gzip\r\n\r\n{\"req\": 0}"),
 		expected:    false,
 		wantErr:     true,
-		expectedErr: errBadRequest,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "empty request line",
+		input:       []byte("\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "empty request line followed by a request",
+		input:       []byte("\r\n\r\nPOST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "whitespace only request line before the header terminator",
+		input:       []byte(" \t \r\nHost: 127.0.0.1:8080\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "complete headers with content length zero",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 0\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "pipelined request without body followed by a request with a body",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\nPOST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "lowercase content length and incomplete body",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\ncontent-length: 10\r\n\r\n{\"req\": "),
+		expected:    false,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "pipelined request without body followed by a partial request line",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\nPO"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "pipelined request with body followed by a request with a larger body",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 2\r\n\r\n{}POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 1000\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "raw control character in the request target",
+		input:       []byte("GET /echo\x01 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "raw DEL character in the request target before the header terminator",
+		input:       []byte("GET /ec\x7fho HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "bare line feed in the request target",
+		input:       []byte("GET /echo\nHost: evil HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "headers terminated with bare line feeds only",
+		input:       []byte("GET /echo HTTP/1.1\nHost: 127.0.0.1:8080\n\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrBareLFTerminator,
+	},
+	{
+		desc:        "headers terminated with a bare line feed after CRLF lines",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrBareLFTerminator,
+	},
+	{
+		desc:        "empty line after a header terminated with a bare line feed",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrBareLFTerminator,
+	},
+	{
+		desc:        "bare line feed terminator followed by a body",
+		input:       []byte("POST /echo HTTP/1.1\nHost: 127.0.0.1:8080\nContent-Length: 2\n\n{}"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrBareLFTerminator,
+	},
+	{
+		desc:        "incomplete headers ending in a single bare line feed",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\n"),
+		expected:    false,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "body with blank lines after a CRLF terminator",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 7\r\n\r\na\n\nb\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "encoded null in the request target is left to the engine",
+		input:       []byte("GET /echo%00 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "invalid percent-encoding in the request target",
+		input:       []byte("GET /echo%zz HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "truncated percent-encoding at the end of the path",
+		input:       []byte("GET /echo%2 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "valid percent-encoding in the request target",
+		input:       []byte("GET /echo%2F%2f?q=%41 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "asterisk-form target for OPTIONS",
+		input:       []byte("OPTIONS * HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "asterisk-form target for GET",
+		input:       []byte("GET * HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrInvalidRequestLine,
+	},
+	{
+		desc:        "duplicate host headers",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUser-Agent: Go-http-client/1.1\r\nHost: evil.example.com\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrDuplicateHost,
+	},
+	{
+		desc:        "duplicate host headers with different casing",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nhOST: evil.example.com\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrDuplicateHost,
+	},
+	{
+		desc:        "HTTP/1.1 request without a host header",
+		input:       []byte("GET /echo HTTP/1.1\r\nUser-Agent: Go-http-client/1.1\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrMissingHost,
+	},
+	{
+		desc:        "HTTP/1.1 request without headers",
+		input:       []byte("GET /echo HTTP/1.1\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrMissingHost,
+	},
+	{
+		desc:        "HTTP/1.1 request with an empty host header",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost:\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "HTTP/1.0 request without a host header",
+		input:       []byte("GET /echo HTTP/1.0\r\nUser-Agent: Go-http-client/1.1\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "host header only in a pipelined request",
+		input:       []byte("GET /echo HTTP/1.1\r\n\r\nGET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    false,
+		wantErr:     true,
+		expectedErr: ErrMissingHost,
+	},
+	{
+		desc:        "host header in a pipelined request is not a duplicate",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\nGET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "header with host as a prefix",
+		input:       []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nHostname: 127.0.0.1\r\nX-Forwarded-Host: 127.0.0.1\r\n\r\n"),
+		expected:    true,
+		wantErr:     false,
+		expectedErr: nil,
 	},
 }
 
@@ -92,14 +316,14 @@ var parseContentLengthTestCases = []struct {
 		input:       []byte("a"),
 		expected:    -1,
 		wantErr:     true,
-		expectedErr: errBadRequest,
+		expectedErr: ErrInvalidContentLength,
 	},
 	{
 		desc:        "middle byte error",
 		input:       []byte("12a"),
 		expected:    -1,
 		wantErr:     true,
-		expectedErr: errBadRequest,
+		expectedErr: ErrInvalidContentLength,
 	},
 	{
 		desc:        "0",
@@ -211,6 +435,491 @@ var parseContentLengthTestCases = []struct {
 		input:       []byte("023456"),
 		expected:    -1,
 		wantErr:     true,
-		expectedErr: errBadRequest,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "largest int64",
+		input:       []byte("9223372036854775807"),
+		expected:    9223372036854775807,
+		wantErr:     false,
+		expectedErr: nil,
+	},
+	{
+		desc:        "one past the largest int64",
+		input:       []byte("9223372036854775808"),
+		expected:    -1,
+		wantErr:     true,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "2^64",
+		input:       []byte("18446744073709551616"),
+		expected:    -1,
+		wantErr:     true,
+		expectedErr: ErrInvalidContentLength,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `RequestLength(data []byte) (int, error)` with pipelined requests
+----------------------------------------------------------------------------------------------------
+*/
+var requestLengthTestCases = []struct {
+	expectedErr error
+	desc        string
+	input       []byte
+	expected    int
+	wantErr     bool
+}{
+	{
+		desc:     "single request without body",
+		input:    []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 44,
+	},
+	{
+		desc:     "request without body followed by a request with a body",
+		input:    []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\nPOST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"),
+		expected: 44,
+	},
+	{
+		desc:     "request with body followed by a request without a body",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 2\r\n\r\n{}GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 66,
+	},
+	{
+		desc:     "lowercase content length frames the body",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\ncontent-length: 44\r\n\r\nGET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 109,
+	},
+	{
+		desc:     "mixed case content length frames the body",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCONTENT-length:2\r\n\r\n{}"),
+		expected: 65,
+	},
+	{
+		desc:     "incomplete request",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 2\r\n\r\n{"),
+		expected: 0,
+	},
+	{
+		desc:     "case insensitive Content-Length without optional whitespace",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\ncontent-length:2\r\n\r\n{}GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 65,
+	},
+	{
+		desc:        "Transfer-Encoding with only the last chunk",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrUnsupportedTransferEncoding,
+	},
+	{
+		desc:        "Transfer-Encoding with data chunks",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nTransfer-Encoding: chunked\r\n\r\n2\r\n{}\r\n0\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrUnsupportedTransferEncoding,
+	},
+	{
+		desc:        "Transfer-Encoding as the only header",
+		input:       []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrUnsupportedTransferEncoding,
+	},
+	{
+		desc:        "Transfer-Encoding as the only header before any chunk",
+		input:       []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrUnsupportedTransferEncoding,
+	},
+	{
+		desc:     "Transfer-Encoding as the only header before the header terminator",
+		input:    []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n"),
+		expected: 0,
+	},
+	{
+		desc:        "duplicate Content-Length",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\n{}"),
+		wantErr:     true,
+		expectedErr: ErrDuplicateContentLength,
+	},
+	{
+		desc:        "whitespace before the colon",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost : 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedHeader,
+	},
+	{
+		desc:        "obsolete line folding",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Folded: a\r\n b\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedHeader,
+	},
+	{
+		desc:        "negative Content-Length",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: -1\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "Content-Length past the largest int64",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 9223372036854775808\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "Content-Length of 2^64",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 18446744073709551616\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "Content-Length that fits an int64 but not past the headers",
+		input:       []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 9223372036854775807\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrInvalidContentLength,
+	},
+	{
+		desc:        "misspelled protocol name",
+		input:       []byte("GET /echo HTPP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedVersion,
+	},
+	{
+		desc:        "version without a minor version",
+		input:       []byte("GET /echo HTTP/1.\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedVersion,
+	},
+	{
+		desc:        "protocol name without a version",
+		input:       []byte("GET /echo HTTP/\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedVersion,
+	},
+	{
+		desc:        "lowercase protocol name",
+		input:       []byte("GET /echo http/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedVersion,
+	},
+	{
+		desc:        "multi digit version",
+		input:       []byte("GET /echo HTTP/1.10\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedVersion,
+	},
+	{
+		desc:        "missing version",
+		input:       []byte("GET /echo\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrMalformedVersion,
+	},
+	{
+		desc:        "HTTP/2.0 request line",
+		input:       []byte("GET /echo HTTP/2.0\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrVersionNotSupported,
+	},
+	{
+		desc:        "HTTP/0.9 style version",
+		input:       []byte("GET /echo HTTP/0.9\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		wantErr:     true,
+		expectedErr: ErrVersionNotSupported,
+	},
+	{
+		desc:     "later HTTP/1 minor version",
+		input:    []byte("GET /echo HTTP/1.2\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 44,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `RequestTargetLength(data []byte) int`
+----------------------------------------------------------------------------------------------------
+*/
+var requestTargetLengthTestCases = []struct {
+	desc     string
+	input    []byte
+	expected int
+}{
+	{
+		desc:     "path only",
+		input:    []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 5,
+	},
+	{
+		desc:     "path and query",
+		input:    []byte("GET /echo?q=abc&r=def HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: 17,
+	},
+	{
+		desc:     "incomplete target",
+		input:    []byte("GET /echo?q=abcdef"),
+		expected: 14,
+	},
+	{
+		desc:     "incomplete method",
+		input:    []byte("GE"),
+		expected: 0,
+	},
+	{
+		desc:     "spaces in the headers don't count",
+		input:    []byte("GET / HTTP/1.1\r\nUser-Agent: a b c\r\n\r\n"),
+		expected: 1,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `LongestHeaderValue(data []byte) int`
+----------------------------------------------------------------------------------------------------
+*/
+var longestHeaderValueTestCases = []struct {
+	desc     string
+	input    []byte
+	expected int
+}{
+	{
+		desc:     "longest of several values",
+		input:    []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCookie: a=1; b=2\r\n\r\n"),
+		expected: 14,
+	},
+	{
+		desc:     "surrounding whitespace doesn't count",
+		input:    []byte("GET /echo HTTP/1.1\r\nX-Padded: \t abc \t\r\n\r\n"),
+		expected: 3,
+	},
+	{
+		desc:     "incomplete value",
+		input:    []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCookie: session=abcdefghijklmnopqrstuvwxyz"),
+		expected: 34,
+	},
+	{
+		desc:     "incomplete name",
+		input:    []byte("GET /echo HTTP/1.1\r\nCook"),
+		expected: 0,
+	},
+	{
+		desc:     "incomplete request line",
+		input:    []byte("GET /echo?q=a:bcdefghijklmnop"),
+		expected: 0,
+	},
+	{
+		desc:     "body and pipelined requests don't count",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: a\r\nContent-Length: 20\r\n\r\nX-Body: aaaaaaaaaaaaGET / HTTP/1.1\r\nX-Long: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\r\n\r\n"),
+		expected: 2,
+	},
+}
+
+var contentLengthTestCases = []struct {
+	desc     string
+	input    []byte
+	expected int64
+	wantErr  bool
+}{
+	{
+		desc:     "declared before the body arrives",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 1048576\r\n\r\nabc"),
+		expected: 1048576,
+	},
+	{
+		desc:     "incomplete headers",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10"),
+		expected: -1,
+	},
+	{
+		desc:     "no Content-Length",
+		input:    []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: -1,
+	},
+	{
+		desc:     "invalid Content-Length",
+		input:    []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 1x\r\n\r\n"),
+		expected: -1,
+		wantErr:  true,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `RequestPath(data []byte) []byte`
+----------------------------------------------------------------------------------------------------
+*/
+var requestPathTestCases = []struct {
+	desc     string
+	input    []byte
+	expected []byte
+}{
+	{
+		desc:     "origin-form",
+		input:    []byte("GET /v1/items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: []byte("/v1/items"),
+	},
+	{
+		desc:     "origin-form with a query",
+		input:    []byte("GET /v1/items?page=2&size=10 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: []byte("/v1/items"),
+	},
+	{
+		desc:     "absolute-form",
+		input:    []byte("GET http://127.0.0.1:8080/v1/items?page=2 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: []byte("/v1/items"),
+	},
+	{
+		desc:     "absolute-form without a path",
+		input:    []byte("GET http://127.0.0.1:8080 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: []byte("/"),
+	},
+	{
+		desc:     "origin-form with a scheme in the query",
+		input:    []byte("GET /redirect?to=http://example.com/ HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: []byte("/redirect"),
+	},
+	{
+		desc:     "asterisk-form",
+		input:    []byte("OPTIONS * HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: []byte("*"),
+	},
+	{
+		desc:     "incomplete request line",
+		input:    []byte("GET /v1/items HTTP/1."),
+		expected: nil,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `HeaderLength(data []byte) int`
+----------------------------------------------------------------------------------------------------
+*/
+var headerLengthTestCases = []struct {
+	desc     string
+	input    []byte
+	expected int
+}{
+	{
+		desc:     "empty header block",
+		input:    []byte("POST / HTTP/1.1\r\n\r\n"),
+		expected: 19,
+	},
+	{
+		desc:     "minimal chunked headers",
+		input:    []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"),
+		expected: 47,
+	},
+	{
+		// The CRLFs of the chunk framing, and the empty line after the last chunk, are all part of the body
+		desc:     "minimal chunked headers followed by chunks",
+		input:    []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"),
+		expected: 47,
+	},
+	{
+		desc:     "minimal chunked headers followed by only the last chunk",
+		input:    []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"),
+		expected: 47,
+	},
+	{
+		desc:     "header terminator split across reads",
+		input:    []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r"),
+		expected: 0,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `HasHeader(data []byte, name string) bool`
+----------------------------------------------------------------------------------------------------
+*/
+var hasHeaderTestCases = []struct {
+	desc     string
+	name     string
+	input    []byte
+	expected bool
+}{
+	{
+		desc:     "header present",
+		name:     "Connection",
+		input:    []byte("GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nConnection: close\r\n\r\n"),
+		expected: true,
+	},
+	{
+		desc:     "header present in another case",
+		name:     "Connection",
+		input:    []byte("GET /health HTTP/1.1\r\nhost: 127.0.0.1:8080\r\nCONNECTION: keep-alive\r\n\r\n"),
+		expected: true,
+	},
+	{
+		desc:     "header absent",
+		name:     "Connection",
+		input:    []byte("GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+		expected: false,
+	},
+	{
+		desc:     "name only in a value",
+		name:     "Connection",
+		input:    []byte("GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Note: Connection: close\r\n\r\n"),
+		expected: false,
+	},
+	{
+		desc:     "name only in the body",
+		name:     "Connection",
+		input:    []byte("POST /echo HTTP/1.1\r\nContent-Length: 19\r\n\r\nConnection: close\r\n"),
+		expected: false,
+	},
+	{
+		desc:     "no headers",
+		name:     "Connection",
+		input:    []byte("GET /health HTTP/1.1\r\n\r\n"),
+		expected: false,
+	},
+	{
+		desc:     "incomplete headers",
+		name:     "Connection",
+		input:    []byte("GET /health HTTP/1.1\r\nConnection: close\r\n"),
+		expected: false,
+	},
+}
+
+/*
+----------------------------------------------------------------------------------------------------
+Testing Cases for `IsRequestComplete(data []byte) (bool, error)` with requests whose bytes arrive over two reads
+----------------------------------------------------------------------------------------------------
+*/
+var splitRequestTestCases = []struct {
+	desc  string
+	input []byte
+	// split is where the first read ends, the rest of the input arrives in the second one
+	split int
+}{
+	{
+		desc:  "headers and half of the body in the first read",
+		input: []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"),
+		split: 70,
+	},
+	{
+		desc:  "headers and the first byte of the body in the first read",
+		input: []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"),
+		split: 66,
+	},
+	{
+		desc:  "only the headers in the first read",
+		input: []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"),
+		split: 65,
+	},
+	{
+		desc:  "header terminator split between the reads",
+		input: []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"),
+		split: 63,
+	},
+	{
+		desc:  "half of a body that holds a header terminator",
+		input: []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 8\r\n\r\nab\r\n\r\ncd"),
+		split: 70,
+	},
+	{
+		desc:  "half of a body that looks like a request",
+		input: []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 16\r\n\r\nGET / HTTP/1.1\r\n"),
+		split: 73,
 	},
 }
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AddVary adds the request header field to the Vary header of the response, merging it into any existing Vary
+// value instead of adding another one, so that caches see every field that the response depends on exactly once.
+// Nothing is added when the field is already listed, or when the response varies on everything ("*").
+func AddVary(header http.Header, field string) {
+	values := header.Values("Vary")
+	for _, value := range values {
+		for _, listed := range strings.Split(value, ",") {
+			listed = strings.TrimSpace(listed)
+			if listed == "*" || strings.EqualFold(listed, field) {
+				return
+			}
+		}
+	}
+
+	merged := make([]string, 0, len(values)+1)
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			merged = append(merged, value)
+		}
+	}
+	header.Set("Vary", strings.Join(append(merged, field), ", "))
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddVary(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		existing []string
+		field    string
+		expected []string
+	}{
+		{
+			desc:     "no existing Vary",
+			field:    "Accept-Encoding",
+			expected: []string{"Accept-Encoding"},
+		},
+		{
+			desc:     "merges with an existing Vary",
+			existing: []string{"Origin"},
+			field:    "Accept-Encoding",
+			expected: []string{"Origin, Accept-Encoding"},
+		},
+		{
+			desc:     "merges several existing Vary headers",
+			existing: []string{"Origin", "Accept-Language, Cookie"},
+			field:    "Accept-Encoding",
+			expected: []string{"Origin, Accept-Language, Cookie, Accept-Encoding"},
+		},
+		{
+			desc:     "already listed",
+			existing: []string{"Origin, Accept-Encoding"},
+			field:    "Accept-Encoding",
+			expected: []string{"Origin, Accept-Encoding"},
+		},
+		{
+			desc:     "already listed with different casing",
+			existing: []string{"accept-encoding"},
+			field:    "Accept-Encoding",
+			expected: []string{"accept-encoding"},
+		},
+		{
+			desc:     "varies on everything",
+			existing: []string{"*"},
+			field:    "Accept-Encoding",
+			expected: []string{"*"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			header := http.Header{}
+			for _, value := range tC.existing {
+				header.Add("Vary", value)
+			}
+
+			AddVary(header, tC.field)
+			// Adding the same field again must never list it twice
+			AddVary(header, tC.field)
+
+			got := header.Values("Vary")
+			if len(got) != len(tC.expected) {
+				subT.Fatalf("Vary = %q, want %q", got, tC.expected)
+			}
+			for i := range got {
+				if got[i] != tC.expected[i] {
+					subT.Errorf("Vary = %q, want %q", got, tC.expected)
+				}
+			}
+		})
+	}
+}
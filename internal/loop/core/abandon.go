@@ -0,0 +1,60 @@
+package core
+
+import (
+	"net/http"
+	"time"
+)
+
+// serveWithDeadline runs the handler on a goroutine of its own and waits for it to return for up to the timeout, see
+// WithAbandonTimedOutHandlers. It reports whether the handler returned in time. When it didn't, the handler is
+// abandoned: it keeps running until it returns on its own, but the response that it was handed is never sent, so the
+// caller must not touch it again. The finish func is called on the handler's goroutine once ServeHTTP actually
+// returns, in time or not, to free whatever the handler may still be using, like its in flight slot.
+func serveWithDeadline(handler http.Handler, res http.ResponseWriter, req *http.Request, timeout time.Duration, finish func()) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer finish()
+		handler.ServeHTTP(res, req)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// handOff returns the func that frees what a handler that may be abandoned is using once it returns: its in flight
+// slot, which has to stay taken for as long as the handler runs, and its spilled body, which it may still be reading.
+// The spill is detached from the connection, so that it isn't removed along with the connection's state once the
+// response is written.
+func (h *Handler) handOff(state *conn, holdsSlot bool) func() {
+	sp := state.spill
+	state.spill = nil
+	return func() {
+		if holdsSlot {
+			h.inFlight.release()
+		}
+		if sp != nil {
+			sp.remove()
+		}
+	}
+}
+
+// hasHandlerTimeouts reports whether any request may have a HandlerTimeout, either the Handler's own or a route's.
+func (cfg Config) hasHandlerTimeouts() bool {
+	if cfg.HandlerTimeout > 0 {
+		return true
+	}
+	for _, route := range cfg.RouteTimeouts {
+		if route.HandlerTimeout > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_AbandonTimedOutHandlers(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	release, finished := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stuck" {
+			// The handler ignores its context, so only abandoning it keeps it from holding up the connection
+			defer close(finished)
+			<-release
+			_, _ = w.Write([]byte("too late"))
+			return
+		}
+		_, _ = w.Write([]byte("on time"))
+	})
+	h := NewHandler(context.Background(), handler, WithHandlerTimeout(timeout), WithAbandonTimedOutHandlers())
+	defer func() {
+		close(release)
+		<-finished
+	}()
+
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	start := time.Now()
+	out, action := h.Data(c, []byte("GET /stuck HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	if elapsed := time.Since(start); elapsed > 50*timeout {
+		t.Errorf("Data() took %v with a HandlerTimeout of %v", elapsed, timeout)
+	}
+	if action != None {
+		t.Errorf("Data() action = %v, want %v", action, None)
+	}
+	expectStatus(t, out, http.StatusServiceUnavailable)
+
+	// The handler is still stuck, but the connection goes on with the next request
+	out, action = h.Data(c, []byte("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	if action != None {
+		t.Errorf("Data() action = %v, want %v", action, None)
+	}
+	expectBody(t, expectStatus(t, out, http.StatusOK), "on time")
+
+	stats := h.Stats()
+	if stats.AbandonedHandlers != 1 || stats.TimedOutHandlers != 1 {
+		t.Errorf("AbandonedHandlers, TimedOutHandlers = %d, %d, want 1, 1", stats.AbandonedHandlers, stats.TimedOutHandlers)
+	}
+}
+
+func TestHandler_AbandonedHandlerHoldsInFlightSlot(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stuck" {
+			<-release
+		}
+	})
+	h := NewHandler(context.Background(), handler, WithHandlerTimeout(timeout), WithAbandonTimedOutHandlers(), WithMaxInFlight(1, OverflowReject))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, _ := h.Data(c, []byte("GET /stuck HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusServiceUnavailable)
+
+	// The abandoned handler is still running, so the only slot is still taken
+	out, _ = h.Data(c, []byte("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusServiceUnavailable)
+
+	// The slot is freed once the handler actually returns
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for len(h.inFlight.slots) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the slot of the abandoned handler wasn't freed once it returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	out, _ = h.Data(c, []byte("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusOK)
+}
+
+func TestHandler_AbandonedHandlerReadsSpilledBody(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	dir := t.TempDir()
+	release := make(chan struct{})
+	read := make(chan int64, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		read <- n
+	})
+	h := NewHandler(context.Background(), handler, WithHandlerTimeout(timeout), WithAbandonTimedOutHandlers(), WithBodySpill(16, dir))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	body := strings.Repeat("0123456789abcdef", 64)
+	out, _ := h.Data(c, []byte("POST /upload HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 1024\r\n\r\n"))
+	if len(out) != 0 {
+		t.Fatalf("Data() = %q before the body arrived, want nothing", out)
+	}
+	out, _ = h.Data(c, []byte(body))
+	expectStatus(t, out, http.StatusServiceUnavailable)
+
+	// The response has been written, but the abandoned handler can still read the whole body from the file
+	close(release)
+	if n := <-read; n != int64(len(body)) {
+		t.Errorf("abandoned handler read %d bytes of the spilled body, want %d", n, len(body))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d spilled files left after the abandoned handler returned, want 0", len(files))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// admission is a global token bucket that caps the rate at which requests are accepted across all connections.
+// It is implemented as the equivalent GCRA (generic cell rate algorithm), which boils the bucket down to a single
+// timestamp, so that it can be updated with a compare and swap instead of a lock shared between the event loops.
+type admission struct {
+	// tat is the unix nano timestamp at which the bucket would be full again (the theoretical arrival time).
+	tat int64
+	// interval is the time it takes for a single token to refill.
+	interval int64
+	// tolerance is how far ahead of now the tat may get, which is what allows bursts.
+	tolerance int64
+}
+
+func newAdmission(perSecond, burst int) *admission {
+	if burst < 1 {
+		burst = 1
+	}
+
+	interval := int64(time.Second) / int64(perSecond)
+	return &admission{
+		interval:  interval,
+		tolerance: interval * int64(burst),
+	}
+}
+
+// allow takes a token from the bucket, and reports whether there was one to take.
+func (a *admission) allow(now int64) bool {
+	for {
+		tat := atomic.LoadInt64(&a.tat)
+		next := tat
+		if next < now {
+			next = now
+		}
+		next += a.interval
+
+		if next-now > a.tolerance {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt64(&a.tat, tat, next) {
+			return true
+		}
+	}
+}
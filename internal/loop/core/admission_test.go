@@ -0,0 +1,103 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdmission_Allow(t *testing.T) {
+	testCases := []struct {
+		desc string
+		// arrivals are the offsets from the start at which requests arrive
+		arrivals  []time.Duration
+		expected  []bool
+		perSecond int
+		burst     int
+	}{
+		{
+			desc:      "burst is accepted then shed",
+			perSecond: 10,
+			burst:     3,
+			arrivals:  []time.Duration{0, 0, 0, 0, 0},
+			expected:  []bool{true, true, true, false, false},
+		},
+		{
+			desc:      "tokens refill over time",
+			perSecond: 10,
+			burst:     1,
+			arrivals:  []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond},
+			expected:  []bool{true, false, true, false, true},
+		},
+		{
+			desc:      "steady rate under the limit",
+			perSecond: 10,
+			burst:     1,
+			arrivals:  []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond},
+			expected:  []bool{true, true, true, true},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			a := newAdmission(tC.perSecond, tC.burst)
+			start := time.Now().UnixNano()
+			for i, arrival := range tC.arrivals {
+				if got := a.allow(start + int64(arrival)); got != tC.expected[i] {
+					subT.Errorf("request %d at %v allowed = %v, want %v", i, arrival, got, tC.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_MaxRequestRate(t *testing.T) {
+	const requests = 50
+
+	h := newTestHandler(WithMaxRequestRate(1, 10))
+
+	// The requests all arrive at once from many connections and event loops
+	var ok, shed int64
+	wg := sync.WaitGroup{}
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		c := newTestConn()
+		h.Opened(c, c.wake)
+		go func(c *testConn) {
+			defer wg.Done()
+
+			out, _ := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				t.Errorf("unable to read response %q: %v", out, err)
+				return
+			}
+
+			switch res.StatusCode {
+			case http.StatusOK:
+				atomic.AddInt64(&ok, 1)
+			case http.StatusServiceUnavailable:
+				atomic.AddInt64(&shed, 1)
+				if res.Header.Get("Retry-After") == "" {
+					t.Error("shed response has no Retry-After")
+				}
+			default:
+				t.Errorf("response status = %d, want %d or %d", res.StatusCode, http.StatusOK, http.StatusServiceUnavailable)
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if ok != 10 {
+		t.Errorf("accepted %d requests, want the burst of 10", ok)
+	}
+	if shed != requests-10 {
+		t.Errorf("shed %d requests, want %d", shed, requests-10)
+	}
+	if got := h.Stats().ShedRequests; got != requests-10 {
+		t.Errorf("Stats().ShedRequests = %d, want %d", got, requests-10)
+	}
+}
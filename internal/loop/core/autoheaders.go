@@ -0,0 +1,74 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// AutoHeader is a bitmask of the response headers that are added automatically to responses that don't set them.
+type AutoHeader uint
+
+const (
+	// AutoHeaderDate adds the Date header, which RFC 7231 section 7.1.1.2 requires from servers with a clock.
+	AutoHeaderDate AutoHeader = 1 << iota
+	// AutoHeaderServer adds the Server header with the configured ServerName.
+	AutoHeaderServer
+	// AutoHeaderKeepAlive adds a Keep-Alive header with the ReadTimeout to responses on persistent connections.
+	AutoHeaderKeepAlive
+	// AutoHeaderAltSvc adds the Alt-Svc header with the configured AltSvc value.
+	AutoHeaderAltSvc
+	// AutoHeaderSecurity adds the configured SecurityHeaders.
+	AutoHeaderSecurity
+
+	// DefaultAutoHeaders is the default value of Config.AutoHeaders.
+	DefaultAutoHeaders = AutoHeaderDate
+)
+
+// DefaultServerName is the default value of Config.ServerName.
+const DefaultServerName = "server-scratch"
+
+// DefaultSecurityHeaders returns the security headers that WithSecurityHeaders adds when it isn't given any:
+// X-Content-Type-Options to stop browsers from sniffing content types, X-Frame-Options to forbid framing, and a
+// basic Content-Security-Policy that only allows resources from the same origin.
+func DefaultSecurityHeaders() http.Header {
+	return http.Header{
+		"X-Content-Type-Options":  {"nosniff"},
+		"X-Frame-Options":         {"DENY"},
+		"Content-Security-Policy": {"default-src 'self'"},
+	}
+}
+
+// injectHeaders is the single place where automatic headers are added to responses. Headers that
+// the handler has already set are never overridden.
+func (h *Handler) injectHeaders(res *internalHttp.ResponseWriter, closeConn bool) {
+	mask := h.config.AutoHeaders
+	header := res.Header()
+
+	if mask&AutoHeaderDate != 0 && header.Get("Date") == "" {
+		header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	if mask&AutoHeaderServer != 0 && h.config.ServerName != "" && header.Get("Server") == "" {
+		header.Set("Server", h.config.ServerName)
+	}
+
+	if mask&AutoHeaderKeepAlive != 0 && !closeConn && h.config.ReadTimeout > 0 && header.Get("Keep-Alive") == "" {
+		header.Set("Keep-Alive", "timeout="+strconv.Itoa(int(h.config.ReadTimeout/time.Second)))
+	}
+
+	if mask&AutoHeaderAltSvc != 0 && h.config.AltSvc != "" && header.Get("Alt-Svc") == "" {
+		header.Set("Alt-Svc", h.config.AltSvc)
+	}
+
+	if mask&AutoHeaderSecurity != 0 {
+		for name, values := range h.config.SecurityHeaders {
+			// Handlers can opt out of a security header by setting it to nil
+			if _, ok := header[name]; !ok {
+				header[name] = append([]string(nil), values...)
+			}
+		}
+	}
+}
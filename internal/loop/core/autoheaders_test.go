@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHandler_AutoHeaders(t *testing.T) {
+	testCases := []struct {
+		expectedHeaders map[string]bool
+		desc            string
+		opts            []Option
+	}{
+		{
+			desc:            "date on by default",
+			expectedHeaders: map[string]bool{"Date": true, "Server": false, "Keep-Alive": false, "Alt-Svc": false},
+		},
+		{
+			desc:            "date toggled off",
+			opts:            []Option{WithAutoHeaders(0)},
+			expectedHeaders: map[string]bool{"Date": false, "Server": false, "Keep-Alive": false, "Alt-Svc": false},
+		},
+		{
+			desc:            "all headers",
+			opts:            []Option{WithReadTimeout(5 * time.Second), WithAltSvc(`h3=":443"`), WithAutoHeaders(AutoHeaderDate | AutoHeaderServer | AutoHeaderKeepAlive | AutoHeaderAltSvc)},
+			expectedHeaders: map[string]bool{"Date": true, "Server": true, "Keep-Alive": true, "Alt-Svc": true},
+		},
+		{
+			desc:            "alt-svc toggled off",
+			opts:            []Option{WithAltSvc(`h3=":443"`), WithAutoHeaders(AutoHeaderDate)},
+			expectedHeaders: map[string]bool{"Date": true, "Alt-Svc": false},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			for header, expected := range tC.expectedHeaders {
+				if got := res.Header.Get(header) != ""; got != expected {
+					subT.Errorf("%s set = %v (%q), want set %v", header, got, res.Header.Get(header), expected)
+				}
+			}
+
+			if date := res.Header.Get("Date"); date != "" {
+				if _, err := http.ParseTime(date); err != nil {
+					subT.Errorf("Date %q is not a valid HTTP date: %v", date, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_SecurityHeaders(t *testing.T) {
+	testCases := []struct {
+		handlerHeaders  http.Header
+		securityHeaders http.Header
+		expectedHeaders map[string]string
+		desc            string
+	}{
+		{
+			desc: "defaults",
+			expectedHeaders: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "DENY",
+				"Content-Security-Policy": "default-src 'self'",
+			},
+		},
+		{
+			desc:            "custom set",
+			securityHeaders: http.Header{"x-content-type-options": {"nosniff"}, "Strict-Transport-Security": {"max-age=63072000"}},
+			expectedHeaders: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "max-age=63072000",
+				"X-Frame-Options":           "",
+			},
+		},
+		{
+			desc:           "handler values take precedence",
+			handlerHeaders: http.Header{"X-Frame-Options": {"SAMEORIGIN"}, "Content-Security-Policy": {"default-src *"}},
+			expectedHeaders: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "SAMEORIGIN",
+				"Content-Security-Policy": "default-src *",
+			},
+		},
+		{
+			desc:           "handler opts out with nil",
+			handlerHeaders: http.Header{"Content-Security-Policy": nil},
+			expectedHeaders: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"Content-Security-Policy": "",
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range tC.handlerHeaders {
+					w.Header()[name] = values
+				}
+				w.Write([]byte("hello"))
+			}), WithLogger(&recordingLogger{}), WithSecurityHeaders(tC.securityHeaders))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			for header, expected := range tC.expectedHeaders {
+				if got := res.Header.Get(header); got != expected {
+					subT.Errorf("%s = %q, want %q", header, got, expected)
+				}
+			}
+		})
+	}
+}
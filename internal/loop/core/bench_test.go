@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+var (
+	benchRequest = []byte("POST /echo?x=1 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUser-Agent: bench\r\nAccept: */*\r\nContent-Type: application/json\r\nContent-Length: 10\r\n\r\n{\"req\": 0}")
+	benchHealth  = []byte("GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUser-Agent: bench\r\nAccept: */*\r\n\r\n")
+	benchOut     []byte
+)
+
+func benchmarkHandler(b *testing.B, h *Handler, request []byte) {
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchOut, _ = h.Data(c, request)
+	}
+}
+
+// BenchmarkHandler_HTTPHandler    	  146319	      8384 ns/op	    7737 B/op	      39 allocs/op
+func BenchmarkHandler_HTTPHandler(b *testing.B) {
+	benchmarkHandler(b, NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Write(body)
+	}), WithLogger(&recordingLogger{})), benchRequest)
+}
+
+// BenchmarkHandler_RawHandler     	  235045	      5413 ns/op	    1848 B/op	      20 allocs/op
+func BenchmarkHandler_RawHandler(b *testing.B) {
+	benchmarkHandler(b, NewHandler(context.Background(), nil, WithLogger(&recordingLogger{}), WithRawHandler(internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.Header().Set("Content-Type", string(req.Header("Content-Type")))
+		w.Write(req.Body)
+	}))), benchRequest)
+}
+
+// BenchmarkHandler_Health         	   96066	     11032 ns/op	    7065 B/op	      35 allocs/op
+func BenchmarkHandler_Health(b *testing.B) {
+	benchmarkHandler(b, NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}), WithLogger(&recordingLogger{})), benchHealth)
+}
+
+// BenchmarkHandler_StaticHealth   	  843421	      1517 ns/op	       0 B/op	       0 allocs/op
+func BenchmarkHandler_StaticHealth(b *testing.B) {
+	benchmarkHandler(b, NewHandler(context.Background(), nil, WithLogger(&recordingLogger{}),
+		WithStaticResponse("/health", StaticResponse(http.StatusOK, "text/plain", []byte("ok")))), benchHealth)
+}
+
+// naiveReap is the scan over every connection that the timing wheel replaced, kept as the baseline of BenchmarkReap.
+func naiveReap(h *Handler, now time.Time) {
+	var marked []*conn
+	h.connsMu.Lock()
+	for state := range h.conns {
+		if h.config.ReadTimeout > 0 && state.readingSince(now) > h.config.ReadTimeout && state.markTimedOut() {
+			marked = append(marked, state)
+		} else if h.config.MaxConnLifetime > 0 && state.age(now) > h.config.MaxConnLifetime && state.markExpired() {
+			marked = append(marked, state)
+		}
+	}
+	h.connsMu.Unlock()
+
+	for _, state := range marked {
+		if state.wake != nil {
+			state.wake()
+		}
+	}
+}
+
+// BenchmarkReap/naive             	     247	   6925297 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkReap/wheel             	12331701	        95.03 ns/op	       0 B/op	       0 allocs/op
+func BenchmarkReap(b *testing.B) {
+	const conns = 100000
+
+	h := NewHandler(context.Background(), nil, WithLogger(&recordingLogger{}), WithReadTimeout(time.Minute), WithMaxConnLifetime(time.Hour))
+	for i := 0; i < conns; i++ {
+		c := newTestConn()
+		h.Opened(c, c.wake)
+	}
+
+	for _, bC := range []struct {
+		reap func(now time.Time)
+		desc string
+	}{
+		{desc: "naive", reap: func(now time.Time) { naiveReap(h, now) }},
+		{desc: "wheel", reap: h.reap},
+	} {
+		b.Run(bC.desc, func(subB *testing.B) {
+			subB.ReportAllocs()
+			subB.ResetTimer()
+			for i := 0; i < subB.N; i++ {
+				bC.reap(time.Now())
+			}
+		})
+	}
+}
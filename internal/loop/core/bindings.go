@@ -0,0 +1,59 @@
+package core
+
+import (
+	"net"
+	"net/http"
+)
+
+// Binding is an extra port that the engines listen on besides their own, whose requests are dispatched to its own
+// handler, e.g. to expose metrics or an admin API next to the application without routing them on the same port.
+type Binding struct {
+	// Handler serves the requests that arrive on the Port. A nil Handler answers them with a 404 Not Found.
+	Handler http.Handler
+	Port    int
+}
+
+// bindingHandlers maps the ports of the bindings to their handlers, or returns nil when there are none.
+func bindingHandlers(bindings []Binding) map[int]http.Handler {
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	handlers := make(map[int]http.Handler, len(bindings))
+	for _, binding := range bindings {
+		handler := binding.Handler
+		if handler == nil {
+			handler = http.NotFoundHandler()
+		}
+		handlers[binding.Port] = handler
+	}
+	return handlers
+}
+
+// bindingHandler returns the handler of the binding that a connection was accepted on, or nil when it was accepted
+// on the engine's own port.
+func bindingHandler(handlers map[int]http.Handler, local net.Addr) http.Handler {
+	if addr, ok := local.(*net.TCPAddr); ok {
+		return handlers[addr.Port]
+	}
+	return nil
+}
+
+// RouteBindings returns a handler that dispatches the requests that arrived on one of the bindings to its handler, and
+// any other request to next. It is how engines that don't go through a Handler (like the standard library's) serve
+// the bindings.
+func RouteBindings(next http.Handler, bindings []Binding) http.Handler {
+	handlers := bindingHandlers(bindings)
+	if handlers == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		if handler := bindingHandler(handlers, local); handler != nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", name)
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestHandler_Bindings(t *testing.T) {
+	bindings := []Binding{
+		{Port: 9090, Handler: namedHandler("admin")},
+		{Port: 9091},
+	}
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.Header().Set("X-Handler", "raw")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		desc            string
+		expectedHandler string
+		opts            []Option
+		port            int
+		expectedStatus  int
+	}{
+		{
+			desc:            "engine port",
+			port:            8080,
+			expectedStatus:  http.StatusOK,
+			expectedHandler: "api",
+		},
+		{
+			desc:            "binding port",
+			port:            9090,
+			expectedStatus:  http.StatusOK,
+			expectedHandler: "admin",
+		},
+		{
+			desc:           "binding without a handler",
+			port:           9091,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			desc:            "engine port with a raw handler",
+			opts:            []Option{WithRawHandler(raw)},
+			port:            8080,
+			expectedStatus:  http.StatusOK,
+			expectedHandler: "raw",
+		},
+		{
+			desc:            "binding port with a raw handler",
+			opts:            []Option{WithRawHandler(raw)},
+			port:            9090,
+			expectedStatus:  http.StatusOK,
+			expectedHandler: "admin",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			opts := append([]Option{WithLogger(&recordingLogger{}), WithBindings(bindings...)}, tC.opts...)
+			h := NewHandler(context.Background(), namedHandler("api"), opts...)
+			c := newTestConn()
+			c.local = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tC.port}
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("GET /metrics HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"))
+			res := expectStatus(subT, out, tC.expectedStatus)
+			if got := res.Header.Get("X-Handler"); got != tC.expectedHandler {
+				subT.Errorf("X-Handler = %q, want %q", got, tC.expectedHandler)
+			}
+		})
+	}
+}
+
+func TestRouteBindings(t *testing.T) {
+	handler := RouteBindings(namedHandler("api"), []Binding{{Port: 9090, Handler: namedHandler("admin")}})
+
+	testCases := []struct {
+		desc            string
+		expectedHandler string
+		port            int
+	}{
+		{desc: "engine port", port: 8080, expectedHandler: "api"},
+		{desc: "binding port", port: 9090, expectedHandler: "admin"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: tC.port}
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			if got := rec.Header().Get("X-Handler"); got != tC.expectedHandler {
+				subT.Errorf("X-Handler = %q, want %q", got, tC.expectedHandler)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned when reading the body of a request past the MaxBodyBytes.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// countingBody is the Body of every request that is dispatched to an http.Handler. It counts the bytes that the
+// handler reads, and enforces the MaxBodyBytes as they are read, on top of the check of the declared Content-Length.
+type countingBody struct {
+	body     io.ReadCloser
+	read     int64
+	limit    int64
+	exceeded bool
+}
+
+func newCountingBody(body io.ReadCloser, limit int64) *countingBody {
+	return &countingBody{body: body, limit: limit}
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+
+	// Reading a single byte past the limit is enough to tell that the body goes over it
+	if b.limit > 0 && int64(len(p)) > b.limit-b.read+1 {
+		p = p[:b.limit-b.read+1]
+	}
+
+	n, err := b.body.Read(p)
+	if b.limit > 0 && b.read+int64(n) > b.limit {
+		b.exceeded = true
+		n = int(b.limit - b.read)
+		b.read = b.limit
+		return n, ErrBodyTooLarge
+	}
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	return b.body.Close()
+}
+
+// BodyBytesRead returns the number of body bytes that have been read from the request so far, which once the handler
+// has returned (e.g. in a middleware or a ResponseInterceptor) is how much of the body it actually consumed. It returns
+// -1 when the Body has been replaced, e.g. by a middleware, since the bytes read from the replacement aren't counted.
+func BodyBytesRead(r *http.Request) int64 {
+	if r.Body == nil || r.Body == http.NoBody {
+		return 0
+	}
+
+	body, ok := r.Body.(*countingBody)
+	if !ok {
+		return -1
+	}
+	return body.read
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestCountingBody(t *testing.T) {
+	testCases := []struct {
+		expectedErr  error
+		desc         string
+		body         string
+		expectedBody string
+		limit        int64
+	}{
+		{
+			desc:         "without a limit",
+			body:         "0123456789",
+			expectedBody: "0123456789",
+		},
+		{
+			desc:         "within the limit",
+			body:         "0123456789",
+			limit:        16,
+			expectedBody: "0123456789",
+		},
+		{
+			desc:         "exactly the limit",
+			body:         "0123456789",
+			limit:        10,
+			expectedBody: "0123456789",
+		},
+		{
+			desc:         "past the limit",
+			body:         "0123456789",
+			limit:        4,
+			expectedBody: "0123",
+			expectedErr:  ErrBodyTooLarge,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			body := newCountingBody(ioutil.NopCloser(strings.NewReader(tC.body)), tC.limit)
+
+			// Small reads make sure that the limit holds across them
+			var read []byte
+			buf := make([]byte, 3)
+			var err error
+			for {
+				var n int
+				n, err = body.Read(buf)
+				read = append(read, buf[:n]...)
+				if err != nil {
+					break
+				}
+			}
+
+			if tC.expectedErr == nil && err != io.EOF || tC.expectedErr != nil && !errors.Is(err, tC.expectedErr) {
+				subT.Errorf("Read() error = %v, want %v", err, tC.expectedErr)
+			}
+			if string(read) != tC.expectedBody {
+				subT.Errorf("read %q, want %q", read, tC.expectedBody)
+			}
+			if body.read != int64(len(tC.expectedBody)) {
+				subT.Errorf("counted %d bytes, want %d", body.read, len(tC.expectedBody))
+			}
+
+			// Once over the limit, the body stays over it
+			if n, err := body.Read(buf); tC.expectedErr != nil && (n != 0 || err != tC.expectedErr) {
+				subT.Errorf("Read() after the limit = %d, %v, want 0, %v", n, err, tC.expectedErr)
+			}
+		})
+	}
+}
+
+func TestHandler_BodyBytesRead(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		request      string
+		expectedRead string
+		read         int64
+	}{
+		{
+			desc:         "body read in full",
+			request:      "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			read:         -1,
+			expectedRead: "10",
+		},
+		{
+			desc:         "body read in part",
+			request:      "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			read:         4,
+			expectedRead: "4",
+		},
+		{
+			desc:         "body left unread",
+			request:      "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			read:         0,
+			expectedRead: "0",
+		},
+		{
+			desc:         "request without a body",
+			request:      "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			read:         -1,
+			expectedRead: "0",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tC.read < 0 {
+					_, _ = io.Copy(ioutil.Discard, r.Body)
+					return
+				}
+				_, _ = io.CopyN(ioutil.Discard, r.Body, tC.read)
+			})
+			// The count is complete once the handler has returned
+			interceptor := func(req *http.Request, rw *internalHttp.ResponseWriter) {
+				rw.Header().Set("X-Body-Read", strconv.FormatInt(BodyBytesRead(req), 10))
+			}
+			h := NewHandler(context.Background(), handler, WithResponseInterceptor(interceptor))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res := expectStatus(subT, out, http.StatusOK)
+			if got := res.Header.Get("X-Body-Read"); got != tC.expectedRead {
+				subT.Errorf("BodyBytesRead() = %s, want %s", got, tC.expectedRead)
+			}
+		})
+	}
+
+	// A body that was replaced isn't counted
+	req, _ := http.NewRequest(http.MethodPost, "/echo", bytes.NewReader([]byte("{}")))
+	if got := BodyBytesRead(req); got != -1 {
+		t.Errorf("BodyBytesRead() of a replaced body = %d, want -1", got)
+	}
+}
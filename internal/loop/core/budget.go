@@ -0,0 +1,119 @@
+package core
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// BudgetPolicy decides what happens when the bytes buffered for incomplete requests go over the MaxBufferedBytes.
+type BudgetPolicy int
+
+const (
+	// BudgetReject answers the connection whose data pushed the buffered bytes over the budget with a 503 Service
+	// Unavailable and closes it.
+	BudgetReject BudgetPolicy = iota
+	// BudgetEvictIdlest closes the least recently active other connection that is in the middle of a request, to make
+	// room for the connection that is making progress. When there is no other such connection, it falls back to BudgetReject.
+	BudgetEvictIdlest
+)
+
+func (p BudgetPolicy) String() string {
+	switch p {
+	case BudgetReject:
+		return "Reject"
+	case BudgetEvictIdlest:
+		return "EvictIdlest"
+	default:
+		return ""
+	}
+}
+
+// loopOf returns the index of the event loop that the connection was assigned to, see LoopIndex. Connections that wrap
+// the engine's own, like the ones that the gnet engine dispatches off its loops, tell it themselves.
+func loopOf(c Conn) int {
+	if lc, ok := c.(interface{ LoopIndex() int }); ok {
+		return lc.LoopIndex()
+	}
+	return LoopIndex(c)
+}
+
+// loopBudgets holds the bytes buffered for incomplete requests on each event loop, which the MaxBufferedBytes bounds
+// loop by loop. Like the loopStats, the counters grow with the loops as they are seen. Each connection keeps a pointer
+// to the counter of its own loop, so that its buffered bytes are accounted for without going through the mutex.
+type loopBudgets struct {
+	loops []*int64
+	// unknown is the counter of the connections whose loop can't be told, e.g. the ones served with ServeConn.
+	unknown int64
+	mu      sync.Mutex
+}
+
+// counter returns the counter of the loop, or the one of the connections without a loop when it is negative.
+func (b *loopBudgets) counter(loop int) *int64 {
+	if loop < 0 {
+		return &b.unknown
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.loops) <= loop {
+		b.loops = append(b.loops, new(int64))
+	}
+	return b.loops[loop]
+}
+
+// overBudget reports whether the bytes buffered across the connections of the connection's loop are over the
+// MaxBufferedBytes.
+func (h *Handler) overBudget(state *conn) bool {
+	return state.buffered != nil && atomic.LoadInt64(state.buffered) > h.config.MaxBufferedBytes
+}
+
+// enforceBudget applies the BudgetPolicy once the connection's data has pushed the buffered bytes of its loop over the
+// budget.
+func (h *Handler) enforceBudget(state *conn) ([]byte, Action) {
+	if h.config.BudgetPolicy == BudgetEvictIdlest {
+		if idlest := h.idlestReading(state); idlest != nil {
+			// The evicted connection is closed from within its own event loop once it is woken up
+			idlest.wake()
+			return nil, None
+		}
+	}
+
+	atomic.AddUint64(&h.stats.OverBudgetConnections, 1)
+	state.reset()
+	return h.respondError(state, h.newResponseWriter(1, 1), http.StatusServiceUnavailable)
+}
+
+// idlestReading finds the least recently active connection other than the given one that is in the middle of reading
+// a request on the same loop and can be woken up, and marks it as evicted. It returns nil when there is no such
+// connection. Connections of other loops are left alone, since evicting them wouldn't make room in this loop's budget.
+func (h *Handler) idlestReading(except *conn) *conn {
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+
+	for {
+		var idlest *conn
+		var idlestActive int64
+		for state := range h.conns {
+			if state == except || state.buffered != except.buffered || state.wake == nil || state.isEvicted() || atomic.LoadInt64(&state.requestStart) == 0 {
+				continue
+			}
+
+			if active := atomic.LoadInt64(&state.lastActive); idlest == nil || active < idlestActive {
+				idlest, idlestActive = state, active
+			}
+		}
+
+		// Another event loop may have evicted the same connection in the meantime, in which case we look again
+		if idlest == nil || idlest.markEvicted() {
+			return idlest
+		}
+	}
+}
+
+// evict closes a connection that was evicted to make room in the buffer budget.
+func (h *Handler) evict(state *conn) ([]byte, Action) {
+	atomic.AddUint64(&h.stats.OverBudgetConnections, 1)
+	state.reset()
+	return h.respondError(state, h.newResponseWriter(1, 1), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// partialRequest returns the beginning of a request that is exactly n bytes long, whose body is never completed.
+func partialRequest(n int) []byte {
+	head := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 100000\r\n\r\n"
+	return []byte(head + strings.Repeat("a", n-len(head)))
+}
+
+func TestHandler_MaxBufferedBytes(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		policy          BudgetPolicy
+		expectedEvicted int
+	}{
+		{
+			desc:            "reject",
+			policy:          BudgetReject,
+			expectedEvicted: -1,
+		},
+		{
+			desc:            "evict idlest",
+			policy:          BudgetEvictIdlest,
+			expectedEvicted: 0,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			const (
+				budget      = 1000
+				requestSize = 300
+			)
+			h := newTestHandler(WithMaxBufferedBytes(budget, tC.policy))
+
+			// Many connections on the same handler each buffer a large partial request, until the fourth one
+			// goes over the budget
+			conns := make([]*testConn, 4)
+			for i := range conns {
+				conns[i] = newTestConn()
+				h.Opened(conns[i], conns[i].wake)
+			}
+
+			for i, c := range conns[:3] {
+				if _, action := h.Data(c, partialRequest(requestSize)); action != None {
+					subT.Fatalf("connection %d was closed within the budget", i)
+				}
+				// Make sure that the connections are ordered by their activity
+				time.Sleep(time.Millisecond)
+			}
+			if got := atomic.LoadInt64(&h.budgets.unknown); got != 3*requestSize {
+				subT.Fatalf("buffered = %d, want %d", got, 3*requestSize)
+			}
+
+			out, action := h.Data(conns[3], partialRequest(requestSize))
+			if tC.expectedEvicted < 0 {
+				if action != Close {
+					subT.Fatalf("connection over the budget action = %v, want %v", action, Close)
+				}
+				expectStatus(subT, out, http.StatusServiceUnavailable)
+			} else {
+				if action != None {
+					subT.Fatalf("connection over the budget action = %v, want %v", action, None)
+				}
+
+				evicted := conns[tC.expectedEvicted]
+				if evicted.woken != 1 {
+					subT.Fatalf("idlest connection was woken %d times, want 1", evicted.woken)
+				}
+				for i, c := range conns[1:3] {
+					if c.woken != 0 {
+						subT.Errorf("connection %d was woken, want only the idlest one", i+1)
+					}
+				}
+
+				out, action := h.Data(evicted, nil)
+				if action != Close {
+					subT.Fatalf("evicted connection action = %v, want %v", action, Close)
+				}
+				expectStatus(subT, out, http.StatusServiceUnavailable)
+			}
+
+			// Either way, one connection's buffer has been released
+			if got := atomic.LoadInt64(&h.budgets.unknown); got != 3*requestSize {
+				subT.Errorf("buffered = %d after going over the budget, want %d", got, 3*requestSize)
+			}
+			if got := h.Stats().OverBudgetConnections; got != 1 {
+				subT.Errorf("Stats().OverBudgetConnections = %d, want 1", got)
+			}
+
+			for _, c := range conns {
+				h.Closed(c, nil)
+			}
+			if got := atomic.LoadInt64(&h.budgets.unknown); got != 0 {
+				subT.Errorf("buffered = %d after closing every connection, want 0", got)
+			}
+		})
+	}
+}
+
+func TestHandler_MaxBufferedBytesCompletedRequests(t *testing.T) {
+	h := newTestHandler(WithMaxBufferedBytes(100, BudgetReject))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	// Requests that complete release their buffer, so they never count against the budget
+	for i := 0; i < 10; i++ {
+		body := fmt.Sprintf(`{"req": %d}`, i)
+		request := fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		for _, frame := range []string{request[:40], request[40:]} {
+			if _, action := h.Data(c, []byte(frame)); action != None {
+				t.Fatalf("request %d action = %v, want %v", i, action, None)
+			}
+		}
+	}
+
+	if got := atomic.LoadInt64(&h.budgets.unknown); got != 0 {
+		t.Errorf("buffered = %d, want 0", got)
+	}
+}
+
+func TestHandler_MaxBufferedBytesPerLoop(t *testing.T) {
+	const (
+		budget      = 1000
+		requestSize = 300
+	)
+	h := newTestHandler(WithMaxBufferedBytes(budget, BudgetEvictIdlest))
+
+	// The connection on the other loop is the idlest one, but evicting it wouldn't make room on the first loop
+	other := newTestConn()
+	other.loop = &testLoop{idx: 1}
+	h.Opened(other, other.wake)
+	if _, action := h.Data(other, partialRequest(requestSize)); action != None {
+		t.Fatalf("connection on the other loop was closed within its budget")
+	}
+	time.Sleep(time.Millisecond)
+
+	// Many connections on the first loop each buffer a large partial request, until the fourth one goes over its budget
+	conns := make([]*testConn, 4)
+	for i := range conns {
+		conns[i] = newTestConn()
+		conns[i].loop = &testLoop{idx: 0}
+		h.Opened(conns[i], conns[i].wake)
+	}
+	for i, c := range conns[:3] {
+		if _, action := h.Data(c, partialRequest(requestSize)); action != None {
+			t.Fatalf("connection %d was closed within the budget", i)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt64(h.budgets.counter(0)); got != 3*requestSize {
+		t.Fatalf("buffered on the first loop = %d, want %d", got, 3*requestSize)
+	}
+	if got := atomic.LoadInt64(h.budgets.counter(1)); got != requestSize {
+		t.Fatalf("buffered on the other loop = %d, want %d", got, requestSize)
+	}
+
+	if _, action := h.Data(conns[3], partialRequest(requestSize)); action != None {
+		t.Fatalf("connection over the budget action = %v, want %v", action, None)
+	}
+	if other.woken != 0 {
+		t.Errorf("connection on the other loop was woken %d times, want 0", other.woken)
+	}
+	if conns[0].woken != 1 {
+		t.Errorf("idlest connection of the loop was woken %d times, want 1", conns[0].woken)
+	}
+}
+
+func expectStatus(t *testing.T, out []byte, status int) *http.Response {
+	t.Helper()
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+	if err != nil {
+		t.Fatalf("unable to read response %q: %v", out, err)
+	}
+	if res.StatusCode != status {
+		t.Errorf("status = %d, want %d", res.StatusCode, status)
+	}
+	return res
+}
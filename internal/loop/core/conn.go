@@ -0,0 +1,293 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/tidwall/evio"
+)
+
+// ConnState describes what a connection is currently doing.
+type ConnState uint32
+
+const (
+	// StateIdle means the connection has no buffered request data and is waiting for a new request.
+	StateIdle ConnState = iota
+	// StateReadingHeaders means part of a request has arrived, but the headers are not complete yet.
+	StateReadingHeaders
+	// StateReadingBody means the headers are complete and we are waiting for the rest of the body.
+	StateReadingBody
+	// StateWriting means a complete request is being handled and its response is being written.
+	StateWriting
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateIdle:
+		return "Idle"
+	case StateReadingHeaders:
+		return "ReadingHeaders"
+	case StateReadingBody:
+		return "ReadingBody"
+	case StateWriting:
+		return "Writing"
+	default:
+		return ""
+	}
+}
+
+// ConnInfo is a point in time copy of the metadata of an active connection.
+type ConnInfo struct {
+	LocalAddr    net.Addr
+	RemoteAddr   net.Addr
+	BytesRead    uint64
+	BytesWritten uint64
+	Requests     uint64
+	Idle         time.Duration
+	State        ConnState
+}
+
+// conn is the per connection state that is stored in the connection's context. It is created once in Opened,
+// and everything that belongs to a single request is cleared by reset between keep-alive requests, while the
+// connection level fields (addresses, counters and timestamps) live for as long as the connection does.
+// The counters are read by Handler.Connections from outside of the event loop, so they are only accessed atomically.
+type conn struct {
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	// wake triggers a Data event with no input on the connection's event loop.
+	wake func()
+	// handler is the handler of the Binding that the connection was accepted on, or nil for the engine's own port.
+	handler http.Handler
+	// custom is the context made by the ContextFactory, which holds the conn in the connection's context, if any.
+	custom ConnContext
+	// buffered is the total of the pending bytes across the connections of its loop, or nil when it isn't tracked.
+	buffered *int64
+	// upgrade holds the request that is answered once the connection has been upgraded to TLS, if any.
+	upgrade []byte
+	// serverName is the server name (SNI) that the client asked for when the connection was upgraded to TLS, if any.
+	serverName string
+	// requestID is the ID of the request being served, which fills the {{request_id}} placeholder of ErrorPages.
+	requestID string
+	// phases marks the phase boundaries of the request being served when its phases are timed.
+	phases phaseMarks
+	stream evio.InputStream
+	// readTimer, bodyTimer, lifetimeTimer and drainTimer are the entries of the connection in the Handler's timing wheel.
+	readTimer     wheelTimer
+	bodyTimer     wheelTimer
+	lifetimeTimer wheelTimer
+	drainTimer    wheelTimer
+	// spill holds the request whose body is being written to a temporary file, if any.
+	spill *spill
+	// rawRequest is reused for every request that is dispatched to a RawHandler, so that it is never allocated.
+	rawRequest   internalHttp.Request
+	bytesRead    uint64
+	bytesWritten uint64
+	requests     uint64
+	// lastActive is the unix nano timestamp of the last time data was read from or written to the connection.
+	lastActive int64
+	// openedAt is the unix nano timestamp of when the connection was opened.
+	openedAt int64
+	// requestStart is the unix nano timestamp of the first byte of the request currently being read,
+	// or zero when no request is being read.
+	requestStart int64
+	// bodyStart is the unix nano timestamp of when the headers of the request currently being read were completed,
+	// or zero when its headers aren't complete yet.
+	bodyStart int64
+	// readTimeout and bodyReadTimeout are the overrides of the ReadTimeout and BodyReadTimeout for the route of the
+	// request being read, or zero when they aren't overridden (see RouteTimeout).
+	readTimeout     int64
+	bodyReadTimeout int64
+	// pending is the amount of bytes of an incomplete request that are currently held in the stream.
+	pending int
+	// streamPeak is the most bytes that the stream has held since it was last replaced, which bounds the capacity of
+	// its buffer.
+	streamPeak int
+	// reads is the amount of reads that the request currently being read has arrived in so far.
+	reads int
+	// loop is the index of the event loop that the connection was assigned to when it is needed, or -1, see LoopIndex.
+	loop     int
+	state    uint32
+	timedOut uint32
+	// bodyTimedOut is set once the body of the request being read has outlived the BodyReadTimeout.
+	bodyTimedOut uint32
+	expired      uint32
+	evicted      uint32
+	draining     uint32
+	// expectChecked is set once the Expect header of the current request has been handled.
+	expectChecked bool
+	// tlsUpgradable is set for connections that can be upgraded to TLS (see upgradesToTLS), and tlsUpgraded once
+	// they have been.
+	tlsUpgradable bool
+	tlsUpgraded   bool
+	// proxied is set once the PROXY protocol header of the connection has been consumed (see WithProxyProtocol).
+	proxied bool
+}
+
+func newConn(c Conn, wake func()) *conn {
+	now := time.Now().UnixNano()
+	state := &conn{
+		localAddr:  c.LocalAddr(),
+		remoteAddr: c.RemoteAddr(),
+		wake:       wake,
+		loop:       -1,
+		lastActive: now,
+		openedAt:   now,
+	}
+	state.readTimer = wheelTimer{conn: state, kind: readTimer}
+	state.bodyTimer = wheelTimer{conn: state, kind: bodyTimer}
+	state.lifetimeTimer = wheelTimer{conn: state, kind: lifetimeTimer}
+	state.drainTimer = wheelTimer{conn: state, kind: drainTimer}
+	return state
+}
+
+func (c *conn) setState(state ConnState) {
+	atomic.StoreUint32(&c.state, uint32(state))
+}
+
+func (c *conn) read(n int) {
+	atomic.AddUint64(&c.bytesRead, uint64(n))
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+func (c *conn) wrote(n int) {
+	atomic.AddUint64(&c.bytesWritten, uint64(n))
+	atomic.AddUint64(&c.requests, 1)
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+// startRequest marks the beginning of a new request on the connection, within the read that is being handled.
+func (c *conn) startRequest() {
+	atomic.StoreInt64(&c.requestStart, time.Now().UnixNano())
+	c.reads = 1
+	c.expectChecked = false
+	c.requestID = ""
+}
+
+// readingSince returns how long the request currently being read has been in progress, or zero when there is none.
+func (c *conn) readingSince(now time.Time) time.Duration {
+	start := atomic.LoadInt64(&c.requestStart)
+	if start == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, start))
+}
+
+// markTimedOut flags the connection as timed out, and reports whether it wasn't already flagged.
+func (c *conn) markTimedOut() bool {
+	return atomic.CompareAndSwapUint32(&c.timedOut, 0, 1)
+}
+
+func (c *conn) isTimedOut() bool {
+	return atomic.LoadUint32(&c.timedOut) == 1
+}
+
+// startBody marks the completion of the headers of the request being read, and reports whether they weren't already
+// complete.
+func (c *conn) startBody() bool {
+	return atomic.CompareAndSwapInt64(&c.bodyStart, 0, time.Now().UnixNano())
+}
+
+// markBodyTimedOut flags the connection's request body as timed out, and reports whether it wasn't already flagged.
+func (c *conn) markBodyTimedOut() bool {
+	return atomic.CompareAndSwapUint32(&c.bodyTimedOut, 0, 1)
+}
+
+func (c *conn) isBodyTimedOut() bool {
+	return atomic.LoadUint32(&c.bodyTimedOut) == 1
+}
+
+// age returns how long the connection has been open.
+func (c *conn) age(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.openedAt))
+}
+
+// markExpired flags the connection as having outlived the MaxConnLifetime, and reports whether it wasn't already flagged.
+func (c *conn) markExpired() bool {
+	return atomic.CompareAndSwapUint32(&c.expired, 0, 1)
+}
+
+func (c *conn) isExpired() bool {
+	return atomic.LoadUint32(&c.expired) == 1
+}
+
+// markEvicted flags the connection as evicted to make room in the buffer budget, and reports whether it wasn't already flagged.
+func (c *conn) markEvicted() bool {
+	return atomic.CompareAndSwapUint32(&c.evicted, 0, 1)
+}
+
+func (c *conn) isEvicted() bool {
+	return atomic.LoadUint32(&c.evicted) == 1
+}
+
+// markDraining flags the connection as draining its last response, and reports whether it wasn't already flagged.
+func (c *conn) markDraining() bool {
+	return atomic.CompareAndSwapUint32(&c.draining, 0, 1)
+}
+
+func (c *conn) isDraining() bool {
+	return atomic.LoadUint32(&c.draining) == 1
+}
+
+// setPending updates the amount of bytes of an incomplete request that are held in the stream, keeping the
+// Handler's total up to date.
+func (c *conn) setPending(n int) {
+	if c.buffered != nil {
+		atomic.AddInt64(c.buffered, int64(n-c.pending))
+	}
+	c.pending = n
+}
+
+// maxRetainedStreamBytes is the buffer capacity from which the stream of a connection is replaced once the data that
+// it holds is much smaller, instead of being reused for the rest of the connection's life.
+const maxRetainedStreamBytes = 64 << 10
+
+// begin returns the data of the connection's incomplete request followed by the input.
+func (c *conn) begin(in []byte) []byte {
+	data := c.stream.Begin(in)
+	if len(data) > c.streamPeak {
+		c.streamPeak = len(data)
+	}
+	return data
+}
+
+// hold keeps the data of an incomplete request in the stream until the next read. The stream copies it to the front
+// of its buffer, so after a large request a connection that always has a small one in progress (like a client that
+// keeps pipelining) would pin the large buffer. It gets a buffer that fits the data instead.
+func (c *conn) hold(data []byte) {
+	if c.streamPeak > maxRetainedStreamBytes && len(data) <= c.streamPeak/4 {
+		c.stream = evio.InputStream{}
+		c.streamPeak = len(data)
+	}
+	c.stream.End(data)
+}
+
+// reset drops the buffered request data once a request has been handled, so that the next request starts empty.
+func (c *conn) reset() {
+	c.stream = evio.InputStream{}
+	c.streamPeak = 0
+	c.setPending(0)
+	c.reads = 0
+	c.expectChecked = false
+	c.requestID = ""
+	c.dropSpill()
+	atomic.StoreInt64(&c.requestStart, 0)
+	atomic.StoreInt64(&c.bodyStart, 0)
+	atomic.StoreInt64(&c.readTimeout, 0)
+	atomic.StoreInt64(&c.bodyReadTimeout, 0)
+	c.setState(StateIdle)
+}
+
+func (c *conn) info(now time.Time) ConnInfo {
+	return ConnInfo{
+		LocalAddr:    c.localAddr,
+		RemoteAddr:   c.remoteAddr,
+		BytesRead:    atomic.LoadUint64(&c.bytesRead),
+		BytesWritten: atomic.LoadUint64(&c.bytesWritten),
+		Requests:     atomic.LoadUint64(&c.requests),
+		Idle:         now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastActive))),
+		State:        ConnState(atomic.LoadUint32(&c.state)),
+	}
+}
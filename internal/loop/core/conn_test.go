@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/evio"
+)
+
+func TestConn_ResetBetweenKeepAliveRequests(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		frames           []string
+		expectedRequests uint64
+	}{
+		{
+			desc: "complete requests",
+			frames: []string{
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 1}",
+			},
+			expectedRequests: 2,
+		},
+		{
+			desc: "requests split across frames",
+			frames: []string{
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 10\r\n\r\n",
+				"{\"req\": 0}",
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\n",
+				"Content-Length: 10\r\n\r\n{\"req\"",
+				": 1}",
+			},
+			expectedRequests: 2,
+		},
+		{
+			desc: "pipelined requests",
+			frames: []string{
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 1}",
+			},
+			expectedRequests: 2,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			h.Opened(c, c.wake)
+			state := c.Context().(*conn)
+
+			for _, frame := range tC.frames {
+				if _, action := h.Data(c, []byte(frame)); action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+			}
+
+			if c.Context() != state {
+				subT.Fatal("connection state was replaced, want it to live as long as the connection")
+			}
+
+			// Nothing of the previous requests may leak into the next one
+			if state.pending != 0 {
+				subT.Errorf("pending = %d, want 0", state.pending)
+			}
+			if rest := state.stream.Begin(nil); len(rest) != 0 {
+				subT.Errorf("stream holds %q, want it empty", rest)
+			}
+			if state.expectChecked {
+				subT.Error("expectChecked is still set")
+			}
+			if state.requestStart != 0 {
+				subT.Errorf("requestStart = %d, want 0", state.requestStart)
+			}
+			if ConnState(state.state) != StateIdle {
+				subT.Errorf("state = %v, want %v", ConnState(state.state), StateIdle)
+			}
+
+			// While the connection level fields are kept
+			if state.requests != tC.expectedRequests {
+				subT.Errorf("requests = %d, want %d", state.requests, tC.expectedRequests)
+			}
+			if state.openedAt == 0 {
+				subT.Error("openedAt was cleared")
+			}
+		})
+	}
+}
+
+// streamCap returns the capacity of the stream's buffer, which evio doesn't expose.
+func streamCap(stream *evio.InputStream) int {
+	return reflect.ValueOf(stream).Elem().FieldByName("b").Cap()
+}
+
+func TestConn_StreamShrinksAfterLargeRequest(t *testing.T) {
+	h := newTestHandler()
+	c := newTestConn()
+	h.Opened(c, c.wake)
+	state := c.Context().(*conn)
+
+	small := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"
+	half := len(small) / 2
+
+	// The large request is followed by the beginning of a small one in its last frame, and every frame after that
+	// completes a small request and begins the next, so the stream is never empty
+	large := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4194304\r\n\r\n" + strings.Repeat("a", 4<<20)
+	payload := []byte(large + small[:half])
+	for len(payload) > 0 {
+		n := 64 << 10
+		if n > len(payload) {
+			n = len(payload)
+		}
+		if _, action := h.Data(c, payload[:n]); action != None {
+			t.Fatalf("Data() action = %v, want %v", action, None)
+		}
+		payload = payload[n:]
+	}
+
+	for i := 0; i < 1000; i++ {
+		out, action := h.Data(c, []byte(small[half:]+small[:half]))
+		if action != None || !bytes.HasPrefix(out, []byte("HTTP/1.1 200")) {
+			t.Fatalf("Data() = %q, %v, want a 200 and %v", out, action, None)
+		}
+	}
+
+	if got := streamCap(&state.stream); got > maxRetainedStreamBytes {
+		t.Errorf("stream capacity = %d bytes after the small requests, want at most %d", got, maxRetainedStreamBytes)
+	}
+	if state.pending != half {
+		t.Errorf("pending = %d, want %d", state.pending, half)
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// EventNilConnContext is logged when the ContextFactory returns a nil context for a new connection, which is then
+// served without a custom context.
+const EventNilConnContext = "conn.nil_context"
+
+// HTTPState is the per connection state that the Handler keeps in a connection's context. Custom connection contexts
+// made by a ContextFactory must embed it, which is what makes them implement ConnContext, and must not touch it.
+type HTTPState struct {
+	conn *conn
+}
+
+func (s *HTTPState) httpState() *HTTPState { return s }
+
+// ConnContext is a custom connection context. It can only be implemented by embedding HTTPState.
+type ConnContext interface {
+	httpState() *HTTPState
+}
+
+// ContextFactory makes the context of every new connection, letting applications attach their own per connection data
+// (e.g. an authenticated session) to it without a separate map keyed by connection. The context lives for as long as
+// the connection does, is the one returned by the engines' Conn.Context, and is handed to the http.Handler in every
+// request's context (see ConnContextFrom). It must return a new context on every call. When it returns nil instead,
+// the connection is served without a custom context, and an EventNilConnContext record is logged.
+type ContextFactory func() ConnContext
+
+type connContextKey struct{}
+
+// ConnContextFrom returns the custom context of the connection that a request arrived on, which the http.Handler can
+// assert back to its own type. It returns nil when there is no ContextFactory.
+func ConnContextFrom(ctx context.Context) ConnContext {
+	cc, _ := ctx.Value(connContextKey{}).(ConnContext)
+	return cc
+}
+
+// newConnContext makes the custom context of a new connection with the ContextFactory. It returns nil, and logs an
+// EventNilConnContext record, when the factory returns a nil context (or a nil pointer to one), which has no HTTPState
+// to hold the connection's state.
+func (h *Handler) newConnContext(state *conn) ConnContext {
+	custom := h.config.ContextFactory()
+	if custom != nil {
+		if v := reflect.ValueOf(custom); v.Kind() != reflect.Ptr || !v.IsNil() {
+			return custom
+		}
+	}
+
+	h.config.Logger.Log(EventNilConnContext, Fields{
+		"local":     state.localAddr.String(),
+		"remote":    state.remoteAddr.String(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	return nil
+}
+
+// connState returns the state that the Handler stored in the connection's context, whether it is the context itself
+// or held by a custom context.
+func connState(c Conn) (*conn, bool) {
+	switch ctx := c.Context().(type) {
+	case *conn:
+		return ctx, true
+	case ConnContext:
+		state := ctx.httpState().conn
+		return state, state != nil
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type sessionContext struct {
+	HTTPState
+	user     string
+	requests int
+}
+
+func TestHandler_ContextFactory(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := ConnContextFrom(r.Context()).(*sessionContext)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		session.requests++
+		if user := r.Header.Get("X-User"); user != "" {
+			session.user = user
+		}
+		w.Header().Set("X-Session", fmt.Sprintf("%s/%d", session.user, session.requests))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	h := NewHandler(context.Background(), handler, WithLogger(&recordingLogger{}), WithContextFactory(func() ConnContext {
+		return &sessionContext{}
+	}))
+	first, second := newTestConn(), newTestConn()
+	h.Opened(first, first.wake)
+	h.Opened(second, second.wake)
+
+	if _, ok := first.Context().(*sessionContext); !ok {
+		t.Fatalf("Context() = %T, want *sessionContext", first.Context())
+	}
+
+	testCases := []struct {
+		conn            *testConn
+		request         string
+		expectedSession string
+	}{
+		{conn: first, request: "GET /login HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-User: alice\r\n\r\n", expectedSession: "alice/1"},
+		{conn: first, request: "GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n", expectedSession: "alice/2"},
+		{conn: second, request: "GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n", expectedSession: "/1"},
+		{conn: first, request: "GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n", expectedSession: "alice/3"},
+	}
+	for i, tC := range testCases {
+		out, action := h.Data(tC.conn, []byte(tC.request))
+		if action != None {
+			t.Fatalf("request %d: Data() action = %v, want %v", i, action, None)
+		}
+
+		res := expectStatus(t, out, http.StatusOK)
+		if got := res.Header.Get("X-Session"); got != tC.expectedSession {
+			t.Errorf("request %d: X-Session = %q, want %q", i, got, tC.expectedSession)
+		}
+	}
+
+	h.Closed(first, nil)
+	if len(h.Connections()) != 1 {
+		t.Errorf("Connections() = %d connections, want 1", len(h.Connections()))
+	}
+}
+
+func TestHandler_ContextFactoryNil(t *testing.T) {
+	testCases := []struct {
+		factory ContextFactory
+		desc    string
+	}{
+		{
+			desc:    "nil context",
+			factory: func() ConnContext { return nil },
+		},
+		{
+			desc:    "nil pointer to a context",
+			factory: func() ConnContext { return (*sessionContext)(nil) },
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			logger := &recordingLogger{}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ConnContextFrom(r.Context()) != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			})
+			h := NewHandler(context.Background(), handler, WithLogger(logger), WithContextFactory(tC.factory))
+			c := newTestConn()
+
+			// The connection is served with the Handler's own state instead
+			if action := h.Opened(c, c.wake); action != None {
+				subT.Fatalf("Opened() = %v, want %v", action, None)
+			}
+			out, action := h.Data(c, []byte("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+			expectStatus(subT, out, http.StatusOK)
+
+			if records := logger.events(EventNilConnContext); len(records) != 1 {
+				subT.Errorf("%d %s records, want 1", len(records), EventNilConnContext)
+			}
+			h.Closed(c, nil)
+		})
+	}
+}
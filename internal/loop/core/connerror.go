@@ -0,0 +1,80 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// ConnErrorCategory is a coarse classification of the errors that connections are closed with.
+type ConnErrorCategory int
+
+const (
+	// ConnErrorOther is any error that doesn't fit one of the more specific categories.
+	ConnErrorOther ConnErrorCategory = iota
+	// ConnErrorReset is a connection that was reset by the peer (ECONNRESET).
+	ConnErrorReset
+	// ConnErrorBrokenPipe is a write to a connection that the peer has already closed (EPIPE).
+	ConnErrorBrokenPipe
+	// ConnErrorTimeout is a read or write that hit a deadline.
+	ConnErrorTimeout
+	// ConnErrorEOF is a connection that was closed in the middle of a read.
+	ConnErrorEOF
+	// ConnErrorClosed is an operation on a connection that was already closed locally.
+	ConnErrorClosed
+)
+
+func (c ConnErrorCategory) String() string {
+	switch c {
+	case ConnErrorReset:
+		return "reset"
+	case ConnErrorBrokenPipe:
+		return "broken_pipe"
+	case ConnErrorTimeout:
+		return "timeout"
+	case ConnErrorEOF:
+		return "eof"
+	case ConnErrorClosed:
+		return "closed"
+	default:
+		return "other"
+	}
+}
+
+// ConnError is the error that is passed to the ConnErrorHandler. It wraps the original
+// error, so errors.Is and errors.As keep working on it.
+type ConnError struct {
+	Err      error
+	Category ConnErrorCategory
+}
+
+func (e *ConnError) Error() string {
+	return e.Category.String() + ": " + e.Err.Error()
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// ConnErrorHandler is called with the remote address of a connection and a *ConnError whenever a connection is closed with an error.
+type ConnErrorHandler func(remote net.Addr, err error)
+
+// ClassifyConnError returns the category of an error that a connection was closed with.
+func ClassifyConnError(err error) ConnErrorCategory {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNRESET):
+		return ConnErrorReset
+	case errors.Is(err, syscall.EPIPE):
+		return ConnErrorBrokenPipe
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ConnErrorEOF
+	case errors.Is(err, net.ErrClosed):
+		return ConnErrorClosed
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ConnErrorTimeout
+	default:
+		return ConnErrorOther
+	}
+}
@@ -0,0 +1,103 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyConnError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		desc     string
+		expected ConnErrorCategory
+	}{
+		{desc: "reset", err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, expected: ConnErrorReset},
+		{desc: "broken pipe", err: &net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)}, expected: ConnErrorBrokenPipe},
+		{desc: "timeout", err: &net.OpError{Op: "read", Err: timeoutError{}}, expected: ConnErrorTimeout},
+		{desc: "unexpected eof", err: fmt.Errorf("reading: %w", io.ErrUnexpectedEOF), expected: ConnErrorEOF},
+		{desc: "closed", err: &net.OpError{Op: "read", Err: net.ErrClosed}, expected: ConnErrorClosed},
+		{desc: "other", err: errors.New("something else"), expected: ConnErrorOther},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := ClassifyConnError(tC.err); got != tC.expected {
+				subT.Errorf("ClassifyConnError() = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestHandler_ConnErrorHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer client.Close()
+
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("unable to accept: %v", err)
+	}
+
+	type connError struct {
+		remote net.Addr
+		err    error
+	}
+	errs := make(chan connError, 1)
+	onError := func(remote net.Addr, err error) {
+		errs <- connError{remote: remote, err: err}
+	}
+
+	go ServeConn(context.Background(), server, http.HandlerFunc(internalHttp.Echo), WithLogger(&recordingLogger{}), WithConnErrorHandler(onError))
+
+	// Closing with a zero linger forcibly resets the connection
+	if err := ApplyLinger(client, 0); err != nil {
+		t.Fatalf("ApplyLinger() error = %v", err)
+	}
+	client.Close()
+
+	select {
+	case got := <-errs:
+		if got.remote.String() != client.LocalAddr().String() {
+			t.Errorf("remote = %v, want %v", got.remote, client.LocalAddr())
+		}
+
+		var connErr *ConnError
+		if !errors.As(got.err, &connErr) {
+			t.Fatalf("error %v is not a *ConnError", got.err)
+		}
+		if connErr.Category != ConnErrorReset {
+			t.Errorf("category = %v, want %v", connErr.Category, ConnErrorReset)
+		}
+		if !errors.Is(got.err, syscall.ECONNRESET) {
+			t.Errorf("error %v doesn't wrap ECONNRESET", got.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the ConnErrorHandler wasn't called for a reset connection")
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// CORS configures the Cross-Origin Resource Sharing headers of the routes under Paths.
+type CORS struct {
+	// Paths are the path prefixes that CORS is enabled for. When empty, it is enabled for every path.
+	Paths []string
+	// AllowedOrigins are the origins that may access the routes. A "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods are the methods that preflight requests may ask for. GET, HEAD and POST are always allowed.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers that preflight requests may ask for.
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache the result of a preflight request. Zero omits the header.
+	MaxAge time.Duration
+}
+
+// applies reports whether CORS is enabled for the path.
+func (cors *CORS) applies(path string) bool {
+	if len(cors.Paths) == 0 {
+		return true
+	}
+
+	for _, prefix := range cors.Paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsOrigin reports whether the origin may access the routes.
+func (cors *CORS) allowsOrigin(origin string) bool {
+	for _, allowed := range cors.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether preflight requests may ask for the method.
+func (cors *CORS) allowsMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		return true
+	}
+
+	for _, allowed := range cors.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether preflight requests may ask for all of the comma separated headers.
+func (cors *CORS) allowsHeaders(headers string) bool {
+	for _, header := range strings.Split(headers, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+
+		allowed := false
+		for _, h := range cors.AllowedHeaders {
+			if strings.EqualFold(h, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// isPreflight reports whether the request is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// handleCORS adds the CORS headers to the response of a request on a CORS enabled route. Preflight requests are
+// answered entirely here, since the handler usually doesn't implement OPTIONS, in which case it reports true
+// and the request must not be dispatched to the handler.
+func (h *Handler) handleCORS(req *http.Request, res *internalHttp.ResponseWriter) bool {
+	cors := h.config.CORS
+	if !cors.applies(req.URL.Path) {
+		return false
+	}
+
+	origin := req.Header.Get("Origin")
+	preflight := isPreflight(req)
+	if origin == "" || !cors.allowsOrigin(origin) {
+		if preflight {
+			res.WriteHeader(http.StatusForbidden)
+		}
+		return preflight
+	}
+
+	res.Header().Set("Access-Control-Allow-Origin", origin)
+	internalHttp.AddVary(res.Header(), "Origin")
+	if !preflight {
+		return false
+	}
+
+	method := req.Header.Get("Access-Control-Request-Method")
+	headers := req.Header.Get("Access-Control-Request-Headers")
+	if !cors.allowsMethod(method) || !cors.allowsHeaders(headers) {
+		res.WriteHeader(http.StatusForbidden)
+		return true
+	}
+
+	res.Header().Set("Access-Control-Allow-Methods", method)
+	if headers != "" {
+		res.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	if cors.MaxAge > 0 {
+		res.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge/time.Second)))
+	}
+	res.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_CORS(t *testing.T) {
+	cors := CORS{
+		Paths:          []string{"/api/"},
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{http.MethodPut},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         time.Hour,
+	}
+
+	testCases := []struct {
+		expectedHeaders map[string]string
+		desc            string
+		request         string
+		expectedStatus  int
+		expectedHandled bool
+	}{
+		{
+			desc:            "valid preflight is short circuited",
+			request:         "OPTIONS /api/items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nOrigin: https://example.com\r\nAccess-Control-Request-Method: PUT\r\nAccess-Control-Request-Headers: content-type\r\n\r\n",
+			expectedStatus:  http.StatusNoContent,
+			expectedHandled: false,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://example.com",
+				"Access-Control-Allow-Methods": "PUT",
+				"Access-Control-Allow-Headers": "content-type",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+		{
+			desc:            "preflight from a disallowed origin",
+			request:         "OPTIONS /api/items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nOrigin: https://evil.com\r\nAccess-Control-Request-Method: PUT\r\n\r\n",
+			expectedStatus:  http.StatusForbidden,
+			expectedHandled: false,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			desc:            "preflight for a disallowed method",
+			request:         "OPTIONS /api/items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nOrigin: https://example.com\r\nAccess-Control-Request-Method: DELETE\r\n\r\n",
+			expectedStatus:  http.StatusForbidden,
+			expectedHandled: false,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			desc:            "preflight outside of the CORS routes",
+			request:         "OPTIONS /other HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nOrigin: https://example.com\r\nAccess-Control-Request-Method: PUT\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: true,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			desc:            "actual request from an allowed origin",
+			request:         "GET /api/items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nOrigin: https://example.com\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: true,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Vary": "Origin"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			handled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				internalHttp.Echo(w, r)
+			})
+			h := NewHandler(context.Background(), handler, WithCORS(cors))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			if handled != tC.expectedHandled {
+				subT.Errorf("handler invoked = %v, want %v", handled, tC.expectedHandled)
+			}
+
+			for header, expected := range tC.expectedHeaders {
+				if got := res.Header.Get(header); got != expected {
+					subT.Errorf("%s = %q, want %q", header, got, expected)
+				}
+			}
+		})
+	}
+}
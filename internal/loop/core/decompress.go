@@ -0,0 +1,49 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+// decompressBody transparently replaces a gzip encoded request body with its decompressed contents.
+// When MaxBodyBytes is set, the decompressed body is capped at it, so that a small compressed payload can't be used to
+// blow up the memory of the server. A non zero status code is returned when the body should be rejected.
+func (h *Handler) decompressBody(req *http.Request) int {
+	encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "x-gzip" {
+		return 0
+	}
+
+	gz, err := gzip.NewReader(req.Body)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	defer gz.Close()
+
+	var r io.Reader = gz
+	if h.config.MaxBodyBytes > 0 {
+		// Read one byte past the limit so that we can tell a body that is exactly at the limit from one that is over it.
+		r = io.LimitReader(gz, h.config.MaxBodyBytes+1)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+
+	if h.config.MaxBodyBytes > 0 && int64(len(body)) > h.config.MaxBodyBytes {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	req.Header.Del("Content-Encoding")
+	return 0
+}
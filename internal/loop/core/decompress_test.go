@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer(nil)
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatalf("unable to gzip data: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("unable to gzip data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandler_RequestDecompression(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		body           []byte
+		expectedBody   []byte
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "gzip body is decompressed",
+			body:           gzipBytes(t, []byte(`{"req": 0}`)),
+			opts:           []Option{WithRequestDecompression()},
+			expectedStatus: http.StatusOK,
+			expectedBody:   []byte(`{"req": 0}`),
+		},
+		{
+			desc:           "gzip body is left alone without the option",
+			body:           gzipBytes(t, []byte(`{"req": 0}`)),
+			expectedStatus: http.StatusOK,
+			expectedBody:   gzipBytes(t, []byte(`{"req": 0}`)),
+		},
+		{
+			desc:           "invalid gzip body",
+			body:           []byte(`{"req": 0}`),
+			opts:           []Option{WithRequestDecompression()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "decompression bomb",
+			body:           gzipBytes(t, make([]byte, 1<<20)),
+			opts:           []Option{WithRequestDecompression(), WithMaxBodyBytes(64 << 10)},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			desc:           "large body without a limit",
+			body:           gzipBytes(t, make([]byte, 1<<20)),
+			opts:           []Option{WithRequestDecompression()},
+			expectedStatus: http.StatusOK,
+			expectedBody:   make([]byte, 1<<20),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			req := fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", len(tC.body), tC.body)
+			out, _ := h.Data(c, []byte(req))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Fatalf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			if tC.expectedBody == nil {
+				return
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if !bytes.Equal(body, tC.expectedBody) {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
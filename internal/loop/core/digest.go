@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+// Digest describes a request header carrying a base64 encoded digest of the request body.
+type Digest struct {
+	// New creates the hash that the digest is computed with.
+	New func() hash.Hash
+	// Header is the name of the request header holding the digest.
+	Header string
+	// Prefix is an optional (case insensitive) prefix that the header value must start with for this
+	// digest to apply, for headers that may carry several algorithms (e.g. "SHA-256=" in a Digest header).
+	Prefix string
+}
+
+// ContentMD5 validates the Content-MD5 header as defined in RFC 1864.
+var ContentMD5 = Digest{
+	Header: "Content-MD5",
+	New:    md5.New,
+}
+
+// expected returns the digest that the request declares for this algorithm, if any.
+func (d Digest) expected(req *http.Request) (string, bool) {
+	value := strings.TrimSpace(req.Header.Get(d.Header))
+	if value == "" {
+		return "", false
+	}
+
+	if d.Prefix == "" {
+		return value, true
+	}
+
+	if len(value) < len(d.Prefix) || !strings.EqualFold(value[:len(d.Prefix)], d.Prefix) {
+		return "", false
+	}
+	return value[len(d.Prefix):], true
+}
+
+// validateDigests checks the request body against every configured digest that the request declares.
+// The digests are computed over the body as it was sent, so this must run before any decompression.
+// A non zero status code is returned when the body should be rejected.
+func (h *Handler) validateDigests(req *http.Request) int {
+	var body []byte
+	read := false
+	for _, digest := range h.config.Digests {
+		expected, ok := digest.expected(req)
+		if !ok {
+			continue
+		}
+
+		if !read {
+			var err error
+			body, err = ioutil.ReadAll(req.Body)
+			if err != nil {
+				return http.StatusBadRequest
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			read = true
+		}
+
+		hash := digest.New()
+		hash.Write(body)
+		if base64.StdEncoding.EncodeToString(hash.Sum(nil)) != expected {
+			return http.StatusBadRequest
+		}
+	}
+
+	return 0
+}
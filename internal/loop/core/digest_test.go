@@ -0,0 +1,80 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+var digestSHA256 = Digest{
+	Header: "Digest",
+	Prefix: "SHA-256=",
+	New:    sha256.New,
+}
+
+func TestHandler_DigestValidation(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		header         string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "matching Content-MD5",
+			header:         "Content-MD5: X8FaE8mr95uic2tu7nD/Yg==",
+			opts:           []Option{WithDigestValidation(ContentMD5)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "mismatching Content-MD5",
+			header:         "Content-MD5: 1B2M2Y8AsgTpgAmY7PhCfg==",
+			opts:           []Option{WithDigestValidation(ContentMD5)},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "mismatching Content-MD5 without validation",
+			header:         "Content-MD5: 1B2M2Y8AsgTpgAmY7PhCfg==",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "no declared digest",
+			header:         "X-Nothing: here",
+			opts:           []Option{WithDigestValidation(ContentMD5)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "matching custom SHA-256 digest",
+			header:         "Digest: sha-256=45Vu9QfJUfpVEU6jFthyVkW7+yVHTzSvSKy0xLMNVz0=",
+			opts:           []Option{WithDigestValidation(ContentMD5, digestSHA256)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "mismatching custom SHA-256 digest",
+			header:         "Digest: SHA-256=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			opts:           []Option{WithDigestValidation(ContentMD5, digestSHA256)},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			body := `{"req": 0}`
+			req := fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n%s\r\nContent-Length: %d\r\n\r\n%s", tC.header, len(body), body)
+			out, _ := h.Data(c, []byte(req))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package core
+
+// DispatchModel decides which goroutine runs the handler of a connection's requests on the gnet engine. A handler
+// that runs on an event loop holds up every other connection of the loop until it returns, so handlers that block
+// should run off the loops. evio can't write to a connection from outside of its event loop, so it (like ServeConn)
+// always runs them inline.
+type DispatchModel int
+
+const (
+	// DispatchInline runs the handler on the event loop that read the request.
+	DispatchInline DispatchModel = iota
+	// DispatchWorkerPool runs the handlers on a pool of WorkerPoolSize goroutines shared by all connections.
+	DispatchWorkerPool
+	// DispatchGoroutinePerConn runs the handlers on a goroutine of the connection's own.
+	DispatchGoroutinePerConn
+)
+
+func (m DispatchModel) String() string {
+	switch m {
+	case DispatchInline:
+		return "Inline"
+	case DispatchWorkerPool:
+		return "WorkerPool"
+	case DispatchGoroutinePerConn:
+		return "GoroutinePerConn"
+	default:
+		return ""
+	}
+}
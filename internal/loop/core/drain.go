@@ -0,0 +1,25 @@
+package core
+
+import "time"
+
+// DrainThreshold is the size from which a response that closes its connection may not fit in the socket's buffers in
+// a single write when the client reads it slowly. Smaller responses are always absorbed by the kernel right away.
+const DrainThreshold = 64 << 10
+
+// drainTimeout is how long a draining connection waits for the client to hang up before it is closed anyway.
+const drainTimeout = 5 * time.Second
+
+// Drain keeps a connection open after a response that should have closed it, for engines that can't wait for a
+// response to be written before closing its connection: gnet writes whatever the socket takes right away and buffers
+// the rest, but when the connection is closed it only makes a single attempt at flushing that buffer, dropping the end
+// of large responses to clients that read slowly. A draining connection ignores any further input, and is closed
+// when the client hangs up after reading the response, or once the drainTimeout passes.
+func (h *Handler) Drain(c Conn) {
+	state, ok := connState(c)
+	if !ok || !state.markDraining() {
+		return
+	}
+
+	state.drainTimer.arm()
+	h.timers.schedule(&state.drainTimer, time.Now().Add(drainTimeout).UnixNano())
+}
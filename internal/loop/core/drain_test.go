@@ -0,0 +1,37 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandler_Drain(t *testing.T) {
+	h := newTestHandler(WithMaxConnLifetime(time.Nanosecond))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	if _, action := h.Data(c, []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n")); action != Close {
+		t.Fatalf("Data() action = %v, want %v", action, Close)
+	}
+	h.Drain(c)
+
+	// Input that follows the closing response is ignored
+	if out, action := h.Data(c, []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n")); len(out) > 0 || action != None {
+		t.Errorf("Data() = %q, %v, want no response and %v", out, action, None)
+	}
+
+	// The lifetime has passed, but only the drain may close the connection
+	h.reap(time.Now().Add(time.Second))
+	if c.woken != 0 {
+		t.Fatalf("connection woken %d times before the drain timeout, want 0", c.woken)
+	}
+
+	h.reap(time.Now().Add(drainTimeout + time.Second))
+	if c.woken != 1 {
+		t.Fatalf("connection woken %d times after the drain timeout, want 1", c.woken)
+	}
+
+	if out, action := h.Data(c, nil); len(out) > 0 || action != Close {
+		t.Errorf("Data() = %q, %v, want no response and %v", out, action, Close)
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// RequestIDHeader is the header that the {{request_id}} placeholder of an ErrorPage is filled from. The response's
+// header is used when the handler (or a middleware) set one, and the request's otherwise.
+const RequestIDHeader = "X-Request-Id"
+
+// ErrorPage is the template of the body of the error responses with a status code, see WithErrorPage.
+type ErrorPage struct {
+	// ContentType is the Content-Type of the rendered body, e.g. text/html; charset=utf-8.
+	ContentType string
+	// Template is the body, in which {{status}}, {{reason}} and {{request_id}} are replaced with the status code, its
+	// reason phrase and the ID of the request (see RequestIDHeader).
+	Template string
+}
+
+// render returns the body of the page for a response with the status to the request with the ID. The ID comes from
+// the client, so it is escaped in HTML pages.
+func (p ErrorPage) render(status int, requestID string) []byte {
+	if strings.Contains(p.ContentType, "html") {
+		requestID = html.EscapeString(requestID)
+	}
+
+	r := strings.NewReplacer("{{status}}", strconv.Itoa(status), "{{reason}}", http.StatusText(status), "{{request_id}}", requestID)
+	return []byte(r.Replace(p.Template))
+}
+
+// errorBody sets the Content-Type in the header of a response with the status, and returns its body, which is the
+// ErrorPage of the status when there is one, or the fallback as plain text.
+func (h *Handler) errorBody(state *conn, header http.Header, status int, fallback string) []byte {
+	page, ok := h.config.ErrorPages[status]
+	if !ok {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		return []byte(fallback)
+	}
+
+	requestID := header.Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = state.requestID
+	}
+	header.Set("Content-Type", page.ContentType)
+	return page.render(status, requestID)
+}
+
+// applyErrorPage gives the response that a handler returned without a body the ErrorPage of its status, if there is
+// one, so that handlers only need to write the status of an error for it to be answered with the page.
+func (h *Handler) applyErrorPage(state *conn, res *internalHttp.ResponseWriter) {
+	if len(res.Bytes()) > 0 {
+		return
+	}
+	if _, ok := h.config.ErrorPages[res.StatusCode]; !ok {
+		return
+	}
+
+	res.Header().Del("Content-Length")
+	res.SetBody(h.errorBody(state, res.Header(), res.StatusCode, ""))
+}
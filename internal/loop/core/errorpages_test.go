@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_ErrorPages(t *testing.T) {
+	pages := []Option{
+		WithErrorPage(http.StatusNotFound, "text/html; charset=utf-8", "<h1>{{status}} {{reason}}</h1><p>Request {{request_id}}</p>"),
+		WithErrorPage(http.StatusBadRequest, "", "{{status}} {{reason}} ({{request_id}})"),
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/traced":
+			w.Header().Set(RequestIDHeader, "from-the-handler")
+			w.WriteHeader(http.StatusNotFound)
+		case "/custom":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("no such item"))
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	testCases := []struct {
+		handler        http.Handler
+		desc           string
+		request        string
+		expectedType   string
+		expectedBody   string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "handler without a body",
+			handler:        handler,
+			request:        "GET /missing HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Request-Id: abc-123\r\n\r\n",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "text/html; charset=utf-8",
+			expectedBody:   "<h1>404 Not Found</h1><p>Request abc-123</p>",
+		},
+		{
+			desc:           "request ID escaped in HTML",
+			handler:        handler,
+			request:        "GET /missing HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Request-Id: <script>\r\n\r\n",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "text/html; charset=utf-8",
+			expectedBody:   "<h1>404 Not Found</h1><p>Request &lt;script&gt;</p>",
+		},
+		{
+			desc:           "request ID of the response",
+			handler:        handler,
+			request:        "GET /traced HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Request-Id: abc-123\r\n\r\n",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "text/html; charset=utf-8",
+			expectedBody:   "<h1>404 Not Found</h1><p>Request from-the-handler</p>",
+		},
+		{
+			desc:           "handler with a body of its own",
+			handler:        handler,
+			request:        "GET /custom HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "text/plain; charset=utf-8",
+			expectedBody:   "no such item",
+		},
+		{
+			desc:           "status without a page",
+			handler:        handler,
+			request:        "GET /broken HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "",
+		},
+		{
+			desc:           "default handler",
+			request:        "GET /missing HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "text/html; charset=utf-8",
+			expectedBody:   "<h1>404 Not Found</h1><p>Request </p>",
+		},
+		{
+			desc:           "raw handler without a body",
+			request:        "GET /missing HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Request-Id: abc-123\r\n\r\n",
+			opts:           []Option{WithRawHandler(raw)},
+			expectedStatus: http.StatusNotFound,
+			expectedType:   "text/html; charset=utf-8",
+			expectedBody:   "<h1>404 Not Found</h1><p>Request abc-123</p>",
+		},
+		{
+			desc:           "request rejected by the Handler",
+			handler:        handler,
+			request:        "GET /files/%00 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Request-Id: abc-123\r\n\r\n",
+			opts:           []Option{WithRejectEncodedNull()},
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "text/plain; charset=utf-8",
+			expectedBody:   "400 Bad Request (abc-123)",
+		},
+		{
+			desc:           "malformed request",
+			handler:        handler,
+			request:        "GET /missing HTTP/1.1\r\nHost 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   "text/plain; charset=utf-8",
+			expectedBody:   "400 Bad Request ()",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), tC.handler, append(append([]Option(nil), pages...), tC.opts...)...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res := expectStatus(subT, out, tC.expectedStatus)
+			if got := res.Header.Get("Content-Type"); tC.expectedType != "" && got != tC.expectedType {
+				subT.Errorf("Content-Type = %q, want %q", got, tC.expectedType)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// bodyETag returns a strong ETag for a response body, which is the hex encoded first half of its SHA-256 hash.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag. RFC 7232 section 3.2 compares them with the
+// weak comparison, so a W/ prefix on either side is ignored.
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// applyETag gives a 200 response to a GET or HEAD request that doesn't have an ETag of its own one computed from its
+// body, see WithETags, and replaces the response with a 304 Not Modified when the request's If-None-Match matches it.
+// It must run before ranges are applied, so that the ETag is always that of the whole body.
+func (h *Handler) applyETag(method, ifNoneMatch string, res *internalHttp.ResponseWriter) {
+	if method != http.MethodGet && method != http.MethodHead {
+		return
+	}
+	if res.StatusCode != 0 && res.StatusCode != http.StatusOK {
+		return
+	}
+
+	header := res.Header()
+	etag := header.Get("ETag")
+	if etag == "" {
+		etag = bodyETag(res.Bytes())
+		header.Set("ETag", etag)
+	}
+
+	if ifNoneMatch == "" || !etagMatches(ifNoneMatch, etag) {
+		return
+	}
+	header.Del("Content-Length")
+	res.SetBody(nil)
+	res.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_ETags(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tagged":
+			w.Header().Set("ETag", `"v1"`)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte("hello from " + r.URL.Path))
+	})
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		_, _ = w.Write([]byte("hello from the raw handler"))
+	})
+
+	testCases := []struct {
+		ifNoneMatch    func(etag string) string
+		desc           string
+		method         string
+		path           string
+		expectedETag   string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "matching ETag",
+			method:         http.MethodGet,
+			path:           "/page",
+			ifNoneMatch:    func(etag string) string { return etag },
+			expectedETag:   bodyETag([]byte("hello from /page")),
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			desc:           "matching weak ETag in a list",
+			method:         http.MethodGet,
+			path:           "/page",
+			ifNoneMatch:    func(etag string) string { return `"other", W/` + etag },
+			expectedETag:   bodyETag([]byte("hello from /page")),
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			desc:           "any ETag",
+			method:         http.MethodHead,
+			path:           "/page",
+			ifNoneMatch:    func(etag string) string { return "*" },
+			expectedETag:   bodyETag([]byte("hello from /page")),
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			desc:           "stale ETag",
+			method:         http.MethodGet,
+			path:           "/page",
+			ifNoneMatch:    func(etag string) string { return `"stale"` },
+			expectedETag:   bodyETag([]byte("hello from /page")),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "handler's own ETag",
+			method:         http.MethodGet,
+			path:           "/tagged",
+			ifNoneMatch:    func(etag string) string { return etag },
+			expectedETag:   `"v1"`,
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			desc:           "error response",
+			method:         http.MethodGet,
+			path:           "/missing",
+			ifNoneMatch:    func(etag string) string { return "*" },
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			desc:           "POST request",
+			method:         http.MethodPost,
+			path:           "/page",
+			ifNoneMatch:    func(etag string) string { return "*" },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "raw handler",
+			method:         http.MethodGet,
+			path:           "/page",
+			opts:           []Option{WithRawHandler(raw)},
+			ifNoneMatch:    func(etag string) string { return etag },
+			expectedETag:   bodyETag([]byte("hello from the raw handler")),
+			expectedStatus: http.StatusNotModified,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), handler, append([]Option{WithETags()}, tC.opts...)...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			request := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n", tC.method, tC.path)
+			out, _ := h.Data(c, []byte(request+"\r\n"))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), &http.Request{Method: tC.method})
+			if err != nil {
+				subT.Fatalf("unable to read the first response %q: %v", out, err)
+			}
+			etag := res.Header.Get("ETag")
+			if etag != tC.expectedETag {
+				subT.Errorf("first response ETag = %q, want %q", etag, tC.expectedETag)
+			}
+
+			out, _ = h.Data(c, []byte(request+"If-None-Match: "+tC.ifNoneMatch(etag)+"\r\n\r\n"))
+			res, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), &http.Request{Method: tC.method})
+			if err != nil {
+				subT.Fatalf("unable to read the second response %q: %v", out, err)
+			}
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("second response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+			if got := res.Header.Get("ETag"); got != tC.expectedETag {
+				subT.Errorf("second response ETag = %q, want %q", got, tC.expectedETag)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read the second response body: %v", err)
+			}
+			if tC.expectedStatus == http.StatusNotModified && (len(body) > 0 || res.ContentLength > 0) {
+				subT.Errorf("304 response has a body %q (Content-Length %d)", body, res.ContentLength)
+			}
+		})
+	}
+}
+
+func TestHandler_ETagsDisabled(t *testing.T) {
+	h := newTestHandler()
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, _ := h.Data(c, []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nIf-None-Match: *\r\n\r\n"))
+	res := expectStatus(t, out, http.StatusOK)
+	if etag := res.Header.Get("ETag"); etag != "" {
+		t.Errorf("ETag = %q, want none", etag)
+	}
+}
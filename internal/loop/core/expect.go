@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventInvalidExpectationStatus is logged when the ExpectationChecker rejects a request with a status that isn't an
+// error, which is answered with a 417 Expectation Failed instead.
+const EventInvalidExpectationStatus = "request.invalid_expectation_status"
+
+var continueResponse = []byte("HTTP/1.1 100 Continue\r\n\r\n")
+
+// ExpectationChecker decides whether the body of a request sent with Expect: 100-continue should be accepted.
+// It is called with the request's headers before the body has arrived, so the request's Body must not be read.
+// It returns zero to accept the body, or the status code of the final response to reject the request with.
+type ExpectationChecker func(req *http.Request) int
+
+// expectContinue is called once the headers of a request have arrived without the entire body.
+// If the client is waiting for a 100 Continue before sending the body, we only send it once we know that the
+// body will be accepted. Otherwise we skip it, send the final response right away, and close the connection,
+// since we can't know whether the client will go on to send the body anyway. Requests with a Content-Length of zero
+// are complete along with their headers, so they are dispatched right away without ever getting here.
+func (h *Handler) expectContinue(state *conn, headers []byte) ([]byte, Action) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(headers)))
+	if err != nil {
+		// The request will be rejected properly once it is complete
+		return nil, None
+	}
+
+	if unsupportedExpectation(req) {
+		return h.respondError(state, h.newResponseWriter(req.ProtoMajor, req.ProtoMinor), http.StatusExpectationFailed)
+	}
+
+	if !strings.EqualFold(req.Header.Get("Expect"), "100-continue") || !req.ProtoAtLeast(1, 1) {
+		return nil, None
+	}
+
+	status := 0
+	if h.config.MaxBodyBytes > 0 && req.ContentLength > h.config.MaxBodyBytes {
+		status = http.StatusRequestEntityTooLarge
+	} else if h.config.ExpectationChecker != nil {
+		status = h.config.ExpectationChecker(req)
+	}
+
+	if status == 0 || status == http.StatusContinue {
+		return continueResponse, None
+	}
+
+	if status < 400 {
+		h.config.Logger.Log(EventInvalidExpectationStatus, Fields{
+			"method":    req.Method,
+			"target":    req.RequestURI,
+			"status":    status,
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		status = http.StatusExpectationFailed
+	}
+	return h.respondError(state, h.newResponseWriter(req.ProtoMajor, req.ProtoMinor), status)
+}
+
+// unsupportedExpectation reports whether the request has an Expect header with a value other than 100-continue,
+// which is the only expectation defined by RFC 7231 section 5.1.1, and must be answered with a 417.
+// Like 100-continue, expectations in HTTP/1.0 requests are ignored.
+func unsupportedExpectation(req *http.Request) bool {
+	expect := req.Header.Get("Expect")
+	return expect != "" && !strings.EqualFold(expect, "100-continue") && req.ProtoAtLeast(1, 1)
+}
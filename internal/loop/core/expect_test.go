@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_ExpectContinue(t *testing.T) {
+	testCases := []struct {
+		checker        ExpectationChecker
+		desc           string
+		headers        string
+		expectedBody   string
+		opts           []Option
+		expectedStatus int
+		expectContinue bool
+	}{
+		{
+			desc:           "accepted body",
+			headers:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 10\r\n\r\n",
+			checker:        func(req *http.Request) int { return 0 },
+			expectContinue: true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"req": 0}`,
+		},
+		{
+			desc:           "accepted body without a checker",
+			headers:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 10\r\n\r\n",
+			expectContinue: true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"req": 0}`,
+		},
+		{
+			desc:           "rejected by the checker",
+			headers:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 10\r\n\r\n",
+			checker:        func(req *http.Request) int { return http.StatusUnauthorized },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:           "rejected for being too large",
+			headers:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 10\r\n\r\n",
+			checker:        func(req *http.Request) int { return 0 },
+			opts:           []Option{WithMaxBodyBytes(5)},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			desc:           "unknown expectation",
+			headers:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: foo\r\nContent-Length: 10\r\n\r\n",
+			checker:        func(req *http.Request) int { return 0 },
+			expectedStatus: http.StatusExpectationFailed,
+		},
+		{
+			desc:           "no expectation",
+			headers:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n",
+			checker:        func(req *http.Request) int { return http.StatusUnauthorized },
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"req": 0}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(append(tC.opts, WithExpectationChecker(tC.checker))...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.headers))
+			if bytes.Equal(out, continueResponse) != tC.expectContinue {
+				subT.Fatalf("Data() wrote %q after the headers, want 100 Continue %v", out, tC.expectContinue)
+			}
+
+			if tC.expectedBody == "" {
+				if action != Close {
+					subT.Errorf("Data() action = %v, want %v", action, Close)
+				}
+			} else {
+				if action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+				out, _ = h.Data(c, []byte(`{"req": 0}`))
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			if tC.expectedBody == "" {
+				return
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandler_ExpectationCheckerNonErrorStatus(t *testing.T) {
+	logger := &recordingLogger{}
+	h := newTestHandler(WithLogger(logger), WithExpectationChecker(func(req *http.Request) int { return http.StatusFound }))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, action := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 10\r\n\r\n"))
+	if action != Close {
+		t.Errorf("Data() action = %v, want %v", action, Close)
+	}
+	expectStatus(t, out, http.StatusExpectationFailed)
+
+	records := logger.events(EventInvalidExpectationStatus)
+	if len(records) != 1 {
+		t.Fatalf("%d %s records, want 1", len(records), EventInvalidExpectationStatus)
+	}
+	if status := records[0].fields["status"]; status != http.StatusFound {
+		t.Errorf("status = %v, want %d", status, http.StatusFound)
+	}
+}
+
+func TestHandler_UnknownExpectation(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		request        string
+		expectedStatus int
+	}{
+		{
+			desc:           "unknown expectation with a body",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: foo\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedStatus: http.StatusExpectationFailed,
+		},
+		{
+			desc:           "unknown expectation without a body",
+			request:        "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: foo\r\n\r\n",
+			expectedStatus: http.StatusExpectationFailed,
+		},
+		{
+			desc:           "unknown expectation is ignored in HTTP/1.0",
+			request:        "GET /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\nExpect: foo\r\n\r\n",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "100-continue with the whole body",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-Continue\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_ExpectContinueEmptyBody(t *testing.T) {
+	request := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nExpect: 100-continue\r\nContent-Length: 0\r\n\r\n"
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.WriteHeader(http.StatusOK)
+	})
+	testCases := []struct {
+		desc      string
+		opts      []Option
+		requests  int
+		pipelined bool
+	}{
+		{
+			desc:     "http handler",
+			requests: 1,
+		},
+		{
+			desc:     "raw handler",
+			opts:     []Option{WithRawHandler(raw)},
+			requests: 1,
+		},
+		{
+			desc:     "checker isn't consulted",
+			opts:     []Option{WithExpectationChecker(func(req *http.Request) int { return http.StatusUnauthorized })},
+			requests: 1,
+		},
+		{
+			desc:     "pipelined",
+			requests: 3,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			// There is no body to wait for, so the request is dispatched right away without an interim response
+			out, action := h.Data(c, bytes.Repeat([]byte(request), tC.requests))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+			if bytes.Contains(out, []byte("100 Continue")) {
+				subT.Errorf("Data() wrote %q, want no 100 Continue", out)
+			}
+
+			reader := bufio.NewReader(bytes.NewReader(out))
+			for i := 0; i < tC.requests; i++ {
+				res, err := http.ReadResponse(reader, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %d of %q: %v", i+1, out, err)
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					subT.Errorf("response %d status = %d, want %d", i+1, res.StatusCode, http.StatusOK)
+				}
+			}
+			if reader.Buffered() > 0 {
+				subT.Errorf("%d unexpected bytes after the responses", reader.Buffered())
+			}
+
+			if state, _ := connState(c); state.pending != 0 || state.expectChecked {
+				subT.Errorf("pending = %d and expectChecked = %v, want the connection reset", state.pending, state.expectChecked)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package core
+
+import "syscall"
+
+// tcpFastOpen is TCP_FASTOPEN from linux/tcp.h, which the syscall package doesn't define.
+const tcpFastOpen = 0x17
+
+// SetTCPFastOpen enables TCP Fast Open on a listening socket, allowing up to queueLen pending
+// Fast Open requests (connections whose SYN carried data that the handshake hasn't completed yet).
+func SetTCPFastOpen(fd, queueLen int) error {
+	return syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpFastOpen, queueLen)
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestSetTCPFastOpen(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		opts     []Option
+		expected int
+	}{
+		{desc: "enabled", opts: []Option{WithTCPFastOpen()}, expected: DefaultTCPFastOpenQueue},
+		{desc: "disabled by default", expected: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			cfg := NewConfig(tC.opts...)
+			if cfg.TCPFastOpenQueue != tC.expected {
+				subT.Fatalf("TCPFastOpenQueue = %d, want %d", cfg.TCPFastOpenQueue, tC.expected)
+			}
+
+			if cfg.TCPFastOpenQueue == 0 {
+				return
+			}
+
+			var setErr error
+			lc := net.ListenConfig{
+				Control: func(network, address string, c syscall.RawConn) error {
+					return c.Control(func(fd uintptr) {
+						setErr = SetTCPFastOpen(int(fd), cfg.TCPFastOpenQueue)
+					})
+				},
+			}
+			ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+			if err != nil {
+				subT.Fatalf("unable to listen: %v", err)
+			}
+			defer ln.Close()
+
+			// The actual Fast Open behavior depends on the kernel's configuration, so we only check
+			// that the option made it to the socket.
+			if setErr != nil {
+				subT.Skipf("TCP Fast Open isn't available: %v", setErr)
+			}
+
+			raw, err := ln.(*net.TCPListener).SyscallConn()
+			if err != nil {
+				subT.Fatalf("unable to get the raw listener: %v", err)
+			}
+
+			var got int
+			var getErr error
+			raw.Control(func(fd uintptr) {
+				got, getErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen)
+			})
+			if getErr != nil {
+				subT.Fatalf("unable to read TCP_FASTOPEN: %v", getErr)
+			}
+			if got != tC.expected {
+				subT.Errorf("TCP_FASTOPEN = %d, want %d", got, tC.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import "errors"
+
+// SetTCPFastOpen enables TCP Fast Open on a listening socket, which is only supported on Linux.
+func SetTCPFastOpen(fd, queueLen int) error {
+	return errors.New("TCP Fast Open is only supported on linux")
+}
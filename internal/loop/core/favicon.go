@@ -0,0 +1,48 @@
+package core
+
+import (
+	"net/http"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// faviconPath is the path that browsers request a site's icon from on their own.
+const faviconPath = "/favicon.ico"
+
+// Favicon is the response that GET and HEAD requests for /favicon.ico are answered with, without reaching the handler.
+type Favicon struct {
+	// ContentType is the Content-Type of the Body. When empty, it is sniffed from the Body.
+	ContentType string
+	// Body is the icon itself. When empty, the response has no body.
+	Body []byte
+	// Status is the status code of the response. Zero answers with a 404.
+	Status int
+}
+
+// isFaviconRequest reports whether a request with the method and path is answered with the configured Favicon.
+func (h *Handler) isFaviconRequest(method, path string) bool {
+	return h.config.Favicon != nil && path == faviconPath && (method == http.MethodGet || method == http.MethodHead)
+}
+
+// serveFavicon populates the response with the configured Favicon.
+func (h *Handler) serveFavicon(res *internalHttp.ResponseWriter) {
+	favicon := h.config.Favicon
+	status := favicon.Status
+	if status == 0 {
+		status = http.StatusNotFound
+	}
+	writeStatic(res, status, favicon.ContentType, favicon.Body)
+}
+
+// writeStatic populates the response with a fixed status and body. When the contentType is empty, it is sniffed
+// from the body.
+func writeStatic(res *internalHttp.ResponseWriter, status int, contentType string, body []byte) {
+	if contentType != "" {
+		res.Header().Set("Content-Type", contentType)
+	}
+
+	res.WriteHeader(status)
+	if len(body) > 0 {
+		_, _ = res.Write(body)
+	}
+}
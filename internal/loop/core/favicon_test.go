@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_Favicon(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00fake icon")
+
+	testCases := []struct {
+		desc                string
+		request             string
+		expectedContentType string
+		expectedBody        []byte
+		favicon             Favicon
+		expectedStatus      int
+		expectedHandled     bool
+	}{
+		{
+			desc:            "default answers with an empty 404",
+			request:         "GET /favicon.ico HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusNotFound,
+			expectedHandled: false,
+		},
+		{
+			desc:                "configured icon",
+			request:             "GET /favicon.ico HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			favicon:             Favicon{Status: http.StatusOK, ContentType: "image/x-icon", Body: icon},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "image/x-icon",
+			expectedBody:        icon,
+			expectedHandled:     false,
+		},
+		{
+			desc:                "HEAD request has no body",
+			request:             "HEAD /favicon.ico HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			favicon:             Favicon{Status: http.StatusOK, ContentType: "image/x-icon", Body: icon},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "image/x-icon",
+			expectedHandled:     false,
+		},
+		{
+			desc:            "other methods reach the handler",
+			request:         "POST /favicon.ico HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 0\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: true,
+		},
+		{
+			desc:            "other paths reach the handler",
+			request:         "GET /favicon.ico.bak HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			handled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				w.WriteHeader(http.StatusOK)
+			})
+			h := NewHandler(context.Background(), handler, WithFavicon(tC.favicon))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+
+			method := http.MethodGet
+			if bytes.HasPrefix([]byte(tC.request), []byte(http.MethodHead)) {
+				method = http.MethodHead
+			}
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), &http.Request{Method: method})
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			if handled != tC.expectedHandled {
+				subT.Errorf("handler invoked = %v, want %v", handled, tC.expectedHandled)
+			}
+
+			if tC.expectedContentType != "" {
+				if got := res.Header.Get("Content-Type"); got != tC.expectedContentType {
+					subT.Errorf("Content-Type = %q, want %q", got, tC.expectedContentType)
+				}
+			}
+
+			if !tC.expectedHandled && !bytes.Equal(body, tC.expectedBody) {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandler_FaviconRaw(t *testing.T) {
+	handled := false
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		handled = true
+		w.WriteHeader(http.StatusOK)
+	})
+	h := NewHandler(context.Background(), nil, WithRawHandler(raw), WithFavicon(Favicon{}))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, _ := h.Data(c, []byte("GET /favicon.ico HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusNotFound)
+	if handled {
+		t.Errorf("raw handler invoked for the favicon request")
+	}
+}
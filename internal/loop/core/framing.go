@@ -0,0 +1,45 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// EventBodyLengthMismatch is logged when the body that was buffered (or spilled) for a complete request isn't as long
+// as the Content-Length that the request declared, which means that the framing of the request went wrong somewhere.
+const EventBodyLengthMismatch = "request.body_length_mismatch"
+
+// bufferedBodyLength returns the length of the body that was assembled for the complete request in the data, which is
+// whatever follows the headers, or the contents of the file when the body was spilled to one.
+func bufferedBodyLength(state *conn, data []byte) int64 {
+	if state.spill != nil {
+		info, err := state.spill.file.Stat()
+		if err != nil {
+			return -1
+		}
+		return info.Size()
+	}
+	return int64(len(data) - internalHttp.HeaderLength(data))
+}
+
+// bodyLengthMismatch reports whether the buffered body of a request isn't as long as its declared Content-Length, and
+// logs an EventBodyLengthMismatch record when it isn't. Requests without a Content-Length (e.g. chunked ones) have
+// nothing to compare against. Such a request must not be dispatched, since the handler would see a Content-Length that
+// its Body doesn't agree with, and whatever follows it on the connection can't be trusted to be the next request.
+func (h *Handler) bodyLengthMismatch(method, target string, declared, buffered int64) bool {
+	if declared < 0 || declared == buffered {
+		return false
+	}
+
+	atomic.AddUint64(&h.stats.BodyLengthMismatches, 1)
+	h.config.Logger.Log(EventBodyLengthMismatch, Fields{
+		"method":    method,
+		"target":    target,
+		"declared":  declared,
+		"buffered":  buffered,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	return true
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_BodyLengthMismatch(t *testing.T) {
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		_, _ = w.Write(req.Body)
+	})
+	const head = "POST /upload HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n"
+
+	// The requests are handed to serve directly, since RequestLength never frames a request like this
+	testCases := []struct {
+		desc             string
+		request          string
+		spilled          string
+		opts             []Option
+		expectedStatus   int
+		expectedBuffered int64
+	}{
+		{
+			desc:           "body as long as declared",
+			request:        head + "0123456789",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:             "body shorter than declared",
+			request:          head + "01234",
+			expectedStatus:   http.StatusInternalServerError,
+			expectedBuffered: 5,
+		},
+		{
+			desc:             "body longer than declared",
+			request:          head + "0123456789abcdef",
+			expectedStatus:   http.StatusInternalServerError,
+			expectedBuffered: 16,
+		},
+		{
+			desc:           "chunked body",
+			request:        "POST /upload HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n01234\r\n0\r\n\r\n",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "spilled body as long as declared",
+			request:        head,
+			spilled:        "0123456789",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:             "spilled body shorter than declared",
+			request:          head,
+			spilled:          "0123",
+			expectedStatus:   http.StatusInternalServerError,
+			expectedBuffered: 4,
+		},
+		{
+			desc:           "raw handler body as long as declared",
+			request:        head + "0123456789",
+			opts:           []Option{WithRawHandler(raw)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:             "raw handler body shorter than declared",
+			request:          head + "01234",
+			opts:             []Option{WithRawHandler(raw)},
+			expectedStatus:   http.StatusInternalServerError,
+			expectedBuffered: 5,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			logger := &recordingLogger{}
+			dispatched := false
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				dispatched = true
+				_, _ = ioutil.ReadAll(r.Body)
+			}), append([]Option{WithLogger(logger)}, tC.opts...)...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+			state, _ := connState(c)
+
+			if tC.spilled != "" {
+				f, err := ioutil.TempFile(subT.TempDir(), "spill-*")
+				if err != nil {
+					subT.Fatalf("unable to create the spill file: %v", err)
+				}
+				if _, err := f.WriteString(tC.spilled); err != nil {
+					subT.Fatalf("unable to write the spill file: %v", err)
+				}
+				state.spill = &spill{file: f, head: []byte(tC.request), length: 10}
+				defer state.dropSpill()
+			}
+
+			out, action := h.serve(state, []byte(tC.request))
+			expectStatus(subT, out, tC.expectedStatus)
+
+			mismatches := logger.events(EventBodyLengthMismatch)
+			if tC.expectedStatus == http.StatusOK {
+				if len(mismatches) != 0 || h.Stats().BodyLengthMismatches != 0 {
+					subT.Fatalf("logged %d %s records, want none", len(mismatches), EventBodyLengthMismatch)
+				}
+				return
+			}
+
+			if action != Close {
+				subT.Errorf("serve() action = %v, want %v", action, Close)
+			}
+			if dispatched {
+				subT.Error("the request was dispatched to the handler")
+			}
+			if got := h.Stats().BodyLengthMismatches; got != 1 {
+				subT.Errorf("Stats().BodyLengthMismatches = %d, want 1", got)
+			}
+			if len(mismatches) != 1 {
+				subT.Fatalf("logged %d %s records, want 1", len(mismatches), EventBodyLengthMismatch)
+			}
+			if declared, buffered := mismatches[0].fields["declared"], mismatches[0].fields["buffered"]; declared != int64(10) || buffered != tC.expectedBuffered {
+				subT.Errorf("mismatch of %v declared and %v buffered bytes, want 10 and %d", declared, buffered, tC.expectedBuffered)
+			}
+		})
+	}
+}
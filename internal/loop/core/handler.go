@@ -0,0 +1,995 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// Action is the engine agnostic version of the actions returned to the evio and gnet event loops.
+// Each engine is responsible for translating it into its own action type.
+type Action int
+
+const (
+	None Action = iota
+	Close
+	Shutdown
+)
+
+// EventTruncatedRequest is logged when a connection is closed in the middle of a request, with the amount of bytes of
+// the request that were pending.
+const EventTruncatedRequest = "conn.truncated_request"
+
+// EventResponseRejected is logged when a response is replaced with a 500 because the handler set a header with a CR or
+// LF in it, which would inject headers or split the response.
+const EventResponseRejected = "response.rejected"
+
+// Conn is the subset of the evio and gnet connection APIs that the Handler relies on.
+// Both evio.Conn and gnet.Conn satisfy it, which lets us share the HTTP logic between the engines.
+type Conn interface {
+	Context() interface{}
+	SetContext(interface{})
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// Handler implements the HTTP connection lifecycle that is shared between the event loop based engines.
+// The engines forward their events to the Handler and translate the returned Actions.
+type Handler struct {
+	ctx         context.Context
+	httpHandler http.Handler
+	// bindings are the handlers of the Bindings by port.
+	bindings  map[int]http.Handler
+	conns     map[*conn]struct{}
+	recorder  *recorder
+	inFlight  *inFlight
+	admission *admission
+	// budgets holds the pending bytes of incomplete requests on each event loop, when MaxBufferedBytes is set.
+	budgets *loopBudgets
+	// loops counts the connections of each event loop when LoopStats is enabled.
+	loops *loopStats
+	// timers tracks the read, lifetime and drain deadlines of the connections.
+	timers  *timingWheel
+	stats   Stats
+	config  Config
+	connsMu sync.Mutex
+	// paused is set while the Handler is paused, see Pause.
+	paused uint32
+}
+
+// NewHandler creates a Handler that dispatches requests to the httpHandler. A nil httpHandler answers every request
+// with a 404 Not Found, so that a server can be started safely before anything is routed on it.
+func NewHandler(ctx context.Context, httpHandler http.Handler, opts ...Option) *Handler {
+	cfg := NewConfig(opts...)
+	if httpHandler == nil {
+		httpHandler = http.NotFoundHandler()
+		if _, ok := cfg.ErrorPages[http.StatusNotFound]; ok {
+			// The page is only applied to responses without a body of their own
+			httpHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+		}
+	}
+
+	h := &Handler{
+		ctx:         ctx,
+		httpHandler: httpHandler,
+		config:      cfg,
+		conns:       make(map[*conn]struct{}),
+		timers:      newTimingWheel(wheelResolution, wheelSlots, time.Now()),
+	}
+	h.bindings = bindingHandlers(h.config.Bindings)
+
+	if h.config.DebugPrefix != "" {
+		h.httpHandler = internalHttp.Debug(h.config.DebugPrefix, httpHandler)
+	}
+
+	if h.config.RecordExchanges > 0 {
+		h.recorder = newRecorder(h.config.RecordExchanges)
+	}
+
+	if h.config.MaxRequestRate > 0 {
+		h.admission = newAdmission(h.config.MaxRequestRate, h.config.RequestBurst)
+	}
+
+	if h.config.MaxBufferedBytes > 0 {
+		h.budgets = &loopBudgets{}
+	}
+
+	if h.config.LoopStats {
+		h.loops = &loopStats{}
+	}
+
+	if h.config.MaxInFlight > 0 {
+		h.inFlight = newInFlight(h.config.MaxInFlight, h.config.MaxQueuedRequests, h.config.InFlightOverflow)
+	}
+
+	return h
+}
+
+// Config returns the Handler's configuration.
+func (h *Handler) Config() Config {
+	return h.config
+}
+
+// Stats returns a snapshot of the Handler's counters.
+func (h *Handler) Stats() Stats {
+	stats := h.stats.snapshot()
+	if h.loops != nil {
+		h.loops.snapshot(&stats)
+	}
+	return stats
+}
+
+// Connections returns a snapshot of the metadata of all of the currently active connections.
+func (h *Handler) Connections() []ConnInfo {
+	now := time.Now()
+
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+
+	infos := make([]ConnInfo, 0, len(h.conns))
+	for state := range h.conns {
+		infos = append(infos, state.info(now))
+	}
+	return infos
+}
+
+// Exchanges returns a copy of the recorded request/response exchanges, oldest first.
+// It is always empty unless recording was enabled with WithRecording.
+func (h *Handler) Exchanges() []Exchange {
+	if h.recorder == nil {
+		return nil
+	}
+	return h.recorder.snapshot()
+}
+
+// Opened fires on opening new connections (per connection).
+// The wake function must trigger a Data event with no input for the connection, and is used to
+// act on connections from outside of their event loop (e.g. when a timeout fires).
+func (h *Handler) Opened(c Conn, wake func()) Action {
+	h.register(c, wake)
+	if h.Paused() {
+		atomic.AddUint64(&h.stats.PausedConnections, 1)
+		return Close
+	}
+
+	select {
+	case <-h.ctx.Done():
+		return Close
+	default:
+		return None
+	}
+}
+
+// register creates the state of a new connection, stores it in the connection's context and tracks it.
+func (h *Handler) register(c Conn, wake func()) *conn {
+	state := newConn(c, wake)
+	if h.budgets != nil || h.config.SlowHandlerThreshold > 0 {
+		state.loop = loopOf(c)
+	}
+	if h.budgets != nil {
+		state.buffered = h.budgets.counter(state.loop)
+	}
+	if h.bindings != nil {
+		state.handler = bindingHandler(h.bindings, state.localAddr)
+	}
+
+	if h.config.ContextFactory != nil {
+		state.custom = h.newConnContext(state)
+	}
+	if state.custom != nil {
+		state.custom.httpState().conn = state
+		c.SetContext(state.custom)
+	} else {
+		c.SetContext(state)
+	}
+
+	h.connsMu.Lock()
+	h.conns[state] = struct{}{}
+	h.connsMu.Unlock()
+
+	if h.config.MaxConnLifetime > 0 {
+		state.lifetimeTimer.arm()
+		h.timers.schedule(&state.lifetimeTimer, state.openedAt+int64(h.config.MaxConnLifetime))
+	}
+	return state
+}
+
+// Closed fires on closing connections (per connection)
+func (h *Handler) Closed(c Conn, err error) Action {
+	if err != nil {
+		if h.config.ConnErrorHandler != nil {
+			h.config.ConnErrorHandler(c.RemoteAddr(), &ConnError{Err: err, Category: ClassifyConnError(err)})
+		} else {
+			fmt.Println("connection between", c.LocalAddr(), "and", c.RemoteAddr(), "has been closed with error value", err)
+		}
+	}
+
+	if state, ok := connState(c); ok {
+		// If the peer went away in the middle of a request, we will never be able to complete it,
+		// so we count it and make sure that the partial buffer is released along with the connection.
+		if state.pending > 0 {
+			atomic.AddUint64(&h.stats.TruncatedRequests, 1)
+			h.config.Logger.Log(EventTruncatedRequest, Fields{
+				"local":     state.localAddr.String(),
+				"remote":    state.remoteAddr.String(),
+				"pending":   state.pending,
+				"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+			})
+		}
+		state.stream.End(nil)
+		state.setPending(0)
+		state.dropSpill()
+
+		h.connsMu.Lock()
+		delete(h.conns, state)
+		h.connsMu.Unlock()
+
+		h.timers.stop(&state.readTimer)
+		h.timers.stop(&state.bodyTimer)
+		h.timers.stop(&state.lifetimeTimer)
+		h.timers.stop(&state.drainTimer)
+	}
+	c.SetContext(nil)
+
+	select {
+	case <-h.ctx.Done():
+		return Shutdown
+	default:
+		return None
+	}
+}
+
+// Data fires on data being sent to a connection (per connection, per data frame read)
+func (h *Handler) Data(c Conn, in []byte) ([]byte, Action) {
+	state, ok := connState(c)
+	if !ok {
+		// The context is set in Opened, but if an engine ever hands us data for a connection before that (or after
+		// its context was cleared), we start it over with a fresh state instead of crashing the whole event loop.
+		// Such a connection can't be woken up, so it is never reaped by the ReadTimeout.
+		state = h.register(c, nil)
+	}
+
+	if state.isDraining() {
+		// Whatever the client sends after the response that closes the connection is ignored, and being woken up
+		// means that the client took too long to hang up
+		if len(in) == 0 {
+			return nil, Close
+		}
+		return nil, None
+	}
+
+	if len(in) == 0 {
+		// Empty data events are triggered by waking the connection up from outside of its event loop
+		return h.wake(state)
+	}
+
+	start := h.phaseStart()
+	state.read(len(in))
+	if state.pending == 0 {
+		state.startRequest()
+		h.armReadTimeout(state)
+	} else {
+		state.reads++
+	}
+
+	var out []byte
+	if state.spill != nil {
+		res, rest, action := h.spillBody(state, in)
+		if action != None || len(rest) == 0 {
+			return res, action
+		}
+
+		// Whatever follows the spilled request is the beginning of the next one
+		out, in = res, rest
+		state.startRequest()
+		h.armReadTimeout(state)
+	}
+	data := state.begin(in)
+	if h.config.ProxyProtocol && !state.proxied {
+		rest, action := h.consumeProxyHeader(state, data)
+		if action != None {
+			state.reset()
+			return out, action
+		}
+
+		if !state.proxied {
+			state.hold(data)
+			state.setPending(len(data))
+			return out, None
+		}
+		data = rest
+	}
+
+	// The data may hold several pipelined requests, so we keep serving complete requests from the
+	// front of it, and only keep what remains of the last, incomplete one for the next read. Once a
+	// request is rejected, nothing after it can be trusted to be framed right, so the responses up to
+	// and including the rejection are written and the rest of the data is discarded with the connection.
+	for len(data) > 0 {
+		if h.config.MaxURILength > 0 && internalHttp.RequestTargetLength(data) > h.config.MaxURILength {
+			state.reset()
+			res, action := h.respondError(state, h.newResponseWriter(1, 1), http.StatusRequestURITooLong)
+			return append(out, res...), action
+		}
+
+		if h.config.MaxHeaderValueBytes > 0 && internalHttp.LongestHeaderValue(data) > h.config.MaxHeaderValueBytes {
+			state.reset()
+			res, action := h.respondError(state, h.newResponseWriter(1, 1), http.StatusRequestHeaderFieldsTooLarge)
+			return append(out, res...), action
+		}
+
+		// A close-delimited body lasts until the client closes its side of the connection (see ReadClosed)
+		if h.config.CloseDelimitedBodies && internalHttp.IsCloseDelimited(data) {
+			if h.config.MaxBodyBytes > 0 && int64(len(data)-internalHttp.HeaderLength(data)) > h.config.MaxBodyBytes {
+				state.reset()
+				res, action := h.respondError(state, h.newResponseWriter(1, 0), http.StatusRequestEntityTooLarge)
+				return append(out, res...), action
+			}
+			break
+		}
+
+		n, err := internalHttp.RequestLength(data)
+		if err == nil && n < 0 {
+			// A negative length can only come from a Content-Length that wrapped around, and slicing with it would panic
+			err = internalHttp.ErrInvalidContentLength
+		}
+		if err != nil {
+			state.reset()
+			if errors.Is(err, internalHttp.ErrBadRequest) {
+				res, action := h.respondError(state, h.newResponseWriter(1, 1), http.StatusBadRequest)
+				return append(out, res...), action
+			}
+
+			if errors.Is(err, internalHttp.ErrVersionNotSupported) {
+				res, action := h.respondError(state, h.newResponseWriter(1, 1), http.StatusHTTPVersionNotSupported)
+				return append(out, res...), action
+			}
+
+			fmt.Println("Uh oh, there was an error checking completeness?", err)
+			return out, Close
+		}
+
+		if n == 0 {
+			break
+		}
+		state.setState(StateWriting)
+		h.stats.observeReads(state.reads)
+		h.stats.observeRequest(n)
+
+		var res []byte
+		var action Action
+		if res = h.staticResponse(state, data[:n]); res == nil {
+			res, action = h.serveObserved(state, data[:n], start)
+		}
+		if h.recorder != nil {
+			h.recorder.record(state.remoteAddr, data[:n], res)
+		}
+
+		if out == nil {
+			out = res
+		} else {
+			out = append(out, res...)
+		}
+
+		data = data[n:]
+		if action != None {
+			state.reset()
+			return out, action
+		}
+
+		if state.upgrade != nil {
+			// The client waits for the 101 before it starts the handshake, so nothing can follow the request in cleartext
+			state.reset()
+			return out, None
+		}
+
+		// Whatever follows the request we just served is the beginning of the next one
+		state.startRequest()
+		h.armReadTimeout(state)
+		start = h.phaseStart()
+	}
+
+	if len(data) == 0 {
+		// Reset the connection state once we have completed all of the buffered requests in order to
+		// ensure that the next request starts empty.
+		state.reset()
+		return out, None
+	}
+
+	state.hold(data)
+	state.setPending(len(data))
+	h.stats.observeBuffered(len(data))
+	if h.overBudget(state) {
+		res, action := h.enforceBudget(state)
+		if action != None {
+			return append(out, res...), action
+		}
+	}
+
+	hl := internalHttp.HeaderLength(data)
+	if hl == 0 {
+		state.setState(StateReadingHeaders)
+		return out, None
+	}
+	state.setState(StateReadingBody)
+	if state.startBody() {
+		if len(h.config.RouteTimeouts) > 0 {
+			h.applyRouteTimeouts(state, data)
+		}
+		h.armBodyTimeout(state)
+	}
+
+	// The headers are complete but the body isn't, so this is the point where a client that sent
+	// Expect: 100-continue is waiting to hear whether it should send the body.
+	if !state.expectChecked {
+		state.expectChecked = true
+
+		res, action := h.expectContinue(state, data[:hl])
+		out = append(out, res...)
+
+		if action != None {
+			state.reset()
+			return out, action
+		}
+	}
+
+	h.maybeSpill(state, data, hl)
+	return out, None
+}
+
+// ReadClosed fires when the client has closed its side of the connection (a TCP half-close) while the connection
+// can still be written to. When close-delimited bodies are enabled and the buffered request is one, it is dispatched
+// as if it had declared the Content-Length of everything that arrived after its headers, and the connection is closed
+// after its response. Only engines that can still write after the client's EOF can call it: evio and gnet close the
+// connection as soon as they read the EOF, so it is only called by ServeConn (and Handler.Serve).
+func (h *Handler) ReadClosed(c Conn) ([]byte, Action) {
+	state, ok := connState(c)
+	if !ok || state.pending == 0 || !h.config.CloseDelimitedBodies {
+		return nil, Close
+	}
+
+	data := state.stream.Begin(nil)
+	if !internalHttp.IsCloseDelimited(data) {
+		return nil, Close
+	}
+
+	// Framing the body with a Content-Length lets it go through the exact same parsing and limits as any other request
+	hl := internalHttp.HeaderLength(data)
+	framed := make([]byte, 0, len(data)+32)
+	framed = append(framed, data[:hl-2]...)
+	framed = append(framed, "Content-Length: "...)
+	framed = strconv.AppendInt(framed, int64(len(data)-hl), 10)
+	framed = append(framed, "\r\n\r\n"...)
+	framed = append(framed, data[hl:]...)
+	state.reset()
+
+	res, _ := h.serveObserved(state, framed, h.phaseStart())
+	return res, Close
+}
+
+// serve parses a complete request, dispatches it to the http.Handler and returns the serialized response.
+func (h *Handler) serve(state *conn, data []byte) ([]byte, Action) {
+	// The bindings always have an http.Handler of their own
+	if h.config.RawHandler != nil && state.handler == nil {
+		return h.serveRaw(state, data)
+	}
+
+	if h.config.AbandonTimedOutHandlers {
+		// The body is read from the data, which belongs to the connection's buffer, and an abandoned handler may still
+		// be reading it once the buffer is reused for the next request
+		data = append([]byte(nil), data...)
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		// RequestLength framed it, but it isn't a request that we can serve, e.g. one with an empty target
+		return h.respondError(state, h.newResponseWriter(1, 1), http.StatusBadRequest)
+	}
+	req.RemoteAddr = state.remoteAddr.String()
+	if len(h.config.ErrorPages) > 0 {
+		state.requestID = req.Header.Get(RequestIDHeader)
+	}
+	if h.bodyLengthMismatch(req.Method, req.RequestURI, req.ContentLength, bufferedBodyLength(state, data)) {
+		return h.respondError(state, h.newResponseWriter(req.ProtoMajor, req.ProtoMinor), http.StatusInternalServerError)
+	}
+	if h.upgradesToTLS(state, req) {
+		// The request is served once the handshake is done, see upgradeTLS
+		state.upgrade = append([]byte(nil), data...)
+		return switchingToTLSResponse, None
+	}
+	if state.spill != nil {
+		// The file is closed and removed along with the spill once the response is written, or once the handler
+		// returns when it may be abandoned
+		req.Body = ioutil.NopCloser(state.spill.file)
+	}
+	if state.custom != nil {
+		req = req.WithContext(context.WithValue(req.Context(), connContextKey{}, state.custom))
+	}
+	if h.config.TraceFormats != 0 || h.config.GenerateTraces {
+		req = h.withTraceContext(req)
+	}
+
+	res := h.newResponseWriter(req.ProtoMajor, req.ProtoMinor)
+	if !AcceptsTrailers(req) {
+		res.RefuseTrailers()
+	}
+	if state.serverName != "" && h.misdirected(state, req.Host) {
+		return h.respondError(state, res, http.StatusMisdirectedRequest)
+	}
+	if h.Paused() || h.admission != nil && !h.admission.allow(time.Now().UnixNano()) {
+		atomic.AddUint64(&h.stats.ShedRequests, 1)
+		res.Header().Set("Retry-After", "1")
+		return h.respondError(state, res, http.StatusServiceUnavailable)
+	}
+
+	if status := h.prepareRequest(req); status != 0 {
+		return h.respondError(state, res, status)
+	}
+
+	// OPTIONS requests for the server as a whole have no resource for the handler to route to, so they are answered
+	// here, like the standard library does
+	if req.Method == http.MethodOptions && req.RequestURI == "*" {
+		answerLocally(req, data, res)
+		return h.respond(state, res, false)
+	}
+
+	// TRACE and OPTIONS requests that have run out of hops are answered here instead of being passed on
+	if req.Method == http.MethodTrace || req.Method == http.MethodOptions {
+		local, ok := maxForwards(req)
+		if !ok {
+			return h.respondError(state, res, http.StatusBadRequest)
+		}
+
+		if local {
+			answerLocally(req, data, res)
+			return h.respond(state, res, false)
+		}
+	}
+
+	// Browsers ask for the icon on their own, so it is answered here to keep the handler (and its logs) out of it
+	if h.isFaviconRequest(req.Method, req.URL.Path) {
+		h.serveFavicon(res)
+		if req.Method == http.MethodHead {
+			res.SetHead()
+		}
+		return h.respond(state, res, false)
+	}
+
+	if h.isRootRequest(req.Method, req.URL.Path) {
+		h.serveRoot(res)
+		if req.Method == http.MethodHead {
+			res.SetHead()
+		}
+		return h.respond(state, res, false)
+	}
+
+	// Preflights are answered without ever reaching the handler
+	if h.config.CORS != nil && h.handleCORS(req, res) {
+		return h.respond(state, res, false)
+	}
+
+	if len(h.config.Sunsets) > 0 {
+		h.addSunsetHeaders(req.URL.Path, res.Header())
+	}
+
+	// A handler that may be abandoned frees its slot itself once it returns, see handOff
+	timeout := h.handlerTimeout(req.URL.Path)
+	abandonable := timeout > 0 && h.config.AbandonTimedOutHandlers
+	if h.inFlight != nil {
+		if !h.inFlight.acquire(h.ctx) {
+			return h.respondError(state, res, http.StatusServiceUnavailable)
+		}
+		if !abandonable {
+			defer h.inFlight.release()
+		}
+	}
+
+	// Requests without a body keep the http.NoBody that handlers may compare their Body against
+	if req.Body != http.NoBody {
+		req.Body = newCountingBody(req.Body, h.config.MaxBodyBytes)
+	}
+
+	h.markHandlerStart(state)
+	watchdog := h.watchHandler(state, req.Method, req.RequestURI)
+	handler := h.httpHandler
+	if state.handler != nil {
+		handler = state.handler
+	}
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	returned := true
+	if abandonable {
+		returned = serveWithDeadline(handler, res, req, timeout, h.handOff(state, h.inFlight != nil))
+	} else {
+		handler.ServeHTTP(res, req)
+	}
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+	if !returned {
+		// The abandoned handler still holds the response, so the 503 is written with one of its own
+		atomic.AddUint64(&h.stats.AbandonedHandlers, 1)
+		return h.respondHandlerTimeout(state, req.ProtoMajor, req.ProtoMinor)
+	}
+	res.HandlerDone()
+	if caller := res.SuperfluousWriteHeader(); caller != "" {
+		h.logSuperfluousWriteHeader(req.Method, req.RequestURI, caller)
+	}
+	if len(h.config.ErrorPages) > 0 {
+		h.applyErrorPage(state, res)
+	}
+	if timeout > 0 && req.Context().Err() == context.DeadlineExceeded {
+		return h.respondHandlerTimeout(state, req.ProtoMajor, req.ProtoMinor)
+	}
+	if h.config.ResponseInterceptor != nil {
+		h.config.ResponseInterceptor(req, res)
+	}
+	if h.config.ETags {
+		h.applyETag(req.Method, req.Header.Get("If-None-Match"), res)
+	}
+	if h.config.Ranges {
+		res.ApplyRange(req)
+	}
+	if req.Method == http.MethodHead {
+		res.SetHead()
+	}
+	return h.respond(state, res, false)
+}
+
+// serveRaw parses a complete request into the connection's Request, dispatches it to the RawHandler and returns the
+// serialized response.
+func (h *Handler) serveRaw(state *conn, data []byte) ([]byte, Action) {
+	req := &state.rawRequest
+	if err := internalHttp.ParseRequest(data, req); err != nil {
+		return h.respondError(state, h.newResponseWriter(1, 1), http.StatusBadRequest)
+	}
+
+	if len(h.config.ErrorPages) > 0 {
+		state.requestID = string(req.Header(RequestIDHeader))
+	}
+
+	res := h.newResponseWriter(req.ProtoMajor, req.ProtoMinor)
+	if declared, err := internalHttp.ContentLength(data); err == nil && h.bodyLengthMismatch(string(req.Method), string(req.Target), declared, int64(len(req.Body))) {
+		return h.respondError(state, res, http.StatusInternalServerError)
+	}
+	if !req.AcceptsTrailers() {
+		res.RefuseTrailers()
+	}
+	if h.Paused() || h.admission != nil && !h.admission.allow(time.Now().UnixNano()) {
+		atomic.AddUint64(&h.stats.ShedRequests, 1)
+		res.Header().Set("Retry-After", "1")
+		return h.respondError(state, res, http.StatusServiceUnavailable)
+	}
+
+	if h.config.MaxBodyBytes > 0 && int64(len(req.Body)) > h.config.MaxBodyBytes {
+		return h.respondError(state, res, http.StatusRequestEntityTooLarge)
+	}
+
+	if h.isFaviconRequest(string(req.Method), string(req.Path())) {
+		h.serveFavicon(res)
+		if req.IsHead() {
+			res.SetHead()
+		}
+		*req = internalHttp.Request{}
+		return h.respond(state, res, false)
+	}
+
+	if h.isRootRequest(string(req.Method), string(req.Path())) {
+		h.serveRoot(res)
+		if req.IsHead() {
+			res.SetHead()
+		}
+		*req = internalHttp.Request{}
+		return h.respond(state, res, false)
+	}
+
+	if len(h.config.Sunsets) > 0 {
+		h.addSunsetHeaders(string(req.Path()), res.Header())
+	}
+
+	if h.inFlight != nil {
+		if !h.inFlight.acquire(h.ctx) {
+			return h.respondError(state, res, http.StatusServiceUnavailable)
+		}
+		defer h.inFlight.release()
+	}
+
+	h.markHandlerStart(state)
+	watchdog := h.watchHandler(state, string(req.Method), string(req.Target))
+	var timeout time.Duration
+	var start time.Time
+	if h.config.HandlerTimeout > 0 || len(h.config.RouteTimeouts) > 0 {
+		timeout = h.handlerTimeout(string(req.Path()))
+		start = time.Now()
+	}
+	h.config.RawHandler.ServeRaw(req, res)
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+	res.HandlerDone()
+	if caller := res.SuperfluousWriteHeader(); caller != "" {
+		h.logSuperfluousWriteHeader(string(req.Method), string(req.Target), caller)
+	}
+	if len(h.config.ErrorPages) > 0 {
+		h.applyErrorPage(state, res)
+	}
+	// RawHandlers have no context to cancel, so the deadline can only be enforced once they return
+	if timeout > 0 && time.Since(start) > timeout {
+		protoMajor, protoMinor := req.ProtoMajor, req.ProtoMinor
+		*req = internalHttp.Request{}
+		return h.respondHandlerTimeout(state, protoMajor, protoMinor)
+	}
+	if h.config.ETags {
+		h.applyETag(string(req.Method), string(req.Header("If-None-Match")), res)
+	}
+	if req.IsHead() {
+		res.SetHead()
+	}
+
+	// The request points into the connection's stream, which is reused once the response is written
+	*req = internalHttp.Request{}
+	return h.respond(state, res, false)
+}
+
+// prepareRequest applies the configured transformations and limits on a request before it is dispatched to the handler.
+// A non zero status code is returned when the request should be rejected with that status instead.
+func (h *Handler) prepareRequest(req *http.Request) int {
+	if h.config.RejectEncodedNull && internalHttp.HasEncodedNull(req.RequestURI) {
+		return http.StatusBadRequest
+	}
+
+	if unsupportedExpectation(req) {
+		return http.StatusExpectationFailed
+	}
+
+	if h.config.MaxBodyBytes > 0 && req.ContentLength > h.config.MaxBodyBytes {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	if len(h.config.Digests) > 0 {
+		if status := h.validateDigests(req); status != 0 {
+			return status
+		}
+	}
+
+	if h.config.DecompressRequests {
+		if status := h.decompressBody(req); status != 0 {
+			return status
+		}
+	}
+
+	return 0
+}
+
+// newResponseWriter creates a ResponseWriter for a request of the given HTTP version.
+func (h *Handler) newResponseWriter(protoMajor, protoMinor int) *internalHttp.ResponseWriter {
+	res := internalHttp.NewResponseWriter()
+	res.SetProto(protoMajor, protoMinor)
+	if h.config.ForceResponseProtoMajor > 0 {
+		res.SetProto(h.config.ForceResponseProtoMajor, h.config.ForceResponseProtoMinor)
+	}
+	return res
+}
+
+// respondError writes a bare response with the given status, and closes the connection after it.
+func (h *Handler) respondError(state *conn, res *internalHttp.ResponseWriter, status int) ([]byte, Action) {
+	res.Header().Set("Connection", "close")
+	body := h.errorBody(state, res.Header(), status, http.StatusText(status))
+	res.WriteHeader(status)
+	res.Write(body)
+	return h.respond(state, res, true)
+}
+
+// respondHandlerTimeout replaces the response of a handler that ran past its HandlerTimeout with a 503, like
+// http.TimeoutHandler does. The request was read completely, so the connection is kept alive.
+func (h *Handler) respondHandlerTimeout(state *conn, protoMajor, protoMinor int) ([]byte, Action) {
+	atomic.AddUint64(&h.stats.TimedOutHandlers, 1)
+	res := h.newResponseWriter(protoMajor, protoMinor)
+	body := h.errorBody(state, res.Header(), http.StatusServiceUnavailable, "handler timeout")
+	res.WriteHeader(http.StatusServiceUnavailable)
+	res.Write(body)
+	return h.respond(state, res, false)
+}
+
+// respond serializes the response and decides whether the connection should be kept open for the next request.
+func (h *Handler) respond(state *conn, res *internalHttp.ResponseWriter, closeConn bool) ([]byte, Action) {
+	h.markSerializeStart(state)
+	// Responses that the Handler wrote itself haven't been handed back yet, which would drop the headers added below
+	res.HandlerDone()
+
+	// Connections that have outlived their lifetime are closed once the response that is in flight has been written
+	if h.config.MaxConnLifetime > 0 && state.age(time.Now()) > h.config.MaxConnLifetime {
+		if !closeConn {
+			atomic.AddUint64(&h.stats.ExpiredConnections, 1)
+		}
+		closeConn = true
+		res.Header().Set("Connection", "close")
+	}
+
+	// Without keep-alive every connection is closed after its first response, whatever the client asked for
+	if h.config.DisableKeepAlive {
+		closeConn = true
+		res.Header().Set("Connection", "close")
+	}
+
+	if h.config.ServerTiming && !state.phases.start.IsZero() {
+		res.Header().Add("Server-Timing", state.phases.serverTiming(time.Now()))
+	}
+	h.injectHeaders(res, closeConn)
+
+	buf := bytes.NewBuffer(nil)
+	err := res.WriteToBuf(buf)
+	if errors.Is(err, internalHttp.ErrInvalidHeader) {
+		// The handler set a header that would inject headers or split the response, so none of it is sent
+		h.config.Logger.Log(EventResponseRejected, Fields{
+			"local":     state.localAddr.String(),
+			"remote":    state.remoteAddr.String(),
+			"error":     err.Error(),
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		return h.respondError(state, h.newResponseWriter(res.ProtoMajor, res.ProtoMinor), http.StatusInternalServerError)
+	}
+	if err != nil {
+		fmt.Println("Uh oh, there was an error writing the response?", err)
+		return nil, Close
+	}
+
+	state.wrote(buf.Len())
+
+	if closeConn {
+		return buf.Bytes(), Close
+	}
+
+	select {
+	case <-h.ctx.Done():
+		return buf.Bytes(), Close
+	default:
+		return buf.Bytes(), None
+	}
+}
+
+// wake handles a Data event that was triggered by waking the connection up.
+func (h *Handler) wake(state *conn) ([]byte, Action) {
+	if state.isEvicted() {
+		return h.evict(state)
+	}
+
+	if state.isBodyTimedOut() {
+		// Unlike the ReadTimeout, the client has always sent the headers of the request by now, so it is told why
+		atomic.AddUint64(&h.stats.TimedOutRequests, 1)
+		state.reset()
+		return h.respondError(state, h.newResponseWriter(1, 1), http.StatusRequestTimeout)
+	}
+
+	if !state.isTimedOut() {
+		if state.isExpired() {
+			atomic.AddUint64(&h.stats.ExpiredConnections, 1)
+			state.reset()
+			return nil, Close
+		}
+		return nil, None
+	}
+
+	atomic.AddUint64(&h.stats.TimedOutRequests, 1)
+	pending := state.pending
+	// The partial request is abandoned, so it isn't counted as truncated when the connection closes
+	state.reset()
+
+	// If the client has sent us part of a request, let it know why we're hanging up on it, since some clients will retry on a 408.
+	if pending > 0 && h.config.RequestTimeoutResponse {
+		return h.respondError(state, h.newResponseWriter(1, 1), http.StatusRequestTimeout)
+	}
+	return nil, Close
+}
+
+// Tick fires on every tick of the event loop
+func (h *Handler) Tick() (time.Duration, Action) {
+	select {
+	case <-h.ctx.Done():
+		return time.Second, Shutdown
+	default:
+		h.reap(time.Now())
+		return time.Second, None
+	}
+}
+
+// reap marks the connections whose current request has been reading for longer than the ReadTimeout, and the
+// connections that have been open for longer than the MaxConnLifetime, and wakes them up so that they can be
+// closed from within their own event loop. Only the connections whose deadline has passed in the timing wheel are
+// visited, so idle connections cost nothing here.
+func (h *Handler) reap(now time.Time) {
+	for _, t := range h.timers.advance(now, nil) {
+		state := t.conn
+		if state.isDraining() && t.kind != drainTimer {
+			// The response that closes the connection has already been written, and only the drain can cut it short
+			continue
+		}
+
+		switch t.kind {
+		case readTimer:
+			// The timer is disarmed before looking at the request, so that a request starting concurrently either
+			// arms it again itself, or is seen here
+			t.disarm()
+			start := atomic.LoadInt64(&state.requestStart)
+			if start == 0 {
+				continue
+			}
+
+			// Only a route's override may have armed the timer of a Handler without a ReadTimeout
+			timeout := h.readTimeout(state)
+			if timeout == 0 {
+				continue
+			}
+
+			// A later request may have started since the timer was scheduled, which moves its deadline
+			if deadline := start + int64(timeout); deadline > now.UnixNano() {
+				if t.arm() {
+					h.timers.schedule(t, deadline)
+				}
+				continue
+			}
+
+			if !state.markTimedOut() {
+				continue
+			}
+		case bodyTimer:
+			t.disarm()
+			start := atomic.LoadInt64(&state.bodyStart)
+			timeout := h.bodyReadTimeout(state)
+			if start == 0 || timeout == 0 {
+				continue
+			}
+
+			if deadline := start + int64(timeout); deadline > now.UnixNano() {
+				if t.arm() {
+					h.timers.schedule(t, deadline)
+				}
+				continue
+			}
+
+			if !state.markBodyTimedOut() {
+				continue
+			}
+		case lifetimeTimer:
+			if !state.markExpired() {
+				continue
+			}
+		case drainTimer:
+			// Draining connections are closed by any wake up
+		}
+
+		if state.wake != nil {
+			state.wake()
+		}
+	}
+}
+
+// armBodyTimeout schedules the body timer of a connection whose request headers have just been completed.
+func (h *Handler) armBodyTimeout(state *conn) {
+	if timeout := h.bodyReadTimeout(state); timeout > 0 && state.bodyTimer.arm() {
+		h.timers.schedule(&state.bodyTimer, atomic.LoadInt64(&state.bodyStart)+int64(timeout))
+	}
+}
+
+// armReadTimeout schedules the read timer of a connection whose request has just started, unless it is already
+// scheduled. Timers are only rescheduled when they fire, so keep-alive connections take the wheel's lock at most
+// once per ReadTimeout instead of once per request.
+func (h *Handler) armReadTimeout(state *conn) {
+	if h.config.ReadTimeout > 0 && state.readTimer.arm() {
+		h.timers.schedule(&state.readTimer, atomic.LoadInt64(&state.requestStart)+int64(h.config.ReadTimeout))
+	}
+}
@@ -0,0 +1,1444 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+	"github.com/tidwall/evio"
+)
+
+// testConn is an in memory Conn used to drive the Handler without a real event loop.
+type testConn struct {
+	ctx    interface{}
+	local  net.Addr
+	remote net.Addr
+	// loop mimics the loop field of the evio and gnet connections that LoopIndex reads, when the test needs one.
+	loop  *testLoop
+	woken int
+}
+
+var testConnPort = 50000
+
+func newTestConn() *testConn {
+	testConnPort++
+	return &testConn{
+		local:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080},
+		remote: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: testConnPort},
+	}
+}
+
+func (c *testConn) Context() interface{}       { return c.ctx }
+func (c *testConn) SetContext(ctx interface{}) { c.ctx = ctx }
+func (c *testConn) LocalAddr() net.Addr        { return c.local }
+func (c *testConn) RemoteAddr() net.Addr       { return c.remote }
+func (c *testConn) wake()                      { c.woken++ }
+
+func newTestHandler(opts ...Option) *Handler {
+	return NewHandler(context.Background(), http.HandlerFunc(internalHttp.Echo), opts...)
+}
+
+func TestHandler_ClosedTruncatedRequest(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		frames            []string
+		expectedTruncated uint64
+	}{
+		{
+			desc:              "closed before any data",
+			frames:            nil,
+			expectedTruncated: 0,
+		},
+		{
+			desc:              "closed after a complete request",
+			frames:            []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"},
+			expectedTruncated: 0,
+		},
+		{
+			desc:              "closed mid headers",
+			frames:            []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"},
+			expectedTruncated: 1,
+		},
+		{
+			desc:              "closed mid body",
+			frames:            []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 100\r\n\r\n", "{\"req\": 0"},
+			expectedTruncated: 1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			logger := &recordingLogger{}
+			h := newTestHandler(WithLogger(logger))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			for _, frame := range tC.frames {
+				if _, action := h.Data(c, []byte(frame)); action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+			}
+
+			h.Closed(c, nil)
+			if got := h.Stats().TruncatedRequests; got != tC.expectedTruncated {
+				subT.Errorf("Stats().TruncatedRequests = %d, want %d", got, tC.expectedTruncated)
+			}
+			records := logger.events(EventTruncatedRequest)
+			if uint64(len(records)) != tC.expectedTruncated {
+				subT.Fatalf("%d %s records, want %d", len(records), EventTruncatedRequest, tC.expectedTruncated)
+			}
+			for _, record := range records {
+				if remote := record.fields["remote"]; remote != c.RemoteAddr().String() {
+					subT.Errorf("remote = %v, want %v", remote, c.RemoteAddr())
+				}
+				if pending, _ := record.fields["pending"].(int); pending <= 0 {
+					subT.Errorf("pending = %v, want the bytes of the incomplete request", record.fields["pending"])
+				}
+			}
+
+			if c.Context() != nil {
+				subT.Errorf("Closed() left the connection context set to %v", c.Context())
+			}
+		})
+	}
+}
+
+// splitFrames splits the data into the given amount of frames of (almost) equal size.
+func splitFrames(data string, n int) []string {
+	frames := make([]string, 0, n)
+	size := (len(data) + n - 1) / n
+	for len(data) > size {
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+	return append(frames, data)
+}
+
+func TestHandler_ReadsPerRequest(t *testing.T) {
+	const request = "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"
+
+	testCases := []struct {
+		desc     string
+		frames   []string
+		expected [ReadsPerRequestBuckets]uint64
+	}{
+		{
+			desc:     "single read",
+			frames:   []string{request},
+			expected: [ReadsPerRequestBuckets]uint64{1},
+		},
+		{
+			desc:     "three reads",
+			frames:   splitFrames(request, 3),
+			expected: [ReadsPerRequestBuckets]uint64{0, 0, 1},
+		},
+		{
+			desc:     "more reads than buckets",
+			frames:   splitFrames(request, ReadsPerRequestBuckets+5),
+			expected: [ReadsPerRequestBuckets]uint64{ReadsPerRequestBuckets - 1: 1},
+		},
+		{
+			desc:     "keep-alive requests",
+			frames:   append([]string{request}, splitFrames(request, 2)...),
+			expected: [ReadsPerRequestBuckets]uint64{1, 1},
+		},
+		{
+			desc:     "pipelined requests in a single read",
+			frames:   []string{request + request},
+			expected: [ReadsPerRequestBuckets]uint64{2},
+		},
+		{
+			desc:     "pipelined request started within a read",
+			frames:   []string{request + request[:20], request[20:40], request[40:]},
+			expected: [ReadsPerRequestBuckets]uint64{1, 0, 1},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			for _, frame := range tC.frames {
+				if _, action := h.Data(c, []byte(frame)); action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+			}
+
+			if got := h.Stats().ReadsPerRequest; got != tC.expected {
+				subT.Errorf("Stats().ReadsPerRequest = %v, want %v", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestHandler_RequestSizeStats(t *testing.T) {
+	small := "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"
+	largeBody := strings.Repeat("a", 4096)
+	large := fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: %d\r\n\r\n%s", len(largeBody), largeBody)
+	abandoned := fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 100000\r\n\r\n%s", strings.Repeat("a", 8192))
+
+	testCases := []struct {
+		desc              string
+		frames            []string
+		expectedMax       uint64
+		expectedCompleted uint64
+		expectedAverage   float64
+	}{
+		{
+			desc:              "small request",
+			frames:            []string{small},
+			expectedMax:       uint64(len(small)),
+			expectedCompleted: 1,
+			expectedAverage:   float64(len(small)),
+		},
+		{
+			desc:              "large request raises the high-water mark",
+			frames:            append([]string{small}, splitFrames(large, 4)...),
+			expectedMax:       uint64(len(large)),
+			expectedCompleted: 2,
+			expectedAverage:   float64(len(small)+len(large)) / 2,
+		},
+		{
+			desc:              "incomplete request raises the high-water mark",
+			frames:            append([]string{small, large}, splitFrames(abandoned, 3)...),
+			expectedMax:       uint64(len(abandoned)),
+			expectedCompleted: 2,
+			expectedAverage:   float64(len(small)+len(large)) / 2,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			for _, frame := range tC.frames {
+				if _, action := h.Data(c, []byte(frame)); action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+			}
+
+			stats := h.Stats()
+			if stats.MaxRequestBytes != tC.expectedMax {
+				subT.Errorf("Stats().MaxRequestBytes = %d, want %d", stats.MaxRequestBytes, tC.expectedMax)
+			}
+			if stats.CompletedRequests != tC.expectedCompleted {
+				subT.Errorf("Stats().CompletedRequests = %d, want %d", stats.CompletedRequests, tC.expectedCompleted)
+			}
+			if got := stats.AverageRequestSize(); got != tC.expectedAverage {
+				subT.Errorf("Stats().AverageRequestSize() = %v, want %v", got, tC.expectedAverage)
+			}
+		})
+	}
+}
+
+func TestHandler_ForceResponseVersion(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		request       string
+		expectedProto string
+		opts          []Option
+	}{
+		{
+			desc:          "1.1 request mirrors",
+			request:       "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedProto: "HTTP/1.1",
+		},
+		{
+			desc:          "1.0 request mirrors",
+			request:       "GET /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedProto: "HTTP/1.0",
+		},
+		{
+			desc:          "1.0 request forced to 1.1",
+			request:       "GET /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:          []Option{WithForceResponseVersion(1, 1)},
+			expectedProto: "HTTP/1.1",
+		},
+		{
+			desc:          "1.1 request forced to 1.0",
+			request:       "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:          []Option{WithForceResponseVersion(1, 0)},
+			expectedProto: "HTTP/1.0",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.Proto != tC.expectedProto {
+				subT.Errorf("response proto = %s, want %s", res.Proto, tC.expectedProto)
+			}
+		})
+	}
+}
+
+func TestHandler_Connections(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		frames           []string
+		expectedRead     uint64
+		expectedRequests uint64
+		expectedState    ConnState
+		expectedWritten  bool
+	}{
+		{
+			desc:          "no data",
+			frames:        nil,
+			expectedState: StateIdle,
+		},
+		{
+			desc:          "partial headers",
+			frames:        []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"},
+			expectedRead:  43,
+			expectedState: StateReadingHeaders,
+		},
+		{
+			desc:          "partial body",
+			frames:        []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n", "{\"req\""},
+			expectedRead:  71,
+			expectedState: StateReadingBody,
+		},
+		{
+			desc:             "complete request",
+			frames:           []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n", "{\"req\": 0}"},
+			expectedRead:     75,
+			expectedWritten:  true,
+			expectedRequests: 1,
+			expectedState:    StateIdle,
+		},
+	}
+
+	h := newTestHandler()
+	conns := make([]*testConn, len(testCases))
+	for i, tC := range testCases {
+		conns[i] = newTestConn()
+		h.Opened(conns[i], conns[i].wake)
+		for _, frame := range tC.frames {
+			h.Data(conns[i], []byte(frame))
+		}
+	}
+
+	infos := h.Connections()
+	if len(infos) != len(testCases) {
+		t.Fatalf("Connections() returned %d connections, want %d", len(infos), len(testCases))
+	}
+
+	for i, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var info *ConnInfo
+			for j := range infos {
+				if infos[j].RemoteAddr == conns[i].RemoteAddr() {
+					info = &infos[j]
+				}
+			}
+			if info == nil {
+				subT.Fatalf("Connections() is missing the connection from %s", conns[i].RemoteAddr())
+			}
+
+			if info.BytesRead != tC.expectedRead {
+				subT.Errorf("BytesRead = %d, want %d", info.BytesRead, tC.expectedRead)
+			}
+			if (info.BytesWritten > 0) != tC.expectedWritten {
+				subT.Errorf("BytesWritten = %d, want written %v", info.BytesWritten, tC.expectedWritten)
+			}
+			if info.Requests != tC.expectedRequests {
+				subT.Errorf("Requests = %d, want %d", info.Requests, tC.expectedRequests)
+			}
+			if info.State != tC.expectedState {
+				subT.Errorf("State = %s, want %s", info.State, tC.expectedState)
+			}
+		})
+	}
+
+	// Closed connections must no longer be reported
+	for _, c := range conns {
+		h.Closed(c, nil)
+	}
+	if infos := h.Connections(); len(infos) != 0 {
+		t.Errorf("Connections() returned %d connections after closing all of them", len(infos))
+	}
+}
+
+func TestHandler_Pipelining(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		frames            []string
+		expectedBodies    []string
+		expectedRemaining ConnState
+	}{
+		{
+			desc: "request without body followed by a request with a body",
+			frames: []string{
+				"GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\nPOST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 1}",
+			},
+			expectedBodies:    []string{"", `{"req": 1}`},
+			expectedRemaining: StateIdle,
+		},
+		{
+			desc: "headers and half of the body in the first frame",
+			frames: []string{
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\"",
+				": 0}GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			},
+			expectedBodies:    []string{`{"req": 0}`, ""},
+			expectedRemaining: StateIdle,
+		},
+		{
+			desc: "second request split across frames",
+			frames: []string{
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\"",
+				": 1}",
+			},
+			expectedBodies:    []string{`{"req": 0}`, `{"req": 1}`},
+			expectedRemaining: StateIdle,
+		},
+		{
+			desc: "second request incomplete",
+			frames: []string{
+				"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n",
+			},
+			expectedBodies:    []string{`{"req": 0}`},
+			expectedRemaining: StateReadingHeaders,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			var out []byte
+			for _, frame := range tC.frames {
+				res, action := h.Data(c, []byte(frame))
+				if action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+				out = append(out, res...)
+			}
+
+			r := bufio.NewReader(bytes.NewReader(out))
+			for i, expected := range tC.expectedBodies {
+				res, err := http.ReadResponse(r, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %d: %v", i, err)
+				}
+
+				body, err := ioutil.ReadAll(res.Body)
+				if err != nil {
+					subT.Fatalf("unable to read response %d body: %v", i, err)
+				}
+				if string(body) != expected {
+					subT.Errorf("response %d body = %q, want %q", i, body, expected)
+				}
+			}
+
+			if r.Buffered() > 0 {
+				subT.Errorf("got %d unexpected trailing response bytes", r.Buffered())
+			}
+
+			if state := h.Connections()[0].State; state != tC.expectedRemaining {
+				subT.Errorf("connection state = %s, want %s", state, tC.expectedRemaining)
+			}
+		})
+	}
+}
+
+func TestHandler_BodySplitAcrossFrames(t *testing.T) {
+	h := newTestHandler()
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	// The first frame completes the headers, so only the rest of the body is left to wait for
+	out, action := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\""))
+	if len(out) > 0 || action != None {
+		t.Fatalf("Data() with half of the body = %q, %v, want no response yet", out, action)
+	}
+	if state := h.Connections()[0].State; state != StateReadingBody {
+		t.Errorf("connection state = %s, want %s", state, StateReadingBody)
+	}
+
+	out, action = h.Data(c, []byte(": 0}"))
+	if action != None {
+		t.Errorf("Data() action = %v, want %v", action, None)
+	}
+	expectBody(t, expectStatus(t, out, http.StatusOK), `{"req": 0}`)
+	if state := h.Connections()[0].State; state != StateIdle {
+		t.Errorf("connection state = %s, want %s", state, StateIdle)
+	}
+}
+
+func TestHandler_PipeliningStopsOnError(t *testing.T) {
+	first := "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"
+	third := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 2}"
+
+	testCases := []struct {
+		desc           string
+		second         string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "malformed header line",
+			second:         "GET /echo HTTP/1.1\r\nHost 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "conflicting Content-Lengths",
+			second:         "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nx",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "missing Host header",
+			second:         "GET /echo HTTP/1.1\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "headers terminated with bare line feeds",
+			second:         "GET /echo HTTP/1.1\nHost: 127.0.0.1:8080\n\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "empty request target",
+			second:         "GET  HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "unsupported version",
+			second:         "GET /echo HTTP/2.0\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusHTTPVersionNotSupported,
+		},
+		{
+			desc:           "request rejected after parsing",
+			second:         "GET /echo%00 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithRejectEncodedNull()},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(first+tC.second+third))
+			if action != Close {
+				subT.Errorf("Data() action = %v, want %v", action, Close)
+			}
+
+			r := bufio.NewReader(bytes.NewReader(out))
+			res, err := http.ReadResponse(r, nil)
+			if err != nil {
+				subT.Fatalf("unable to read the first response: %v", err)
+			}
+			if res.StatusCode != http.StatusOK {
+				subT.Errorf("first response status = %d, want %d", res.StatusCode, http.StatusOK)
+			}
+			_, _ = ioutil.ReadAll(res.Body)
+
+			res, err = http.ReadResponse(r, nil)
+			if err != nil {
+				subT.Fatalf("unable to read the second response: %v", err)
+			}
+			if res.StatusCode != tC.expectedStatus || !res.Close {
+				subT.Errorf("second response = %d closing %v, want %d closing the connection", res.StatusCode, res.Close, tC.expectedStatus)
+			}
+			_, _ = ioutil.ReadAll(res.Body)
+
+			// The request after the rejected one is never served
+			if r.Buffered() > 0 {
+				subT.Errorf("got %d unexpected trailing response bytes", r.Buffered())
+			}
+			if infos := h.Connections(); len(infos) != 1 || infos[0].Requests != 2 {
+				subT.Errorf("Connections() = %v, want a connection that served 2 requests", infos)
+			}
+		})
+	}
+}
+
+func TestHandler_RequestTargetValidation(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		request        string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "encoded null allowed by default",
+			request:        "GET /echo?q=%00 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "encoded null rejected",
+			request:        "GET /echo?q=%00 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithRejectEncodedNull()},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "encoded percent sign is not a null",
+			request:        "GET /echo?q=%2500 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithRejectEncodedNull()},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+		})
+	}
+
+	// Malformed targets never make it to the handler, they are answered with a 400 and the connection is closed
+	malformedTargets := []string{"/echo\x00", "/echo%zz", "/echo%2", "/echo%2/"}
+	for _, target := range malformedTargets {
+		handled := false
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handled = true })
+		h := NewHandler(context.Background(), handler)
+		c := newTestConn()
+		h.Opened(c, c.wake)
+
+		out, action := h.Data(c, []byte("GET "+target+" HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+		if action != Close {
+			t.Errorf("Data() for target %q action = %v, want %v", target, action, Close)
+		}
+
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+		if err != nil {
+			t.Fatalf("unable to read response %q for target %q: %v", out, target, err)
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("response status for target %q = %d, want %d", target, res.StatusCode, http.StatusBadRequest)
+		}
+		if handled {
+			t.Errorf("handler invoked for target %q", target)
+		}
+	}
+}
+
+func TestHandler_RequestVersionValidation(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		version        string
+		expectedStatus int
+	}{
+		{
+			desc:           "misspelled protocol name",
+			version:        "HTPP/1.1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "version without a minor version",
+			version:        "HTTP/1.",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "protocol name without a version",
+			version:        "HTTP/",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			desc:           "unsupported major version",
+			version:        "HTTP/2.0",
+			expectedStatus: http.StatusHTTPVersionNotSupported,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			handled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handled = true })
+			h := NewHandler(context.Background(), handler)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte("GET /echo "+tC.version+"\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			if action != Close {
+				subT.Errorf("Data() action = %v, want %v", action, Close)
+			}
+			expectStatus(subT, out, tC.expectedStatus)
+
+			if handled {
+				subT.Error("handler invoked for a request with an invalid version")
+			}
+		})
+	}
+}
+
+func TestHandler_DataWithoutContext(t *testing.T) {
+	testCases := []struct {
+		ctx            interface{}
+		desc           string
+		input          string
+		expectedStatus int
+	}{
+		{
+			desc:           "nil context",
+			input:          "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "wrong context type",
+			ctx:            &evio.InputStream{},
+			input:          "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc: "nil context woken up",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			c.SetContext(tC.ctx)
+
+			var out []byte
+			var action Action
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						subT.Fatalf("Data() panicked: %v", r)
+					}
+				}()
+				out, action = h.Data(c, []byte(tC.input))
+			}()
+
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+
+			if _, ok := c.Context().(*conn); !ok {
+				subT.Errorf("connection context = %T, want a fresh state", c.Context())
+			}
+
+			if len(h.Connections()) != 1 {
+				subT.Errorf("Connections() = %d connections, want 1", len(h.Connections()))
+			}
+
+			if tC.expectedStatus == 0 {
+				if len(out) > 0 {
+					subT.Errorf("Data() = %q, want no response", out)
+				}
+				return
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_AltSvc(t *testing.T) {
+	testCases := []struct {
+		handler  http.HandlerFunc
+		desc     string
+		expected string
+		opts     []Option
+	}{
+		{
+			desc:     "injected",
+			handler:  internalHttp.Echo,
+			opts:     []Option{WithAltSvc(`h3=":443"; ma=86400`)},
+			expected: `h3=":443"; ma=86400`,
+		},
+		{
+			desc: "handler value takes precedence",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Alt-Svc", "clear")
+				internalHttp.Echo(w, r)
+			},
+			opts:     []Option{WithAltSvc(`h3=":443"; ma=86400`)},
+			expected: "clear",
+		},
+		{
+			desc:     "not injected by default",
+			handler:  internalHttp.Echo,
+			expected: "",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), tC.handler, tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if got := res.Header.Get("Alt-Svc"); got != tC.expected {
+				subT.Errorf("Alt-Svc = %q, want %q", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestHandler_NilHandler(t *testing.T) {
+	testCases := []struct {
+		desc string
+		opts []Option
+	}{
+		{
+			desc: "defaults",
+		},
+		{
+			desc: "with the debug endpoints",
+			opts: []Option{WithDebugEndpoints("/debug")},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), nil, append(tC.opts, WithLogger(&recordingLogger{}))...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+			expectStatus(subT, out, http.StatusNotFound)
+		})
+	}
+}
+
+func TestHandler_DisableKeepAlive(t *testing.T) {
+	request := "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nConnection: keep-alive\r\n\r\n"
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		desc              string
+		opts              []Option
+		expectedResponses int
+		expectedAction    Action
+		expectedClose     bool
+	}{
+		{
+			desc:              "keep-alive by default",
+			expectedResponses: 2,
+			expectedAction:    None,
+			expectedClose:     false,
+		},
+		{
+			desc:              "disabled",
+			opts:              []Option{WithDisableKeepAlive()},
+			expectedResponses: 1,
+			expectedAction:    Close,
+			expectedClose:     true,
+		},
+		{
+			desc:              "disabled with a raw handler",
+			opts:              []Option{WithDisableKeepAlive(), WithRawHandler(raw)},
+			expectedResponses: 1,
+			expectedAction:    Close,
+			expectedClose:     true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			// The second request is pipelined behind the first one
+			out, action := h.Data(c, []byte(request+request))
+			if action != tC.expectedAction {
+				subT.Errorf("Data() action = %v, want %v", action, tC.expectedAction)
+			}
+
+			reader := bufio.NewReader(bytes.NewReader(out))
+			responses := 0
+			for {
+				res, err := http.ReadResponse(reader, nil)
+				if err != nil {
+					break
+				}
+				res.Body.Close()
+				responses++
+
+				if res.Close != tC.expectedClose {
+					subT.Errorf("response %d closes the connection = %v, want %v", responses, res.Close, tC.expectedClose)
+				}
+			}
+
+			if responses != tC.expectedResponses {
+				subT.Errorf("got %d responses, want %d", responses, tC.expectedResponses)
+			}
+		})
+	}
+}
+
+func TestHandler_EmptyBodyKeepsAlive(t *testing.T) {
+	request := "GET /empty HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"
+	testCases := []struct {
+		desc string
+		opts []Option
+	}{
+		{
+			desc: "http handler",
+		},
+		{
+			desc: "raw handler",
+			opts: []Option{WithRawHandler(internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+				w.Header().Set("X-Empty", "true")
+			}))},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Empty", "true")
+				w.WriteHeader(http.StatusOK)
+			}), tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			// The second request is pipelined behind the first one, so it is only served if the first response
+			// keeps the connection alive
+			out, action := h.Data(c, []byte(request+request))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+
+			if n := bytes.Count(out, []byte("\r\nContent-Length: 0\r\n")); n != 2 {
+				subT.Errorf("got %d responses with a Content-Length: 0 header in %q, want 2", n, out)
+			}
+
+			reader := bufio.NewReader(bytes.NewReader(out))
+			for i := 0; i < 2; i++ {
+				res, err := http.ReadResponse(reader, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %d: %v", i+1, err)
+				}
+				if res.StatusCode != http.StatusOK || res.ContentLength != 0 || res.Close {
+					subT.Errorf("response %d = %d with ContentLength %d and Close %v, want 200, 0 and false", i+1, res.StatusCode, res.ContentLength, res.Close)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_MaxURILength(t *testing.T) {
+	// The target "/echo?q=" is 8 bytes long, so the query fills it up to the limit
+	query := strings.Repeat("a", 92)
+
+	testCases := []struct {
+		desc           string
+		request        string
+		opts           []Option
+		expectedStatus int
+		expectedAction Action
+	}{
+		{
+			desc:           "at the limit",
+			request:        "GET /echo?q=" + query + " HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithMaxURILength(100)},
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+		{
+			desc:           "over the limit",
+			request:        "GET /echo?q=" + query + "a HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithMaxURILength(100)},
+			expectedStatus: http.StatusRequestURITooLong,
+			expectedAction: Close,
+		},
+		{
+			desc:           "over the limit before the request line ends",
+			request:        "GET /echo?q=" + query + query,
+			opts:           []Option{WithMaxURILength(100)},
+			expectedStatus: http.StatusRequestURITooLong,
+			expectedAction: Close,
+		},
+		{
+			desc:           "no limit by default",
+			request:        "GET /echo?q=" + query + query + " HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != tC.expectedAction {
+				subT.Errorf("Data() action = %v, want %v", action, tC.expectedAction)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_MaxHeaderValueBytes(t *testing.T) {
+	cookie := strings.Repeat("a", 1000)
+
+	testCases := []struct {
+		desc           string
+		request        string
+		opts           []Option
+		expectedStatus int
+		expectedAction Action
+	}{
+		{
+			desc:           "at the limit",
+			request:        "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCookie: " + cookie + "\r\n\r\n",
+			opts:           []Option{WithMaxHeaderValueBytes(1000)},
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+		{
+			desc:           "oversized cookie",
+			request:        "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCookie: " + cookie + "a\r\n\r\n",
+			opts:           []Option{WithMaxHeaderValueBytes(1000)},
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+			expectedAction: Close,
+		},
+		{
+			desc:           "oversized cookie before the headers end",
+			request:        "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCookie: " + cookie + cookie,
+			opts:           []Option{WithMaxHeaderValueBytes(1000)},
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+			expectedAction: Close,
+		},
+		{
+			desc:           "no limit by default",
+			request:        "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nCookie: " + cookie + cookie + "\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != tC.expectedAction {
+				subT.Errorf("Data() action = %v, want %v", action, tC.expectedAction)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_ResponseInterceptor(t *testing.T) {
+	testCases := []struct {
+		interceptor     ResponseInterceptor
+		expectedHeaders map[string]string
+		desc            string
+		expectedBody    string
+	}{
+		{
+			desc: "adds a header",
+			interceptor: func(req *http.Request, rw *internalHttp.ResponseWriter) {
+				rw.Header().Set("X-Content-Type-Options", "nosniff")
+			},
+			expectedHeaders: map[string]string{"X-Content-Type-Options": "nosniff"},
+			expectedBody:    `{"req": 0}`,
+		},
+		{
+			desc: "redacts the body",
+			interceptor: func(req *http.Request, rw *internalHttp.ResponseWriter) {
+				rw.SetBody(bytes.ReplaceAll(rw.Bytes(), []byte("0"), []byte("*")))
+			},
+			expectedHeaders: map[string]string{"Content-Length": "10"},
+			expectedBody:    `{"req": *}`,
+		},
+		{
+			desc:         "no interceptor",
+			expectedBody: `{"req": 0}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var opts []Option
+			if tC.interceptor != nil {
+				opts = append(opts, WithResponseInterceptor(tC.interceptor))
+			}
+			h := newTestHandler(opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			for header, expected := range tC.expectedHeaders {
+				if got := res.Header.Get(header); got != expected {
+					subT.Errorf("%s = %q, want %q", header, got, expected)
+				}
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandler_HeaderInjection(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		value          string
+		expectedStatus int
+		expectedAction Action
+		expectedLogs   int
+	}{
+		{
+			desc:           "plain value",
+			value:          "bob",
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+		{
+			desc:           "embedded CRLF",
+			value:          "bob\r\nSet-Cookie: session=stolen",
+			expectedStatus: http.StatusInternalServerError,
+			expectedAction: Close,
+			expectedLogs:   1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			logger := &recordingLogger{}
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-User", tC.value)
+				w.Write([]byte("hello"))
+			}), WithLogger(logger))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte("GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			if action != tC.expectedAction {
+				subT.Errorf("Data() action = %v, want %v", action, tC.expectedAction)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+			if got := res.Header.Get("Set-Cookie"); got != "" {
+				subT.Errorf("injected Set-Cookie header %q made it into the response", got)
+			}
+			if bytes.Contains(out, []byte("session=stolen")) {
+				subT.Errorf("response %q contains the injected header", out)
+			}
+			if records := logger.events(EventResponseRejected); len(records) != tC.expectedLogs {
+				subT.Errorf("%d %s records, want %d", len(records), EventResponseRejected, tC.expectedLogs)
+			}
+		})
+	}
+}
+
+func TestHandler_DebugEndpoints(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		prefix       string
+		request      string
+		expectedBody string
+	}{
+		{
+			desc:         "ip is the connection's remote address",
+			prefix:       "/debug",
+			request:      "GET /debug/ip HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedBody: `{"origin":"127.0.0.1"}`,
+		},
+		{
+			desc:         "headers",
+			prefix:       "/debug",
+			request:      "GET /debug/headers HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Test: yes\r\n\r\n",
+			expectedBody: `{"headers":{"Host":"127.0.0.1:8080","X-Test":"yes"}}`,
+		},
+		{
+			desc:         "other paths reach the handler",
+			prefix:       "/debug",
+			request:      "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedBody: `{"req": 0}`,
+		},
+		{
+			desc:         "disabled",
+			request:      "POST /debug/ip HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedBody: `{"req": 0}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(WithDebugEndpoints(tC.prefix))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandler_RawHandler(t *testing.T) {
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.Header().Set("X-Path", string(req.Path()))
+		w.Header().Set("X-Test", string(req.Header("x-test")))
+		w.WriteHeader(http.StatusOK)
+		w.Write(req.Body)
+	})
+
+	testCases := []struct {
+		desc           string
+		request        string
+		expectedPath   string
+		expectedTest   string
+		expectedBody   string
+		opts           []Option
+		expectedStatus int
+		expectedLength int64
+	}{
+		{
+			desc:           "post",
+			request:        "POST /echo?x=1 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Test: yes\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedStatus: http.StatusOK,
+			expectedPath:   "/echo",
+			expectedTest:   "yes",
+			expectedBody:   `{"req": 0}`,
+			expectedLength: 10,
+		},
+		{
+			desc:           "head",
+			request:        "HEAD /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedPath:   "/echo",
+			expectedLength: 0,
+		},
+		{
+			desc:           "body over the limit",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			opts:           []Option{WithMaxBodyBytes(5)},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   http.StatusText(http.StatusRequestEntityTooLarge),
+			expectedLength: int64(len(http.StatusText(http.StatusRequestEntityTooLarge))),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// The http.Handler must never be reached once a RawHandler is set
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subT.Errorf("http.Handler was called for %s %s", r.Method, r.URL)
+			}), append(tC.opts, WithRawHandler(raw))...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if strings.HasPrefix(tC.request, http.MethodHead) {
+				req.Method = http.MethodHead
+			}
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), req)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+			if got := res.Header.Get("X-Path"); got != tC.expectedPath {
+				subT.Errorf("X-Path = %q, want %q", got, tC.expectedPath)
+			}
+			if got := res.Header.Get("X-Test"); got != tC.expectedTest {
+				subT.Errorf("X-Test = %q, want %q", got, tC.expectedTest)
+			}
+			if res.ContentLength != tC.expectedLength {
+				subT.Errorf("ContentLength = %d, want %d", res.ContentLength, tC.expectedLength)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandler_AsteriskTarget(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		request         string
+		expectedAllow   string
+		expectedStatus  int
+		expectedHandled bool
+	}{
+		{
+			desc:           "server-wide options",
+			request:        "OPTIONS * HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  allowedMethods,
+		},
+		{
+			desc:            "options for a resource",
+			request:         "OPTIONS /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: true,
+		},
+		{
+			desc:           "asterisk for another method",
+			request:        "GET * HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var handled bool
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				w.WriteHeader(http.StatusOK)
+			}), WithLogger(&recordingLogger{}))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+			if got := res.Header.Get("Allow"); got != tC.expectedAllow {
+				subT.Errorf("Allow = %q, want %q", got, tC.expectedAllow)
+			}
+			if handled != tC.expectedHandled {
+				subT.Errorf("handler called = %v, want %v", handled, tC.expectedHandled)
+			}
+		})
+	}
+}
+
+func TestHandler_MissingHost(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		request        string
+		expectedAction Action
+		expectedStatus int
+	}{
+		{
+			desc:           "HTTP/1.1 without a Host header",
+			request:        "GET /echo HTTP/1.1\r\nUser-Agent: test\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedAction: Close,
+		},
+		{
+			desc:           "HTTP/1.1 with an empty Host header",
+			request:        "GET /echo HTTP/1.1\r\nHost:\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+		{
+			desc:           "HTTP/1.0 without a Host header",
+			request:        "GET /echo HTTP/1.0\r\nConnection: keep-alive\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedAction: None,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler()
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != tC.expectedAction {
+				subT.Errorf("Data() action = %v, want %v", action, tC.expectedAction)
+			}
+			expectStatus(subT, out, tC.expectedStatus)
+		})
+	}
+}
+
+func TestHandler_BareLFTerminator(t *testing.T) {
+	h := newTestHandler(WithReadTimeout(time.Minute))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	// The request is rejected as soon as it arrives, instead of waiting for a CRLF CRLF until the ReadTimeout
+	out, action := h.Data(c, []byte("GET /echo HTTP/1.1\nHost: 127.0.0.1:8080\n\n"))
+	if action != Close {
+		t.Errorf("Data() action = %v, want %v", action, Close)
+	}
+	expectStatus(t, out, http.StatusBadRequest)
+}
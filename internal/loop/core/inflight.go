@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// OverflowBehavior decides what happens to a request that arrives while MaxInFlight requests are already being handled.
+type OverflowBehavior int
+
+const (
+	// OverflowReject answers the request with a 503 Service Unavailable right away.
+	OverflowReject OverflowBehavior = iota
+	// OverflowQueue blocks the request's event loop until a slot frees up, as long as there are less than
+	// MaxQueuedRequests requests already waiting. Requests that don't fit in the queue are rejected with a 503.
+	OverflowQueue
+)
+
+// inFlight is a semaphore that caps the amount of requests that are dispatched to the http.Handler at the same time,
+// across all of the connections and event loops of a Handler.
+type inFlight struct {
+	slots     chan struct{}
+	queued    int64
+	maxQueued int64
+	overflow  OverflowBehavior
+}
+
+func newInFlight(n, maxQueued int, overflow OverflowBehavior) *inFlight {
+	return &inFlight{
+		slots:     make(chan struct{}, n),
+		maxQueued: int64(maxQueued),
+		overflow:  overflow,
+	}
+}
+
+// acquire takes a slot for a request, queueing for one if the overflow behavior allows it.
+// It reports false when the request should be rejected instead.
+func (l *inFlight) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.overflow != OverflowQueue {
+		return false
+	}
+
+	defer atomic.AddInt64(&l.queued, -1)
+	if queued := atomic.AddInt64(&l.queued, 1); l.maxQueued > 0 && queued > l.maxQueued {
+		return false
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees the slot taken by a request once it has been handled.
+func (l *inFlight) release() {
+	<-l.slots
+}
+
+// waiting returns the amount of requests that are currently queued for a slot.
+func (l *inFlight) waiting() int64 {
+	return atomic.LoadInt64(&l.queued)
+}
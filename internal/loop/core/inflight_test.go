@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_MaxInFlight(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		opts             []Option
+		expectedStatuses []int
+	}{
+		{
+			desc:             "reject overflow",
+			opts:             []Option{WithMaxInFlight(1, OverflowReject)},
+			expectedStatuses: []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		},
+		{
+			desc:             "queue overflow",
+			opts:             []Option{WithMaxInFlight(1, OverflowQueue)},
+			expectedStatuses: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			desc:             "bounded queue overflow",
+			opts:             []Option{WithMaxInFlight(1, OverflowQueue), WithMaxQueuedRequests(1)},
+			expectedStatuses: []int{http.StatusOK, http.StatusOK, http.StatusServiceUnavailable},
+		},
+		{
+			desc:             "no cap",
+			opts:             []Option{WithMaxInFlight(0, OverflowReject)},
+			expectedStatuses: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// The handler holds on to every request until it is released, so that they pile up
+			blocked := make(chan struct{}, len(tC.expectedStatuses))
+			release := make(chan struct{})
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				blocked <- struct{}{}
+				<-release
+				internalHttp.Echo(w, r)
+			})
+			h := NewHandler(context.Background(), handler, tC.opts...)
+
+			var queued int64
+			statuses := make([]chan int, len(tC.expectedStatuses))
+			for i := range tC.expectedStatuses {
+				statuses[i] = make(chan int, 1)
+				c := newTestConn()
+				h.Opened(c, c.wake)
+
+				go func(status chan int) {
+					out, _ := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"))
+					res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+					if err != nil {
+						status <- 0
+						return
+					}
+					status <- res.StatusCode
+				}(statuses[i])
+
+				// Wait for the request to settle (dispatched, queued or answered) before sending the next one,
+				// so that the requests are guaranteed to arrive in order.
+				waitFor(subT, func() bool {
+					return len(blocked) > 0 || len(statuses[i]) > 0 || waiting(h) > queued
+				})
+				if len(blocked) > 0 {
+					<-blocked
+				} else if waiting(h) > queued {
+					queued++
+				}
+			}
+			close(release)
+
+			for i, expected := range tC.expectedStatuses {
+				select {
+				case got := <-statuses[i]:
+					if got != expected {
+						subT.Errorf("request %d status = %d, want %d", i, got, expected)
+					}
+				case <-time.After(time.Second):
+					subT.Fatalf("request %d was never answered", i)
+				}
+			}
+		})
+	}
+}
+
+// waiting returns the amount of requests that are queued for an in flight slot.
+func waiting(h *Handler) int64 {
+	if h.inFlight == nil {
+		return 0
+	}
+	return h.inFlight.waiting()
+}
+
+// waitFor polls the condition until it holds, failing the test if it doesn't within a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
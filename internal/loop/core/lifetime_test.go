@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHandler_MaxConnLifetime(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		request        string
+		opts           []Option
+		expectedAction Action
+		expectedWoken  bool
+	}{
+		{
+			desc:           "idle connection is closed on tick",
+			opts:           []Option{WithMaxConnLifetime(time.Millisecond)},
+			expectedWoken:  true,
+			expectedAction: Close,
+		},
+		{
+			desc:           "request after the lifetime is answered before closing",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			opts:           []Option{WithMaxConnLifetime(time.Millisecond)},
+			expectedAction: Close,
+		},
+		{
+			desc:           "connection within its lifetime is kept",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			opts:           []Option{WithMaxConnLifetime(time.Hour)},
+			expectedAction: None,
+		},
+		{
+			desc:           "no lifetime by default",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}",
+			expectedAction: None,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			time.Sleep(5 * time.Millisecond)
+
+			if tC.request == "" {
+				h.Tick()
+				if (c.woken > 0) != tC.expectedWoken {
+					subT.Fatalf("connection woken %d times, want woken %v", c.woken, tC.expectedWoken)
+				}
+
+				out, action := h.Data(c, nil)
+				if action != tC.expectedAction || len(out) > 0 {
+					subT.Errorf("Data() = %q, %v, want no response and %v", out, action, tC.expectedAction)
+				}
+			} else {
+				out, action := h.Data(c, []byte(tC.request))
+				if action != tC.expectedAction {
+					subT.Errorf("Data() action = %v, want %v", action, tC.expectedAction)
+				}
+
+				res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %q: %v", out, err)
+				}
+
+				if res.StatusCode != http.StatusOK {
+					subT.Errorf("response status = %d, want %d", res.StatusCode, http.StatusOK)
+				}
+
+				if res.Close != (tC.expectedAction == Close) {
+					subT.Errorf("response Connection: close = %v, want %v", res.Close, tC.expectedAction == Close)
+				}
+			}
+
+			expectedExpired := uint64(0)
+			if tC.expectedAction == Close {
+				expectedExpired = 1
+			}
+			if got := h.Stats().ExpiredConnections; got != expectedExpired {
+				subT.Errorf("Stats().ExpiredConnections = %d, want %d", got, expectedExpired)
+			}
+		})
+	}
+}
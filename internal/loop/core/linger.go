@@ -0,0 +1,28 @@
+package core
+
+import (
+	"net"
+	"time"
+)
+
+// LingerSeconds converts a linger duration to the whole seconds expected by SO_LINGER.
+// Positive durations are rounded up so that a sub second linger doesn't turn into an immediate reset.
+func LingerSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// ApplyLinger sets the SO_LINGER behavior of a TCP connection. Negative durations and non TCP connections are left untouched.
+func ApplyLinger(conn net.Conn, d time.Duration) error {
+	if d < 0 {
+		return nil
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	return tcpConn.SetLinger(LingerSeconds(d))
+}
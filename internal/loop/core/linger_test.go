@@ -0,0 +1,83 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package core
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLingerSeconds(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    time.Duration
+		expected int
+	}{
+		{desc: "zero", input: 0, expected: 0},
+		{desc: "sub second rounds up", input: 10 * time.Millisecond, expected: 1},
+		{desc: "whole seconds", input: 3 * time.Second, expected: 3},
+		{desc: "fractional seconds round up", input: 3*time.Second + time.Millisecond, expected: 4},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := LingerSeconds(tC.input); got != tC.expected {
+				subT.Errorf("LingerSeconds() = %d, want %d", got, tC.expected)
+			}
+		})
+	}
+}
+
+func TestApplyLinger(t *testing.T) {
+	testCases := []struct {
+		expectedErr error
+		desc        string
+		linger      time.Duration
+	}{
+		{
+			desc:        "default linger closes gracefully",
+			linger:      -1,
+			expectedErr: io.EOF,
+		},
+		{
+			desc:        "zero linger resets",
+			linger:      0,
+			expectedErr: syscall.ECONNRESET,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				subT.Fatalf("unable to listen: %v", err)
+			}
+			defer ln.Close()
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				subT.Fatalf("unable to dial: %v", err)
+			}
+			defer client.Close()
+
+			server, err := ln.Accept()
+			if err != nil {
+				subT.Fatalf("unable to accept: %v", err)
+			}
+
+			if err := ApplyLinger(server, tC.linger); err != nil {
+				subT.Fatalf("ApplyLinger() error = %v", err)
+			}
+			server.Close()
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = client.Read(make([]byte, 1))
+			if !errors.Is(err, tC.expectedErr) {
+				subT.Errorf("client read error = %v, want %v", err, tC.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// PreboundListener returns the pre-bound listener that the engines serve on instead of binding their own address, as set
+// by WithListener or WithFD, or nil when there is none. A file descriptor is consumed by the listener that is created
+// from it, so it must only be called once.
+func (cfg Config) PreboundListener() (net.Listener, error) {
+	if cfg.Listener != nil {
+		return cfg.Listener, nil
+	}
+
+	if cfg.ListenerFD < 0 {
+		return nil, nil
+	}
+
+	f := os.NewFile(uintptr(cfg.ListenerFD), "listener")
+	if f == nil {
+		return nil, fmt.Errorf("invalid listener file descriptor %d", cfg.ListenerFD)
+	}
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a listener from file descriptor %d: %w", cfg.ListenerFD, err)
+	}
+	return ln, nil
+}
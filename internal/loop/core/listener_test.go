@@ -0,0 +1,112 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_ServePreboundListener(t *testing.T) {
+	testCases := []struct {
+		option func(subT *testing.T, ln net.Listener) Option
+		desc   string
+	}{
+		{
+			desc: "listener",
+			option: func(subT *testing.T, ln net.Listener) Option {
+				return WithListener(ln)
+			},
+		},
+		{
+			desc: "file descriptor",
+			option: func(subT *testing.T, ln net.Listener) Option {
+				// Hand over a descriptor of its own like systemd would, the original listener is closed by the test
+				f, err := ln.(*net.TCPListener).File()
+				if err != nil {
+					subT.Fatalf("unable to get the listener's file: %v", err)
+				}
+				defer f.Close()
+
+				fd, err := syscall.Dup(int(f.Fd()))
+				if err != nil {
+					subT.Fatalf("unable to duplicate the listener's file descriptor: %v", err)
+				}
+				return WithFD(fd)
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				subT.Fatalf("unable to listen: %v", err)
+			}
+			defer ln.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			opts := []Option{tC.option(subT, ln), WithLogger(&recordingLogger{})}
+			prebound, err := NewConfig(opts...).PreboundListener()
+			if err != nil {
+				subT.Fatalf("PreboundListener() error = %v", err)
+			}
+			if prebound == nil {
+				subT.Fatal("PreboundListener() returned no listener")
+			}
+
+			h := NewHandler(ctx, http.HandlerFunc(internalHttp.Echo), opts...)
+			errs := make(chan error, 1)
+			go func() {
+				errs <- h.Serve(prebound)
+			}()
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				subT.Fatalf("unable to connect: %v", err)
+			}
+			defer client.Close()
+
+			r := bufio.NewReader(client)
+			for i := 0; i < 2; i++ {
+				body := fmt.Sprintf(`{"req": %d}`, i)
+				fmt.Fprintf(client, "POST /echo HTTP/1.1\r\nHost: 127.0.0.1\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+
+				res, err := http.ReadResponse(r, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %d: %v", i, err)
+				}
+
+				got, err := ioutil.ReadAll(res.Body)
+				if err != nil {
+					subT.Fatalf("unable to read response body %d: %v", i, err)
+				}
+				if string(got) != body {
+					subT.Errorf("response %d body = %q, want %q", i, got, body)
+				}
+			}
+
+			cancel()
+			if err := <-errs; err != nil {
+				subT.Errorf("Serve() error = %v, want nil once the context is done", err)
+			}
+		})
+	}
+}
+
+func TestConfig_PreboundListenerNone(t *testing.T) {
+	ln, err := NewConfig().PreboundListener()
+	if err != nil || ln != nil {
+		t.Errorf("PreboundListener() = %v, %v, want no listener and no error", ln, err)
+	}
+}
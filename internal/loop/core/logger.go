@@ -0,0 +1,81 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// EventServerStart is logged once the engine is up and serving.
+	EventServerStart = "server.start"
+	// EventServerStop is logged once the engine has shut down.
+	EventServerStop = "server.stop"
+	// EventServerError is logged when the engine fails to apply part of its configuration.
+	EventServerError = "server.error"
+)
+
+// Fields holds the structured data attached to a log record.
+type Fields map[string]interface{}
+
+// Logger receives the structured records emitted by the engines.
+// Implementations must be safe for concurrent use, since records may be logged from any of the event loops.
+type Logger interface {
+	Log(event string, fields Fields)
+}
+
+type jsonLogger struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+// NewJSONLogger returns a Logger that writes every record as a single line JSON object to w.
+// The event name is written under the "event" key alongside the record's fields.
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (l *jsonLogger) Log(event string, fields Fields) {
+	record := make(Fields, len(fields)+1)
+	for k, v := range fields {
+		record[k] = v
+	}
+	record["event"] = event
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// There isn't much we can do if the log destination is failing us
+	_ = l.enc.Encode(record)
+}
+
+// LogServerEvent logs a server lifecycle event (EventServerStart or EventServerStop) for the given backend.
+func (h *Handler) LogServerEvent(event, backend string, port, loops int) {
+	h.config.LogServerEvent(event, backend, port, loops)
+}
+
+// LogServerError logs an EventServerError record for the given backend.
+func (h *Handler) LogServerError(backend string, err error) {
+	h.config.LogServerError(backend, err)
+}
+
+// LogServerEvent logs a server lifecycle event with the Config's Logger, for the engines that serve without a Handler.
+func (cfg Config) LogServerEvent(event, backend string, port, loops int) {
+	cfg.Logger.Log(event, Fields{
+		"backend":   backend,
+		"port":      port,
+		"loops":     loops,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// LogServerError logs an EventServerError record with the Config's Logger, for the engines that serve without a Handler.
+func (cfg Config) LogServerError(backend string, err error) {
+	cfg.Logger.Log(EventServerError, Fields{
+		"backend":   backend,
+		"error":     err.Error(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testRecord struct {
+	fields Fields
+	event  string
+}
+
+// recordingLogger is a Logger that keeps every record in memory so that tests can inspect them.
+type recordingLogger struct {
+	records []testRecord
+	mu      sync.Mutex
+}
+
+func (l *recordingLogger) Log(event string, fields Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, testRecord{event: event, fields: fields})
+}
+
+func (l *recordingLogger) events(event string) []testRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var records []testRecord
+	for _, r := range l.records {
+		if r.event == event {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func TestHandler_LogServerEvent(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		event   string
+		backend string
+		port    int
+		loops   int
+	}{
+		{
+			desc:    "gnet start",
+			event:   EventServerStart,
+			backend: "gnet",
+			port:    8080,
+			loops:   4,
+		},
+		{
+			desc:    "evio stop",
+			event:   EventServerStop,
+			backend: "evio",
+			port:    9090,
+			loops:   1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			logger := &recordingLogger{}
+			h := newTestHandler(WithLogger(logger))
+
+			before := time.Now().UTC()
+			h.LogServerEvent(tC.event, tC.backend, tC.port, tC.loops)
+
+			records := logger.events(tC.event)
+			if len(records) != 1 {
+				subT.Fatalf("got %d %s records, want 1", len(records), tC.event)
+			}
+
+			fields := records[0].fields
+			if fields["backend"] != tC.backend {
+				subT.Errorf("backend = %v, want %v", fields["backend"], tC.backend)
+			}
+			if fields["port"] != tC.port {
+				subT.Errorf("port = %v, want %v", fields["port"], tC.port)
+			}
+			if fields["loops"] != tC.loops {
+				subT.Errorf("loops = %v, want %v", fields["loops"], tC.loops)
+			}
+
+			ts, err := time.Parse(time.RFC3339Nano, fields["timestamp"].(string))
+			if err != nil {
+				subT.Fatalf("unable to parse timestamp %v: %v", fields["timestamp"], err)
+			}
+			if ts.Before(before.Truncate(time.Second)) {
+				subT.Errorf("timestamp %v is before the event was logged at %v", ts, before)
+			}
+		})
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	logger := NewJSONLogger(buf)
+	logger.Log(EventServerStart, Fields{"backend": "gnet", "port": 8080})
+	logger.Log(EventServerStop, Fields{"backend": "gnet", "port": 8080})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(lines[0], &record); err != nil {
+		t.Fatalf("unable to decode record %q: %v", lines[0], err)
+	}
+
+	if record["event"] != EventServerStart || record["backend"] != "gnet" || record["port"] != float64(8080) {
+		t.Errorf("unexpected record %v", record)
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+)
+
+// loopStats counts the connections that each event loop was assigned, see WithLoopStats. Connections are only opened
+// and closed once each, so a mutex is cheap enough, and it lets the counters grow with the loops as they are seen.
+type loopStats struct {
+	// opened counts the connections that were assigned to each loop, and active the ones that are still open.
+	opened []uint64
+	active []uint64
+	mu     sync.Mutex
+}
+
+func (l *loopStats) open(loop int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for len(l.opened) <= loop {
+		l.opened = append(l.opened, 0)
+		l.active = append(l.active, 0)
+	}
+	l.opened[loop]++
+	l.active[loop]++
+}
+
+func (l *loopStats) close(loop int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if loop < len(l.active) && l.active[loop] > 0 {
+		l.active[loop]--
+	}
+}
+
+// snapshot copies the counters into the Stats.
+func (l *loopStats) snapshot(s *Stats) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s.LoopConnections = append([]uint64(nil), l.opened...)
+	s.LoopActiveConnections = append([]uint64(nil), l.active...)
+}
+
+// LoopOpened counts a connection that was opened on one of the engine's event loops, when WithLoopStats is enabled.
+// Engines call it from their own opened event, with their own connection.
+func (h *Handler) LoopOpened(c interface{}) {
+	if h.loops == nil {
+		return
+	}
+
+	if loop := LoopIndex(c); loop >= 0 {
+		h.loops.open(loop)
+	}
+}
+
+// LoopClosed counts a connection that was opened with LoopOpened as closed.
+func (h *Handler) LoopClosed(c interface{}) {
+	if h.loops == nil {
+		return
+	}
+
+	if loop := LoopIndex(c); loop >= 0 {
+		h.loops.close(loop)
+	}
+}
+
+// LoopIndex returns the index of the event loop that an evio or gnet connection was assigned to, or -1 when it can't
+// tell. Neither library exposes it, but both keep the connection's loop in a loop field whose own idx field is the
+// index, so it is read from there with reflection. This is only meant for diagnostics (see WithLoopStats), since it
+// relies on the internals of the versions that the engines are built with.
+func LoopIndex(c interface{}) int {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return -1
+	}
+
+	loop := v.Elem().FieldByName("loop")
+	if loop.Kind() != reflect.Ptr || loop.IsNil() || loop.Elem().Kind() != reflect.Struct {
+		return -1
+	}
+
+	idx := loop.Elem().FieldByName("idx")
+	if idx.Kind() != reflect.Int {
+		return -1
+	}
+	return int(idx.Int())
+}
@@ -0,0 +1,73 @@
+package core
+
+import "testing"
+
+type testLoop struct {
+	idx int
+}
+
+type testLoopConn struct {
+	loop *testLoop
+}
+
+func TestLoopIndex(t *testing.T) {
+	testCases := []struct {
+		conn          interface{}
+		desc          string
+		expectedIndex int
+	}{
+		{
+			desc:          "connection with a loop",
+			conn:          &testLoopConn{loop: &testLoop{idx: 3}},
+			expectedIndex: 3,
+		},
+		{
+			desc:          "connection without a loop yet",
+			conn:          &testLoopConn{},
+			expectedIndex: -1,
+		},
+		{
+			desc:          "connection without loops",
+			conn:          newTestConn(),
+			expectedIndex: -1,
+		},
+		{
+			desc:          "nil connection",
+			conn:          (*testLoopConn)(nil),
+			expectedIndex: -1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := LoopIndex(tC.conn); got != tC.expectedIndex {
+				subT.Errorf("LoopIndex() = %d, want %d", got, tC.expectedIndex)
+			}
+		})
+	}
+}
+
+func TestHandler_LoopStats(t *testing.T) {
+	h := newTestHandler(WithLoopStats())
+	conns := []*testLoopConn{
+		{loop: &testLoop{idx: 0}},
+		{loop: &testLoop{idx: 1}},
+		{loop: &testLoop{idx: 1}},
+	}
+	for _, c := range conns {
+		h.LoopOpened(c)
+	}
+	h.LoopClosed(conns[1])
+
+	stats := h.Stats()
+	if got := stats.LoopConnections; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("LoopConnections = %v, want [1 2]", got)
+	}
+	if got := stats.LoopActiveConnections; len(got) != 2 || got[0] != 1 || got[1] != 1 {
+		t.Errorf("LoopActiveConnections = %v, want [1 1]", got)
+	}
+
+	// The stats are only tracked when enabled
+	if stats := newTestHandler().Stats(); stats.LoopConnections != nil {
+		t.Errorf("LoopConnections = %v without WithLoopStats, want nil", stats.LoopConnections)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// allowedMethods is the Allow header of OPTIONS requests that are answered locally.
+const allowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, TRACE"
+
+// maxForwards handles the Max-Forwards header of TRACE and OPTIONS requests (RFC 7231 section 5.1.2), and reports
+// whether the request has run out of hops, in which case it must be answered by the recipient instead of being
+// forwarded. Otherwise, the header is decremented for the handler, since anything that it forwards the request to
+// is one hop further. A malformed header is reported as not ok.
+func maxForwards(req *http.Request) (local bool, ok bool) {
+	value := req.Header.Get("Max-Forwards")
+	if value == "" {
+		return false, true
+	}
+
+	hops, err := strconv.ParseUint(value, 10, 63)
+	if err != nil {
+		return false, false
+	}
+
+	if hops == 0 {
+		return true, true
+	}
+
+	req.Header.Set("Max-Forwards", strconv.FormatUint(hops-1, 10))
+	return false, true
+}
+
+// answerLocally populates the response to a TRACE or OPTIONS request that is answered by the server itself, either
+// because it has run out of hops, or because it is an OPTIONS request for the server as a whole. TRACE requests get
+// the request line and headers that were received reflected back to them (without the body, which TRACE requests
+// must not have), and OPTIONS requests get the methods that the server supports.
+func answerLocally(req *http.Request, data []byte, res *internalHttp.ResponseWriter) {
+	if req.Method == http.MethodOptions {
+		res.Header().Set("Allow", allowedMethods)
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	res.Header().Set("Content-Type", "message/http")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data[:internalHttp.HeaderLength(data)])
+}
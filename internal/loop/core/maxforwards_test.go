@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_MaxForwards(t *testing.T) {
+	testCases := []struct {
+		desc                string
+		request             string
+		expectedBody        string
+		expectedAllow       string
+		expectedForwarded   string
+		expectedContentType string
+		expectedStatus      int
+		expectedHandled     bool
+	}{
+		{
+			desc:                "trace at zero hops is reflected",
+			request:             "TRACE /resource HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nMax-Forwards: 0\r\nX-Test: yes\r\n\r\n",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "message/http",
+			expectedBody:        "TRACE /resource HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nMax-Forwards: 0\r\nX-Test: yes\r\n\r\n",
+		},
+		{
+			desc:           "options at zero hops lists the methods",
+			request:        "OPTIONS * HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nMax-Forwards: 0\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedAllow:  allowedMethods,
+		},
+		{
+			desc:              "trace with hops left is decremented",
+			request:           "TRACE /resource HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nMax-Forwards: 5\r\n\r\n",
+			expectedStatus:    http.StatusOK,
+			expectedHandled:   true,
+			expectedForwarded: "4",
+		},
+		{
+			desc:            "trace without max-forwards",
+			request:         "TRACE /resource HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: true,
+		},
+		{
+			desc:              "other methods are ignored",
+			request:           "GET /resource HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nMax-Forwards: 0\r\n\r\n",
+			expectedStatus:    http.StatusOK,
+			expectedHandled:   true,
+			expectedForwarded: "0",
+		},
+		{
+			desc:           "malformed max-forwards",
+			request:        "TRACE /resource HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nMax-Forwards: -1\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   http.StatusText(http.StatusBadRequest),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var handled bool
+			var forwarded string
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				forwarded = r.Header.Get("Max-Forwards")
+				w.WriteHeader(http.StatusOK)
+			}), WithLogger(&recordingLogger{}))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+			if handled != tC.expectedHandled {
+				subT.Errorf("handler called = %v, want %v", handled, tC.expectedHandled)
+			}
+			if forwarded != tC.expectedForwarded {
+				subT.Errorf("Max-Forwards seen by the handler = %q, want %q", forwarded, tC.expectedForwarded)
+			}
+			if got := res.Header.Get("Allow"); got != tC.expectedAllow {
+				subT.Errorf("Allow = %q, want %q", got, tC.expectedAllow)
+			}
+			if got := res.Header.Get("Content-Type"); tC.expectedContentType != "" && got != tC.expectedContentType {
+				subT.Errorf("Content-Type = %q, want %q", got, tC.expectedContentType)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package core
+
+import (
+	"net"
+	"strings"
+)
+
+// misdirected reports whether a request with the Host was sent on a TLS connection that was established for another
+// server name (SNI), which RFC 7540 section 9.1.2 answers with a 421 Misdirected Request. Clients that coalesce
+// connections to different hosts onto a single connection send such requests by mistake, and the certificate that was
+// presented for the server name may not even be valid for the Host. Connections without TLS, or whose client didn't
+// send a server name (e.g. because it connected to an IP address), have nothing to compare against.
+func (h *Handler) misdirected(state *conn, host string) bool {
+	if !h.config.RejectMisdirected || state.serverName == "" {
+		return false
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return !strings.EqualFold(strings.TrimSuffix(host, "."), state.serverName)
+}
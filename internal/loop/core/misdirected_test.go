@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestServeConn_RejectMisdirected(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+
+	testCases := []struct {
+		desc           string
+		serverName     string
+		host           string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "matching host",
+			serverName:     "example.com",
+			host:           "example.com",
+			opts:           []Option{WithRejectMisdirected()},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "matching host with a port and in another case",
+			serverName:     "example.com",
+			host:           "EXAMPLE.com:8443",
+			opts:           []Option{WithRejectMisdirected()},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "mismatched host",
+			serverName:     "example.com",
+			host:           "other.example.com",
+			opts:           []Option{WithRejectMisdirected()},
+			expectedStatus: http.StatusMisdirectedRequest,
+		},
+		{
+			desc:           "mismatched host without the option",
+			serverName:     "example.com",
+			host:           "other.example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			// Clients don't send a server name when they connect to an IP address
+			desc:           "client without a server name",
+			serverName:     "127.0.0.1",
+			host:           "other.example.com",
+			opts:           []Option{WithRejectMisdirected()},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			opts := append([]Option{WithLogger(&recordingLogger{}), WithTLSUpgrade(serverTLS)}, tC.opts...)
+			go func() {
+				_ = ServeConn(ctx, server, handler, opts...)
+			}()
+
+			// The request that asks for the upgrade was sent before the server name, so only the ones after it are checked
+			go func() {
+				_, _ = client.Write([]byte("GET /upgrade HTTP/1.1\r\nHost: " + tC.serverName + "\r\nUpgrade: TLS/1.0\r\nConnection: Upgrade\r\n\r\n"))
+			}()
+			r := bufio.NewReader(client)
+			res, err := http.ReadResponse(r, nil)
+			if err != nil || res.StatusCode != http.StatusSwitchingProtocols {
+				subT.Fatalf("response = %v, %v, want a 101", res, err)
+			}
+
+			config := clientTLS.Clone()
+			config.ServerName = tC.serverName
+			tlsConn := tls.Client(client, config)
+			if err := tlsConn.Handshake(); err != nil {
+				subT.Fatalf("unable to complete the TLS handshake: %v", err)
+			}
+			r = bufio.NewReader(tlsConn)
+			res, err = http.ReadResponse(r, nil)
+			if err != nil {
+				subT.Fatalf("unable to read the response to the upgrade request: %v", err)
+			}
+			expectBody(subT, res, "/upgrade")
+
+			go func() {
+				_, _ = tlsConn.Write([]byte("GET /second HTTP/1.1\r\nHost: " + tC.host + "\r\n\r\n"))
+			}()
+			res, err = http.ReadResponse(r, nil)
+			if err != nil {
+				subT.Fatalf("unable to read the second response: %v", err)
+			}
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+			if tC.expectedStatus == http.StatusMisdirectedRequest && !res.Close {
+				subT.Error("misdirected request didn't close the connection")
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_MultipartUpload(t *testing.T) {
+	photo := bytes.Repeat([]byte("\xff\xd8\xff\xe0photo"), 1<<12)
+	photoSum := sha256.Sum256(photo)
+	expectedSum := hex.EncodeToString(photoSum[:])
+
+	body := bytes.NewBuffer(nil)
+	mw := multipart.NewWriter(body)
+	_ = mw.WriteField("title", "holiday")
+	fw, _ := mw.CreateFormFile("photo", "beach.jpg")
+	_, _ = fw.Write(photo)
+	_ = mw.Close()
+
+	// The title is read from the form, and the photo is streamed through a hash without being kept in memory
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 10); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		f, header, err := r.FormFile("photo")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+
+		sum := sha256.New()
+		_, _ = io.Copy(sum, f)
+		w.Header().Set("X-Title", r.FormValue("title"))
+		w.Header().Set("X-Filename", header.Filename)
+		w.Header().Set("X-Sum", hex.EncodeToString(sum.Sum(nil)))
+	})
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		mr, err := req.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			switch part.FormName() {
+			case "title":
+				title, _ := io.ReadAll(part)
+				w.Header().Set("X-Title", string(title))
+			case "photo":
+				sum := sha256.New()
+				_, _ = io.Copy(sum, part)
+				w.Header().Set("X-Filename", part.FileName())
+				w.Header().Set("X-Sum", hex.EncodeToString(sum.Sum(nil)))
+			}
+		}
+	})
+
+	testCases := []struct {
+		desc string
+		opts []Option
+	}{
+		{
+			desc: "buffered body",
+		},
+		{
+			desc: "body spilled to disk",
+			opts: []Option{WithBodySpill(1<<10, t.TempDir())},
+		},
+		{
+			desc: "raw handler",
+			opts: []Option{WithRawHandler(raw)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), handler, tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			head := "POST /upload HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Type: " + mw.FormDataContentType() +
+				"\r\nContent-Length: " + strconv.Itoa(body.Len()) + "\r\n\r\n"
+			out, _ := h.Data(c, []byte(head))
+
+			// The body arrives in several reads, like a large upload would
+			data := body.Bytes()
+			for len(data) > 0 {
+				n := 4096
+				if n > len(data) {
+					n = len(data)
+				}
+				var res []byte
+				res, _ = h.Data(c, data[:n])
+				out = append(out, res...)
+				data = data[n:]
+			}
+
+			res := expectStatus(subT, out, http.StatusOK)
+			for name, expected := range map[string]string{"X-Title": "holiday", "X-Filename": "beach.jpg", "X-Sum": expectedSum} {
+				if got := res.Header.Get(name); got != expected {
+					subT.Errorf("%s = %q, want %q", name, got, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,760 @@
+package core
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// Config holds the settings of a Handler. It is built by applying Options on top of the defaults.
+type Config struct {
+	// Logger receives the structured records emitted by the engines. It defaults to JSON lines on stdout.
+	Logger Logger
+	// ExpectationChecker decides whether the body of a request sent with Expect: 100-continue is accepted.
+	// When nil, every body within MaxBodyBytes is accepted.
+	ExpectationChecker ExpectationChecker
+	// CORS enables Cross-Origin Resource Sharing on its routes. When nil, no CORS headers are added.
+	CORS *CORS
+	// Favicon answers GET and HEAD requests for /favicon.ico without dispatching them to the handler. When nil, they
+	// are dispatched like any other request.
+	Favicon *Favicon
+	// RootResponse answers GET and HEAD requests for exactly / without dispatching them to the handler. When nil, they
+	// are dispatched like any other request.
+	RootResponse *RootResponse
+	// TLSUpgrade is the TLS configuration of connections that are upgraded to TLS with an Upgrade: TLS/1.0 header.
+	// When nil, such requests are served in cleartext.
+	TLSUpgrade *tls.Config
+	// TLSSessionTickets rotates the keys of the session tickets that upgraded connections are resumed with. When nil,
+	// the tls package manages the keys of the TLSUpgrade config itself.
+	TLSSessionTickets *TLSSessionTickets
+	// Listener is a pre-bound listener that the engines serve on instead of binding their own address.
+	Listener net.Listener
+	// ContextFactory makes the context of every new connection. When nil, the Handler's own state is the context.
+	ContextFactory ContextFactory
+	// ConnErrorHandler is called whenever a connection is closed with an error. When nil, the errors are printed.
+	ConnErrorHandler ConnErrorHandler
+	// AltSvc is the value of the Alt-Svc header when AutoHeaderAltSvc is enabled (WithAltSvc enables it).
+	AltSvc string
+	// DebugPrefix is the path prefix that the debugging endpoints are served under. When empty, they are disabled.
+	DebugPrefix string
+	// SpillDir is the directory that spilled request bodies are written to. When empty, os.TempDir is used.
+	SpillDir string
+	// ServerName is the value of the Server header when AutoHeaderServer is enabled.
+	ServerName string
+	// RawHandler replaces the http.Handler when set, and is dispatched lightweight Requests instead of http.Requests.
+	RawHandler internalHttp.RawHandler
+	// ResponseInterceptor is called with every response populated by the handler before it is written.
+	ResponseInterceptor ResponseInterceptor
+	// PhaseObserver is called with the time spent in each phase of every request. When nil, the phases aren't timed.
+	PhaseObserver PhaseObserver
+	// StaticResponses are the precomputed responses that GET requests for exactly their paths are answered with,
+	// without being parsed or dispatched to the handler.
+	StaticResponses map[string][]byte
+	// ErrorPages are the templates of the bodies of the error responses by status code, see WithErrorPage.
+	ErrorPages map[int]ErrorPage
+	// SecurityHeaders are the headers added when AutoHeaderSecurity is enabled (WithSecurityHeaders enables it).
+	SecurityHeaders http.Header
+	// Bindings are the extra ports that the engines listen on, each with its own handler.
+	Bindings []Binding
+	// Digests are the body digests that are validated when a request declares them. Requests whose body
+	// doesn't match a declared digest are rejected with a 400.
+	Digests []Digest
+	// RouteTimeouts override the timeouts of the requests for the routes under their prefixes.
+	RouteTimeouts []RouteTimeout
+	// Sunsets are the deprecated routes, whose responses advertise when they were deprecated and when they go away.
+	Sunsets []Sunset
+	// MaxBufferedBytes is the budget for the bytes of incomplete requests that are buffered across the connections of
+	// each event loop. Going over it is handled according to the BudgetPolicy. Zero disables the budget.
+	MaxBufferedBytes int64
+	// MaxBodyBytes is the largest request body that will be accepted, both as declared by the Content-Length header
+	// and after decompression. Requests over the limit are rejected with a 413, and an http.Handler that reads past it
+	// anyway gets ErrBodyTooLarge from its Body. Zero disables the limit.
+	MaxBodyBytes int64
+	// SpillThreshold is the declared Content-Length above which a request body is written to a temporary file in
+	// SpillDir as it arrives, instead of being buffered in memory. Zero disables spilling.
+	SpillThreshold int64
+	// ForceResponseProtoMajor and ForceResponseProtoMinor override the HTTP version that responses are written with.
+	// When ForceResponseProtoMajor is zero, responses mirror the version of the request they answer.
+	ForceResponseProtoMajor int
+	ForceResponseProtoMinor int
+	// MaxInFlight caps the amount of requests that are dispatched to the http.Handler at the same time across all connections.
+	// Requests over the cap are handled according to InFlightOverflow. Zero disables the cap.
+	MaxInFlight int
+	// MaxRequestRate caps the amount of requests per second that are accepted across all connections. Requests over
+	// the rate are shed with a 503. Zero disables the cap.
+	MaxRequestRate int
+	// RequestBurst is the amount of requests that may be accepted at once over the MaxRequestRate after a quiet period.
+	RequestBurst int
+	// MaxQueuedRequests is the most requests that may wait for a slot when InFlightOverflow is OverflowQueue. Zero doesn't limit the queue.
+	MaxQueuedRequests int
+	// BudgetPolicy decides what happens to connections when the MaxBufferedBytes is exceeded.
+	BudgetPolicy BudgetPolicy
+	// Dispatch decides which goroutine runs the handler of a connection's requests on the gnet engine.
+	Dispatch DispatchModel
+	// WorkerPoolSize is the amount of goroutines of the DispatchWorkerPool. Zero uses runtime.GOMAXPROCS.
+	WorkerPoolSize int
+	// InFlightOverflow decides whether requests over MaxInFlight are rejected with a 503 or queued.
+	InFlightOverflow OverflowBehavior
+	// MaxURILength is the longest request target (path and query) that will be accepted. Requests with longer
+	// targets are rejected with a 414. Zero disables the limit.
+	MaxURILength int
+	// MaxHeaderValueBytes is the longest single header value that will be accepted. Requests with a longer value are
+	// rejected with a 431. Zero disables the limit.
+	MaxHeaderValueBytes int
+	// TCPFastOpenQueue enables TCP Fast Open on the listener with up to this many pending Fast Open requests.
+	// Zero disables it.
+	TCPFastOpenQueue int
+	// ListenerFD is the file descriptor of a pre-bound listener that the engines serve on instead of binding their own
+	// address, e.g. one passed down by systemd socket activation or by the previous process during a restart.
+	// A negative value disables it. Only one of Listener and ListenerFD may be set.
+	ListenerFD int
+	// AutoHeaders is the set of headers that are added automatically to responses that don't set them.
+	AutoHeaders AutoHeader
+	// TraceFormats is the set of trace context propagation formats that are extracted from requests into their
+	// context (see TraceContextFrom). Zero disables the extraction.
+	TraceFormats TraceFormat
+	// RecordExchanges is the amount of most recent request/response exchanges that are kept in memory for debugging.
+	// Zero disables recording.
+	RecordExchanges int
+	// ReadTimeout is the longest a request may take to arrive, measured from its first byte. Connections whose request
+	// takes longer are closed on the next tick of the event loop (ticks happen every second). Zero disables the timeout.
+	ReadTimeout time.Duration
+	// BodyReadTimeout is the longest the body of a request may take to arrive, measured from when its headers were
+	// complete. Connections whose body takes longer get a 408 Request Timeout on the next tick of the event loop, and
+	// are closed. Zero disables the timeout.
+	BodyReadTimeout time.Duration
+	// HandlerTimeout is the longest the handler may take to serve a request. The request's context is cancelled once
+	// it passes, and the response of a handler that returns after that is replaced with a 503 Service Unavailable.
+	// Handlers run on the event loop, so they can't be interrupted, only told to stop, or abandoned (see
+	// AbandonTimedOutHandlers). Zero disables the timeout.
+	HandlerTimeout time.Duration
+	// MaxConnLifetime is the longest a connection may stay open regardless of its activity. Connections that outlive it
+	// are closed after the response that is in flight, or on the next tick of the event loop when idle. Zero disables it.
+	MaxConnLifetime time.Duration
+	// SlowHandlerThreshold is how long a handler may run on an event loop before an EventSlowHandler warning is logged.
+	// Zero disables the watchdog.
+	SlowHandlerThreshold time.Duration
+	// Linger controls the SO_LINGER behavior of closed connections. A negative value keeps the OS default,
+	// zero resets connections (RST) as soon as they are closed, and a positive value lingers for up to that long
+	// (rounded up to whole seconds) to flush unsent data.
+	Linger time.Duration
+	// RequestTimeoutResponse makes connections that hit the ReadTimeout get a 408 Request Timeout response before they are closed.
+	RequestTimeoutResponse bool
+	// DisableKeepAlive closes every connection after its first response, which carries a Connection: close header.
+	DisableKeepAlive bool
+	// RejectEncodedNull rejects requests whose target contains a percent-encoded null byte (%00) with a 400.
+	RejectEncodedNull bool
+	// Ranges enables serving single byte ranges of complete 200 responses to GET and HEAD requests.
+	Ranges bool
+	// CloseDelimitedBodies enables HTTP/1.0 request bodies that are delimited by the client closing its side of the connection.
+	CloseDelimitedBodies bool
+	// DecompressRequests enables transparent decompression of gzip encoded request bodies.
+	DecompressRequests bool
+	// GenerateTraces gives requests that don't carry a trace context in any of the TraceFormats a new one.
+	GenerateTraces bool
+	// RejectMisdirected rejects requests on TLS connections whose Host doesn't match the connection's server name with a 421.
+	RejectMisdirected bool
+	// ProxyProtocol requires every connection to start with a PROXY protocol (v1 or v2) header, whose source address
+	// replaces the connection's remote address.
+	ProxyProtocol bool
+	// LoopStats tracks how many connections each event loop is assigned, see WithLoopStats.
+	LoopStats bool
+	// ETags gives successful GET and HEAD responses an ETag computed from their body, see WithETags.
+	ETags bool
+	// ServerTiming reports the phases of every request in a Server-Timing response header, see WithServerTiming.
+	ServerTiming bool
+	// AbandonTimedOutHandlers answers the requests whose handler runs past its HandlerTimeout with a 503 as soon as it
+	// passes, instead of once the handler returns, see WithAbandonTimedOutHandlers.
+	AbandonTimedOutHandlers bool
+}
+
+// ResponseInterceptor is called with a request and the response that the handler populated for it, after the handler
+// returns and before the response is written. It may modify the response's status, headers and body (see
+// ResponseWriter.Bytes and ResponseWriter.SetBody), and must not hold on to either of them after it returns.
+type ResponseInterceptor func(req *http.Request, rw *internalHttp.ResponseWriter)
+
+// Option configures a Handler.
+type Option func(*Config)
+
+// NewConfig builds a Config by applying the options on top of the defaults.
+func NewConfig(opts ...Option) Config {
+	cfg := Config{
+		Logger:      NewJSONLogger(os.Stdout),
+		Linger:      -1,
+		ListenerFD:  -1,
+		AutoHeaders: DefaultAutoHeaders,
+		ServerName:  DefaultServerName,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithForceResponseVersion makes every response use the given HTTP version regardless of the request's version.
+// This is mostly useful for testing clients and for some proxy setups.
+func WithForceResponseVersion(major, minor int) Option {
+	return func(cfg *Config) {
+		cfg.ForceResponseProtoMajor = major
+		cfg.ForceResponseProtoMinor = minor
+	}
+}
+
+// WithMaxBodyBytes sets the largest request body that will be accepted. Zero disables the limit.
+func WithMaxBodyBytes(n int64) Option {
+	return func(cfg *Config) {
+		cfg.MaxBodyBytes = n
+	}
+}
+
+// WithRequestDecompression enables transparent decompression of request bodies sent with Content-Encoding: gzip.
+// The handler receives the decompressed body, and the Content-Encoding header is removed from the request. Bodies are
+// decompressed in memory, so it should be paired with WithMaxBodyBytes to keep a small compressed payload from
+// expanding without bounds.
+func WithRequestDecompression() Option {
+	return func(cfg *Config) {
+		cfg.DecompressRequests = true
+	}
+}
+
+// WithLogger sets the Logger that receives the structured records emitted by the engines.
+func WithLogger(logger Logger) Option {
+	return func(cfg *Config) {
+		cfg.Logger = logger
+	}
+}
+
+// WithLinger sets the SO_LINGER behavior of closed connections. A negative duration keeps the OS default, and zero
+// makes closing a connection send an immediate RST, which is useful for tearing down abusive connections quickly.
+// The gnet engine applies it on the listening socket (accepted sockets inherit it), the stdlib engine applies it on
+// every accepted connection, and evio doesn't expose its sockets so it ignores it.
+func WithLinger(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Linger = d
+	}
+}
+
+// WithRecording keeps the raw bytes of the last n request/response exchanges in memory for debugging.
+// The recorded exchanges are available through the engine's Exchanges method. Since every recorded exchange
+// is copied, this should only be enabled while troubleshooting.
+func WithRecording(n int) Option {
+	return func(cfg *Config) {
+		cfg.RecordExchanges = n
+	}
+}
+
+// WithReadTimeout sets the longest a request may take to arrive, measured from its first byte.
+func WithReadTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.ReadTimeout = d
+	}
+}
+
+// WithBodyReadTimeout sets the longest the body of a request may take to arrive, measured from when its headers were
+// complete, so that clients that declare a large body and then dribble it can't hold on to a connection for as long
+// as the ReadTimeout allows. Requests whose body takes longer are answered with a 408 Request Timeout, and their
+// connection is closed.
+func WithBodyReadTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.BodyReadTimeout = d
+	}
+}
+
+// WithHandlerTimeout sets the longest the handler may take to serve a request. Once it passes, the request's context
+// is cancelled so that the handler can give up, and its response is replaced with a 503 Service Unavailable. RawHandlers
+// aren't handed a context, so their response is replaced once they return late, but they can't be told to stop.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.HandlerTimeout = d
+	}
+}
+
+// WithRouteTimeouts overrides the ReadTimeout, BodyReadTimeout and HandlerTimeout of the requests for the routes under
+// the prefixes, for endpoints like uploads and long-polling that legitimately need longer (or shorter) than the rest.
+// The route of a request is only known once its headers have arrived, so the read timeouts are only overridden for
+// requests whose body arrives after them. When the path of a request falls under several prefixes, the longest one wins.
+func WithRouteTimeouts(routes ...RouteTimeout) Option {
+	return func(cfg *Config) {
+		cfg.RouteTimeouts = append(cfg.RouteTimeouts, routes...)
+	}
+}
+
+// WithRequestTimeoutResponse makes the engine answer requests that hit the ReadTimeout with a
+// 408 Request Timeout (and Connection: close) instead of closing the connection without a word.
+// Connections that haven't sent any bytes of a request are still closed without a response.
+func WithRequestTimeoutResponse() Option {
+	return func(cfg *Config) {
+		cfg.RequestTimeoutResponse = true
+	}
+}
+
+// WithExpectationChecker sets the callback that decides whether the body of a request sent with
+// Expect: 100-continue is accepted (and a 100 Continue is sent) or rejected with a final response.
+func WithExpectationChecker(checker ExpectationChecker) Option {
+	return func(cfg *Config) {
+		cfg.ExpectationChecker = checker
+	}
+}
+
+// WithRejectEncodedNull rejects requests whose target contains a percent-encoded null byte (%00) with a 400.
+// Raw control characters in the target are always rejected.
+func WithRejectEncodedNull() Option {
+	return func(cfg *Config) {
+		cfg.RejectEncodedNull = true
+	}
+}
+
+// WithDigestValidation validates request bodies against the given digests (e.g. ContentMD5) when a request
+// declares them, rejecting mismatches with a 400 before the request is dispatched.
+func WithDigestValidation(digests ...Digest) Option {
+	return func(cfg *Config) {
+		cfg.Digests = append(cfg.Digests, digests...)
+	}
+}
+
+// WithConnErrorHandler sets the callback that is invoked whenever a connection is closed with an error, instead of
+// printing it. The error is a *ConnError, whose Category can be used to alert on or count specific classes of errors.
+func WithConnErrorHandler(handler ConnErrorHandler) Option {
+	return func(cfg *Config) {
+		cfg.ConnErrorHandler = handler
+	}
+}
+
+// WithMaxInFlight caps the amount of requests that are dispatched to the http.Handler at the same time across all
+// connections and event loops. Requests that arrive while the cap is reached are either rejected with a 503 right
+// away (OverflowReject), or block their event loop until a slot frees up (OverflowQueue).
+func WithMaxInFlight(n int, overflow OverflowBehavior) Option {
+	return func(cfg *Config) {
+		cfg.MaxInFlight = n
+		cfg.InFlightOverflow = overflow
+	}
+}
+
+// WithDispatch sets the DispatchModel of the gnet engine (DispatchInline by default) and the size of its worker pool.
+func WithDispatch(model DispatchModel, workers int) Option {
+	return func(cfg *Config) {
+		cfg.Dispatch = model
+		cfg.WorkerPoolSize = workers
+	}
+}
+
+// WithMaxQueuedRequests bounds the amount of requests that may wait for a slot with OverflowQueue.
+// Requests that arrive while the queue is full are rejected with a 503.
+func WithMaxQueuedRequests(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxQueuedRequests = n
+	}
+}
+
+// WithAltSvc adds an Alt-Svc header with the given value (e.g. `h3=":443"; ma=86400`) to every response,
+// advertising alternative services that clients may switch to. Handlers that set their own Alt-Svc header keep it.
+// It enables AutoHeaderAltSvc, so it must come before any WithAutoHeaders that should be able to turn it back off.
+func WithAltSvc(value string) Option {
+	return func(cfg *Config) {
+		cfg.AltSvc = value
+		cfg.AutoHeaders |= AutoHeaderAltSvc
+	}
+}
+
+// WithCORS enables Cross-Origin Resource Sharing on the routes configured in cors. Responses to allowed origins get
+// the Access-Control-Allow-Origin header, and preflight requests are answered without being dispatched to the handler.
+func WithCORS(cors CORS) Option {
+	return func(cfg *Config) {
+		cfg.CORS = &cors
+	}
+}
+
+// WithFavicon answers the GET and HEAD requests for /favicon.ico that browsers send on their own with the favicon,
+// without dispatching them to the handler. The zero Favicon answers them with an empty 404, which keeps APIs that
+// don't have an icon from seeing (and logging) these requests at all.
+func WithFavicon(favicon Favicon) Option {
+	return func(cfg *Config) {
+		cfg.Favicon = &favicon
+	}
+}
+
+// WithRootResponse answers the GET and HEAD requests for exactly / with the response, without dispatching them to the
+// handler, which gives a bare server a landing page or a health check. Every other path, including ones under /,
+// still reaches the handler. The zero RootResponse answers them with an empty 200.
+func WithRootResponse(root RootResponse) Option {
+	return func(cfg *Config) {
+		cfg.RootResponse = &root
+	}
+}
+
+// WithStaticResponse answers GET requests for exactly the path with the precomputed response, which is a complete
+// HTTP/1.1 response (see StaticResponse) that is written as is, straight from the data of the request: the request
+// isn't parsed, and neither a ResponseWriter nor the response are built for it. This makes for the cheapest possible
+// health checks and small cached bodies, at the cost of everything else that the server does to its responses, so
+// none of the other options that add headers to or change the responses apply to it: CORS headers, ETags,
+// Server-Timing, the ResponseInterceptor and the like are all skipped. Requests that the response isn't right for as
+// is (HEAD, HTTP/1.0 or with a Connection header) are served the usual way, and so is every request when
+// WithMaxRequestRate is set, and every request on a TLS connection with a server name when WithRejectMisdirected is
+// set, so that they are still checked. The response must not be modified after it is registered.
+func WithStaticResponse(path string, response []byte) Option {
+	return func(cfg *Config) {
+		responses := make(map[string][]byte, len(cfg.StaticResponses)+1)
+		for p, res := range cfg.StaticResponses {
+			responses[p] = res
+		}
+		responses[path] = response
+		cfg.StaticResponses = responses
+	}
+}
+
+// WithErrorPage answers the error responses with the status (which must be a 4xx or 5xx) with a body rendered from
+// the template, so that error pages are consistent across the server. In the template, {{status}}, {{reason}} and
+// {{request_id}} are replaced with the status code (e.g. 404), its reason phrase (e.g. Not Found) and the ID of the
+// request (see RequestIDHeader). The page is used for the errors that the Handler answers with itself, and for the
+// responses with the status that the handler returns without writing a body. An empty contentType is plain text.
+func WithErrorPage(status int, contentType, template string) Option {
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	return func(cfg *Config) {
+		pages := make(map[int]ErrorPage, len(cfg.ErrorPages)+1)
+		for s, page := range cfg.ErrorPages {
+			pages[s] = page
+		}
+		pages[status] = ErrorPage{ContentType: contentType, Template: template}
+		cfg.ErrorPages = pages
+	}
+}
+
+// WithPhaseObserver reports how the time spent serving every request breaks down into parsing, the handler and
+// serializing the response, for finding out where the time goes when profiling. Timing the phases reads the clock
+// a few times per request, so it is best left off when it isn't needed.
+func WithPhaseObserver(observer PhaseObserver) Option {
+	return func(cfg *Config) {
+		cfg.PhaseObserver = observer
+	}
+}
+
+// WithSunsets adds the Deprecation, Sunset and Link headers of the deprecated routes to the responses that the handler
+// writes for them, so that API versions can be retired without every handler having to announce it. When the path of
+// a request falls under several prefixes, the longest one wins.
+func WithSunsets(sunsets ...Sunset) Option {
+	return func(cfg *Config) {
+		cfg.Sunsets = append(cfg.Sunsets, sunsets...)
+	}
+}
+
+// WithTLSUpgrade lets clients upgrade their cleartext connection to TLS within the connection, as defined in RFC 2817:
+// requests with an Upgrade: TLS/1.0 and a Connection: Upgrade header are answered with a 101 Switching Protocols,
+// the TLS handshake is run with the config, and the request is then served over TLS. Only ServeConn (and
+// Handler.Serve, which the event loop engines use on a pre-bound listener) can run the handshake, so the event loop
+// engines serve such requests in cleartext, as if the header wasn't there.
+func WithTLSUpgrade(config *tls.Config) Option {
+	return func(cfg *Config) {
+		cfg.TLSUpgrade = config
+	}
+}
+
+// WithTLSSessionTickets issues the session tickets of connections that are upgraded to TLS with the rotating keys of
+// tickets, so that clients with a tls.ClientSessionCache can resume their session on a later connection and skip the
+// full handshake. It enables tickets on a clone of the TLSUpgrade config, which isn't modified. The same tickets must
+// be passed to every ServeConn call that clients may resume on. It requires TLSUpgrade.
+func WithTLSSessionTickets(tickets *TLSSessionTickets) Option {
+	return func(cfg *Config) {
+		cfg.TLSSessionTickets = tickets
+	}
+}
+
+// WithRejectMisdirected answers requests that arrive on a TLS connection with a Host that doesn't match the server
+// name (SNI) that the connection was established for with a 421 Misdirected Request, and closes the connection.
+// Clients that get one may retry the request on a new connection. Requests on connections without TLS, or whose
+// client didn't send a server name, aren't checked. It requires TLSUpgrade, which is how connections get TLS.
+func WithRejectMisdirected() Option {
+	return func(cfg *Config) {
+		cfg.RejectMisdirected = true
+	}
+}
+
+// WithProxyProtocol makes the engines expect every connection to start with a PROXY protocol header, in either the v1
+// (text) or the v2 (binary) format, like the ones that L4 load balancers such as HAProxy or AWS NLBs prepend. The header
+// is consumed before the first request is parsed, and the client address that it carries becomes the connection's
+// remote address, which is what requests see as their RemoteAddr. Connections that don't start with a valid header are
+// closed without a response. It must only be enabled behind such a load balancer, since otherwise any client could
+// claim to be any address.
+func WithProxyProtocol() Option {
+	return func(cfg *Config) {
+		cfg.ProxyProtocol = true
+	}
+}
+
+// WithLoopStats tracks which event loop every connection is assigned to by the engine's load balancing, and adds up
+// the connections of each loop in Stats.LoopConnections and Stats.LoopActiveConnections, for checking how evenly the
+// connections are spread over the loops. It is a diagnostic that reads the internals of evio and gnet, so it is best
+// left off in production.
+func WithLoopStats() Option {
+	return func(cfg *Config) {
+		cfg.LoopStats = true
+	}
+}
+
+// WithETags gives the 200 responses to GET and HEAD requests that don't set an ETag of their own a strong one, which
+// is a hash of their buffered body, and answers the requests whose If-None-Match matches the response's ETag with a
+// 304 Not Modified without the body, so that responses become cacheable without any changes to the handlers. The
+// handler still runs for every request, so it saves the bandwidth of the body but not the work of building it.
+func WithETags() Option {
+	return func(cfg *Config) {
+		cfg.ETags = true
+	}
+}
+
+// WithServerTiming adds a Server-Timing header to the responses, with the time that the request spent in the parse,
+// handler and serialize phases (see RequestPhases) as the parse, handler and serialize metrics, in milliseconds, so
+// that they show up in the browser's developer tools. The metrics are added after any that the handler set. Since the
+// header goes out with the response, the serialize metric only covers the work done before the response is written.
+// It exposes how long requests take to anyone who can make one, so it is meant for debugging.
+func WithServerTiming() Option {
+	return func(cfg *Config) {
+		cfg.ServerTiming = true
+	}
+}
+
+// WithAbandonTimedOutHandlers turns the HandlerTimeout (and the HandlerTimeout of the RouteTimeouts) into a hard limit
+// on how long the response may be held up: the handler runs on a goroutine of its own, and once its timeout passes the
+// request is answered with a 503 Service Unavailable right away, without waiting for the handler to return. The handler
+// is abandoned, so it keeps running until it notices that its context was cancelled, but whatever it writes is thrown
+// away. This keeps a stuck handler from holding up the event loop (or the worker of a DispatchWorkerPool) for longer
+// than its timeout, at the cost of a goroutine per request and a copy of every request. An abandoned handler keeps its
+// MaxInFlight slot and its spilled body (see WithBodySpill) until it returns. RawHandlers are never abandoned, since
+// their Request points into the connection's buffer.
+func WithAbandonTimedOutHandlers() Option {
+	return func(cfg *Config) {
+		cfg.AbandonTimedOutHandlers = true
+	}
+}
+
+// WithTracePropagation extracts the trace context that requests carry in any of the formats (W3C Trace Context
+// takes precedence over B3) into their context, where handlers and the libraries they use can find it with
+// TraceContextFrom to continue the trace. With generate, requests that don't carry a trace context start a new,
+// sampled trace. RawHandlers aren't handed a context, so they never see it.
+func WithTracePropagation(formats TraceFormat, generate bool) Option {
+	return func(cfg *Config) {
+		cfg.TraceFormats = formats
+		cfg.GenerateTraces = generate
+	}
+}
+
+// WithAutoHeaders sets the mask of headers that are added automatically to responses that don't set them,
+// replacing the default (only AutoHeaderDate). For example, WithAutoHeaders(AutoHeaderDate | AutoHeaderServer)
+// adds the Server header as well, and WithAutoHeaders(0) disables the automatic headers entirely.
+func WithAutoHeaders(mask AutoHeader) Option {
+	return func(cfg *Config) {
+		cfg.AutoHeaders = mask
+	}
+}
+
+// WithServerName sets the value of the Server header that is added when AutoHeaderServer is enabled.
+func WithServerName(name string) Option {
+	return func(cfg *Config) {
+		cfg.ServerName = name
+	}
+}
+
+// WithMaxConnLifetime caps how long a connection may stay open regardless of its activity, forcing clients
+// to reconnect periodically. A connection that outlives it is closed after the response that is in flight
+// (with Connection: close), or on the next tick of the event loop (ticks happen every second) when idle.
+func WithMaxConnLifetime(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.MaxConnLifetime = d
+	}
+}
+
+// WithRanges makes the engine serve Range requests on behalf of handlers that don't support them. Complete 200
+// responses to GET and HEAD requests get Accept-Ranges: bytes, and requests for a single byte range are answered
+// with a 206 Partial Content holding only that range (or a 416 when it is out of bounds). HEAD requests get the
+// same headers as the equivalent GET, without the body.
+func WithRanges() Option {
+	return func(cfg *Config) {
+		cfg.Ranges = true
+	}
+}
+
+// WithMaxURILength sets the longest request target (path and query) that will be accepted, regardless of the rest of
+// the request line. Requests with longer targets are rejected with a 414 URI Too Long as soon as the target is read.
+func WithMaxURILength(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxURILength = n
+	}
+}
+
+// WithMaxHeaderValueBytes sets the longest single header value that will be accepted, so that one enormous value
+// (e.g. a multi-megabyte Cookie) can't get by on its own. Requests with a longer value are rejected with a
+// 431 Request Header Fields Too Large as soon as that much of the value is read.
+func WithMaxHeaderValueBytes(n int) Option {
+	return func(cfg *Config) {
+		cfg.MaxHeaderValueBytes = n
+	}
+}
+
+// DefaultTCPFastOpenQueue is the amount of pending Fast Open requests that WithTCPFastOpen allows.
+const DefaultTCPFastOpenQueue = 256
+
+// WithTCPFastOpen enables TCP Fast Open (RFC 7413) on the listener, which saves a round trip when clients that
+// have connected before reconnect. It is only supported on Linux (which must also allow it in the server bit of
+// the net.ipv4.tcp_fastopen sysctl), and only by the gnet and stdlib engines, since evio doesn't expose its listener.
+// Engines that fail to enable it log the error and keep serving without it.
+func WithTCPFastOpen() Option {
+	return func(cfg *Config) {
+		cfg.TCPFastOpenQueue = DefaultTCPFastOpenQueue
+	}
+}
+
+// WithResponseInterceptor sets a hook that can modify every response populated by the handler right before it is
+// written, e.g. to add security headers or redact bodies. Unlike a middleware wrapping the handler, it operates on
+// the complete response. Responses generated by the engine itself (like errors) are not intercepted.
+func WithResponseInterceptor(interceptor ResponseInterceptor) Option {
+	return func(cfg *Config) {
+		cfg.ResponseInterceptor = interceptor
+	}
+}
+
+// WithMaxRequestRate caps the rate at which requests are accepted across all connections to perSecond requests per
+// second, allowing bursts of up to burst requests. Requests over the rate are shed with a 503 (and Retry-After)
+// before they are dispatched, and counted in Stats.ShedRequests. Unlike per client rate limiting, this protects
+// the server as a whole.
+func WithMaxRequestRate(perSecond, burst int) Option {
+	return func(cfg *Config) {
+		cfg.MaxRequestRate = perSecond
+		cfg.RequestBurst = burst
+	}
+}
+
+// WithListener makes the engines serve on an already bound listener instead of binding their own address. The stdlib
+// engine serves on it as is, while the evio and gnet engines can't adopt a listener, so they fall back to serving
+// each of its connections on a goroutine with the same request handling as their event loops (see Handler.Serve).
+func WithListener(ln net.Listener) Option {
+	return func(cfg *Config) {
+		cfg.Listener = ln
+	}
+}
+
+// WithFD makes the engines serve on the already bound listening socket with the given file descriptor, like
+// WithListener. This is meant for systemd socket activation (where the first socket is fd 3) and for zero downtime
+// restarts where the listening socket is inherited from the previous process.
+func WithFD(fd int) Option {
+	return func(cfg *Config) {
+		cfg.ListenerFD = fd
+	}
+}
+
+// WithDebugEndpoints serves httpbin like debugging endpoints (headers, ip, delay and status) under the path prefix,
+// in front of the handler. See internalHttp.Debug for the endpoints. They are meant for testing clients and proxies,
+// and should never be enabled on a server that is exposed publicly. Note that the delay endpoint blocks the event
+// loop of the evio and gnet engines while it sleeps.
+func WithDebugEndpoints(prefix string) Option {
+	return func(cfg *Config) {
+		cfg.DebugPrefix = prefix
+	}
+}
+
+// WithRawHandler dispatches requests to a RawHandler instead of the http.Handler, skipping the construction of an
+// http.Request entirely. Since the features that operate on an http.Request (CORS, digest validation, decompression,
+// Max-Forwards, response interception and ranges) need one, they are skipped as well, while the connection level
+// features (limits, timeouts, admission control and the in flight cap) still apply.
+func WithRawHandler(handler internalHttp.RawHandler) Option {
+	return func(cfg *Config) {
+		cfg.RawHandler = handler
+	}
+}
+
+// WithSlowHandlerWatchdog logs an EventSlowHandler warning, with the request's method and target, the index of the
+// loop and the connection's addresses, whenever a handler keeps running on an event loop for longer than the
+// threshold. Since handlers run inline on the event loops, a slow handler stalls every other connection on its loop,
+// and these warnings make such handlers easy to find. The watchdog only logs, the handler keeps running.
+func WithSlowHandlerWatchdog(threshold time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.SlowHandlerThreshold = threshold
+	}
+}
+
+// WithMaxBufferedBytes bounds the memory that is held by the buffers of incomplete requests on each event loop to a
+// budget of n bytes, handling the connections that go over their loop's budget according to the policy. The engines
+// hand over data once it has been read, so there is no way to stop reading from a connection and apply backpressure at
+// the socket, which is why going over the budget costs a connection instead. The loop of a connection is found with
+// LoopIndex, and the connections whose loop can't be told (like the ones served with ServeConn) share a budget of
+// their own.
+func WithMaxBufferedBytes(n int64, policy BudgetPolicy) Option {
+	return func(cfg *Config) {
+		cfg.MaxBufferedBytes = n
+		cfg.BudgetPolicy = policy
+	}
+}
+
+// WithSecurityHeaders adds the given security headers to every response that doesn't set them, or the
+// DefaultSecurityHeaders when none are given. Headers that the handler has set, even to nil, take precedence.
+func WithSecurityHeaders(headers http.Header) Option {
+	return func(cfg *Config) {
+		if headers == nil {
+			headers = DefaultSecurityHeaders()
+		}
+
+		cfg.SecurityHeaders = make(http.Header, len(headers))
+		for name, values := range headers {
+			cfg.SecurityHeaders[http.CanonicalHeaderKey(name)] = values
+		}
+		cfg.AutoHeaders |= AutoHeaderSecurity
+	}
+}
+
+// WithCloseDelimitedBodies accepts HTTP/1.0 POST, PUT and PATCH requests that send a body without a Content-Length,
+// which can only be delimited by the client closing its side of the connection. Such requests are buffered (up to the
+// MaxBodyBytes) until the client half-closes the connection, and then dispatched. HTTP/1.1 requests always need a
+// Content-Length. Since evio and gnet close connections as soon as they read an EOF, leaving no way to respond, only
+// connections served by ServeConn (including those served from a pre-bound listener by evio and gnet) support it.
+func WithCloseDelimitedBodies() Option {
+	return func(cfg *Config) {
+		cfg.CloseDelimitedBodies = true
+	}
+}
+
+// WithContextFactory makes the context of every connection with the factory, so that applications can keep their own
+// per connection data in it. The http.Handler gets the connection's context with ConnContextFrom(req.Context()),
+// and since a connection's requests are handled one at a time, the data needs no locking unless it is shared with
+// other goroutines. Requests that are dispatched to a RawHandler don't carry the context.
+func WithContextFactory(factory ContextFactory) Option {
+	return func(cfg *Config) {
+		cfg.ContextFactory = factory
+	}
+}
+
+// WithDisableKeepAlive closes every connection after its first response, which always carries a Connection: close
+// header, regardless of what the client asked for. Any requests that the client pipelined after the first one are
+// dropped. It is meant for debugging and for clients that misbehave on persistent connections, like the standard
+// library's Server.SetKeepAlivesEnabled(false).
+func WithDisableKeepAlive() Option {
+	return func(cfg *Config) {
+		cfg.DisableKeepAlive = true
+	}
+}
+
+// WithBindings makes the engines listen on the ports of the bindings as well as their own, dispatching the requests
+// that arrive on each of them to its handler. Every port is served by the same event loops (with the same options,
+// counters and shutdown) on evio. gnet can only listen on a single address per server, so it runs a server with its
+// own event loops for each binding, which still share everything else. Bindings can't be combined with a pre-bound
+// Listener or ListenerFD.
+func WithBindings(bindings ...Binding) Option {
+	return func(cfg *Config) {
+		cfg.Bindings = append(cfg.Bindings, bindings...)
+	}
+}
+
+// WithBodySpill writes the bodies of requests that declare a Content-Length above the threshold to a temporary file in
+// dir (or os.TempDir when it is empty) as they arrive, instead of buffering them in memory, so that large uploads
+// don't grow the connection's buffer. The handler reads the body from the file, which is removed once the response
+// is written. Bodies over the MaxBodyBytes are still rejected without being spilled, and requests that are dispatched
+// to a RawHandler are always buffered.
+func WithBodySpill(threshold int64, dir string) Option {
+	return func(cfg *Config) {
+		cfg.SpillThreshold = threshold
+		cfg.SpillDir = dir
+	}
+}
@@ -0,0 +1,21 @@
+package core
+
+import "sync/atomic"
+
+// Pause stops the Handler from accepting new connections without shutting the server down, e.g. for a maintenance
+// window or to shed load: until Resume is called, new connections are closed as soon as they are opened (and counted
+// in Stats.PausedConnections), and the requests that arrive on the connections that were already open are answered
+// with a 503 Service Unavailable and a Retry-After, which closes them too. It is safe to call from any goroutine.
+func (h *Handler) Pause() {
+	atomic.StoreUint32(&h.paused, 1)
+}
+
+// Resume makes a Handler that was paused with Pause accept connections and serve requests again.
+func (h *Handler) Resume() {
+	atomic.StoreUint32(&h.paused, 0)
+}
+
+// Paused reports whether the Handler is paused, see Pause.
+func (h *Handler) Paused() bool {
+	return atomic.LoadUint32(&h.paused) == 1
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestHandler_Pause(t *testing.T) {
+	request := []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n")
+	static := []byte("GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n")
+	h := newTestHandler(WithStaticResponse("/health", StaticResponse(http.StatusOK, "text/plain", []byte("ok"))))
+	open, openStatic := newTestConn(), newTestConn()
+	h.Opened(open, open.wake)
+	h.Opened(openStatic, openStatic.wake)
+
+	h.Pause()
+	if !h.Paused() {
+		t.Fatalf("Paused() = false after Pause")
+	}
+
+	c := newTestConn()
+	if action := h.Opened(c, c.wake); action != Close {
+		t.Errorf("Opened() while paused = %v, want %v", action, Close)
+	}
+	h.Closed(c, nil)
+
+	// Static routes are paused along with the rest
+	for _, tC := range []struct {
+		c   *testConn
+		req []byte
+	}{{open, request}, {openStatic, static}} {
+		out, action := h.Data(tC.c, tC.req)
+		if action != Close {
+			t.Errorf("Data(%q) while paused action = %v, want %v", tC.req, action, Close)
+		}
+		if res := expectStatus(t, out, http.StatusServiceUnavailable); res.Header.Get("Retry-After") == "" {
+			t.Errorf("503 response to %q without a Retry-After", tC.req)
+		}
+		h.Closed(tC.c, nil)
+	}
+
+	stats := h.Stats()
+	if stats.PausedConnections != 1 || stats.ShedRequests != 2 {
+		t.Errorf("PausedConnections, ShedRequests = %d, %d, want 1, 2", stats.PausedConnections, stats.ShedRequests)
+	}
+
+	h.Resume()
+	c = newTestConn()
+	if action := h.Opened(c, c.wake); action != None {
+		t.Errorf("Opened() after Resume = %v, want %v", action, None)
+	}
+	out, action := h.Data(c, request)
+	if action != None {
+		t.Errorf("Data() after Resume action = %v, want %v", action, None)
+	}
+	expectStatus(t, out, http.StatusOK)
+	if out, _ = h.Data(c, static); !bytes.Equal(out, StaticResponse(http.StatusOK, "text/plain", []byte("ok"))) {
+		t.Errorf("response after Resume = %q, want the static response", out)
+	}
+}
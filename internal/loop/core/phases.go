@@ -0,0 +1,124 @@
+package core
+
+import (
+	"strconv"
+	"time"
+)
+
+// RequestPhases is the breakdown of the time that the Handler spent on a single request, from the moment that the
+// read which completed it was handed to the Handler until its response was serialized. Time spent waiting for the
+// request's bytes to arrive is not included.
+type RequestPhases struct {
+	// Parse is the time spent reassembling the request from the connection's buffered data, parsing it and applying
+	// the configured limits, up until it was dispatched to the handler (or answered without it).
+	Parse time.Duration
+	// Handler is the time spent in the handler, along with the ResponseInterceptor and serving ranges. It is zero for
+	// requests that were answered without reaching the handler.
+	Handler time.Duration
+	// Serialize is the time spent adding the automatic headers and serializing the response.
+	Serialize time.Duration
+	// Total is the time from the start of the Parse phase until the end of the Serialize phase.
+	Total time.Duration
+}
+
+// PhaseObserver is called with the phases of every request that the Handler serves, on the goroutine that served it,
+// so it must be fast and safe for concurrent use.
+type PhaseObserver func(RequestPhases)
+
+// phaseMarks are the timestamps of the phase boundaries of the request that is being served on a connection.
+type phaseMarks struct {
+	start          time.Time
+	handlerStart   time.Time
+	serializeStart time.Time
+}
+
+// timesPhases reports whether the phases of the requests are timed, which they are when there is a PhaseObserver or
+// they are reported in a Server-Timing header.
+func (h *Handler) timesPhases() bool {
+	return h.config.PhaseObserver != nil || h.config.ServerTiming
+}
+
+// phaseStart returns the start of the Parse phase of a request that is about to be reassembled, or the zero time when
+// the phases aren't timed, so that the clock is only read when someone is listening.
+func (h *Handler) phaseStart() time.Time {
+	if !h.timesPhases() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// markHandlerStart marks the end of the Parse phase of the request being served on the connection.
+func (h *Handler) markHandlerStart(state *conn) {
+	if h.timesPhases() {
+		state.phases.handlerStart = time.Now()
+	}
+}
+
+// markSerializeStart marks the start of the Serialize phase of the request being served on the connection. A response
+// that is replaced while it is serialized keeps the first mark.
+func (h *Handler) markSerializeStart(state *conn) {
+	if h.timesPhases() && state.phases.serializeStart.IsZero() {
+		state.phases.serializeStart = time.Now()
+	}
+}
+
+// serverTiming formats the phases of the request that have passed by now as the value of a Server-Timing header, with
+// their durations in milliseconds. The header is serialized along with the rest of the response, so the serialize
+// metric only covers the time up until it is added, and the handler metric is left out for requests that were
+// answered without reaching the handler.
+func (m phaseMarks) serverTiming(now time.Time) string {
+	parseEnd := m.handlerStart
+	if parseEnd.IsZero() {
+		parseEnd = m.serializeStart
+	}
+
+	b := appendServerTimingMetric(nil, "parse", parseEnd.Sub(m.start))
+	if !m.handlerStart.IsZero() {
+		b = appendServerTimingMetric(append(b, ", "...), "handler", m.serializeStart.Sub(m.handlerStart))
+	}
+	b = appendServerTimingMetric(append(b, ", "...), "serialize", now.Sub(m.serializeStart))
+	return string(b)
+}
+
+// appendServerTimingMetric appends a Server-Timing metric with its duration, e.g. parse;dur=0.042.
+func appendServerTimingMetric(b []byte, name string, d time.Duration) []byte {
+	b = append(b, name...)
+	b = append(b, ";dur="...)
+	return strconv.AppendFloat(b, float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// serveObserved serves a complete request that started being reassembled at start, and reports its phases to the
+// PhaseObserver. The marks are kept on the connection while it is served, for the Server-Timing header.
+func (h *Handler) serveObserved(state *conn, data []byte, start time.Time) ([]byte, Action) {
+	if !h.timesPhases() {
+		return h.serve(state, data)
+	}
+
+	state.phases = phaseMarks{start: start}
+	res, action := h.serve(state, data)
+	end := time.Now()
+
+	// Responses that are written outside of serve, e.g. to malformed requests, aren't timed
+	marks := state.phases
+	state.phases = phaseMarks{}
+	if h.config.PhaseObserver == nil {
+		return res, action
+	}
+	if marks.serializeStart.IsZero() {
+		// The request was dropped without a response, so all of it was spent parsing
+		marks.serializeStart = end
+	}
+
+	phases := RequestPhases{
+		Serialize: end.Sub(marks.serializeStart),
+		Total:     end.Sub(start),
+	}
+	if marks.handlerStart.IsZero() {
+		phases.Parse = marks.serializeStart.Sub(start)
+	} else {
+		phases.Parse = marks.handlerStart.Sub(start)
+		phases.Handler = marks.serializeStart.Sub(marks.handlerStart)
+	}
+	h.config.PhaseObserver(phases)
+	return res, action
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_PhaseObserver(t *testing.T) {
+	const handlerDelay = 5 * time.Millisecond
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(handlerDelay)
+		w.WriteHeader(http.StatusOK)
+	})
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		time.Sleep(handlerDelay)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		desc            string
+		opts            []Option
+		frames          []string
+		expectedHandled []bool
+	}{
+		{
+			desc:            "single request",
+			frames:          []string{"GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"},
+			expectedHandled: []bool{true},
+		},
+		{
+			desc:            "request split across frames",
+			frames:          []string{"POST /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n", "{\"req\": 0}"},
+			expectedHandled: []bool{true},
+		},
+		{
+			desc:            "pipelined requests",
+			frames:          []string{strings.Repeat("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n", 3)},
+			expectedHandled: []bool{true, true, true},
+		},
+		{
+			desc:            "request answered without the handler",
+			opts:            []Option{WithFavicon(Favicon{})},
+			frames:          []string{"GET /favicon.ico HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\nGET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"},
+			expectedHandled: []bool{false, true},
+		},
+		{
+			desc:            "raw handler",
+			opts:            []Option{WithRawHandler(raw)},
+			frames:          []string{"GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"},
+			expectedHandled: []bool{true},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var observed []RequestPhases
+			opts := append([]Option{WithPhaseObserver(func(phases RequestPhases) {
+				observed = append(observed, phases)
+			})}, tC.opts...)
+			h := NewHandler(context.Background(), handler, opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			for _, frame := range tC.frames {
+				if _, action := h.Data(c, []byte(frame)); action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+			}
+
+			if len(observed) != len(tC.expectedHandled) {
+				subT.Fatalf("observed %d requests, want %d", len(observed), len(tC.expectedHandled))
+			}
+
+			for i, phases := range observed {
+				if phases.Parse <= 0 || phases.Serialize <= 0 {
+					subT.Errorf("request %d: phases = %+v, want positive Parse and Serialize", i, phases)
+				}
+
+				if sum := phases.Parse + phases.Handler + phases.Serialize; sum != phases.Total {
+					subT.Errorf("request %d: phases sum to %v, want the Total of %v", i, sum, phases.Total)
+				}
+
+				if !tC.expectedHandled[i] {
+					if phases.Handler != 0 {
+						subT.Errorf("request %d: Handler = %v, want 0 without the handler", i, phases.Handler)
+					}
+					continue
+				}
+
+				// The handler's sleep must land in its own phase and nowhere else
+				if phases.Handler < handlerDelay {
+					subT.Errorf("request %d: Handler = %v, want at least %v", i, phases.Handler, handlerDelay)
+				}
+				if phases.Parse >= handlerDelay || phases.Serialize >= handlerDelay {
+					subT.Errorf("request %d: phases = %+v, want Parse and Serialize under %v", i, phases, handlerDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_ServerTiming(t *testing.T) {
+	const handlerDelay = 5 * time.Millisecond
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cached" {
+			w.Header().Set("Server-Timing", "cache;desc=hit")
+		}
+		time.Sleep(handlerDelay)
+		w.WriteHeader(http.StatusOK)
+	})
+	metric := regexp.MustCompile(`^([a-z]+);dur=(\d+\.\d{3})$`)
+
+	testCases := []struct {
+		desc            string
+		request         string
+		expectedMetrics []string
+		opts            []Option
+		expectedStatus  int
+	}{
+		{
+			desc:            "handled request",
+			request:         "GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedMetrics: []string{"parse", "handler", "serialize"},
+		},
+		{
+			desc:            "handler's own metrics",
+			request:         "GET /cached HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedMetrics: []string{"cache;desc=hit", "parse", "handler", "serialize"},
+		},
+		{
+			desc:            "request answered without the handler",
+			request:         "GET /items%00 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:            []Option{WithRejectEncodedNull()},
+			expectedStatus:  http.StatusBadRequest,
+			expectedMetrics: []string{"parse", "serialize"},
+		},
+		{
+			desc:           "malformed request",
+			request:        "GET /items HTTP/1.1\r\nHost 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), handler, append([]Option{WithServerTiming()}, tC.opts...)...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte(tC.request))
+			res := expectStatus(subT, out, tC.expectedStatus)
+
+			var metrics []string
+			for _, value := range res.Header.Values("Server-Timing") {
+				for _, m := range strings.Split(value, ",") {
+					metrics = append(metrics, strings.TrimSpace(m))
+				}
+			}
+			if len(metrics) != len(tC.expectedMetrics) {
+				subT.Fatalf("Server-Timing = %q, want the metrics %v", metrics, tC.expectedMetrics)
+			}
+
+			for i, m := range metrics {
+				match := metric.FindStringSubmatch(m)
+				if match == nil {
+					if m != tC.expectedMetrics[i] {
+						subT.Errorf("metric %d = %q, want %q", i, m, tC.expectedMetrics[i])
+					}
+					continue
+				}
+				if match[1] != tC.expectedMetrics[i] {
+					subT.Errorf("metric %d = %q, want %q", i, match[1], tC.expectedMetrics[i])
+				}
+
+				dur, err := strconv.ParseFloat(match[2], 64)
+				if err != nil {
+					subT.Fatalf("metric %q has an invalid duration: %v", m, err)
+				}
+				if match[1] == "handler" && dur < float64(handlerDelay)/float64(time.Millisecond) {
+					subT.Errorf("handler duration = %vms, want at least %v", dur, handlerDelay)
+				}
+				if match[1] != "handler" && dur >= float64(handlerDelay)/float64(time.Millisecond) {
+					subT.Errorf("%s duration = %vms, want under %v", match[1], dur, handlerDelay)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrInvalidProxyHeader is returned when a connection that must start with a PROXY protocol header doesn't.
+	ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+	crlf             = []byte("\r\n")
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// EventInvalidProxyHeader is logged when a connection that must start with a PROXY protocol header is closed because
+// it doesn't.
+const EventInvalidProxyHeader = "conn.invalid_proxy_header"
+
+const (
+	// proxyV1MaxLength is the longest that a v1 header can be, including its CRLF.
+	proxyV1MaxLength = 107
+	// proxyV2HeaderLength is the length of the fixed part of a v2 header, which is followed by its addresses.
+	proxyV2HeaderLength = 16
+)
+
+// parseProxyHeader parses the PROXY protocol header (either the v1 text or the v2 binary format) at the front of the
+// data, and returns its length along with the source address of the client that it carries. The length is zero when
+// the header isn't complete yet, and the address is nil when the header doesn't carry one, like for the health checks
+// that load balancers send with the UNKNOWN (v1) or LOCAL (v2) commands, which are served with the connection's own.
+func parseProxyHeader(data []byte) (int, net.Addr, error) {
+	if bytes.HasPrefix(data, proxyV1Prefix) {
+		return parseProxyV1(data)
+	}
+	if bytes.HasPrefix(data, proxyV2Signature) {
+		return parseProxyV2(data)
+	}
+
+	// Too little of the data has arrived to tell which of the headers it is
+	if bytes.HasPrefix(proxyV1Prefix, data) || bytes.HasPrefix(proxyV2Signature, data) {
+		return 0, nil, nil
+	}
+	return 0, nil, ErrInvalidProxyHeader
+}
+
+// parseProxyV1 parses a v1 header, e.g. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func parseProxyV1(data []byte) (int, net.Addr, error) {
+	end := bytes.Index(data, crlf)
+	if end < 0 {
+		if len(data) >= proxyV1MaxLength {
+			return 0, nil, ErrInvalidProxyHeader
+		}
+		return 0, nil, nil
+	}
+	if end+len(crlf) > proxyV1MaxLength {
+		return 0, nil, ErrInvalidProxyHeader
+	}
+
+	fields := bytes.Split(data[len(proxyV1Prefix):end], []byte(" "))
+	if string(fields[0]) == "UNKNOWN" {
+		return end + len(crlf), nil, nil
+	}
+	if len(fields) != 5 || (string(fields[0]) != "TCP4" && string(fields[0]) != "TCP6") {
+		return 0, nil, fmt.Errorf("%w: unsupported v1 header %q", ErrInvalidProxyHeader, data[:end])
+	}
+
+	ip := net.ParseIP(string(fields[1]))
+	if ip == nil || (ip.To4() != nil) != (string(fields[0]) == "TCP4") || net.ParseIP(string(fields[2])) == nil {
+		return 0, nil, fmt.Errorf("%w: invalid v1 addresses %q", ErrInvalidProxyHeader, data[:end])
+	}
+	port, err := strconv.ParseUint(string(fields[3]), 10, 16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: invalid v1 source port %q", ErrInvalidProxyHeader, fields[3])
+	}
+	return end + len(crlf), &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseProxyV2 parses a v2 header, which is the signature followed by the version and command, the address family,
+// the length of the rest of the header and then the addresses, which may be followed by TLVs that are skipped.
+func parseProxyV2(data []byte) (int, net.Addr, error) {
+	if len(data) < proxyV2HeaderLength {
+		return 0, nil, nil
+	}
+
+	versionCommand, family := data[12], data[13]
+	if versionCommand>>4 != 2 {
+		return 0, nil, fmt.Errorf("%w: unsupported v2 version %d", ErrInvalidProxyHeader, versionCommand>>4)
+	}
+
+	n := proxyV2HeaderLength + int(binary.BigEndian.Uint16(data[14:16]))
+	if len(data) < n {
+		return 0, nil, nil
+	}
+	addrs := data[proxyV2HeaderLength:n]
+
+	// LOCAL connections are made by the proxy itself, so only PROXY ones carry the address of a client
+	command := versionCommand & 0x0f
+	if command == 0x0 {
+		return n, nil, nil
+	}
+	if command != 0x1 {
+		return 0, nil, fmt.Errorf("%w: unsupported v2 command %d", ErrInvalidProxyHeader, command)
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(addrs) < 12 {
+			return 0, nil, fmt.Errorf("%w: v2 IPv4 addresses are too short", ErrInvalidProxyHeader)
+		}
+		ip := net.IP(append([]byte(nil), addrs[:4]...))
+		return n, &net.TCPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(addrs[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(addrs) < 36 {
+			return 0, nil, fmt.Errorf("%w: v2 IPv6 addresses are too short", ErrInvalidProxyHeader)
+		}
+		ip := net.IP(append([]byte(nil), addrs[:16]...))
+		return n, &net.TCPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(addrs[32:34]))}, nil
+	default:
+		// UNSPEC and the families that HTTP can't be served over carry no address that we can use
+		return n, nil, nil
+	}
+}
+
+// consumeProxyHeader consumes the PROXY protocol header at the front of the data of a connection that hasn't sent one
+// yet, and replaces the connection's remote address with the client's. It returns what follows the header, which is
+// nil while the header is still incomplete, and Close when the connection doesn't start with a valid header.
+func (h *Handler) consumeProxyHeader(state *conn, data []byte) ([]byte, Action) {
+	n, addr, err := parseProxyHeader(data)
+	if err != nil {
+		h.config.Logger.Log(EventInvalidProxyHeader, Fields{
+			"local":     state.localAddr.String(),
+			"remote":    state.remoteAddr.String(),
+			"error":     err.Error(),
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		return nil, Close
+	}
+	if n == 0 {
+		return nil, None
+	}
+
+	state.proxied = true
+	if addr != nil {
+		// The address is read by Handler.Connections from outside of the event loop
+		h.connsMu.Lock()
+		state.remoteAddr = addr
+		h.connsMu.Unlock()
+	}
+	return data[n:], None
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// proxyV2Header builds a v2 header with the command and family, followed by the addresses.
+func proxyV2Header(command, family byte, addrs []byte) []byte {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x20|command, family, byte(len(addrs)>>8), byte(len(addrs)))
+	return append(header, addrs...)
+}
+
+var (
+	proxyV2IPv4Addrs = []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	proxyV2IPv6Addrs = append(append(append([]byte(nil), net.ParseIP("2001:db8::1")...), net.ParseIP("2001:db8::2")...), 0xdc, 0x04, 0x01, 0xbb)
+)
+
+func TestParseProxyHeader(t *testing.T) {
+	testCases := []struct {
+		expectedErr    error
+		desc           string
+		expectedAddr   string
+		data           []byte
+		expectedLength int
+	}{
+		{
+			desc:           "v1 TCP4",
+			data:           []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n"),
+			expectedAddr:   "192.0.2.1:56324",
+			expectedLength: 45,
+		},
+		{
+			desc:           "v1 TCP6",
+			data:           []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			expectedAddr:   "[2001:db8::1]:56324",
+			expectedLength: 46,
+		},
+		{
+			desc:           "v1 UNKNOWN",
+			data:           []byte("PROXY UNKNOWN\r\n"),
+			expectedLength: 15,
+		},
+		{
+			desc: "v1 incomplete",
+			data: []byte("PROXY TCP4 192.0.2.1 198.51"),
+		},
+		{
+			desc: "v1 incomplete prefix",
+			data: []byte("PRO"),
+		},
+		{
+			desc:        "v1 IPv6 addresses declared as TCP4",
+			data:        []byte("PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			expectedErr: ErrInvalidProxyHeader,
+		},
+		{
+			desc:        "v1 invalid port",
+			data:        []byte("PROXY TCP4 192.0.2.1 198.51.100.1 70000 443\r\n"),
+			expectedErr: ErrInvalidProxyHeader,
+		},
+		{
+			desc:        "v1 too long",
+			data:        append([]byte("PROXY TCP4 "), make([]byte, proxyV1MaxLength)...),
+			expectedErr: ErrInvalidProxyHeader,
+		},
+		{
+			desc:           "v2 TCP over IPv4",
+			data:           append(proxyV2Header(0x1, 0x11, proxyV2IPv4Addrs), "GET / HTTP/1.1\r\n"...),
+			expectedAddr:   "192.0.2.1:56324",
+			expectedLength: 28,
+		},
+		{
+			desc:           "v2 TCP over IPv6",
+			data:           proxyV2Header(0x1, 0x21, proxyV2IPv6Addrs),
+			expectedAddr:   "[2001:db8::1]:56324",
+			expectedLength: 52,
+		},
+		{
+			desc:           "v2 with TLVs after the addresses",
+			data:           proxyV2Header(0x1, 0x11, append(append([]byte(nil), proxyV2IPv4Addrs...), 0x04, 0x00, 0x01, 0x00)),
+			expectedAddr:   "192.0.2.1:56324",
+			expectedLength: 32,
+		},
+		{
+			desc:           "v2 LOCAL",
+			data:           proxyV2Header(0x0, 0x00, nil),
+			expectedLength: 16,
+		},
+		{
+			desc:           "v2 UNSPEC",
+			data:           proxyV2Header(0x1, 0x00, nil),
+			expectedLength: 16,
+		},
+		{
+			desc: "v2 incomplete signature",
+			data: proxyV2Signature[:5],
+		},
+		{
+			desc: "v2 incomplete addresses",
+			data: proxyV2Header(0x1, 0x11, proxyV2IPv4Addrs)[:20],
+		},
+		{
+			desc:        "v2 truncated addresses",
+			data:        proxyV2Header(0x1, 0x11, proxyV2IPv4Addrs[:8]),
+			expectedErr: ErrInvalidProxyHeader,
+		},
+		{
+			desc:        "v2 unsupported version",
+			data:        append(append([]byte(nil), proxyV2Signature...), 0x11, 0x11, 0x00, 0x00),
+			expectedErr: ErrInvalidProxyHeader,
+		},
+		{
+			desc:        "HTTP request without a header",
+			data:        []byte("GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"),
+			expectedErr: ErrInvalidProxyHeader,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			n, addr, err := parseProxyHeader(tC.data)
+			if !errors.Is(err, tC.expectedErr) {
+				subT.Fatalf("parseProxyHeader() error = %v, want %v", err, tC.expectedErr)
+			}
+			if n != tC.expectedLength {
+				subT.Errorf("parseProxyHeader() length = %d, want %d", n, tC.expectedLength)
+			}
+
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tC.expectedAddr {
+				subT.Errorf("parseProxyHeader() addr = %q, want %q", got, tC.expectedAddr)
+			}
+		})
+	}
+}
+
+func TestHandler_ProxyProtocol(t *testing.T) {
+	request := "GET /whoami HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"
+
+	testCases := []struct {
+		desc               string
+		expectedRemoteAddr string
+		reads              [][]byte
+	}{
+		{
+			desc:               "v1 header and request in one read",
+			reads:              [][]byte{[]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n" + request)},
+			expectedRemoteAddr: "192.0.2.1:56324",
+		},
+		{
+			desc:               "v1 header split across reads",
+			reads:              [][]byte{[]byte("PROXY TCP4 192.0"), []byte(".2.1 198.51.100.1 56324 443\r\nGET /whoami"), []byte(request[len("GET /whoami"):])},
+			expectedRemoteAddr: "192.0.2.1:56324",
+		},
+		{
+			desc:               "v2 header and request in one read",
+			reads:              [][]byte{append(proxyV2Header(0x1, 0x21, proxyV2IPv6Addrs), request...)},
+			expectedRemoteAddr: "[2001:db8::1]:56324",
+		},
+		{
+			desc:               "v2 header split across reads",
+			reads:              [][]byte{proxyV2Signature[:7], proxyV2Header(0x1, 0x11, proxyV2IPv4Addrs)[7:20], append(proxyV2Header(0x1, 0x11, proxyV2IPv4Addrs)[20:], request...)},
+			expectedRemoteAddr: "192.0.2.1:56324",
+		},
+		{
+			desc:  "v2 LOCAL keeps the connection's address",
+			reads: [][]byte{append(proxyV2Header(0x0, 0x00, nil), request...)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(r.RemoteAddr))
+			}), WithProxyProtocol())
+			c := newTestConn()
+			h.Opened(c, c.wake)
+			if tC.expectedRemoteAddr == "" {
+				tC.expectedRemoteAddr = c.RemoteAddr().String()
+			}
+
+			var out []byte
+			for _, read := range tC.reads {
+				res, action := h.Data(c, read)
+				if action != None {
+					subT.Fatalf("Data() action = %v, want %v", action, None)
+				}
+				out = append(out, res...)
+			}
+			res := expectStatus(subT, out, http.StatusOK)
+			expectBody(subT, res, tC.expectedRemoteAddr)
+
+			// Only the first request of the connection is preceded by the header
+			out, _ = h.Data(c, []byte(request))
+			expectBody(subT, expectStatus(subT, out, http.StatusOK), tC.expectedRemoteAddr)
+
+			if conns := h.Connections(); len(conns) != 1 || conns[0].RemoteAddr.String() != tC.expectedRemoteAddr {
+				subT.Errorf("Connections() = %v, want the remote address %s", conns, tC.expectedRemoteAddr)
+			}
+		})
+	}
+}
+
+func TestHandler_ProxyProtocolMissing(t *testing.T) {
+	logger := &recordingLogger{}
+	h := NewHandler(context.Background(), nil, WithProxyProtocol(), WithLogger(logger))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, action := h.Data(c, []byte("GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	if action != Close || len(out) > 0 {
+		t.Errorf("Data() = %q, %v, want the connection closed without a response", out, action)
+	}
+
+	records := logger.events(EventInvalidProxyHeader)
+	if len(records) != 1 {
+		t.Fatalf("%d %s records, want 1", len(records), EventInvalidProxyHeader)
+	}
+	if remote := records[0].fields["remote"]; remote != c.RemoteAddr().String() {
+		t.Errorf("remote = %v, want %v", remote, c.RemoteAddr())
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_Ranges(t *testing.T) {
+	body := strings.Repeat("0123456789", 100)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(body))
+	})
+
+	testCases := []struct {
+		expectedHeaders map[string]string
+		desc            string
+		request         string
+		expectedBody    string
+		opts            []Option
+		expectedStatus  int
+	}{
+		{
+			desc:           "HEAD with a range",
+			request:        "HEAD /file HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nRange: bytes=0-99\r\n\r\n",
+			opts:           []Option{WithRanges()},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Content-Range":  "bytes 0-99/1000",
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "100",
+			},
+		},
+		{
+			desc:           "GET with a range",
+			request:        "GET /file HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nRange: bytes=10-19\r\n\r\n",
+			opts:           []Option{WithRanges()},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "0123456789",
+			expectedHeaders: map[string]string{
+				"Content-Range":  "bytes 10-19/1000",
+				"Content-Length": "10",
+			},
+		},
+		{
+			desc:           "GET with an unsatisfiable range",
+			request:        "GET /file HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nRange: bytes=1000-\r\n\r\n",
+			opts:           []Option{WithRanges()},
+			expectedStatus: http.StatusRequestedRangeNotSatisfiable,
+			expectedHeaders: map[string]string{
+				"Content-Range": "bytes */1000",
+			},
+		},
+		{
+			desc:           "HEAD without a range",
+			request:        "HEAD /file HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithRanges()},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "1000",
+			},
+		},
+		{
+			desc:           "ranges are ignored by default",
+			request:        "GET /file HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nRange: bytes=0-99\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedBody:   body,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "",
+				"Content-Range": "",
+			},
+		},
+		{
+			desc:           "HEAD body is stripped by default",
+			request:        "HEAD /file HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Length": "1000",
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), handler, tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(tC.request)))
+			if err != nil {
+				subT.Fatalf("unable to read request: %v", err)
+			}
+
+			out, _ := h.Data(c, []byte(tC.request))
+			if req.Method == http.MethodHead && !bytes.HasSuffix(out, []byte("\r\n\r\n")) {
+				subT.Errorf("HEAD response %q has a body", out)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), req)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			for header, expected := range tC.expectedHeaders {
+				if got := res.Header.Get(header); got != expected {
+					subT.Errorf("%s = %q, want %q", header, got, expected)
+				}
+			}
+
+			got, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(got) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", got, tC.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Exchange is a recorded request and the response that was written for it, as raw bytes.
+type Exchange struct {
+	Time       time.Time
+	RemoteAddr net.Addr
+	Request    []byte
+	Response   []byte
+}
+
+// recorder keeps a rolling window of the most recent exchanges in a ring buffer.
+type recorder struct {
+	exchanges []Exchange
+	next      int
+	full      bool
+	mu        sync.Mutex
+}
+
+func newRecorder(n int) *recorder {
+	return &recorder{
+		exchanges: make([]Exchange, n),
+	}
+}
+
+// record copies the request and response, since both are backed by buffers that are reused by the connection.
+func (r *recorder) record(remoteAddr net.Addr, request, response []byte) {
+	exchange := Exchange{
+		Time:       time.Now(),
+		RemoteAddr: remoteAddr,
+		Request:    append([]byte(nil), request...),
+		Response:   append([]byte(nil), response...),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.exchanges[r.next] = exchange
+	r.next++
+	if r.next == len(r.exchanges) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *recorder) snapshot() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]Exchange(nil), r.exchanges[:r.next]...)
+	}
+
+	exchanges := make([]Exchange, 0, len(r.exchanges))
+	exchanges = append(exchanges, r.exchanges[r.next:]...)
+	return append(exchanges, r.exchanges[:r.next]...)
+}
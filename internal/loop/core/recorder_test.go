@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestHandler_Recording(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		record        int
+		requests      int
+		expectedFirst int
+	}{
+		{
+			desc:     "disabled",
+			record:   0,
+			requests: 3,
+		},
+		{
+			desc:          "window not full",
+			record:        5,
+			requests:      3,
+			expectedFirst: 0,
+		},
+		{
+			desc:          "window wraps around",
+			record:        3,
+			requests:      7,
+			expectedFirst: 4,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(WithRecording(tC.record))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			requests := make([][]byte, tC.requests)
+			responses := make([][]byte, tC.requests)
+			for i := 0; i < tC.requests; i++ {
+				body := fmt.Sprintf(`{"req": %d}`, i)
+				requests[i] = []byte(fmt.Sprintf("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: %d\r\n\r\n%s", len(body), body))
+				out, _ := h.Data(c, requests[i])
+				responses[i] = append([]byte(nil), out...)
+			}
+
+			exchanges := h.Exchanges()
+			expectedLen := tC.requests - tC.expectedFirst
+			if tC.record == 0 {
+				expectedLen = 0
+			}
+			if len(exchanges) != expectedLen {
+				subT.Fatalf("Exchanges() returned %d exchanges, want %d", len(exchanges), expectedLen)
+			}
+
+			for i, exchange := range exchanges {
+				j := tC.expectedFirst + i
+				if !bytes.Equal(exchange.Request, requests[j]) {
+					subT.Errorf("exchange %d request = %q, want %q", i, exchange.Request, requests[j])
+				}
+				if !bytes.Equal(exchange.Response, responses[j]) {
+					subT.Errorf("exchange %d response = %q, want %q", i, exchange.Response, responses[j])
+				}
+				if exchange.RemoteAddr != c.RemoteAddr() {
+					subT.Errorf("exchange %d remote addr = %v, want %v", i, exchange.RemoteAddr, c.RemoteAddr())
+				}
+			}
+		})
+	}
+}
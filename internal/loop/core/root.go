@@ -0,0 +1,32 @@
+package core
+
+import (
+	"net/http"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// RootResponse is the response that GET and HEAD requests for exactly / are answered with, without reaching the handler.
+type RootResponse struct {
+	// ContentType is the Content-Type of the Body. When empty, it is sniffed from the Body.
+	ContentType string
+	// Body is the landing page or health message. When empty, the response has no body.
+	Body []byte
+	// Status is the status code of the response. Zero answers with a 200.
+	Status int
+}
+
+// isRootRequest reports whether a request with the method and path is answered with the configured RootResponse.
+func (h *Handler) isRootRequest(method, path string) bool {
+	return h.config.RootResponse != nil && path == "/" && (method == http.MethodGet || method == http.MethodHead)
+}
+
+// serveRoot populates the response with the configured RootResponse.
+func (h *Handler) serveRoot(res *internalHttp.ResponseWriter) {
+	root := h.config.RootResponse
+	status := root.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	writeStatic(res, status, root.ContentType, root.Body)
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_RootResponse(t *testing.T) {
+	landing := []byte("server-scratch is up")
+
+	testCases := []struct {
+		desc                string
+		request             string
+		expectedContentType string
+		expectedBody        []byte
+		root                RootResponse
+		expectedStatus      int
+		expectedHandled     bool
+	}{
+		{
+			desc:            "default answers with an empty 200",
+			request:         "GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatus:  http.StatusOK,
+			expectedHandled: false,
+		},
+		{
+			desc:                "configured response",
+			request:             "GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			root:                RootResponse{Status: http.StatusOK, ContentType: "text/plain", Body: landing},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/plain",
+			expectedBody:        landing,
+			expectedHandled:     false,
+		},
+		{
+			desc:           "query on the root path",
+			request:        "GET /?probe=1 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			root:           RootResponse{Status: http.StatusTeapot, Body: landing},
+			expectedStatus: http.StatusTeapot,
+			expectedBody:   landing,
+		},
+		{
+			desc:                "HEAD request has no body",
+			request:             "HEAD / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			root:                RootResponse{ContentType: "text/plain", Body: landing},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/plain",
+			expectedHandled:     false,
+		},
+		{
+			desc:            "other methods reach the handler",
+			request:         "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 0\r\n\r\n",
+			root:            RootResponse{Body: landing},
+			expectedStatus:  http.StatusAccepted,
+			expectedHandled: true,
+		},
+		{
+			desc:            "other paths reach the handler",
+			request:         "GET /anything HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			root:            RootResponse{Body: landing},
+			expectedStatus:  http.StatusAccepted,
+			expectedHandled: true,
+		},
+		{
+			desc:            "paths under the root reach the handler",
+			request:         "GET /anything/ HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			root:            RootResponse{Body: landing},
+			expectedStatus:  http.StatusAccepted,
+			expectedHandled: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			handled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				w.WriteHeader(http.StatusAccepted)
+			})
+			h := NewHandler(context.Background(), handler, WithRootResponse(tC.root))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+
+			method := http.MethodGet
+			if strings.HasPrefix(tC.request, http.MethodHead) {
+				method = http.MethodHead
+			}
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), &http.Request{Method: method})
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			if handled != tC.expectedHandled {
+				subT.Errorf("handler invoked = %v, want %v", handled, tC.expectedHandled)
+			}
+
+			if tC.expectedContentType != "" {
+				if got := res.Header.Get("Content-Type"); got != tC.expectedContentType {
+					subT.Errorf("Content-Type = %q, want %q", got, tC.expectedContentType)
+				}
+			}
+
+			if !tC.expectedHandled && !bytes.Equal(body, tC.expectedBody) {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestHandler_RootResponseRaw(t *testing.T) {
+	var handled []string
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		handled = append(handled, string(req.Path()))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	h := NewHandler(context.Background(), nil, WithRawHandler(raw), WithRootResponse(RootResponse{Status: http.StatusNoContent}))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, _ := h.Data(c, []byte("GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusNoContent)
+
+	out, _ = h.Data(c, []byte("GET /anything HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusAccepted)
+
+	if len(handled) != 1 || handled[0] != "/anything" {
+		t.Errorf("raw handler invoked for %q, want only /anything", handled)
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+// RouteTimeout overrides the timeouts of the requests for the routes under a path prefix, e.g. to give uploads longer
+// to arrive, or long-polling handlers longer to run. Zero fields keep the Handler's own timeout.
+type RouteTimeout struct {
+	// Prefix is the path prefix of the routes, like "/uploads/".
+	Prefix string
+	// ReadTimeout overrides the ReadTimeout of requests whose headers arrived before the rest of the request.
+	ReadTimeout time.Duration
+	// BodyReadTimeout overrides the BodyReadTimeout.
+	BodyReadTimeout time.Duration
+	// HandlerTimeout overrides the HandlerTimeout.
+	HandlerTimeout time.Duration
+}
+
+// matchRouteTimeout returns the RouteTimeout with the longest Prefix that the path falls under, or nil when there is none.
+func (h *Handler) matchRouteTimeout(path string) *RouteTimeout {
+	var match *RouteTimeout
+	for i := range h.config.RouteTimeouts {
+		route := &h.config.RouteTimeouts[i]
+		if strings.HasPrefix(path, route.Prefix) && (match == nil || len(route.Prefix) > len(match.Prefix)) {
+			match = route
+		}
+	}
+	return match
+}
+
+// applyRouteTimeouts overrides the read timeouts of the request being read on the connection once its headers, and so
+// its target, are known. It is called before the body timer is armed, so that it is armed with the override.
+func (h *Handler) applyRouteTimeouts(state *conn, data []byte) {
+	route := h.matchRouteTimeout(string(internalHttp.RequestPath(data)))
+	if route == nil {
+		return
+	}
+
+	atomic.StoreInt64(&state.bodyReadTimeout, int64(route.BodyReadTimeout))
+	if route.ReadTimeout > 0 {
+		atomic.StoreInt64(&state.readTimeout, int64(route.ReadTimeout))
+
+		// The read timer was scheduled with the Handler's ReadTimeout when the request started (if at all), and a
+		// shorter override must not wait for it
+		state.readTimer.arm()
+		h.timers.schedule(&state.readTimer, atomic.LoadInt64(&state.requestStart)+int64(route.ReadTimeout))
+	}
+}
+
+// readTimeout returns the ReadTimeout of the request being read on the connection.
+func (h *Handler) readTimeout(state *conn) time.Duration {
+	if d := atomic.LoadInt64(&state.readTimeout); d > 0 {
+		return time.Duration(d)
+	}
+	return h.config.ReadTimeout
+}
+
+// bodyReadTimeout returns the BodyReadTimeout of the request being read on the connection.
+func (h *Handler) bodyReadTimeout(state *conn) time.Duration {
+	if d := atomic.LoadInt64(&state.bodyReadTimeout); d > 0 {
+		return time.Duration(d)
+	}
+	return h.config.BodyReadTimeout
+}
+
+// handlerTimeout returns the HandlerTimeout of a request for the path.
+func (h *Handler) handlerTimeout(path string) time.Duration {
+	if route := h.matchRouteTimeout(path); route != nil && route.HandlerTimeout > 0 {
+		return route.HandlerTimeout
+	}
+	return h.config.HandlerTimeout
+}
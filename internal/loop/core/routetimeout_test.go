@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_RouteHandlerTimeouts(t *testing.T) {
+	const handlerDuration = 50 * time.Millisecond
+	routes := WithRouteTimeouts(
+		RouteTimeout{Prefix: "/poll/", HandlerTimeout: time.Minute},
+		RouteTimeout{Prefix: "/poll/fast/", HandlerTimeout: 10 * time.Millisecond},
+	)
+
+	testCases := []struct {
+		desc              string
+		target            string
+		opts              []Option
+		expectedStatus    int
+		expectedCancelled bool
+	}{
+		{
+			desc:              "long-running handler on a default route",
+			target:            "/items",
+			opts:              []Option{WithHandlerTimeout(10 * time.Millisecond), routes},
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedCancelled: true,
+		},
+		{
+			desc:           "long-running handler on a long timeout route",
+			target:         "/poll/updates?since=42",
+			opts:           []Option{WithHandlerTimeout(10 * time.Millisecond), routes},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:              "path that only shares the beginning of the prefix",
+			target:            "/poll",
+			opts:              []Option{WithHandlerTimeout(10 * time.Millisecond), routes},
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedCancelled: true,
+		},
+		{
+			desc:              "longest prefix wins",
+			target:            "/poll/fast/updates",
+			opts:              []Option{routes},
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedCancelled: true,
+		},
+		{
+			desc:           "route without a handler timeout of its own",
+			target:         "/items",
+			opts:           []Option{routes},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "no timeouts",
+			target:         "/items",
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			cancelled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+					cancelled = true
+				case <-time.After(handlerDuration):
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			h := NewHandler(context.Background(), handler, tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte("GET "+tC.target+" HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			if action != None {
+				subT.Errorf("Data() action = %v, want %v", action, None)
+			}
+			expectStatus(subT, out, tC.expectedStatus)
+
+			if cancelled != tC.expectedCancelled {
+				subT.Errorf("handler cancelled = %v, want %v", cancelled, tC.expectedCancelled)
+			}
+
+			expectedTimedOut := uint64(0)
+			if tC.expectedCancelled {
+				expectedTimedOut = 1
+			}
+			if got := h.Stats().TimedOutHandlers; got != expectedTimedOut {
+				subT.Errorf("Stats().TimedOutHandlers = %d, want %d", got, expectedTimedOut)
+			}
+		})
+	}
+}
+
+func TestHandler_RouteHandlerTimeoutsRaw(t *testing.T) {
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	h := NewHandler(context.Background(), nil, WithRawHandler(raw), WithHandlerTimeout(10*time.Millisecond),
+		WithRouteTimeouts(RouteTimeout{Prefix: "/poll/", HandlerTimeout: time.Minute}))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, _ := h.Data(c, []byte("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusServiceUnavailable)
+
+	out, _ = h.Data(c, []byte("GET /poll/updates HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	expectStatus(t, out, http.StatusOK)
+}
+
+func TestHandler_RouteReadTimeouts(t *testing.T) {
+	routes := WithRouteTimeouts(
+		RouteTimeout{Prefix: "/uploads/", ReadTimeout: time.Minute, BodyReadTimeout: time.Minute},
+		RouteTimeout{Prefix: "/quick/", ReadTimeout: time.Millisecond},
+	)
+
+	testCases := []struct {
+		desc           string
+		target         string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "slow body on a default route",
+			target:         "/items",
+			opts:           []Option{WithBodyReadTimeout(10 * time.Millisecond), routes},
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		{
+			desc:           "slow body on a long timeout route",
+			target:         "/uploads/avatar",
+			opts:           []Option{WithBodyReadTimeout(10 * time.Millisecond), routes},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "slow request on a long read timeout route",
+			target:         "/uploads/avatar",
+			opts:           []Option{WithReadTimeout(10 * time.Millisecond), WithRequestTimeoutResponse(), routes},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "slow request on a short read timeout route",
+			target:         "/quick/ping",
+			opts:           []Option{WithReadTimeout(time.Minute), WithRequestTimeoutResponse(), routes},
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		{
+			desc:           "slow request on a short read timeout route without a default",
+			target:         "/quick/ping",
+			opts:           []Option{routes},
+			expectedStatus: 0,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			h.Data(c, []byte("POST "+tC.target+" HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n"))
+
+			// The body is fed a byte at a time, taking longer than the default timeouts in total
+			var out []byte
+			var action Action
+			for _, b := range []byte("{\"req\": 0}") {
+				time.Sleep(3 * time.Millisecond)
+				h.Tick()
+				if c.woken > 0 {
+					out, action = h.Data(c, nil)
+					break
+				}
+				out, action = h.Data(c, []byte{b})
+			}
+
+			switch tC.expectedStatus {
+			case http.StatusOK:
+				if c.woken > 0 || action != None {
+					subT.Fatalf("connection woken %d times with action %v, want it left alone", c.woken, action)
+				}
+			case 0:
+				// Without RequestTimeoutResponse the connection is closed without a response
+				if c.woken != 1 || action != Close || len(out) > 0 {
+					subT.Fatalf("connection woken %d times with %q and %v, want it closed without a response", c.woken, out, action)
+				}
+				return
+			default:
+				if c.woken != 1 || action != Close {
+					subT.Fatalf("connection woken %d times with action %v, want it woken once and closed", c.woken, action)
+				}
+			}
+			expectStatus(subT, out, tC.expectedStatus)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ServeConn runs the full read, parse, dispatch and write loop of the event loop engines over a single standard
+// net.Conn, keeping the connection alive between requests until either side closes it or the context is done.
+// It blocks until the connection is closed, and returns nil when the connection was closed cleanly.
+// Since there is no event loop ticking, the options that rely on ticks (like ReadTimeout) have no effect here.
+func ServeConn(ctx context.Context, conn net.Conn, handler http.Handler, opts ...Option) error {
+	return NewHandler(ctx, handler, opts...).serveConn(conn)
+}
+
+// Serve accepts connections on the listener and serves each of them on its own goroutine with the same loop as
+// ServeConn, until the handler's context is done (which closes the listener) or accepting fails. It is how the
+// event loop engines serve on a pre-bound listener, since neither of them can adopt one. It returns nil when
+// it stopped because the context is done.
+func (h *Handler) Serve(ln net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-h.ctx.Done():
+			ln.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if h.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			_ = h.serveConn(conn)
+		}()
+	}
+}
+
+func (h *Handler) serveConn(conn net.Conn) error {
+	ctx := h.ctx
+	c := &netConn{Conn: conn}
+
+	// Closing the connection is the only way to interrupt a blocked Read once the context is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if h.Opened(c, nil) != None {
+		h.Closed(c, nil)
+		return conn.Close()
+	}
+	if state, ok := connState(c); ok {
+		state.tlsUpgradable = true
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			out, action := h.Data(c, buf[:n])
+			if len(out) > 0 {
+				if _, werr := conn.Write(out); werr != nil {
+					h.Closed(c, werr)
+					conn.Close()
+					return werr
+				}
+			}
+
+			if action != None {
+				h.Closed(c, nil)
+				return conn.Close()
+			}
+
+			// The response to a request that upgraded the connection goes over TLS, as does everything after it
+			if state, ok := connState(c); ok && state.upgrade != nil {
+				out, action, herr := h.upgradeTLS(c, state)
+				if herr != nil {
+					h.Closed(c, herr)
+					conn.Close()
+					return herr
+				}
+				conn = c.Conn
+
+				if _, werr := conn.Write(out); werr != nil {
+					h.Closed(c, werr)
+					conn.Close()
+					return werr
+				}
+
+				if action != None {
+					h.Closed(c, nil)
+					return conn.Close()
+				}
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// The client may have only closed its side of the connection, leaving us room for a response
+				if out, _ := h.ReadClosed(c); len(out) > 0 {
+					_, _ = conn.Write(out)
+				}
+			}
+
+			conn.Close()
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				h.Closed(c, nil)
+				return nil
+			}
+
+			h.Closed(c, err)
+			return err
+		}
+	}
+}
+
+// netConn adapts a standard net.Conn to the Conn interface by holding its context.
+type netConn struct {
+	net.Conn
+	ctx interface{}
+}
+
+func (c *netConn) Context() interface{}       { return c.ctx }
+func (c *netConn) SetContext(ctx interface{}) { c.ctx = ctx }
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestServeConn(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		requests int
+		cancel   bool
+	}{
+		{
+			desc:     "single request",
+			requests: 1,
+		},
+		{
+			desc:     "keep-alive requests",
+			requests: 5,
+		},
+		{
+			desc:     "context cancelled",
+			requests: 1,
+			cancel:   true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- ServeConn(ctx, server, http.HandlerFunc(internalHttp.Echo), WithLogger(&recordingLogger{}))
+			}()
+
+			r := bufio.NewReader(client)
+			for i := 0; i < tC.requests; i++ {
+				body := fmt.Sprintf(`{"req": %d}`, i)
+				fmt.Fprintf(client, "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+
+				res, err := http.ReadResponse(r, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %d: %v", i, err)
+				}
+
+				got, err := ioutil.ReadAll(res.Body)
+				if err != nil {
+					subT.Fatalf("unable to read response %d body: %v", i, err)
+				}
+				if string(got) != body {
+					subT.Errorf("response %d body = %q, want %q", i, got, body)
+				}
+			}
+
+			if tC.cancel {
+				cancel()
+			} else {
+				client.Close()
+			}
+
+			select {
+			case err := <-errs:
+				if err != nil {
+					subT.Errorf("ServeConn() error = %v", err)
+				}
+			case <-time.After(time.Second):
+				subT.Fatalf("ServeConn() did not return after the connection was done")
+			}
+		})
+	}
+}
+
+func TestServeConn_CloseDelimitedBody(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		request        string
+		expectedBody   string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "HTTP/1.0 post",
+			request:        "POST /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n{\"req\": 0}",
+			opts:           []Option{WithCloseDelimitedBodies()},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"req": 0}`,
+		},
+		{
+			desc:           "HTTP/1.0 post without a body",
+			request:        "POST /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:           []Option{WithCloseDelimitedBodies()},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			desc:           "body over the limit",
+			request:        "POST /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n{\"req\": 0}",
+			opts:           []Option{WithCloseDelimitedBodies(), WithMaxBodyBytes(5)},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   http.StatusText(http.StatusRequestEntityTooLarge),
+		},
+		{
+			desc:           "HTTP/1.1 post is still rejected",
+			request:        "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n{\"req\": 0}",
+			opts:           []Option{WithCloseDelimitedBodies()},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   http.StatusText(http.StatusBadRequest),
+		},
+		{
+			desc:           "disabled",
+			request:        "POST /echo HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n{\"req\": 0}",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   http.StatusText(http.StatusBadRequest),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			// A half-close needs a real TCP connection
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				subT.Fatalf("unable to listen: %v", err)
+			}
+			defer ln.Close()
+
+			errs := make(chan error, 1)
+			go func() {
+				server, err := ln.Accept()
+				if err != nil {
+					errs <- err
+					return
+				}
+				errs <- ServeConn(context.Background(), server, http.HandlerFunc(internalHttp.Echo), append(tC.opts, WithLogger(&recordingLogger{}))...)
+			}()
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				subT.Fatalf("unable to connect: %v", err)
+			}
+			defer client.Close()
+
+			if _, err := client.Write([]byte(tC.request)); err != nil {
+				subT.Fatalf("unable to write request: %v", err)
+			}
+			if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+				subT.Fatalf("unable to half-close the connection: %v", err)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(client), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response: %v", err)
+			}
+			if res.StatusCode != tC.expectedStatus {
+				subT.Errorf("status = %d, want %d", res.StatusCode, tC.expectedStatus)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+
+			if err := <-errs; err != nil {
+				subT.Errorf("ServeConn() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+// smugglingTestCases are adversarial requests that try to make the engine frame a request differently than
+// another HTTP parser would (a proxy in front of it, or http.ReadRequest behind it). Every one of them must be
+// rejected outright, since serving any part of them risks desyncing the connection.
+var smugglingTestCases = []struct {
+	desc    string
+	request string
+}{
+	{
+		desc:    "CL.TE",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nSMUGGLED",
+	},
+	{
+		desc:    "TE.CL",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n8\r\nSMUGGLED\r\n0\r\n\r\n",
+	},
+	{
+		desc:    "TE.CL with the smuggled request in the chunk",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nTransfer-Encoding: chunked\r\nContent-Length: 4\r\n\r\n5c\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 15\r\n\r\nx=1\r\n0\r\n\r\n",
+	},
+	{
+		desc:    "TE only",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+	},
+	{
+		desc:    "TE as the only header with a chunk that looks like a request",
+		request: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n2d\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n\r\n0\r\n\r\n",
+	},
+	{
+		desc:    "TE.TE with an unknown coding",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a lowercase name",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\ntransfer-encoding: chunked\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a space before the colon",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\nTransfer-Encoding : chunked\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a tab before the value",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\nTransfer-Encoding:\tchunked\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a folded value",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\nTransfer-Encoding:\r\n chunked\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a leading space in the name",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\n Transfer-Encoding: chunked\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a quoted value",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\nTransfer-Encoding: \"chunked\"\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "TE.TE with a bare line feed",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4\r\nX-Foo: bar\nTransfer-Encoding: chunked\r\n\r\n5c\r\n",
+	},
+	{
+		desc:    "duplicate Content-Length",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 0\r\nContent-Length: 44\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "lowercase Content-Length hiding a body that looks like a request",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\ncontent-length: 44\r\ncontent-length: 0\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "Content-Length hidden behind a bare line feed",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nX-Foo: bar\nContent-Length: 44\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "Content-Length hidden behind a bare line feed in the request line",
+		request: "POST / HTTP/1.1\nContent-Length: 44\r\nHost: 127.0.0.1:8080\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "Content-Length with a space before the colon",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length : 44\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "signed Content-Length",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: +44\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "Content-Length list",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 0, 44\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "Content-Length past the largest int64",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 9223372036854775808\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+	{
+		desc:    "Content-Length that wraps around a uint64",
+		request: "POST / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 18446744073709551616\r\n\r\nGET /admin HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+	},
+}
+
+func TestHandler_RequestSmuggling(t *testing.T) {
+	for _, tC := range smugglingTestCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var handled []string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = append(handled, r.URL.Path)
+			})
+			h := NewHandler(context.Background(), handler)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, action := h.Data(c, []byte(tC.request))
+			if action != Close {
+				subT.Errorf("Data() action = %v, want %v", action, Close)
+			}
+
+			if len(handled) > 0 {
+				subT.Errorf("handler invoked for %v, want the request rejected before dispatch", handled)
+			}
+
+			// Exactly one response must have been written, and it must be the rejection
+			reader := bufio.NewReader(bytes.NewReader(out))
+			res, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+			if _, err := ioutil.ReadAll(res.Body); err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+
+			if res.StatusCode != http.StatusBadRequest {
+				subT.Errorf("response status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+			}
+			if !res.Close {
+				subT.Error("response doesn't close the connection")
+			}
+			if reader.Buffered() > 0 {
+				subT.Errorf("unexpected data after the rejection: %q", out[len(out)-reader.Buffered():])
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/tidwall/evio"
+)
+
+// EventSpillFailed is logged when the body of a request can't be spilled to (or read back from) its temporary file.
+// Failures before any of the body was spilled leave the request buffered in memory, later ones fail the request.
+const EventSpillFailed = "request.spill_failed"
+
+// spill holds a request whose body is written to a temporary file as it arrives, instead of being buffered.
+type spill struct {
+	file *os.File
+	// head is a copy of the request line and headers, which are parsed once the whole body is in the file.
+	head []byte
+	// length is the declared Content-Length of the body.
+	length int64
+	// remaining is the amount of body bytes that haven't arrived yet.
+	remaining int64
+}
+
+// maybeSpill moves the body of the incomplete request at the front of the data to a temporary file when it declares
+// a Content-Length over the SpillThreshold, so that the rest of it is written to the file as it arrives instead of
+// being buffered. When the file can't be written, the request simply stays buffered.
+func (h *Handler) maybeSpill(state *conn, data []byte, hl int) {
+	if h.config.SpillThreshold == 0 || (h.config.RawHandler != nil && state.handler == nil) {
+		return
+	}
+
+	length, err := internalHttp.ContentLength(data)
+	if err != nil || length <= h.config.SpillThreshold {
+		return
+	}
+
+	// The request will be rejected once it is complete, so there's no point in keeping its body around
+	if h.config.MaxBodyBytes > 0 && length > h.config.MaxBodyBytes {
+		return
+	}
+
+	f, err := ioutil.TempFile(h.config.SpillDir, "server-scratch-body-*")
+	if err != nil {
+		h.logSpillFailed(state, "create", err, true)
+		return
+	}
+
+	if _, err := f.Write(data[hl:]); err != nil {
+		h.logSpillFailed(state, "write", err, true)
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+
+	state.spill = &spill{
+		file:      f,
+		head:      append([]byte(nil), data[:hl]...),
+		length:    length,
+		remaining: length - int64(len(data)-hl),
+	}
+	state.stream = evio.InputStream{}
+	state.streamPeak = 0
+	state.setPending(hl)
+}
+
+// spillBody writes the input that belongs to the spilled body to its file, and serves the request once the body is
+// complete. It returns the response along with the rest of the input, which is the beginning of the next request.
+func (h *Handler) spillBody(state *conn, in []byte) ([]byte, []byte, Action) {
+	sp := state.spill
+	n := len(in)
+	if int64(n) > sp.remaining {
+		n = int(sp.remaining)
+	}
+
+	if _, err := sp.file.Write(in[:n]); err != nil {
+		h.logSpillFailed(state, "write", err, false)
+		state.reset()
+		res, action := h.respondError(state, h.newResponseWriter(1, 1), http.StatusInternalServerError)
+		return res, nil, action
+	}
+
+	sp.remaining -= int64(n)
+	if sp.remaining > 0 {
+		return nil, nil, None
+	}
+
+	if _, err := sp.file.Seek(0, io.SeekStart); err != nil {
+		h.logSpillFailed(state, "rewind", err, false)
+		state.reset()
+		res, action := h.respondError(state, h.newResponseWriter(1, 1), http.StatusInternalServerError)
+		return res, nil, action
+	}
+
+	state.setState(StateWriting)
+	h.stats.observeReads(state.reads)
+	h.stats.observeSpilled(int64(len(sp.head)) + sp.length)
+
+	res, action := h.serveObserved(state, sp.head, h.phaseStart())
+	if h.recorder != nil {
+		h.recorder.record(state.remoteAddr, sp.head, res)
+	}
+	state.reset()
+	return res, in[n:], action
+}
+
+// logSpillFailed logs an EventSpillFailed record for the connection's request, whose body failed to be spilled at the
+// stage ("create", "write" or "rewind"). Buffered tells whether the request is still served from memory instead.
+func (h *Handler) logSpillFailed(state *conn, stage string, err error, buffered bool) {
+	h.config.Logger.Log(EventSpillFailed, Fields{
+		"stage":     stage,
+		"remote":    state.remoteAddr.String(),
+		"error":     err.Error(),
+		"buffered":  buffered,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// dropSpill closes and removes the file of the connection's spilled body, if it has one.
+func (c *conn) dropSpill() {
+	if c.spill == nil {
+		return
+	}
+
+	c.spill.remove()
+	c.spill = nil
+}
+
+// remove closes and removes the file of the spilled body.
+func (sp *spill) remove() {
+	sp.file.Close()
+	os.Remove(sp.file.Name())
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandler_BodySpill(t *testing.T) {
+	dir := t.TempDir()
+	var spilled int
+	h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			files, _ := ioutil.ReadDir(dir)
+			spilled = len(files)
+		}
+
+		sum := sha256.New()
+		n, err := io.Copy(sum, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Body-Length", strconv.FormatInt(n, 10))
+		w.Header().Set("X-Body-Sum", hex.EncodeToString(sum.Sum(nil)))
+	}), WithBodySpill(1<<10, dir))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	head := "POST /upload HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"
+	// The last chunk is followed by a pipelined request, which is served from memory
+	payload := append(append([]byte(head), body...), "GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"...)
+
+	var out []byte
+	for len(payload) > 0 {
+		n := 16 << 10
+		if n > len(payload) {
+			n = len(payload)
+		}
+
+		res, action := h.Data(c, payload[:n])
+		if action != None {
+			t.Fatalf("Data() action = %v, want %v", action, None)
+		}
+		out = append(out, res...)
+		payload = payload[n:]
+
+		// Only the headers of the upload are ever held in memory
+		if state, _ := connState(c); state.pending > len(head) {
+			t.Fatalf("pending = %d bytes, want at most %d", state.pending, len(head))
+		}
+	}
+
+	if spilled != 1 {
+		t.Errorf("handler saw %d spilled files, want 1", spilled)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d spilled files left after the response, want 0", len(files))
+	}
+
+	r := bufio.NewReader(bytes.NewReader(out))
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("unable to read response %q: %v", out, err)
+	}
+	sum := sha256.Sum256(body)
+	if got := res.Header.Get("X-Body-Length"); got != strconv.Itoa(len(body)) {
+		t.Errorf("handler read %s bytes, want %d", got, len(body))
+	}
+	if got := res.Header.Get("X-Body-Sum"); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("handler read a body with sum %s, want %s", got, hex.EncodeToString(sum[:]))
+	}
+
+	if _, err := http.ReadResponse(r, nil); err != nil {
+		t.Errorf("unable to read the response to the pipelined request: %v", err)
+	}
+	if stats := h.Stats(); stats.SpilledRequests != 1 {
+		t.Errorf("SpilledRequests = %d, want 1", stats.SpilledRequests)
+	}
+}
+
+func TestHandler_BodySpillDropped(t *testing.T) {
+	testCases := []struct {
+		close func(h *Handler, c *testConn)
+		desc  string
+	}{
+		{
+			desc:  "closed by the client",
+			close: func(h *Handler, c *testConn) { h.Closed(c, nil) },
+		},
+		{
+			desc: "timed out",
+			close: func(h *Handler, c *testConn) {
+				state, _ := connState(c)
+				state.reset()
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			dir := subT.TempDir()
+			h := newTestHandler(WithBodySpill(1<<10, dir))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			head := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 4096\r\n\r\n"
+			if _, action := h.Data(c, []byte(head+strings.Repeat("a", 2048))); action != None {
+				subT.Fatalf("Data() action = %v, want %v", action, None)
+			}
+			if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+				subT.Fatalf("%d spilled files, want 1", len(files))
+			}
+
+			tC.close(h, c)
+			if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+				subT.Errorf("%d spilled files left, want 0", len(files))
+			}
+		})
+	}
+}
+
+func TestHandler_BodySpillUnderThreshold(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(WithBodySpill(1<<10, dir))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	head := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 1024\r\n\r\n"
+	if _, action := h.Data(c, []byte(head)); action != None {
+		t.Fatalf("Data() action = %v, want %v", action, None)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d spilled files for a body within the threshold, want 0", len(files))
+	}
+
+	out, _ := h.Data(c, bytes.Repeat([]byte("a"), 1024))
+	expectStatus(t, out, http.StatusOK)
+}
+
+func TestHandler_BodySpillFailed(t *testing.T) {
+	logger := &recordingLogger{}
+	// The directory doesn't exist, so the file can't be created and the body stays buffered
+	h := newTestHandler(WithBodySpill(1<<10, filepath.Join(t.TempDir(), "missing")), WithLogger(logger))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	head := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 2048\r\n\r\n"
+	if _, action := h.Data(c, []byte(head)); action != None {
+		t.Fatalf("Data() action = %v, want %v", action, None)
+	}
+	out, _ := h.Data(c, bytes.Repeat([]byte("a"), 2048))
+	expectStatus(t, out, http.StatusOK)
+
+	records := logger.events(EventSpillFailed)
+	if len(records) != 1 {
+		t.Fatalf("%d %s records, want 1", len(records), EventSpillFailed)
+	}
+	if stage, buffered := records[0].fields["stage"], records[0].fields["buffered"]; stage != "create" || buffered != true {
+		t.Errorf("stage, buffered = %v, %v, want create, true", stage, buffered)
+	}
+	if stats := h.Stats(); stats.SpilledRequests != 0 {
+		t.Errorf("SpilledRequests = %d, want 0", stats.SpilledRequests)
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+var (
+	getPrefix = []byte("GET ")
+	http11    = []byte("HTTP/1.1")
+)
+
+// StaticResponse serializes a complete HTTP/1.1 response with the status, Content-Type and body, to be registered with
+// WithStaticResponse. When the contentType is empty, it is sniffed from the body.
+func StaticResponse(status int, contentType string, body []byte) []byte {
+	res := internalHttp.NewResponseWriter()
+	writeStatic(res, status, contentType, body)
+
+	buf := bytes.NewBuffer(nil)
+	_ = res.WriteToBuf(buf)
+	return buf.Bytes()
+}
+
+// staticResponse returns the StaticResponse that the complete request is answered with, or nil when it must be served
+// the usual way. The response is written as is, so only the GET requests that it is right for as is are answered with
+// it: HTTP/1.1 requests without a Connection header, on connections that stay open after the response.
+func (h *Handler) staticResponse(state *conn, request []byte) []byte {
+	if len(h.config.StaticResponses) == 0 || !bytes.HasPrefix(request, getPrefix) {
+		return nil
+	}
+
+	// The conversion of the key doesn't allocate when it is only used for the lookup
+	res := h.config.StaticResponses[string(internalHttp.RequestPath(request))]
+	if res == nil {
+		return nil
+	}
+
+	requestLine := request[:bytes.IndexByte(request, '\r')]
+	if !bytes.HasSuffix(requestLine, http11) || internalHttp.HasHeader(request, "Connection") {
+		return nil
+	}
+
+	if h.config.DisableKeepAlive || h.ctx.Err() != nil {
+		return nil
+	}
+	// Requests that may have to be shed, or rejected for their Host, are checked the usual way
+	if h.Paused() || h.admission != nil || h.config.RejectMisdirected && state.serverName != "" {
+		return nil
+	}
+	if h.config.MaxConnLifetime > 0 && state.age(time.Now()) > h.config.MaxConnLifetime {
+		return nil
+	}
+
+	state.wrote(len(res))
+	// Capping the capacity makes appending the responses of pipelined requests copy it instead of writing into it
+	return res[:len(res):len(res)]
+}
+
+// validateStaticResponse reports whether the response is a complete response that can be written as is to a
+// connection that stays open, which needs it to be framed by its Content-Length and not to close the connection.
+func validateStaticResponse(path string, response []byte) error {
+	r := bufio.NewReader(bytes.NewReader(response))
+	res, err := http.ReadResponse(r, &http.Request{Method: http.MethodGet})
+	if err != nil {
+		return invalidConfig("static response of %q is not a valid response: %v", path, err)
+	}
+	defer res.Body.Close()
+
+	if res.ContentLength < 0 || res.Close {
+		return invalidConfig("static response of %q must have a Content-Length and keep the connection alive", path)
+	}
+
+	// The body must end the response exactly, or the rest would be taken for the beginning of another response
+	if _, err := ioutil.ReadAll(res.Body); err != nil {
+		return invalidConfig("static response of %q is shorter than its Content-Length: %v", path, err)
+	}
+	if _, err := r.Peek(1); err != io.EOF {
+		return invalidConfig("static response of %q is longer than its Content-Length", path)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandler_StaticResponse(t *testing.T) {
+	health := StaticResponse(http.StatusOK, "text/plain", []byte("ok"))
+
+	testCases := []struct {
+		desc           string
+		request        string
+		serverName     string
+		opts           []Option
+		expectedStatic bool
+	}{
+		{
+			desc:           "static path",
+			request:        "GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatic: true,
+		},
+		{
+			desc:           "static path with a query",
+			request:        "GET /health?probe=1 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			expectedStatic: true,
+		},
+		{
+			desc:    "path under the static path",
+			request: "GET /health/deep HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+		},
+		{
+			desc:    "HEAD request",
+			request: "HEAD /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+		},
+		{
+			desc:    "HTTP/1.0 request",
+			request: "GET /health HTTP/1.0\r\nHost: 127.0.0.1:8080\r\n\r\n",
+		},
+		{
+			desc:    "request with a Connection header",
+			request: "GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nConnection: close\r\n\r\n",
+		},
+		{
+			desc:    "connection without keep-alive",
+			request: "GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:    []Option{WithDisableKeepAlive()},
+		},
+		{
+			desc:    "request rate limit",
+			request: "GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n",
+			opts:    []Option{WithMaxRequestRate(1000, 1000)},
+		},
+		{
+			desc:       "TLS connection with a server name that rejects misdirected requests",
+			request:    "GET /health HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			serverName: "example.com",
+			opts:       []Option{WithRejectMisdirected()},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			handled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				w.WriteHeader(http.StatusAccepted)
+			})
+			h := NewHandler(context.Background(), handler, append([]Option{WithStaticResponse("/health", health)}, tC.opts...)...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+			if state, ok := connState(c); ok {
+				state.serverName = tC.serverName
+			}
+
+			out, _ := h.Data(c, []byte(tC.request))
+			if tC.expectedStatic {
+				if !bytes.Equal(out, health) {
+					subT.Errorf("response = %q, want the static response %q", out, health)
+				}
+			} else if !strings.Contains(string(out), " 202 Accepted\r\n") {
+				subT.Errorf("response = %q, want the handler's 202", out)
+			}
+
+			if handled == tC.expectedStatic {
+				subT.Errorf("handler invoked = %v, want %v", handled, !tC.expectedStatic)
+			}
+		})
+	}
+}
+
+func TestHandler_StaticResponsePipelined(t *testing.T) {
+	health := StaticResponse(http.StatusOK, "text/plain", []byte("ok"))
+	// Spare capacity in the registered response must not be written into by the responses that follow it
+	registered := append(make([]byte, 0, len(health)+512), health...)
+
+	h := newTestHandler(WithStaticResponse("/health", registered))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	request := "GET /health HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"
+	out, action := h.Data(c, []byte(request+"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 2\r\n\r\n{}"+request))
+	if action != None {
+		t.Errorf("Data() action = %v, want %v", action, None)
+	}
+
+	if !bytes.HasPrefix(out, health) || !bytes.HasSuffix(out, health) || len(out) <= 2*len(health) {
+		t.Errorf("response = %q, want the static response around the echoed one", out)
+	}
+	if got := registered[:cap(registered)][len(health):]; !bytes.Equal(got, make([]byte, len(got))) {
+		t.Errorf("the registered static response was written past its end: %q", got)
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import "sync/atomic"
+
+// Stats holds the counters tracked by a Handler over its lifetime.
+// The live counters are updated atomically by the event loops, so callers
+// should only ever look at a copy retrieved via Handler.Stats.
+type Stats struct {
+	// LoopConnections counts the connections that each event loop was assigned, by the index of the loop, and
+	// LoopActiveConnections the ones that are still open. They are only tracked with WithLoopStats, and engines with
+	// several servers (like gnet with Bindings) add up the loops with the same index.
+	LoopConnections       []uint64
+	LoopActiveConnections []uint64
+	// ReadsPerRequest is a histogram of how many reads it took to assemble each complete request. The bucket at
+	// index i counts the requests that were assembled in i+1 reads, except for the last bucket, which counts all
+	// of the requests that took ReadsPerRequestBuckets reads or more. Pipelined requests that start within a read
+	// count it as their first read.
+	ReadsPerRequest [ReadsPerRequestBuckets]uint64
+	// TruncatedRequests counts connections that were closed by the peer while
+	// an incomplete request (partial headers or a body shorter than the declared
+	// Content-Length) was still buffered.
+	TruncatedRequests uint64
+	// TimedOutRequests counts connections that were closed because a request took longer than the ReadTimeout (or its
+	// body longer than the BodyReadTimeout) to arrive.
+	TimedOutRequests uint64
+	// TimedOutHandlers counts requests whose handler ran for longer than its HandlerTimeout, and were answered with a 503.
+	TimedOutHandlers uint64
+	// AbandonedHandlers counts the TimedOutHandlers that were answered without waiting for the handler to return, see
+	// WithAbandonTimedOutHandlers.
+	AbandonedHandlers uint64
+	// ExpiredConnections counts connections that were closed because they were open for longer than the MaxConnLifetime.
+	ExpiredConnections uint64
+	// OverBudgetConnections counts connections that were closed to keep the buffered bytes within the MaxBufferedBytes.
+	OverBudgetConnections uint64
+	// SpilledRequests counts requests whose body was written to a temporary file instead of being buffered, see WithBodySpill.
+	SpilledRequests uint64
+	// ShedRequests counts requests that were rejected with a 503 because they arrived over the MaxRequestRate, or while
+	// the Handler was paused.
+	ShedRequests uint64
+	// PausedConnections counts connections that were closed as soon as they were opened because the Handler was paused.
+	PausedConnections uint64
+	// BodyLengthMismatches counts requests that were rejected with a 500 because the body that was assembled for them
+	// wasn't as long as their declared Content-Length, see EventBodyLengthMismatch.
+	BodyLengthMismatches uint64
+	// MaxRequestBytes is the high-water mark of the bytes buffered for a single request, including requests that
+	// never completed.
+	MaxRequestBytes uint64
+	// CompletedRequests and CompletedRequestBytes count the requests that were read completely and their total size,
+	// see AverageRequestSize.
+	CompletedRequests     uint64
+	CompletedRequestBytes uint64
+}
+
+// AverageRequestSize returns the average size in bytes of the requests that were read completely.
+func (s Stats) AverageRequestSize() float64 {
+	if s.CompletedRequests == 0 {
+		return 0
+	}
+	return float64(s.CompletedRequestBytes) / float64(s.CompletedRequests)
+}
+
+// ReadsPerRequestBuckets is the amount of buckets in the Stats.ReadsPerRequest histogram.
+const ReadsPerRequestBuckets = 8
+
+// observeRequest records the size of a request that was read completely.
+func (s *Stats) observeRequest(size int) {
+	atomic.AddUint64(&s.CompletedRequests, 1)
+	atomic.AddUint64(&s.CompletedRequestBytes, uint64(size))
+	s.observeBuffered(size)
+}
+
+// observeSpilled records the size of a request that was read completely with its body spilled to a file, which
+// doesn't count towards the MaxRequestBytes since it was never buffered.
+func (s *Stats) observeSpilled(size int64) {
+	atomic.AddUint64(&s.SpilledRequests, 1)
+	atomic.AddUint64(&s.CompletedRequests, 1)
+	atomic.AddUint64(&s.CompletedRequestBytes, uint64(size))
+}
+
+// observeBuffered raises the MaxRequestBytes high-water mark to the bytes that are buffered for a request, if they are over it.
+func (s *Stats) observeBuffered(size int) {
+	for {
+		hwm := atomic.LoadUint64(&s.MaxRequestBytes)
+		if uint64(size) <= hwm || atomic.CompareAndSwapUint64(&s.MaxRequestBytes, hwm, uint64(size)) {
+			return
+		}
+	}
+}
+
+// observeReads records that a request was assembled in the given amount of reads.
+func (s *Stats) observeReads(reads int) {
+	if reads < 1 {
+		reads = 1
+	}
+	if reads > ReadsPerRequestBuckets {
+		reads = ReadsPerRequestBuckets
+	}
+	atomic.AddUint64(&s.ReadsPerRequest[reads-1], 1)
+}
+
+func (s *Stats) snapshot() Stats {
+	snapshot := Stats{
+		TruncatedRequests:     atomic.LoadUint64(&s.TruncatedRequests),
+		TimedOutRequests:      atomic.LoadUint64(&s.TimedOutRequests),
+		TimedOutHandlers:      atomic.LoadUint64(&s.TimedOutHandlers),
+		AbandonedHandlers:     atomic.LoadUint64(&s.AbandonedHandlers),
+		ExpiredConnections:    atomic.LoadUint64(&s.ExpiredConnections),
+		ShedRequests:          atomic.LoadUint64(&s.ShedRequests),
+		PausedConnections:     atomic.LoadUint64(&s.PausedConnections),
+		SpilledRequests:       atomic.LoadUint64(&s.SpilledRequests),
+		BodyLengthMismatches:  atomic.LoadUint64(&s.BodyLengthMismatches),
+		MaxRequestBytes:       atomic.LoadUint64(&s.MaxRequestBytes),
+		CompletedRequests:     atomic.LoadUint64(&s.CompletedRequests),
+		CompletedRequestBytes: atomic.LoadUint64(&s.CompletedRequestBytes),
+		OverBudgetConnections: atomic.LoadUint64(&s.OverBudgetConnections),
+	}
+	for i := range s.ReadsPerRequest {
+		snapshot.ReadsPerRequest[i] = atomic.LoadUint64(&s.ReadsPerRequest[i])
+	}
+	return snapshot
+}
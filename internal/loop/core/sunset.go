@@ -0,0 +1,53 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sunset marks the routes under a path prefix as deprecated, advertising it to clients with the Deprecation header
+// (RFC 9745) and the Sunset header (RFC 8594) on every response that the handler writes for them.
+type Sunset struct {
+	// Deprecated is when the routes were deprecated. When zero, no Deprecation header is added.
+	Deprecated time.Time
+	// At is when the routes are expected to stop responding. When zero, no Sunset header is added.
+	At time.Time
+	// Prefix is the path prefix of the routes, like "/v1/".
+	Prefix string
+	// Link is the URL of a resource that documents the deprecation, added as a Link header with the rel of
+	// "deprecation". When empty, no Link header is added.
+	Link string
+}
+
+// matchSunset returns the Sunset with the longest Prefix that the path falls under, or nil when there is none.
+func (h *Handler) matchSunset(path string) *Sunset {
+	var match *Sunset
+	for i := range h.config.Sunsets {
+		sunset := &h.config.Sunsets[i]
+		if strings.HasPrefix(path, sunset.Prefix) && (match == nil || len(sunset.Prefix) > len(match.Prefix)) {
+			match = sunset
+		}
+	}
+	return match
+}
+
+// addSunsetHeaders adds the deprecation headers of the routes that the path falls under, if any. They are added before
+// the request is dispatched, so the handler can still override them.
+func (h *Handler) addSunsetHeaders(path string, header http.Header) {
+	sunset := h.matchSunset(path)
+	if sunset == nil {
+		return
+	}
+
+	if !sunset.Deprecated.IsZero() {
+		header.Set("Deprecation", "@"+strconv.FormatInt(sunset.Deprecated.Unix(), 10))
+	}
+	if !sunset.At.IsZero() {
+		header.Set("Sunset", sunset.At.UTC().Format(http.TimeFormat))
+	}
+	if sunset.Link != "" {
+		header.Add("Link", "<"+sunset.Link+">; rel=\"deprecation\"")
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+)
+
+func TestHandler_Sunsets(t *testing.T) {
+	deprecated := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2026, time.December, 31, 23, 59, 59, 0, time.UTC)
+	betaAt := time.Date(2026, time.June, 30, 0, 0, 0, 0, time.UTC)
+	sunsets := []Sunset{
+		{Prefix: "/v1/", Deprecated: deprecated, At: at, Link: "https://example.com/migrating-to-v2"},
+		{Prefix: "/v1/beta/", At: betaAt},
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/postponed" {
+			w.Header().Set("Sunset", "Fri, 31 Dec 2027 23:59:59 GMT")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		desc               string
+		target             string
+		expectedDeprecated string
+		expectedSunset     string
+		expectedLink       string
+		opts               []Option
+	}{
+		{
+			desc:               "deprecated route",
+			target:             "/v1/items",
+			expectedDeprecated: "@1767225600",
+			expectedSunset:     "Thu, 31 Dec 2026 23:59:59 GMT",
+			expectedLink:       `<https://example.com/migrating-to-v2>; rel="deprecation"`,
+		},
+		{
+			desc:               "deprecated route with a query",
+			target:             "/v1/items?page=2",
+			expectedDeprecated: "@1767225600",
+			expectedSunset:     "Thu, 31 Dec 2026 23:59:59 GMT",
+			expectedLink:       `<https://example.com/migrating-to-v2>; rel="deprecation"`,
+		},
+		{
+			desc:           "longest prefix wins",
+			target:         "/v1/beta/items",
+			expectedSunset: "Tue, 30 Jun 2026 00:00:00 GMT",
+		},
+		{
+			desc:               "handler overrides the headers",
+			target:             "/v1/postponed",
+			expectedDeprecated: "@1767225600",
+			expectedSunset:     "Fri, 31 Dec 2027 23:59:59 GMT",
+			expectedLink:       `<https://example.com/migrating-to-v2>; rel="deprecation"`,
+		},
+		{
+			desc:   "path that only shares the beginning of the prefix",
+			target: "/v1",
+		},
+		{
+			desc:   "other version",
+			target: "/v2/items",
+		},
+		{
+			desc:   "other version under the prefix",
+			target: "/api/v1/items",
+		},
+		{
+			desc:               "raw handler",
+			target:             "/v1/items",
+			opts:               []Option{WithRawHandler(raw)},
+			expectedDeprecated: "@1767225600",
+			expectedSunset:     "Thu, 31 Dec 2026 23:59:59 GMT",
+			expectedLink:       `<https://example.com/migrating-to-v2>; rel="deprecation"`,
+		},
+		{
+			desc:   "raw handler on another version",
+			target: "/v2/items",
+			opts:   []Option{WithRawHandler(raw)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), handler, append([]Option{WithSunsets(sunsets...)}, tC.opts...)...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("GET "+tC.target+" HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			res := expectStatus(subT, out, http.StatusOK)
+
+			for _, header := range []struct {
+				name     string
+				expected string
+			}{
+				{name: "Deprecation", expected: tC.expectedDeprecated},
+				{name: "Sunset", expected: tC.expectedSunset},
+				{name: "Link", expected: tC.expectedLink},
+			} {
+				if got := res.Header.Get(header.name); got != header.expected {
+					subT.Errorf("%s = %q, want %q", header.name, got, header.expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHandler_ReadTimeout(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		frames         []string
+		opts           []Option
+		expectedStatus int
+		expectedWoken  bool
+	}{
+		{
+			desc:           "partial request gets a 408",
+			frames:         []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\""},
+			opts:           []Option{WithReadTimeout(time.Millisecond), WithRequestTimeoutResponse()},
+			expectedWoken:  true,
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		{
+			desc:          "partial request is closed without the response option",
+			frames:        []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"},
+			opts:          []Option{WithReadTimeout(time.Millisecond)},
+			expectedWoken: true,
+		},
+		{
+			desc:          "idle connection is left alone",
+			frames:        []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"},
+			opts:          []Option{WithReadTimeout(time.Millisecond), WithRequestTimeoutResponse()},
+			expectedWoken: false,
+		},
+		{
+			desc:          "partial request is left alone without a timeout",
+			frames:        []string{"POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"},
+			expectedWoken: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			for _, frame := range tC.frames {
+				h.Data(c, []byte(frame))
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			h.Tick()
+
+			if (c.woken > 0) != tC.expectedWoken {
+				subT.Fatalf("connection woken %d times, want woken %v", c.woken, tC.expectedWoken)
+			}
+
+			if !tC.expectedWoken {
+				return
+			}
+
+			// Ticking again must not wake the connection again
+			h.Tick()
+			if c.woken != 1 {
+				subT.Errorf("connection woken %d times, want 1", c.woken)
+			}
+
+			out, action := h.Data(c, nil)
+			if action != Close {
+				subT.Errorf("Data() action = %v, want %v", action, Close)
+			}
+
+			if h.Stats().TimedOutRequests != 1 {
+				subT.Errorf("Stats().TimedOutRequests = %d, want 1", h.Stats().TimedOutRequests)
+			}
+
+			h.Closed(c, nil)
+			if h.Stats().TruncatedRequests != 0 {
+				subT.Errorf("Stats().TruncatedRequests = %d, want 0", h.Stats().TruncatedRequests)
+			}
+
+			if tC.expectedStatus == 0 {
+				if len(out) > 0 {
+					subT.Errorf("Data() wrote %q, want no response", out)
+				}
+				return
+			}
+
+			if !bytes.HasPrefix(out, []byte("HTTP/1.1 408 Request Timeout\r\n")) {
+				subT.Errorf("Data() wrote %q, want a 408 status line", out)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+			if res.StatusCode != tC.expectedStatus || !res.Close {
+				subT.Errorf("response status = %d close = %v, want %d and close", res.StatusCode, res.Close, tC.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_BodyReadTimeout(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		opts           []Option
+		expectedStatus int
+	}{
+		{
+			desc:           "slow body gets a 408",
+			opts:           []Option{WithBodyReadTimeout(10 * time.Millisecond)},
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		{
+			desc:           "slow body within the timeout is handled",
+			opts:           []Option{WithBodyReadTimeout(time.Minute)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "slow body is handled without a timeout",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "slow body is handled within the read timeout",
+			opts:           []Option{WithReadTimeout(time.Minute), WithRequestTimeoutResponse()},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := newTestHandler(tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			if out, action := h.Data(c, []byte("POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n")); len(out) > 0 || action != None {
+				subT.Fatalf("Data() = %q, %v, want nothing and %v", out, action, None)
+			}
+
+			// The body is fed a byte at a time, taking longer than the BodyReadTimeout in total
+			var out []byte
+			var action Action
+			for _, b := range []byte("{\"req\": 0}") {
+				time.Sleep(3 * time.Millisecond)
+				h.Tick()
+				if c.woken > 0 {
+					break
+				}
+				out, action = h.Data(c, []byte{b})
+			}
+
+			if tC.expectedStatus == http.StatusOK {
+				if c.woken > 0 {
+					subT.Fatalf("connection woken %d times, want it left alone", c.woken)
+				}
+				if action != None {
+					subT.Errorf("Data() action = %v, want %v", action, None)
+				}
+				expectStatus(subT, out, http.StatusOK)
+
+				// The body timer of the handled request must not fire for the next one
+				time.Sleep(3 * time.Millisecond)
+				h.Tick()
+				if c.woken > 0 {
+					subT.Errorf("connection woken %d times after the request was handled, want 0", c.woken)
+				}
+				return
+			}
+
+			if c.woken != 1 {
+				subT.Fatalf("connection woken %d times, want 1", c.woken)
+			}
+
+			out, action = h.Data(c, nil)
+			if action != Close {
+				subT.Errorf("Data() action = %v, want %v", action, Close)
+			}
+			if res := expectStatus(subT, out, tC.expectedStatus); !res.Close {
+				subT.Error("response doesn't close the connection")
+			}
+
+			if h.Stats().TimedOutRequests != 1 {
+				subT.Errorf("Stats().TimedOutRequests = %d, want 1", h.Stats().TimedOutRequests)
+			}
+
+			h.Closed(c, nil)
+			if h.Stats().TruncatedRequests != 0 {
+				subT.Errorf("Stats().TruncatedRequests = %d, want 0", h.Stats().TruncatedRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timerKind is the deadline that a wheelTimer tracks.
+type timerKind uint8
+
+const (
+	// readTimer fires when the request being read on the connection has outlived the ReadTimeout.
+	readTimer timerKind = iota
+	// bodyTimer fires when the body of the request being read on the connection has outlived the BodyReadTimeout.
+	bodyTimer
+	// lifetimeTimer fires when the connection has outlived the MaxConnLifetime.
+	lifetimeTimer
+	// drainTimer fires when a draining connection hasn't been closed by the client within the drainTimeout.
+	drainTimer
+)
+
+// Timing wheel defaults: ticks happen every second, so a revolution of the wheel covers a little over 8 minutes,
+// and deadlines that are further away than that stay in their slot for another round.
+const (
+	wheelResolution = time.Second
+	wheelSlots      = 512
+)
+
+// wheelTimer is an entry of a timingWheel. Every conn embeds one timer per kind of deadline, so scheduling never
+// allocates. Except for armed, its fields are guarded by the lock of the wheel.
+type wheelTimer struct {
+	conn       *conn
+	prev, next *wheelTimer
+	// deadline is the unix nano timestamp that the timer fires at.
+	deadline int64
+	// armed is set while the timer is scheduled, and lets the event loops skip the wheel's lock when it already is.
+	armed uint32
+	kind  timerKind
+	// stopped is set once the connection is closed, after which the timer can't be scheduled again.
+	stopped bool
+}
+
+// arm flags the timer as scheduled, and reports whether it wasn't already flagged.
+func (t *wheelTimer) arm() bool {
+	return atomic.CompareAndSwapUint32(&t.armed, 0, 1)
+}
+
+// disarm clears the scheduled flag of a timer that has fired.
+func (t *wheelTimer) disarm() {
+	atomic.StoreUint32(&t.armed, 0)
+}
+
+// timingWheel is a hashed timing wheel of connection deadlines. Timers are hashed into the slot of the tick that their
+// deadline falls in, so that advancing the wheel only visits the slots of the ticks that have passed, instead of
+// every connection. Scheduling, stopping and firing a timer are all O(1).
+type timingWheel struct {
+	// slots are the sentinels of the circular lists of timers in each slot.
+	slots      []wheelTimer
+	resolution int64
+	// tick is the last tick that the wheel was advanced to. Its slot is visited again on the next advance, since it
+	// may have been scheduled with deadlines that hadn't passed yet.
+	tick int64
+	mu   sync.Mutex
+}
+
+func newTimingWheel(resolution time.Duration, slots int, now time.Time) *timingWheel {
+	w := &timingWheel{
+		slots:      make([]wheelTimer, slots),
+		resolution: int64(resolution),
+		tick:       now.UnixNano() / int64(resolution),
+	}
+	for i := range w.slots {
+		head := &w.slots[i]
+		head.prev, head.next = head, head
+	}
+	return w
+}
+
+// schedule (re)schedules the timer to fire at the deadline, unless it has been stopped.
+func (w *timingWheel) schedule(t *wheelTimer, deadline int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.stopped {
+		return
+	}
+	if t.next != nil {
+		unlink(t)
+	}
+
+	t.deadline = deadline
+	tick := deadline / w.resolution
+	if tick < w.tick {
+		// Deadlines that have already passed fire on the next advance
+		tick = w.tick
+	}
+
+	head := &w.slots[tick%int64(len(w.slots))]
+	t.prev, t.next = head.prev, head
+	head.prev.next = t
+	head.prev = t
+}
+
+// stop removes the timer from the wheel for good.
+func (w *timingWheel) stop(t *wheelTimer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.next != nil {
+		unlink(t)
+	}
+	t.stopped = true
+}
+
+// advance moves the wheel up to now, removing the timers whose deadline has passed and appending them to expired.
+func (w *timingWheel) advance(now time.Time, expired []*wheelTimer) []*wheelTimer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	nowNano := now.UnixNano()
+	nowTick := nowNano / w.resolution
+	if nowTick < w.tick {
+		return expired
+	}
+
+	// After a full revolution every slot has been visited, so a long pause between advances is bounded by the wheel's size
+	ticks := nowTick - w.tick + 1
+	if ticks > int64(len(w.slots)) {
+		ticks = int64(len(w.slots))
+	}
+
+	for i := int64(0); i < ticks; i++ {
+		head := &w.slots[(w.tick+i)%int64(len(w.slots))]
+		for t := head.next; t != head; {
+			next := t.next
+			// Slots hold the deadlines of every revolution, so the ones that are still due in a later round are kept
+			if t.deadline <= nowNano {
+				unlink(t)
+				expired = append(expired, t)
+			}
+			t = next
+		}
+	}
+
+	w.tick = nowTick
+	return expired
+}
+
+func unlink(t *wheelTimer) {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev, t.next = nil, nil
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingWheel(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(d time.Duration) int64 { return start.Add(d).UnixNano() }
+
+	testCases := []struct {
+		desc      string
+		deadlines []int64
+		stopped   []int
+		moved     map[int]int64
+		advances  []time.Duration
+		expected  [][]int
+	}{
+		{
+			desc:      "deadlines within the current tick",
+			deadlines: []int64{at(100 * time.Millisecond), at(900 * time.Millisecond)},
+			advances:  []time.Duration{500 * time.Millisecond, 950 * time.Millisecond},
+			expected:  [][]int{{0}, {1}},
+		},
+		{
+			desc:      "deadlines fire on the tick they fall in",
+			deadlines: []int64{at(3 * time.Second), at(time.Second), at(2 * time.Second)},
+			advances:  []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+			expected:  [][]int{{1}, {2}, {0}},
+		},
+		{
+			desc:      "skipped ticks are visited",
+			deadlines: []int64{at(time.Second), at(5 * time.Second), at(10 * time.Second)},
+			advances:  []time.Duration{7 * time.Second},
+			expected:  [][]int{{0, 1}},
+		},
+		{
+			desc:      "overdue deadlines fire on the next advance",
+			deadlines: []int64{at(-time.Hour)},
+			advances:  []time.Duration{0},
+			expected:  [][]int{{0}},
+		},
+		{
+			desc:      "later rounds are kept in their slot",
+			deadlines: []int64{at(time.Second), at(time.Second + wheelSlots*time.Second)},
+			advances:  []time.Duration{time.Second, wheelSlots * time.Second, (wheelSlots + 1) * time.Second},
+			expected:  [][]int{{0}, nil, {1}},
+		},
+		{
+			desc:      "pauses longer than a revolution",
+			deadlines: []int64{at(time.Second), at(time.Hour)},
+			advances:  []time.Duration{2 * time.Hour},
+			expected:  [][]int{{0, 1}},
+		},
+		{
+			desc:      "stopped timers never fire",
+			deadlines: []int64{at(time.Second), at(time.Second)},
+			stopped:   []int{0},
+			advances:  []time.Duration{time.Second},
+			expected:  [][]int{{1}},
+		},
+		{
+			desc:      "rescheduled timers fire at their new deadline",
+			deadlines: []int64{at(time.Second), at(2 * time.Second)},
+			moved:     map[int]int64{0: at(3 * time.Second)},
+			advances:  []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+			expected:  [][]int{nil, {1}, {0}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			w := newTimingWheel(wheelResolution, wheelSlots, start)
+			timers := make([]wheelTimer, len(tC.deadlines))
+			index := make(map[*wheelTimer]int, len(timers))
+			for i, deadline := range tC.deadlines {
+				index[&timers[i]] = i
+				w.schedule(&timers[i], deadline)
+			}
+			for _, i := range tC.stopped {
+				w.stop(&timers[i])
+			}
+			for i, deadline := range tC.moved {
+				w.schedule(&timers[i], deadline)
+			}
+
+			for i, advance := range tC.advances {
+				expired := w.advance(start.Add(advance), nil)
+				if len(expired) != len(tC.expected[i]) {
+					subT.Fatalf("advance(%v) expired %d timers, want %v", advance, len(expired), tC.expected[i])
+				}
+
+				fired := make(map[int]bool, len(expired))
+				for _, timer := range expired {
+					fired[index[timer]] = true
+				}
+				for _, expected := range tC.expected[i] {
+					if !fired[expected] {
+						subT.Errorf("advance(%v) didn't expire timer %d", advance, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_ReadTimeoutRearms(t *testing.T) {
+	h := newTestHandler(WithReadTimeout(time.Hour))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	request := "POST /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nContent-Length: 10\r\n\r\n{\"req\": 0}"
+	h.Data(c, []byte(request))
+	h.Data(c, []byte(request))
+
+	// The timer of the first request fires after the request is done, and is only scheduled again by the next one
+	h.reap(time.Now().Add(2 * time.Hour))
+	if c.woken != 0 {
+		t.Fatalf("connection woken %d times, want 0", c.woken)
+	}
+
+	h.Data(c, []byte(request[:20]))
+	h.reap(time.Now().Add(2 * time.Hour))
+	if c.woken != 1 {
+		t.Fatalf("connection woken %d times, want 1", c.woken)
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// TLSSessionTickets holds the keys that TLS session tickets are encrypted with, so that returning clients (with a
+// tls.ClientSessionCache) can resume their session with an abbreviated handshake instead of a full one. A new key is
+// made every rotation, and the key it replaces still decrypts tickets for one more rotation, so tickets are accepted
+// for at least one and at most two rotations. The same TLSSessionTickets has to be used for all the connections that
+// clients may resume on.
+type TLSSessionTickets struct {
+	rotated  time.Time
+	now      func() time.Time
+	base     *tls.Config
+	config   *tls.Config
+	keys     [][32]byte
+	rotation time.Duration
+	mu       sync.Mutex
+}
+
+// NewTLSSessionTickets makes session ticket keys that are rotated every rotation, which must be positive.
+func NewTLSSessionTickets(rotation time.Duration) *TLSSessionTickets {
+	return &TLSSessionTickets{rotation: rotation, now: time.Now}
+}
+
+// ServerConfig returns a clone of the base config that issues session tickets with the current key, and accepts the
+// ones of the previous key. It is meant to be called for every handshake, for example from the GetConfigForClient of
+// the base config, since keys are rotated lazily when a handshake needs them. A key that should have been replaced
+// more than a rotation ago is dropped instead of kept as the previous key.
+func (t *TLSSessionTickets) ServerConfig(base *tls.Config) (*tls.Config, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	rotate := len(t.keys) == 0 || now.Sub(t.rotated) >= t.rotation
+	if rotate {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+
+		keys := [][32]byte{key}
+		if len(t.keys) > 0 && now.Sub(t.rotated) < 2*t.rotation {
+			keys = append(keys, t.keys[0])
+		}
+		t.keys = keys
+		t.rotated = now
+	}
+
+	// The configs that handshakes already run with are never modified, so the keys are set on a new clone instead
+	if rotate || t.base != base {
+		config := base.Clone()
+		config.SessionTicketsDisabled = false
+		config.SetSessionTicketKeys(t.keys)
+		t.base = base
+		t.config = config
+	}
+	return t.config, nil
+}
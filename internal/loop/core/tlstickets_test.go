@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+// testTLSConfigs returns the TLS configs of a server with a self signed certificate for 127.0.0.1 and example.com, and
+// of a client that trusts it.
+func testTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server-scratch"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unable to parse certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+	return server, client
+}
+
+func TestTLSSessionTickets(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	clientTLS.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	clock := time.Unix(0, 0)
+	tickets := NewTLSSessionTickets(time.Hour)
+	tickets.now = func() time.Time { return clock }
+
+	steps := []struct {
+		desc           string
+		advance        time.Duration
+		expectedResume bool
+	}{
+		{desc: "first connection runs the full handshake"},
+		{desc: "returning client resumes", advance: time.Minute, expectedResume: true},
+		{desc: "ticket of the previous key resumes after a rotation", advance: time.Hour, expectedResume: true},
+		{desc: "ticket of a key that aged out runs the full handshake", advance: 2 * time.Hour},
+		{desc: "new ticket resumes again", advance: time.Minute, expectedResume: true},
+	}
+	for _, step := range steps {
+		clock = clock.Add(step.advance)
+		config, err := tickets.ServerConfig(serverTLS)
+		if err != nil {
+			t.Fatalf("%s: ServerConfig() error = %v", step.desc, err)
+		}
+		if resumed := serveTLSConn(t, config, clientTLS); resumed != step.expectedResume {
+			t.Fatalf("%s: resumed = %v, want %v", step.desc, resumed, step.expectedResume)
+		}
+	}
+
+	if serverTLS.SessionTicketsDisabled {
+		t.Error("the base config was modified")
+	}
+}
+
+// serveTLSConn serves a TLS connection with ServeConn, reads the response to a request over it (which is when the
+// client gets its session ticket) and closes it, and reports whether the handshake was resumed.
+func serveTLSConn(t *testing.T, serverTLS, clientTLS *tls.Config) bool {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- ServeConn(ctx, tls.Server(server, serverTLS), handler, WithLogger(&recordingLogger{}))
+	}()
+
+	tlsConn := tls.Client(client, clientTLS)
+	go func() {
+		_, _ = tlsConn.Write([]byte("GET /resume HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	}()
+	res, err := http.ReadResponse(bufio.NewReader(tlsConn), nil)
+	if err != nil {
+		t.Fatalf("unable to read response over TLS: %v", err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unable to read response body: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || string(body) != "/resume" {
+		t.Errorf("response = %d %q, want 200 %q", res.StatusCode, body, "/resume")
+	}
+
+	tlsConn.Close()
+	if err := <-errs; err != nil {
+		t.Errorf("ServeConn() error = %v, want nil", err)
+	}
+	return tlsConn.ConnectionState().DidResume
+}
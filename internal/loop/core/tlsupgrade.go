@@ -0,0 +1,62 @@
+package core
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+)
+
+var switchingToTLSResponse = []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: TLS/1.0, HTTP/1.1\r\nConnection: Upgrade\r\n\r\n")
+
+// upgradesToTLS reports whether the request asks to upgrade its connection to TLS as defined in RFC 2817 section 3.2,
+// and the connection can be upgraded. Only connections served by ServeConn (and Handler.Serve) own the net.Conn that
+// the handshake has to run over, so requests on the event loop engines are served in cleartext, which the RFC allows
+// since the client didn't make the upgrade mandatory.
+func (h *Handler) upgradesToTLS(state *conn, req *http.Request) bool {
+	// Spilled bodies are gone by the time the handshake is done, so those requests are served in cleartext as well
+	if h.config.TLSUpgrade == nil || !state.tlsUpgradable || state.tlsUpgraded || state.spill != nil || !req.ProtoAtLeast(1, 1) {
+		return false
+	}
+	return headerHasToken(req.Header, "Connection", "upgrade") && headerHasToken(req.Header, "Upgrade", "TLS/1.0")
+}
+
+// headerHasToken reports whether any of the comma separated values of the header is the token, ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeTLS runs the TLS handshake over the connection once the 101 Switching Protocols has been written, and then
+// serves the request that asked for the upgrade, whose response RFC 2817 section 3.3 requires to be sent over TLS.
+// The connection is replaced by the TLS connection that the response and everything after it go through.
+func (h *Handler) upgradeTLS(c *netConn, state *conn) ([]byte, Action, error) {
+	data := state.upgrade
+	state.upgrade = nil
+	state.tlsUpgraded = true
+
+	config := h.config.TLSUpgrade
+	if h.config.TLSSessionTickets != nil {
+		var err error
+		if config, err = h.config.TLSSessionTickets.ServerConfig(config); err != nil {
+			return nil, Close, err
+		}
+	}
+
+	tlsConn := tls.Server(c.Conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, Close, err
+	}
+	c.Conn = tlsConn
+	state.serverName = tlsConn.ConnectionState().ServerName
+
+	state.setState(StateWriting)
+	res, action := h.serveObserved(state, data, h.phaseStart())
+	state.reset()
+	return res, action, nil
+}
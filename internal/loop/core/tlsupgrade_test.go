@@ -0,0 +1,207 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestServeConn_TLSUpgrade(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upgrade", r.Header.Get("Upgrade"))
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+
+	testCases := []struct {
+		desc            string
+		headers         string
+		opts            []Option
+		expectedUpgrade bool
+	}{
+		{
+			desc:            "upgrade",
+			headers:         "Upgrade: TLS/1.0\r\nConnection: Upgrade\r\n",
+			opts:            []Option{WithTLSUpgrade(serverTLS)},
+			expectedUpgrade: true,
+		},
+		{
+			desc:            "upgrade among other protocols and connection options",
+			headers:         "Upgrade: websocket, tls/1.0\r\nConnection: keep-alive, upgrade\r\n",
+			opts:            []Option{WithTLSUpgrade(serverTLS)},
+			expectedUpgrade: true,
+		},
+		{
+			desc:    "upgrade without the connection option",
+			headers: "Upgrade: TLS/1.0\r\n",
+			opts:    []Option{WithTLSUpgrade(serverTLS)},
+		},
+		{
+			desc:    "upgrade to another protocol",
+			headers: "Upgrade: websocket\r\nConnection: Upgrade\r\n",
+			opts:    []Option{WithTLSUpgrade(serverTLS)},
+		},
+		{
+			desc:    "upgrade without the option",
+			headers: "Upgrade: TLS/1.0\r\nConnection: Upgrade\r\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- ServeConn(ctx, server, handler, append([]Option{WithLogger(&recordingLogger{})}, tC.opts...)...)
+			}()
+
+			go func() {
+				_, _ = client.Write([]byte("GET /first HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n" + tC.headers + "\r\n"))
+			}()
+
+			var conn net.Conn = client
+			r := bufio.NewReader(client)
+			res, err := http.ReadResponse(r, nil)
+			if err != nil {
+				subT.Fatalf("unable to read response: %v", err)
+			}
+
+			if tC.expectedUpgrade {
+				if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Upgrade") != "TLS/1.0, HTTP/1.1" || res.Header.Get("Connection") != "Upgrade" {
+					subT.Fatalf("response = %d %v, want a 101 that upgrades to TLS/1.0", res.StatusCode, res.Header)
+				}
+
+				// The response to the request that asked for the upgrade only comes once the handshake is done
+				tlsConn := tls.Client(client, clientTLS)
+				if err := tlsConn.Handshake(); err != nil {
+					subT.Fatalf("unable to complete the TLS handshake: %v", err)
+				}
+				conn = tlsConn
+				r = bufio.NewReader(tlsConn)
+
+				res, err = http.ReadResponse(r, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response over TLS: %v", err)
+				}
+			}
+
+			expectBody(subT, res, "/first")
+			if got := res.Header.Get("X-Upgrade"); got == "" {
+				subT.Error("the handler didn't see the Upgrade header of the request")
+			}
+
+			// Whatever the connection ended up as, it is kept alive for the next request
+			go func() {
+				_, _ = conn.Write([]byte("GET /second HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+			}()
+			res, err = http.ReadResponse(r, nil)
+			if err != nil {
+				subT.Fatalf("unable to read the second response: %v", err)
+			}
+			expectBody(subT, res, "/second")
+
+			conn.Close()
+			if err := <-errs; err != nil {
+				subT.Errorf("ServeConn() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func expectBody(t *testing.T, res *http.Response, expected string) {
+	t.Helper()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unable to read response body: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || string(body) != expected {
+		t.Errorf("response = %d %q, want 200 %q", res.StatusCode, body, expected)
+	}
+}
+
+func TestHandler_TLSUpgradeOnEventLoop(t *testing.T) {
+	serverTLS, _ := testTLSConfigs(t)
+	h := newTestHandler(WithTLSUpgrade(serverTLS))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	// The event loop engines can't run the handshake, so the request is served in cleartext
+	out, action := h.Data(c, []byte("GET /echo HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUpgrade: TLS/1.0\r\nConnection: Upgrade\r\n\r\n"))
+	if action != None {
+		t.Errorf("Data() action = %v, want %v", action, None)
+	}
+	expectStatus(t, out, http.StatusOK)
+}
+
+func TestServeConn_TLSUpgradeSessionTickets(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	clientTLS.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	tickets := NewTLSSessionTickets(time.Hour)
+
+	// Tickets are only issued because of the option
+	serverTLS.SessionTicketsDisabled = true
+
+	for i, expectedResume := range []bool{false, true} {
+		if resumed := upgradeTLSConn(t, clientTLS, WithTLSUpgrade(serverTLS), WithTLSSessionTickets(tickets)); resumed != expectedResume {
+			t.Fatalf("connection %d: resumed = %v, want %v", i, resumed, expectedResume)
+		}
+	}
+}
+
+// upgradeTLSConn serves a connection that upgrades to TLS with ServeConn, reads the response to the upgrading request
+// (which is when the client gets its session ticket) and closes it, and reports whether the handshake was resumed.
+func upgradeTLSConn(t *testing.T, clientTLS *tls.Config, opts ...Option) bool {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- ServeConn(ctx, server, handler, append([]Option{WithLogger(&recordingLogger{})}, opts...)...)
+	}()
+
+	go func() {
+		_, _ = client.Write([]byte("GET /resume HTTP/1.1\r\nHost: 127.0.0.1:8080\r\nUpgrade: TLS/1.0\r\nConnection: Upgrade\r\n\r\n"))
+	}()
+	res, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatalf("unable to read response: %v", err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("response = %d, want %d", res.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	tlsConn := tls.Client(client, clientTLS)
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("unable to complete the TLS handshake: %v", err)
+	}
+	res, err = http.ReadResponse(bufio.NewReader(tlsConn), nil)
+	if err != nil {
+		t.Fatalf("unable to read response over TLS: %v", err)
+	}
+	expectBody(t, res, "/resume")
+
+	tlsConn.Close()
+	if err := <-errs; err != nil {
+		t.Errorf("ServeConn() error = %v, want nil", err)
+	}
+	return tlsConn.ConnectionState().DidResume
+}
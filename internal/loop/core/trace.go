@@ -0,0 +1,218 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// TraceFormat is a bit mask of the trace context propagation formats that are extracted from requests.
+type TraceFormat uint
+
+const (
+	// TraceW3C extracts the W3C Trace Context traceparent and tracestate headers.
+	TraceW3C TraceFormat = 1 << iota
+	// TraceB3 extracts the B3 headers of Zipkin, either the single b3 header or the X-B3-* headers.
+	TraceB3
+)
+
+// TraceID identifies a trace across all of the services that take part in it.
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the trace ID isn't all zeroes, which both formats reserve as invalid.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a single span of a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the span ID isn't all zeroes, which both formats reserve as invalid.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// TraceContext is the trace that a request belongs to, as propagated by the client or generated by the Handler.
+type TraceContext struct {
+	// State is the vendor specific tracestate of a W3C trace, if any.
+	State string
+	// TraceID is the trace that the request belongs to. B3 trace IDs of 64 bits are left padded with zeroes.
+	TraceID TraceID
+	// ParentID is the span of the client that sent the request, which the spans of the handler are children of.
+	// It is zero for generated traces, since the request is the root of the trace.
+	ParentID SpanID
+	// Sampled reports whether the client decided that the trace is recorded. Generated traces are always sampled.
+	Sampled bool
+	// Generated reports whether the trace was generated by the Handler because the request didn't carry one.
+	Generated bool
+}
+
+// Traceparent returns the trace context as a W3C traceparent header value, for propagating it with the given span
+// of the handler as the parent of the next hop.
+func (tc TraceContext) Traceparent(span SpanID) string {
+	flags := "00"
+	if tc.Sampled {
+		flags = "01"
+	}
+	return "00-" + tc.TraceID.String() + "-" + span.String() + "-" + flags
+}
+
+type traceContextKey struct{}
+
+// TraceContextFrom returns the trace context of a request, which is only set when trace propagation is enabled
+// (see WithTracePropagation) and the request carried a valid trace context, or one was generated for it.
+func TraceContextFrom(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// NewSpanID returns a random span ID, for handlers to identify their own spans with.
+func NewSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// withTraceContext returns the request with the trace context that it carries (or a generated one) in its context.
+func (h *Handler) withTraceContext(req *http.Request) *http.Request {
+	tc, ok := extractTraceContext(req.Header, h.config.TraceFormats)
+	if !ok {
+		if !h.config.GenerateTraces {
+			return req
+		}
+		tc = TraceContext{Sampled: true, Generated: true}
+		for !tc.TraceID.IsValid() {
+			_, _ = rand.Read(tc.TraceID[:])
+		}
+	}
+	return req.WithContext(context.WithValue(req.Context(), traceContextKey{}, tc))
+}
+
+// extractTraceContext parses the trace context of the first of the formats that the headers carry a valid one in.
+// W3C Trace Context takes precedence over B3, since it is the standard that both are moving towards.
+func extractTraceContext(header http.Header, formats TraceFormat) (TraceContext, bool) {
+	if formats&TraceW3C != 0 {
+		if tc, ok := parseTraceparent(header.Get("Traceparent")); ok {
+			tc.State = strings.Join(header.Values("Tracestate"), ",")
+			return tc, true
+		}
+	}
+
+	if formats&TraceB3 != 0 {
+		if b3 := header.Get("B3"); b3 != "" {
+			return parseB3Single(b3)
+		}
+		return parseB3Multi(header)
+	}
+	return TraceContext{}, false
+}
+
+// parseTraceparent parses a W3C traceparent header value: version-traceid-parentid-flags, all in lowercase hex.
+// Versions after 00 may append fields after the flags, which are ignored as the specification requires.
+func parseTraceparent(value string) (TraceContext, bool) {
+	var tc TraceContext
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return tc, false
+	}
+
+	version := value[:2]
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(value) != 55) || (len(value) > 55 && value[55] != '-') {
+		return tc, false
+	}
+
+	flags, ok := decodeLowerHex(value[53:55], 1)
+	if !ok {
+		return tc, false
+	}
+
+	if !decodeID(tc.TraceID[:], value[3:35]) || !decodeID(tc.ParentID[:], value[36:52]) {
+		return tc, false
+	}
+	tc.Sampled = flags[0]&1 == 1
+	return tc, tc.TraceID.IsValid() && tc.ParentID.IsValid()
+}
+
+// parseB3Single parses a single b3 header value: traceid-spanid, optionally followed by -sampling and -parentspanid.
+// A value that only holds a sampling decision carries no trace.
+func parseB3Single(value string) (TraceContext, bool) {
+	var tc TraceContext
+	fields := strings.Split(value, "-")
+	if len(fields) < 2 || len(fields) > 4 {
+		return tc, false
+	}
+
+	if !decodeB3TraceID(&tc.TraceID, fields[0]) || !decodeID(tc.ParentID[:], fields[1]) {
+		return tc, false
+	}
+
+	if len(fields) > 2 {
+		switch fields[2] {
+		case "1", "d":
+			tc.Sampled = true
+		case "0":
+		default:
+			return tc, false
+		}
+	}
+	return tc, tc.TraceID.IsValid() && tc.ParentID.IsValid()
+}
+
+// parseB3Multi parses the X-B3-TraceId, X-B3-SpanId, X-B3-Sampled and X-B3-Flags headers.
+func parseB3Multi(header http.Header) (TraceContext, bool) {
+	var tc TraceContext
+	if !decodeB3TraceID(&tc.TraceID, header.Get("X-B3-Traceid")) || !decodeID(tc.ParentID[:], header.Get("X-B3-Spanid")) {
+		return tc, false
+	}
+
+	switch header.Get("X-B3-Sampled") {
+	case "1", "true":
+		tc.Sampled = true
+	}
+
+	// The debug flag implies that the trace is sampled
+	if header.Get("X-B3-Flags") == "1" {
+		tc.Sampled = true
+	}
+	return tc, tc.TraceID.IsValid() && tc.ParentID.IsValid()
+}
+
+// decodeB3TraceID decodes a B3 trace ID, which is either 64 or 128 bits long.
+func decodeB3TraceID(id *TraceID, value string) bool {
+	if len(value) == 16 {
+		return decodeID(id[8:], value)
+	}
+	return decodeID(id[:], value)
+}
+
+// decodeID decodes the lowercase hex value into the ID, which it must exactly fill.
+func decodeID(id []byte, value string) bool {
+	decoded, ok := decodeLowerHex(value, len(id))
+	if !ok {
+		return false
+	}
+	copy(id, decoded)
+	return true
+}
+
+// decodeLowerHex decodes a lowercase hex value of n bytes. Both formats forbid uppercase hex digits.
+func decodeLowerHex(value string, n int) ([]byte, bool) {
+	if len(value) != n*2 || !isLowerHex(value) {
+		return nil, false
+	}
+
+	decoded, err := hex.DecodeString(value)
+	return decoded, err == nil
+}
+
+func isLowerHex(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
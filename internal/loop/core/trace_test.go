@@ -0,0 +1,183 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestHandler_TracePropagation(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := TraceContextFrom(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("X-Trace-Id", tc.TraceID.String())
+		w.Header().Set("X-Parent-Id", tc.ParentID.String())
+		w.Header().Set("X-Trace-State", tc.State)
+		w.Header().Set("X-Sampled", strconv.FormatBool(tc.Sampled))
+		w.Header().Set("X-Generated", strconv.FormatBool(tc.Generated))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		desc              string
+		headers           string
+		expectedTraceID   string
+		expectedParentID  string
+		expectedState     string
+		expectedSampled   string
+		expectedGenerated string
+		formats           TraceFormat
+		generate          bool
+	}{
+		{
+			desc:             "w3c trace context",
+			headers:          "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\ntracestate: congo=t61rcWkgMzE\r\ntracestate: rojo=00f067aa0ba902b7\r\n",
+			formats:          TraceW3C,
+			expectedTraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedParentID: "00f067aa0ba902b7",
+			expectedState:    "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7",
+			expectedSampled:  "true",
+		},
+		{
+			desc:             "w3c trace context of a future version",
+			headers:          "traceparent: 01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future\r\n",
+			formats:          TraceW3C,
+			expectedTraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedParentID: "00f067aa0ba902b7",
+			expectedSampled:  "false",
+		},
+		{
+			desc:    "uppercase w3c trace id",
+			headers: "traceparent: 00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01\r\n",
+			formats: TraceW3C,
+		},
+		{
+			desc:    "all zero w3c trace id",
+			headers: "traceparent: 00-00000000000000000000000000000000-00f067aa0ba902b7-01\r\n",
+			formats: TraceW3C,
+		},
+		{
+			desc:    "invalid w3c version",
+			headers: "traceparent: ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n",
+			formats: TraceW3C,
+		},
+		{
+			desc:    "w3c trace context that isn't enabled",
+			headers: "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n",
+			formats: TraceB3,
+		},
+		{
+			desc:             "single b3 header",
+			headers:          "b3: 80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90\r\n",
+			formats:          TraceB3,
+			expectedTraceID:  "80f198ee56343ba864fe8b2a57d3eff7",
+			expectedParentID: "e457b5a2e4d86bd1",
+			expectedSampled:  "true",
+		},
+		{
+			desc:    "single b3 header with only a sampling decision",
+			headers: "b3: 0\r\n",
+			formats: TraceB3,
+		},
+		{
+			desc:             "multiple b3 headers with a 64 bit trace id",
+			headers:          "X-B3-TraceId: a3ce929d0e0e4736\r\nX-B3-SpanId: 00f067aa0ba902b7\r\nX-B3-Flags: 1\r\n",
+			formats:          TraceB3,
+			expectedTraceID:  "0000000000000000a3ce929d0e0e4736",
+			expectedParentID: "00f067aa0ba902b7",
+			expectedSampled:  "true",
+		},
+		{
+			desc:             "w3c trace context takes precedence over b3",
+			headers:          "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00\r\nb3: 80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1\r\n",
+			formats:          TraceW3C | TraceB3,
+			expectedTraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedParentID: "00f067aa0ba902b7",
+			expectedSampled:  "false",
+		},
+		{
+			desc:             "invalid w3c trace context falls back to b3",
+			headers:          "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01\r\nb3: 80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0\r\n",
+			formats:          TraceW3C | TraceB3,
+			expectedTraceID:  "80f198ee56343ba864fe8b2a57d3eff7",
+			expectedParentID: "e457b5a2e4d86bd1",
+			expectedSampled:  "false",
+		},
+		{
+			desc:              "generated trace",
+			formats:           TraceW3C,
+			generate:          true,
+			expectedParentID:  "0000000000000000",
+			expectedSampled:   "true",
+			expectedGenerated: "true",
+		},
+		{
+			desc:    "missing trace",
+			formats: TraceW3C | TraceB3,
+		},
+		{
+			desc:    "disabled",
+			headers: "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			h := NewHandler(context.Background(), handler, WithLogger(&recordingLogger{}), WithTracePropagation(tC.formats, tC.generate))
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("GET /items HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"+tC.headers+"\r\n"))
+			if tC.expectedParentID == "" {
+				expectStatus(subT, out, http.StatusNoContent)
+				return
+			}
+
+			res := expectStatus(subT, out, http.StatusOK)
+			traceID := res.Header.Get("X-Trace-Id")
+			if tC.expectedGenerated == "" {
+				tC.expectedGenerated = "false"
+			} else if len(traceID) != 32 || traceID == "00000000000000000000000000000000" {
+				subT.Errorf("generated trace id = %q, want 32 hex digits that aren't all zero", traceID)
+			}
+
+			for _, header := range []struct {
+				name     string
+				expected string
+			}{
+				{name: "X-Parent-Id", expected: tC.expectedParentID},
+				{name: "X-Trace-State", expected: tC.expectedState},
+				{name: "X-Sampled", expected: tC.expectedSampled},
+				{name: "X-Generated", expected: tC.expectedGenerated},
+			} {
+				if got := res.Header.Get(header.name); got != header.expected {
+					subT.Errorf("%s = %q, want %q", header.name, got, header.expected)
+				}
+			}
+
+			if tC.expectedTraceID != "" && traceID != tC.expectedTraceID {
+				subT.Errorf("X-Trace-Id = %q, want %q", traceID, tC.expectedTraceID)
+			}
+		})
+	}
+}
+
+func TestTraceContext_Traceparent(t *testing.T) {
+	tc, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatal("unable to parse traceparent")
+	}
+
+	span := SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31}
+	if got, want := tc.Traceparent(span), "00-4bf92f3577b34da6a3ce929d0e0e4736-b7ad6b7169203331-01"; got != want {
+		t.Errorf("Traceparent() = %q, want %q", got, want)
+	}
+
+	if !NewSpanID().IsValid() {
+		t.Error("NewSpanID() returned an all zero span id")
+	}
+}
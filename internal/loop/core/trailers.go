@@ -0,0 +1,10 @@
+package core
+
+import "net/http"
+
+// AcceptsTrailers reports whether the request advertised TE: trailers, meaning that the client is willing to accept
+// trailer fields in a chunked response. The trailers of responses to requests without it are dropped, so handlers can
+// check it to skip computing trailers that would never be sent. RawHandlers have Request.AcceptsTrailers instead.
+func AcceptsTrailers(r *http.Request) bool {
+	return headerHasToken(r.Header, "TE", "trailers")
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/ioutil"
+)
+
+func TestHandler_Trailers(t *testing.T) {
+	var accepted bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = AcceptsTrailers(r)
+		w.Header().Set("Trailer", "X-Checksum")
+		_, _ = w.Write([]byte("hello, world"))
+		w.Header().Set("X-Checksum", "abc123")
+	})
+	raw := internalHttp.RawHandlerFunc(func(req *internalHttp.Request, w *internalHttp.ResponseWriter) {
+		accepted = req.AcceptsTrailers()
+		w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc123")
+		_, _ = w.Write([]byte("hello, world"))
+	})
+
+	testCases := []struct {
+		desc             string
+		headers          string
+		opts             []Option
+		expectedAccepted bool
+	}{
+		{
+			desc:             "client accepts trailers",
+			headers:          "TE: trailers\r\n",
+			expectedAccepted: true,
+		},
+		{
+			desc:             "client accepts trailers among other codings",
+			headers:          "TE: deflate;q=0.5, trailers\r\n",
+			expectedAccepted: true,
+		},
+		{
+			desc: "client without TE",
+		},
+		{
+			desc:    "client with TE but without trailers",
+			headers: "TE: deflate\r\n",
+		},
+		{
+			desc:             "raw handler with a client that accepts trailers",
+			headers:          "TE: trailers\r\n",
+			opts:             []Option{WithRawHandler(raw)},
+			expectedAccepted: true,
+		},
+		{
+			desc: "raw handler with a client without TE",
+			opts: []Option{WithRawHandler(raw)},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			accepted = !tC.expectedAccepted
+			h := NewHandler(context.Background(), handler, tC.opts...)
+			c := newTestConn()
+			h.Opened(c, c.wake)
+
+			out, _ := h.Data(c, []byte("GET /checksum HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n"+tC.headers+"\r\n"))
+			if accepted != tC.expectedAccepted {
+				subT.Errorf("accepts trailers = %v, want %v", accepted, tC.expectedAccepted)
+			}
+
+			res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), nil)
+			if err != nil {
+				subT.Fatalf("unable to read response %q: %v", out, err)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read response body: %v", err)
+			}
+			if string(body) != "hello, world" {
+				subT.Errorf("body = %q, want %q", body, "hello, world")
+			}
+
+			// The trailer is only known once the body has been read
+			expectedTrailer := ""
+			if tC.expectedAccepted {
+				expectedTrailer = "abc123"
+			}
+			if got := res.Trailer.Get("X-Checksum"); got != expectedTrailer {
+				subT.Errorf("X-Checksum trailer = %q, want %q", got, expectedTrailer)
+			}
+			if got := res.Header.Get("X-Checksum"); got != "" {
+				subT.Errorf("X-Checksum header = %q, want the trailer to never be sent as a header", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfig is wrapped by the errors returned from Config.Validate.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Validate reports the first inconsistency in the configuration, such as negative limits and timeouts, or options
+// that only take effect together with another option that isn't set, so that misconfigurations are caught when the
+// server is created instead of surfacing as odd behavior at runtime. The returned errors wrap ErrInvalidConfig.
+func (cfg Config) Validate() error {
+	for _, check := range []func() error{
+		cfg.validateLimits,
+		cfg.validateBudget,
+		cfg.validateTimeouts,
+		cfg.validateInFlight,
+		cfg.validateDispatch,
+		cfg.validateRequestRate,
+		cfg.validateResponses,
+		cfg.validateListener,
+	} {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func invalidConfig(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
+
+func (cfg Config) validateLimits() error {
+	for _, limit := range []struct {
+		name  string
+		value int64
+	}{
+		{name: "MaxBodyBytes", value: cfg.MaxBodyBytes},
+		{name: "MaxBufferedBytes", value: cfg.MaxBufferedBytes},
+		{name: "SpillThreshold", value: cfg.SpillThreshold},
+		{name: "MaxURILength", value: int64(cfg.MaxURILength)},
+		{name: "MaxHeaderValueBytes", value: int64(cfg.MaxHeaderValueBytes)},
+		{name: "RecordExchanges", value: int64(cfg.RecordExchanges)},
+		{name: "TCPFastOpenQueue", value: int64(cfg.TCPFastOpenQueue)},
+	} {
+		if limit.value < 0 {
+			return invalidConfig("%s must not be negative, got %d", limit.name, limit.value)
+		}
+	}
+	return nil
+}
+
+func (cfg Config) validateBudget() error {
+	if cfg.BudgetPolicy != BudgetReject && cfg.BudgetPolicy != BudgetEvictIdlest {
+		return invalidConfig("unknown BudgetPolicy %d", cfg.BudgetPolicy)
+	}
+	return nil
+}
+
+func (cfg Config) validateTimeouts() error {
+	if cfg.ReadTimeout < 0 {
+		return invalidConfig("ReadTimeout must not be negative, got %v", cfg.ReadTimeout)
+	}
+
+	if cfg.BodyReadTimeout < 0 {
+		return invalidConfig("BodyReadTimeout must not be negative, got %v", cfg.BodyReadTimeout)
+	}
+
+	if cfg.HandlerTimeout < 0 {
+		return invalidConfig("HandlerTimeout must not be negative, got %v", cfg.HandlerTimeout)
+	}
+
+	for _, route := range cfg.RouteTimeouts {
+		if !strings.HasPrefix(route.Prefix, "/") {
+			return invalidConfig("route timeout prefix must start with a /, got %q", route.Prefix)
+		}
+		if route.ReadTimeout < 0 || route.BodyReadTimeout < 0 || route.HandlerTimeout < 0 {
+			return invalidConfig("route timeouts of %q must not be negative", route.Prefix)
+		}
+	}
+
+	if cfg.MaxConnLifetime < 0 {
+		return invalidConfig("MaxConnLifetime must not be negative, got %v", cfg.MaxConnLifetime)
+	}
+
+	if cfg.SlowHandlerThreshold < 0 {
+		return invalidConfig("SlowHandlerThreshold must not be negative, got %v", cfg.SlowHandlerThreshold)
+	}
+
+	if cfg.RequestTimeoutResponse && cfg.ReadTimeout == 0 {
+		return invalidConfig("RequestTimeoutResponse requires a ReadTimeout")
+	}
+
+	if cfg.AbandonTimedOutHandlers && !cfg.hasHandlerTimeouts() {
+		return invalidConfig("AbandonTimedOutHandlers requires a HandlerTimeout")
+	}
+	return nil
+}
+
+func (cfg Config) validateDispatch() error {
+	if cfg.Dispatch != DispatchInline && cfg.Dispatch != DispatchWorkerPool && cfg.Dispatch != DispatchGoroutinePerConn {
+		return invalidConfig("unknown Dispatch %d", cfg.Dispatch)
+	}
+
+	if cfg.WorkerPoolSize < 0 {
+		return invalidConfig("WorkerPoolSize must not be negative, got %d", cfg.WorkerPoolSize)
+	}
+
+	if cfg.WorkerPoolSize > 0 && cfg.Dispatch != DispatchWorkerPool {
+		return invalidConfig("WorkerPoolSize requires the DispatchWorkerPool")
+	}
+	return nil
+}
+
+func (cfg Config) validateInFlight() error {
+	if cfg.MaxInFlight < 0 {
+		return invalidConfig("MaxInFlight must not be negative, got %d", cfg.MaxInFlight)
+	}
+
+	if cfg.MaxQueuedRequests < 0 {
+		return invalidConfig("MaxQueuedRequests must not be negative, got %d", cfg.MaxQueuedRequests)
+	}
+
+	if cfg.InFlightOverflow != OverflowReject && cfg.InFlightOverflow != OverflowQueue {
+		return invalidConfig("unknown InFlightOverflow %d", cfg.InFlightOverflow)
+	}
+
+	if cfg.MaxQueuedRequests > 0 && (cfg.MaxInFlight == 0 || cfg.InFlightOverflow != OverflowQueue) {
+		return invalidConfig("MaxQueuedRequests requires a MaxInFlight with the OverflowQueue behavior")
+	}
+	return nil
+}
+
+func (cfg Config) validateRequestRate() error {
+	if cfg.MaxRequestRate < 0 || cfg.MaxRequestRate > int(time.Second) {
+		return invalidConfig("MaxRequestRate must be between 0 and %d, got %d", int(time.Second), cfg.MaxRequestRate)
+	}
+
+	if cfg.RequestBurst < 0 {
+		return invalidConfig("RequestBurst must not be negative, got %d", cfg.RequestBurst)
+	}
+
+	if cfg.RequestBurst > 0 && cfg.MaxRequestRate == 0 {
+		return invalidConfig("RequestBurst requires a MaxRequestRate")
+	}
+	return nil
+}
+
+func (cfg Config) validateResponses() error {
+	if cfg.Logger == nil {
+		return invalidConfig("Logger must not be nil")
+	}
+
+	if cfg.ForceResponseProtoMajor != 0 && (cfg.ForceResponseProtoMajor != 1 || cfg.ForceResponseProtoMinor < 0 || cfg.ForceResponseProtoMinor > 1) {
+		return invalidConfig("only HTTP/1.0 and HTTP/1.1 responses can be forced, got HTTP/%d.%d", cfg.ForceResponseProtoMajor, cfg.ForceResponseProtoMinor)
+	}
+
+	if cfg.AutoHeaders&AutoHeaderAltSvc != 0 && cfg.AltSvc == "" {
+		return invalidConfig("AutoHeaderAltSvc requires an AltSvc value")
+	}
+
+	if cfg.AutoHeaders&AutoHeaderServer != 0 && cfg.ServerName == "" {
+		return invalidConfig("AutoHeaderServer requires a ServerName")
+	}
+
+	if cfg.RejectMisdirected && cfg.TLSUpgrade == nil {
+		return invalidConfig("RejectMisdirected requires a TLSUpgrade config")
+	}
+
+	if cfg.TLSSessionTickets != nil {
+		if cfg.TLSUpgrade == nil {
+			return invalidConfig("TLSSessionTickets requires a TLSUpgrade config")
+		}
+		if cfg.TLSSessionTickets.rotation <= 0 {
+			return invalidConfig("TLSSessionTickets rotation must be positive, got %v", cfg.TLSSessionTickets.rotation)
+		}
+	}
+
+	for _, digest := range cfg.Digests {
+		if digest.New == nil || digest.Header == "" {
+			return invalidConfig("digest %q must have a Header and a New function", digest.Header)
+		}
+	}
+
+	for _, sunset := range cfg.Sunsets {
+		if !strings.HasPrefix(sunset.Prefix, "/") {
+			return invalidConfig("sunset prefix must start with a /, got %q", sunset.Prefix)
+		}
+		if sunset.Deprecated.IsZero() && sunset.At.IsZero() {
+			return invalidConfig("sunset of %q must have a Deprecated or an At time", sunset.Prefix)
+		}
+	}
+
+	if cfg.CORS != nil && cfg.CORS.MaxAge < 0 {
+		return invalidConfig("CORS MaxAge must not be negative, got %v", cfg.CORS.MaxAge)
+	}
+
+	if cfg.Favicon != nil && cfg.Favicon.Status != 0 && (cfg.Favicon.Status < 200 || cfg.Favicon.Status > 599) {
+		return invalidConfig("Favicon Status must be between 200 and 599, got %d", cfg.Favicon.Status)
+	}
+
+	if cfg.RootResponse != nil && cfg.RootResponse.Status != 0 && (cfg.RootResponse.Status < 200 || cfg.RootResponse.Status > 599) {
+		return invalidConfig("RootResponse Status must be between 200 and 599, got %d", cfg.RootResponse.Status)
+	}
+
+	for status := range cfg.ErrorPages {
+		if status < 400 || status > 599 {
+			return invalidConfig("error pages are only for 4xx and 5xx statuses, got %d", status)
+		}
+	}
+
+	for path, response := range cfg.StaticResponses {
+		if !strings.HasPrefix(path, "/") {
+			return invalidConfig("static response path must start with a /, got %q", path)
+		}
+		if err := validateStaticResponse(path, response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg Config) validateListener() error {
+	if cfg.Listener != nil && cfg.ListenerFD >= 0 {
+		return invalidConfig("only one of Listener and ListenerFD may be set")
+	}
+
+	if len(cfg.Bindings) > 0 && (cfg.Listener != nil || cfg.ListenerFD >= 0) {
+		return invalidConfig("Bindings can't be combined with a pre-bound listener")
+	}
+
+	ports := make(map[int]bool, len(cfg.Bindings))
+	for _, binding := range cfg.Bindings {
+		if binding.Port <= 0 || binding.Port > 65535 {
+			return invalidConfig("binding port must be between 1 and 65535, got %d", binding.Port)
+		}
+		if ports[binding.Port] {
+			return invalidConfig("port %d is bound more than once", binding.Port)
+		}
+		ports[binding.Port] = true
+	}
+	return nil
+}
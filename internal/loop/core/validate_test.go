@@ -0,0 +1,262 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		expectedMessage string
+		opts            []Option
+	}{
+		{
+			desc: "defaults",
+		},
+		{
+			desc: "consistent options",
+			opts: []Option{
+				WithMaxBodyBytes(1 << 20),
+				WithReadTimeout(time.Second),
+				WithRequestTimeoutResponse(),
+				WithMaxInFlight(10, OverflowQueue),
+				WithMaxQueuedRequests(100),
+				WithMaxRequestRate(1000, 50),
+				WithAltSvc(`h3=":443"`),
+				WithDigestValidation(ContentMD5),
+			},
+		},
+		{
+			desc:            "negative max body bytes",
+			opts:            []Option{WithMaxBodyBytes(-1)},
+			expectedMessage: "MaxBodyBytes must not be negative, got -1",
+		},
+		{
+			desc:            "negative spill threshold",
+			opts:            []Option{WithBodySpill(-1, "")},
+			expectedMessage: "SpillThreshold must not be negative, got -1",
+		},
+		{
+			desc:            "negative read timeout",
+			opts:            []Option{WithReadTimeout(-time.Second)},
+			expectedMessage: "ReadTimeout must not be negative, got -1s",
+		},
+		{
+			desc:            "negative body read timeout",
+			opts:            []Option{WithBodyReadTimeout(-time.Second)},
+			expectedMessage: "BodyReadTimeout must not be negative, got -1s",
+		},
+		{
+			desc:            "negative handler timeout",
+			opts:            []Option{WithHandlerTimeout(-time.Second)},
+			expectedMessage: "HandlerTimeout must not be negative, got -1s",
+		},
+		{
+			desc:            "route timeout with a relative prefix",
+			opts:            []Option{WithRouteTimeouts(RouteTimeout{Prefix: "uploads/", ReadTimeout: time.Minute})},
+			expectedMessage: `route timeout prefix must start with a /, got "uploads/"`,
+		},
+		{
+			desc:            "negative route timeout",
+			opts:            []Option{WithRouteTimeouts(RouteTimeout{Prefix: "/uploads/", HandlerTimeout: -time.Minute})},
+			expectedMessage: `route timeouts of "/uploads/" must not be negative`,
+		},
+		{
+			desc:            "negative max conn lifetime",
+			opts:            []Option{WithMaxConnLifetime(-time.Minute)},
+			expectedMessage: "MaxConnLifetime must not be negative, got -1m0s",
+		},
+		{
+			desc:            "timeout response without a timeout",
+			opts:            []Option{WithRequestTimeoutResponse()},
+			expectedMessage: "RequestTimeoutResponse requires a ReadTimeout",
+		},
+		{
+			desc:            "abandoned handlers without a timeout",
+			opts:            []Option{WithAbandonTimedOutHandlers()},
+			expectedMessage: "AbandonTimedOutHandlers requires a HandlerTimeout",
+		},
+		{
+			desc: "abandoned handlers with a route timeout",
+			opts: []Option{
+				WithAbandonTimedOutHandlers(),
+				WithRouteTimeouts(RouteTimeout{Prefix: "/poll/", HandlerTimeout: time.Minute}),
+			},
+		},
+		{
+			desc:            "queue without in flight cap",
+			opts:            []Option{WithMaxQueuedRequests(10)},
+			expectedMessage: "MaxQueuedRequests requires a MaxInFlight with the OverflowQueue behavior",
+		},
+		{
+			desc:            "queue with the reject behavior",
+			opts:            []Option{WithMaxInFlight(10, OverflowReject), WithMaxQueuedRequests(10)},
+			expectedMessage: "MaxQueuedRequests requires a MaxInFlight with the OverflowQueue behavior",
+		},
+		{
+			desc:            "unknown overflow behavior",
+			opts:            []Option{WithMaxInFlight(10, OverflowBehavior(7))},
+			expectedMessage: "unknown InFlightOverflow 7",
+		},
+		{
+			desc:            "unknown dispatch model",
+			opts:            []Option{WithDispatch(DispatchModel(5), 0)},
+			expectedMessage: "unknown Dispatch 5",
+		},
+		{
+			desc:            "negative worker pool size",
+			opts:            []Option{WithDispatch(DispatchWorkerPool, -1)},
+			expectedMessage: "WorkerPoolSize must not be negative, got -1",
+		},
+		{
+			desc:            "workers without a pool",
+			opts:            []Option{WithDispatch(DispatchGoroutinePerConn, 4)},
+			expectedMessage: "WorkerPoolSize requires the DispatchWorkerPool",
+		},
+		{
+			desc:            "unknown budget policy",
+			opts:            []Option{WithMaxBufferedBytes(1<<20, BudgetPolicy(3))},
+			expectedMessage: "unknown BudgetPolicy 3",
+		},
+		{
+			desc:            "negative request rate",
+			opts:            []Option{WithMaxRequestRate(-1, 0)},
+			expectedMessage: "MaxRequestRate must be between 0 and 1000000000, got -1",
+		},
+		{
+			desc:            "burst without a request rate",
+			opts:            []Option{WithMaxRequestRate(0, 10)},
+			expectedMessage: "RequestBurst requires a MaxRequestRate",
+		},
+		{
+			desc:            "unsupported forced version",
+			opts:            []Option{WithForceResponseVersion(2, 0)},
+			expectedMessage: "only HTTP/1.0 and HTTP/1.1 responses can be forced, got HTTP/2.0",
+		},
+		{
+			desc:            "alt-svc header without a value",
+			opts:            []Option{WithAutoHeaders(AutoHeaderAltSvc)},
+			expectedMessage: "AutoHeaderAltSvc requires an AltSvc value",
+		},
+		{
+			desc:            "server header without a name",
+			opts:            []Option{WithAutoHeaders(AutoHeaderServer), WithServerName("")},
+			expectedMessage: "AutoHeaderServer requires a ServerName",
+		},
+		{
+			desc:            "misdirected requests without TLS",
+			opts:            []Option{WithRejectMisdirected()},
+			expectedMessage: "RejectMisdirected requires a TLSUpgrade config",
+		},
+		{
+			desc:            "session tickets without TLS",
+			opts:            []Option{WithTLSSessionTickets(NewTLSSessionTickets(time.Hour))},
+			expectedMessage: "TLSSessionTickets requires a TLSUpgrade config",
+		},
+		{
+			desc:            "session tickets without a rotation",
+			opts:            []Option{WithTLSUpgrade(&tls.Config{}), WithTLSSessionTickets(NewTLSSessionTickets(0))},
+			expectedMessage: "TLSSessionTickets rotation must be positive, got 0s",
+		},
+		{
+			desc:            "digest without a header",
+			opts:            []Option{WithDigestValidation(Digest{New: sha256.New})},
+			expectedMessage: `digest "" must have a Header and a New function`,
+		},
+		{
+			desc:            "favicon with an invalid status",
+			opts:            []Option{WithFavicon(Favicon{Status: 42})},
+			expectedMessage: "Favicon Status must be between 200 and 599, got 42",
+		},
+		{
+			desc:            "root response with an invalid status",
+			opts:            []Option{WithRootResponse(RootResponse{Status: 99})},
+			expectedMessage: "RootResponse Status must be between 200 and 599, got 99",
+		},
+		{
+			desc:            "sunset with a relative prefix",
+			opts:            []Option{WithSunsets(Sunset{Prefix: "v1/", At: time.Unix(1, 0)})},
+			expectedMessage: `sunset prefix must start with a /, got "v1/"`,
+		},
+		{
+			desc:            "sunset without any time",
+			opts:            []Option{WithSunsets(Sunset{Prefix: "/v1/", Link: "https://example.com/v2"})},
+			expectedMessage: `sunset of "/v1/" must have a Deprecated or an At time`,
+		},
+		{
+			desc:            "error page for a successful status",
+			opts:            []Option{WithErrorPage(http.StatusOK, "", "{{status}} {{reason}}")},
+			expectedMessage: "error pages are only for 4xx and 5xx statuses, got 200",
+		},
+		{
+			desc:            "static response with a relative path",
+			opts:            []Option{WithStaticResponse("health", StaticResponse(http.StatusOK, "text/plain", []byte("ok")))},
+			expectedMessage: `static response path must start with a /, got "health"`,
+		},
+		{
+			desc:            "static response without a Content-Length",
+			opts:            []Option{WithStaticResponse("/health", []byte("HTTP/1.1 200 OK\r\n\r\nok"))},
+			expectedMessage: `static response of "/health" must have a Content-Length and keep the connection alive`,
+		},
+		{
+			desc:            "static response that closes the connection",
+			opts:            []Option{WithStaticResponse("/health", []byte("HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\n\r\nok"))},
+			expectedMessage: `static response of "/health" must have a Content-Length and keep the connection alive`,
+		},
+		{
+			desc:            "static response longer than its Content-Length",
+			opts:            []Option{WithStaticResponse("/health", []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nokay"))},
+			expectedMessage: `static response of "/health" is longer than its Content-Length`,
+		},
+		{
+			desc:            "nil logger",
+			opts:            []Option{WithLogger(nil)},
+			expectedMessage: "Logger must not be nil",
+		},
+		{
+			desc:            "binding on an invalid port",
+			opts:            []Option{WithBindings(Binding{Port: 70000})},
+			expectedMessage: "binding port must be between 1 and 65535, got 70000",
+		},
+		{
+			desc:            "port bound twice",
+			opts:            []Option{WithBindings(Binding{Port: 9090}, Binding{Port: 9090})},
+			expectedMessage: "port 9090 is bound more than once",
+		},
+		{
+			desc:            "bindings with a pre-bound listener",
+			opts:            []Option{WithFD(3), WithBindings(Binding{Port: 9090})},
+			expectedMessage: "Bindings can't be combined with a pre-bound listener",
+		},
+		{
+			desc:            "listener and file descriptor",
+			opts:            []Option{WithListener(&net.TCPListener{}), WithFD(3)},
+			expectedMessage: "only one of Listener and ListenerFD may be set",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			err := NewConfig(tC.opts...).Validate()
+			if tC.expectedMessage == "" {
+				if err != nil {
+					subT.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidConfig) {
+				subT.Fatalf("Validate() error = %v, want it to wrap %v", err, ErrInvalidConfig)
+			}
+			if !strings.HasSuffix(err.Error(), ": "+tC.expectedMessage) {
+				subT.Errorf("Validate() error = %q, want it to end with %q", err, tC.expectedMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"time"
+)
+
+const (
+	// EventSlowHandler is logged when a handler has been running on an event loop for longer than the SlowHandlerThreshold.
+	EventSlowHandler = "handler.slow"
+	// EventSuperfluousWriteHeader is logged when a handler calls WriteHeader after the header was already written, which
+	// is ignored, like the standard library's "http: superfluous response.WriteHeader call" warning.
+	EventSuperfluousWriteHeader = "handler.superfluous_write_header"
+)
+
+// watchHandler starts the slow handler watchdog for a single dispatch, which logs an EventSlowHandler record if the
+// dispatch is still running once the SlowHandlerThreshold has passed. The returned timer must be stopped once the
+// handler returns, and is nil when the watchdog is disabled. The record identifies the blocked loop by its index (see
+// LoopIndex, which is -1 for connections without a loop) along with the connection that it is serving.
+func (h *Handler) watchHandler(state *conn, method, target string) *time.Timer {
+	if h.config.SlowHandlerThreshold <= 0 {
+		return nil
+	}
+
+	start := time.Now()
+	return time.AfterFunc(h.config.SlowHandlerThreshold, func() {
+		h.config.Logger.Log(EventSlowHandler, Fields{
+			"method":    method,
+			"target":    target,
+			"loop":      state.loop,
+			"local":     state.localAddr.String(),
+			"remote":    state.remoteAddr.String(),
+			"threshold": h.config.SlowHandlerThreshold.String(),
+			"running":   time.Since(start).String(),
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	})
+}
+
+// logSuperfluousWriteHeader logs an EventSuperfluousWriteHeader record for the handler's ignored WriteHeader call,
+// which was made from the caller.
+func (h *Handler) logSuperfluousWriteHeader(method, target, caller string) {
+	h.config.Logger.Log(EventSuperfluousWriteHeader, Fields{
+		"method":    method,
+		"target":    target,
+		"caller":    caller,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_SlowHandlerWatchdog(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		threshold     time.Duration
+		handlerTime   time.Duration
+		expectedWarns int
+	}{
+		{
+			desc:          "slow handler",
+			threshold:     20 * time.Millisecond,
+			handlerTime:   100 * time.Millisecond,
+			expectedWarns: 1,
+		},
+		{
+			desc:          "fast handler",
+			threshold:     100 * time.Millisecond,
+			handlerTime:   0,
+			expectedWarns: 0,
+		},
+		{
+			desc:          "disabled",
+			handlerTime:   50 * time.Millisecond,
+			expectedWarns: 0,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			logger := &recordingLogger{}
+			h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tC.handlerTime)
+				w.WriteHeader(http.StatusOK)
+			}), WithLogger(logger), WithSlowHandlerWatchdog(tC.threshold))
+			c := newTestConn()
+			c.loop = &testLoop{idx: 2}
+			h.Opened(c, c.wake)
+
+			h.Data(c, []byte("GET /slow?x=1 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+
+			// Give a watchdog that should have been stopped the chance to (wrongly) fire
+			time.Sleep(tC.threshold)
+
+			warns := logger.events(EventSlowHandler)
+			if len(warns) != tC.expectedWarns {
+				subT.Fatalf("logged %d %s records, want %d", len(warns), EventSlowHandler, tC.expectedWarns)
+			}
+
+			for _, warn := range warns {
+				if warn.fields["method"] != http.MethodGet || warn.fields["target"] != "/slow?x=1" {
+					subT.Errorf("warning is for %v %v, want GET /slow?x=1", warn.fields["method"], warn.fields["target"])
+				}
+				if warn.fields["loop"] != 2 {
+					subT.Errorf("warning loop = %v, want 2", warn.fields["loop"])
+				}
+				if warn.fields["remote"] != c.RemoteAddr().String() {
+					subT.Errorf("warning remote = %v, want %v", warn.fields["remote"], c.RemoteAddr())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_SuperfluousWriteHeader(t *testing.T) {
+	logger := &recordingLogger{}
+	h := NewHandler(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		w.Header().Set("X-Late", "dropped")
+		w.WriteHeader(http.StatusInternalServerError)
+	}), WithLogger(logger))
+	c := newTestConn()
+	h.Opened(c, c.wake)
+
+	out, _ := h.Data(c, []byte("GET /late?x=1 HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n"))
+	res := expectStatus(t, out, http.StatusOK)
+	if got := res.Header.Get("X-Late"); got != "" {
+		t.Errorf("X-Late = %q, want headers set after the first Write dropped", got)
+	}
+
+	warns := logger.events(EventSuperfluousWriteHeader)
+	if len(warns) != 1 {
+		t.Fatalf("logged %d %s records, want 1", len(warns), EventSuperfluousWriteHeader)
+	}
+	if warns[0].fields["method"] != http.MethodGet || warns[0].fields["target"] != "/late?x=1" {
+		t.Errorf("warning is for %v %v, want GET /late?x=1", warns[0].fields["method"], warns[0].fields["target"])
+	}
+	if caller, _ := warns[0].fields["caller"].(string); !strings.Contains(caller, "watchdog_test.go:") {
+		t.Errorf("warning caller = %q, want the handler's line in watchdog_test.go", caller)
+	}
+}
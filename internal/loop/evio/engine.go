@@ -1,128 +1,176 @@
 package evio
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
-	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/loop/core"
 	"github.com/tidwall/evio"
 )
 
 type Engine struct {
+	core    *core.Handler
 	handler evio.Events
+	// stopped is closed once the event loops of the current ListenAndServe have returned.
+	stopped chan struct{}
 	binding string
 	port    int
+	// started is set once the event loops of the current ListenAndServe are serving, which they never get to when
+	// binding the addresses fails.
+	started bool
 }
 
 func (e *Engine) ListenAndServe() error {
-	return evio.Serve(e.handler, fmt.Sprintf("tcp://%s:%d", e.binding, e.port))
+	ln, err := e.core.Config().PreboundListener()
+	if err != nil {
+		return err
+	}
+
+	if ln != nil {
+		// evio can't adopt an existing listener, so its connections are served without the event loops
+		e.core.LogServerEvent(core.EventServerStart, "evio", e.port, 0)
+		err = e.core.Serve(ln)
+		e.core.LogServerEvent(core.EventServerStop, "evio", e.port, 0)
+		return err
+	}
+
+	// The bindings are served by the same event loops, which route their connections by the port they arrived on
+	addrs := []string{fmt.Sprintf("tcp://%s:%d", e.binding, e.port)}
+	for _, binding := range e.core.Config().Bindings {
+		addrs = append(addrs, fmt.Sprintf("tcp://%s:%d", e.binding, binding.Port))
+	}
+
+	e.stopped = make(chan struct{})
+	e.started = false
+	err = evio.Serve(e.handler, addrs...)
+	close(e.stopped)
+	if e.started {
+		e.core.LogServerEvent(core.EventServerStop, "evio", e.port, e.handler.NumLoops)
+	}
+	return err
 }
 
-func NewEngine(ctx context.Context, loops, port int, httpHandler http.Handler) *Engine {
+// Stats returns a snapshot of the engine's counters.
+func (e *Engine) Stats() core.Stats {
+	return e.core.Stats()
+}
+
+// Connections returns a snapshot of the metadata of the engine's active connections.
+func (e *Engine) Connections() []core.ConnInfo {
+	return e.core.Connections()
+}
+
+// Exchanges returns the request/response exchanges recorded by the engine, if recording is enabled.
+func (e *Engine) Exchanges() []core.Exchange {
+	return e.core.Exchanges()
+}
+
+// Pause stops the engine from accepting new connections until Resume is called, see core.Handler.Pause.
+func (e *Engine) Pause() {
+	e.core.Pause()
+}
+
+// Resume makes a paused engine accept new connections again.
+func (e *Engine) Resume() {
+	e.core.Resume()
+}
+
+func NewEngine(ctx context.Context, loops, port int, httpHandler http.Handler, opts ...core.Option) *Engine {
+	c := core.NewHandler(ctx, httpHandler, opts...)
+	e := &Engine{
+		core: c,
+		port: port,
+	}
+
 	var handler evio.Events
 	handler.NumLoops = loops
 	handler.LoadBalance = evio.RoundRobin
 
 	// Serving fires on server up (one time)
 	handler.Serving = func(server evio.Server) evio.Action {
-		fmt.Println("evio server started with", server.NumLoops, "event loops on port", port)
+		// Serving is called from within evio.Serve, before it returns
+		e.started = true
+		c.LogServerEvent(core.EventServerStart, "evio", port, server.NumLoops)
 
 		select {
 		case <-ctx.Done():
 			return evio.Shutdown
 		default:
+			go e.wakeOnCancel(ctx, server.Addrs[0], e.stopped)
 			return evio.None
 		}
 	}
 
 	// Opened fires on opening new connections (per connection)
-	handler.Opened = func(c evio.Conn) ([]byte, evio.Options, evio.Action) {
-		c.SetContext(&evio.InputStream{})
-
-		select {
-		case <-ctx.Done():
-			return nil, evio.Options{}, evio.Close
-		default:
-			return nil, evio.Options{}, evio.None
-		}
+	handler.Opened = func(conn evio.Conn) ([]byte, evio.Options, evio.Action) {
+		c.LoopOpened(conn)
+		return nil, evio.Options{}, toAction(c.Opened(conn, conn.Wake))
 	}
 
 	// Closed fires on closing connections (per connection)
-	handler.Closed = func(c evio.Conn, err error) evio.Action {
-		if err != nil {
-			fmt.Println("connection between", c.LocalAddr(), "and", c.RemoteAddr(), "has been closed with error value", err)
-		}
-
-		select {
-		case <-ctx.Done():
-			return evio.Shutdown
-		default:
-			return evio.None
-		}
+	handler.Closed = func(conn evio.Conn, err error) evio.Action {
+		c.LoopClosed(conn)
+		return toAction(c.Closed(conn, err))
 	}
 
 	// Data fires on data being sent to a connection (per connection, per data frame read)
-	handler.Data = func(c evio.Conn, in []byte) ([]byte, evio.Action) {
-		if len(in) == 0 {
-			return nil, evio.None
-		}
-
-		stream := c.Context().(*evio.InputStream)
-		data := stream.Begin(in)
-
-		complete, err := internalHttp.IsRequestComplete(data)
-		if err != nil {
-			fmt.Println("Uh oh, there was an error checking completeness?", err)
-			return nil, evio.Close
-		}
+	handler.Data = func(conn evio.Conn, in []byte) ([]byte, evio.Action) {
+		out, action := c.Data(conn, in)
+		return out, toAction(action)
+	}
 
-		stream.End(data)
-		if !complete {
-			return nil, evio.None
-		}
+	handler.Tick = func() (time.Duration, evio.Action) {
+		delay, action := c.Tick()
+		return delay, toAction(action)
+	}
 
-		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
-		if err != nil {
-			fmt.Println("Uh oh, there was an error creating the request?", err)
-			return nil, evio.Close
-		}
+	e.handler = handler
+	return e
+}
 
-		res := internalHttp.NewResponseWriter()
-		httpHandler.ServeHTTP(res, req)
+// wakeOnCancel connects to the server once the context is canceled. The event loops only look at the context when
+// they have an event to handle, which would otherwise leave the server running until the next tick. The connection
+// is closed by Opened, and closing it shuts the server down.
+func (e *Engine) wakeOnCancel(ctx context.Context, addr net.Addr, stopped <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-stopped:
+		return
+	}
 
-		buf := bytes.NewBuffer(nil)
-		err = res.WriteToBuf(buf)
-		if err != nil {
-			fmt.Println("Uh oh, there was an error writing the response?", err)
-			return nil, evio.Close
-		}
+	conn, err := net.DialTimeout("tcp", dialAddr(addr), time.Second)
+	if err != nil {
+		// The next tick shuts the server down anyway
+		return
+	}
+	conn.Close()
+}
 
-		select {
-		case <-ctx.Done():
-			return buf.Bytes(), evio.Close
-		default:
-			// Reset the connection context to an empty input stream once we have completed a full request in order to
-			// ensure that the next request starts empty.
-			c.SetContext(&evio.InputStream{})
-			return buf.Bytes(), evio.None
-		}
+// dialAddr returns the address to connect to a listener on, which is the loopback for listeners on every interface.
+func dialAddr(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
 	}
 
-	handler.Tick = func() (delay time.Duration, action evio.Action) {
-		select {
-		case <-ctx.Done():
-			return time.Second, evio.Shutdown
-		default:
-			return time.Second, evio.None
-		}
+	loopback := net.IPv6loopback
+	if tcp.IP.To4() != nil {
+		loopback = net.IPv4(127, 0, 0, 1)
 	}
+	return net.JoinHostPort(loopback.String(), strconv.Itoa(tcp.Port))
+}
 
-	return &Engine{
-		handler: handler,
-		port:    port,
+func toAction(action core.Action) evio.Action {
+	switch action {
+	case core.Close:
+		return evio.Close
+	case core.Shutdown:
+		return evio.Shutdown
+	default:
+		return evio.None
 	}
 }
@@ -0,0 +1,226 @@
+package evio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestEngine_Bindings(t *testing.T) {
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+
+	apiPort, adminPort := freePort(t), freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	e := NewEngine(ctx, 1, apiPort, named("api"), core.WithLogger(core.NewJSONLogger(io.Discard)), core.WithBindings(core.Binding{Port: adminPort, Handler: named("admin")}))
+
+	served := make(chan error, 1)
+	go func() {
+		served <- e.ListenAndServe()
+	}()
+	defer func() {
+		cancel()
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Errorf("engine didn't shut down")
+		}
+	}()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	testCases := []struct {
+		desc         string
+		expectedBody string
+		port         int
+	}{
+		{desc: "engine port", port: apiPort, expectedBody: "api"},
+		{desc: "binding port", port: adminPort, expectedBody: "admin"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			var (
+				res *http.Response
+				err error
+			)
+			for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+				if res, err = client.Get(fmt.Sprintf("http://127.0.0.1:%d/", tC.port)); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				subT.Fatalf("unable to reach port %d: %v", tC.port, err)
+			}
+			defer res.Body.Close()
+
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				subT.Fatalf("unable to read the response body: %v", err)
+			}
+			if string(body) != tC.expectedBody {
+				subT.Errorf("response body = %q, want %q", body, tC.expectedBody)
+			}
+		})
+	}
+}
+
+func TestEngine_LoopStats(t *testing.T) {
+	const loops, conns = 4, 80
+
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	e := NewEngine(ctx, loops, port, nil, core.WithLogger(core.NewJSONLogger(io.Discard)), core.WithLoopStats())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- e.ListenAndServe()
+	}()
+	defer func() {
+		cancel()
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Errorf("engine didn't shut down")
+		}
+	}()
+
+	for i := 0; i < conns; i++ {
+		var conn net.Conn
+		var err error
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			t.Fatalf("unable to connect to the engine: %v", err)
+		}
+
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+			t.Fatalf("unable to read the response: %v", err)
+		}
+		conn.Close()
+	}
+
+	// Every loop is woken up for each connection, and evio's round robin uses up the turn of a loop that finds that the
+	// connection was already accepted by another one, so the connections are only spread roughly evenly
+	stats := e.Stats()
+	if len(stats.LoopConnections) != loops {
+		t.Fatalf("LoopConnections = %v, want %d loops", stats.LoopConnections, loops)
+	}
+	for loop, n := range stats.LoopConnections {
+		if n < conns/loops/2 || n > conns/loops*2 {
+			t.Errorf("LoopConnections = %v, want about %d connections on loop %d", stats.LoopConnections, conns/loops, loop)
+		}
+	}
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		active := uint64(0)
+		for _, n := range e.Stats().LoopActiveConnections {
+			active += n
+		}
+		if active == 0 {
+			return
+		}
+	}
+	t.Errorf("LoopActiveConnections = %v, want none once the connections are closed", e.Stats().LoopActiveConnections)
+}
+
+func TestEngine_PauseResume(t *testing.T) {
+	port := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	e := NewEngine(ctx, 1, port, nil, core.WithLogger(core.NewJSONLogger(io.Discard)))
+
+	served := make(chan error, 1)
+	go func() {
+		served <- e.ListenAndServe()
+	}()
+	defer func() {
+		cancel()
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Errorf("engine didn't shut down")
+		}
+	}()
+
+	// get sends a request on a new connection, and returns the error of reading its response
+	get := func() error {
+		var conn net.Conn
+		var err error
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			t.Fatalf("unable to connect to the engine: %v", err)
+		}
+		defer conn.Close()
+
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		return err
+	}
+
+	if err := get(); err != nil {
+		t.Fatalf("unable to read the response before pausing: %v", err)
+	}
+
+	e.Pause()
+	if err := get(); err == nil {
+		t.Errorf("got a response while paused, want the connection closed")
+	}
+
+	e.Resume()
+	if err := get(); err != nil {
+		t.Errorf("unable to read the response after resuming: %v", err)
+	}
+	if paused := e.Stats().PausedConnections; paused != 1 {
+		t.Errorf("PausedConnections = %d, want 1", paused)
+	}
+}
+
+func TestEngine_BindFailureLogsNoStop(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer ln.Close()
+
+	var logs bytes.Buffer
+	e := NewEngine(context.Background(), 1, ln.Addr().(*net.TCPAddr).Port, nil, core.WithLogger(core.NewJSONLogger(&logs)))
+	if err := e.ListenAndServe(); err == nil {
+		t.Fatalf("ListenAndServe() on a port in use succeeded")
+	}
+
+	// A server that never started must not be logged as stopped either
+	if strings.Contains(logs.String(), core.EventServerStart) || strings.Contains(logs.String(), core.EventServerStop) {
+		t.Errorf("logs = %q, want neither %s nor %s", logs.String(), core.EventServerStart, core.EventServerStop)
+	}
+}
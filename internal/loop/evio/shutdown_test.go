@@ -0,0 +1,88 @@
+package evio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+func TestEngine_ShutdownOnCancel(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		loops int
+		conns int
+	}{
+		{desc: "idle", loops: 1},
+		{desc: "several loops", loops: 4},
+		{desc: "open connections", loops: 2, conns: 4},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			port := freePort(subT)
+			ctx, cancel := context.WithCancel(context.Background())
+			e := NewEngine(ctx, tC.loops, port, http.NotFoundHandler(), core.WithLogger(core.NewJSONLogger(io.Discard)))
+
+			served := make(chan error, 1)
+			go func() {
+				served <- e.ListenAndServe()
+			}()
+
+			var conn net.Conn
+			var err error
+			for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+				if conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				subT.Fatalf("unable to connect to the engine: %v", err)
+			}
+			conn.Close()
+
+			for i := 0; i < tC.conns; i++ {
+				conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+				if err != nil {
+					subT.Fatalf("unable to connect to the engine: %v", err)
+				}
+				defer conn.Close()
+			}
+
+			// Let the first tick pass, so that the shutdown can't be picked up by it
+			time.Sleep(100 * time.Millisecond)
+
+			cancel()
+			start := time.Now()
+			select {
+			case err := <-served:
+				if err != nil {
+					subT.Errorf("ListenAndServe() error = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				subT.Fatal("engine didn't shut down")
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				subT.Errorf("engine shut down %v after the context was canceled, want at most 500ms", elapsed)
+			}
+
+			// None of the engine's goroutines outlive it, although evio's ticker only notices that the loops are gone
+			// once it is done sleeping through the last tick's delay
+			deadline := time.Now().Add(2 * time.Second)
+			for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n := runtime.NumGoroutine(); n > baseline {
+				buf := make([]byte, 1<<16)
+				subT.Errorf("%d goroutines after the shutdown, want at most %d:\n%s", n, baseline, buf[:runtime.Stack(buf, true)])
+			}
+		})
+	}
+}
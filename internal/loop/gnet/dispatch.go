@@ -0,0 +1,294 @@
+package gnet
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"sync"
+
+	"github.com/panjf2000/gnet"
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+// asyncConn is the connection that the core serves off the event loops, one goroutine at a time, with the context
+// and addresses of its own since gnet releases them as soon as the connection is closed.
+type asyncConn struct {
+	conn   gnet.Conn
+	ctx    interface{}
+	local  net.Addr
+	remote net.Addr
+	// ready is signaled when the connection is scheduled, for the DispatchGoroutinePerConn.
+	ready chan struct{}
+	// closeErr is the error that gnet closed the connection with.
+	closeErr error
+	// frames is the input that hasn't been served yet, where an empty frame wakes the connection up.
+	frames [][]byte
+	mu     sync.Mutex
+	// scheduled is set while the connection is waiting for or being served by a goroutine.
+	scheduled bool
+	// closed is set once gnet has closed the connection, which is the last thing that is served.
+	closed bool
+	// done is set once the core has closed the connection, after which the rest of its input is dropped.
+	done bool
+}
+
+func (c *asyncConn) Context() interface{}       { return c.ctx }
+func (c *asyncConn) SetContext(ctx interface{}) { c.ctx = ctx }
+func (c *asyncConn) LocalAddr() net.Addr        { return c.local }
+func (c *asyncConn) RemoteAddr() net.Addr       { return c.remote }
+
+// LoopIndex returns the index of the event loop that gnet assigned the connection to, see core.LoopIndex.
+func (c *asyncConn) LoopIndex() int {
+	return core.LoopIndex(c.conn)
+}
+
+// push queues a frame of input, and reports whether the connection was idle and needs to be scheduled.
+func (c *asyncConn) push(frame []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	c.frames = append(c.frames, frame)
+	return c.schedule()
+}
+
+// close marks the connection as closed by gnet, and reports whether it was idle and needs to be scheduled.
+func (c *asyncConn) close(err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed, c.closeErr = true, err
+	return c.schedule()
+}
+
+// schedule must be called with the mutex held.
+func (c *asyncConn) schedule() bool {
+	if c.scheduled {
+		return false
+	}
+	c.scheduled = true
+	return true
+}
+
+// take returns the queued input and whether the connection was closed after it. When there is neither, the connection
+// goes back to being idle and ok is false.
+func (c *asyncConn) take() (frames [][]byte, closed, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.frames) == 0 && !c.closed {
+		c.scheduled = false
+		return nil, false, false
+	}
+
+	frames, c.frames = c.frames, nil
+	return frames, c.closed, true
+}
+
+// runQueue is the unbounded FIFO of the connections that are waiting for a worker of the DispatchWorkerPool.
+type runQueue struct {
+	ready   *sync.Cond
+	conns   []*asyncConn
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newRunQueue() *runQueue {
+	q := &runQueue{}
+	q.ready = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues the connection, and reports false once the queue is stopped.
+func (q *runQueue) push(ac *asyncConn) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return false
+	}
+	q.conns = append(q.conns, ac)
+	q.ready.Signal()
+	return true
+}
+
+// pop waits for the next connection, and reports false once the queue is stopped.
+func (q *runQueue) pop() (*asyncConn, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.conns) == 0 && !q.stopped {
+		q.ready.Wait()
+	}
+	if q.stopped {
+		return nil, false
+	}
+
+	ac := q.conns[0]
+	q.conns[0] = nil
+	q.conns = q.conns[1:]
+	return ac, true
+}
+
+// stop wakes up the waiting workers, and returns the connections that were still waiting for one.
+func (q *runQueue) stop() []*asyncConn {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stopped = true
+	q.ready.Broadcast()
+	conns := q.conns
+	q.conns = nil
+	return conns
+}
+
+// dispatcher serves connections off the event loops for the DispatchWorkerPool and DispatchGoroutinePerConn.
+type dispatcher struct {
+	ctx     context.Context
+	core    *core.Handler
+	runq    *runQueue
+	model   core.DispatchModel
+	workers int
+	start   sync.Once
+}
+
+func newDispatcher(ctx context.Context, h *core.Handler) *dispatcher {
+	cfg := h.Config()
+	d := &dispatcher{ctx: ctx, core: h, model: cfg.Dispatch, workers: cfg.WorkerPoolSize}
+	if d.model == core.DispatchWorkerPool {
+		if d.workers == 0 {
+			d.workers = runtime.GOMAXPROCS(0)
+		}
+		d.runq = newRunQueue()
+	}
+	return d
+}
+
+// inline reports whether the handlers run on the event loops.
+func (d *dispatcher) inline() bool {
+	return d.model == core.DispatchInline
+}
+
+// opened registers a new connection with the core, and starts its goroutine or, on the first one, the workers.
+func (d *dispatcher) opened(c gnet.Conn) core.Action {
+	ac := &asyncConn{conn: c, local: c.LocalAddr(), remote: c.RemoteAddr(), ready: make(chan struct{}, 1)}
+	c.SetContext(ac)
+	action := d.core.Opened(ac, func() {
+		d.push(ac, nil)
+	})
+
+	switch d.model {
+	case core.DispatchGoroutinePerConn:
+		go func() {
+			for range ac.ready {
+				if d.serve(ac) {
+					return
+				}
+			}
+		}()
+	case core.DispatchWorkerPool:
+		d.start.Do(func() {
+			for i := 0; i < d.workers; i++ {
+				go d.work()
+			}
+			go d.stop()
+		})
+	}
+	return action
+}
+
+// react queues a copy of the frame, since gnet reuses its buffer once React returns.
+func (d *dispatcher) react(c gnet.Conn, frame []byte) {
+	if ac, ok := c.Context().(*asyncConn); ok {
+		d.push(ac, append([]byte(nil), frame...))
+	}
+}
+
+// closed queues the closing of the connection after the rest of its input.
+func (d *dispatcher) closed(c gnet.Conn, err error) {
+	if ac, ok := c.Context().(*asyncConn); ok && ac.close(err) {
+		d.schedule(ac)
+	}
+}
+
+func (d *dispatcher) push(ac *asyncConn, frame []byte) {
+	if ac.push(frame) {
+		d.schedule(ac)
+	}
+}
+
+func (d *dispatcher) schedule(ac *asyncConn) {
+	if d.model == core.DispatchGoroutinePerConn {
+		// The connection's goroutine has taken the previous signal before it went idle, so this never blocks
+		ac.ready <- struct{}{}
+		return
+	}
+
+	// Scheduling runs on the event loops, so it never waits for a worker
+	if !d.runq.push(ac) {
+		// The workers are gone, but the connections that gnet closes while shutting down still have to be released
+		go d.serve(ac)
+	}
+}
+
+func (d *dispatcher) work() {
+	for {
+		ac, ok := d.runq.pop()
+		if !ok {
+			return
+		}
+		d.serve(ac)
+	}
+}
+
+// stop stops the workers once the context is done, and releases the connections that were still waiting for one.
+func (d *dispatcher) stop() {
+	<-d.ctx.Done()
+	for _, ac := range d.runq.stop() {
+		go d.serve(ac)
+	}
+}
+
+// serve runs the core on the connection's queued input until there is none left, and reports whether the connection
+// is closed for good, in which case it must not be served again.
+func (d *dispatcher) serve(ac *asyncConn) bool {
+	for {
+		frames, closed, ok := ac.take()
+		if !ok {
+			return false
+		}
+
+		for _, frame := range frames {
+			if ac.done {
+				break
+			}
+			d.data(ac, frame)
+		}
+
+		if closed {
+			d.core.Closed(ac, ac.closeErr)
+			return true
+		}
+	}
+}
+
+func (d *dispatcher) data(ac *asyncConn, frame []byte) {
+	out, action := d.core.Data(ac, frame)
+	if len(out) > 0 {
+		_ = ac.conn.AsyncWrite(out)
+	}
+
+	if action == core.None {
+		return
+	}
+
+	// Like on the event loop, large responses are drained before closing instead of cut short
+	if action == core.Close && len(out) >= core.DrainThreshold {
+		d.core.Drain(ac)
+		return
+	}
+	ac.done = true
+	_ = ac.conn.Close()
+}
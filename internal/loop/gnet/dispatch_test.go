@@ -0,0 +1,267 @@
+package gnet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+var dispatchModels = []struct {
+	desc    string
+	model   core.DispatchModel
+	workers int
+}{
+	{desc: "inline", model: core.DispatchInline},
+	{desc: "worker pool", model: core.DispatchWorkerPool, workers: 4},
+	{desc: "goroutine per conn", model: core.DispatchGoroutinePerConn},
+}
+
+func TestEngine_DispatchPipelining(t *testing.T) {
+	for _, tC := range dispatchModels {
+		t.Run(tC.desc, func(subT *testing.T) {
+			addr := startEngine(subT, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.URL.Path))
+			}), core.WithDispatch(tC.model, tC.workers))
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				subT.Fatalf("unable to connect to the engine: %v", err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			// The requests are pipelined in a single write, and the responses must come back in the same order
+			var requests string
+			for i := 0; i < 3; i++ {
+				requests += fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n", i)
+			}
+			if _, err := io.WriteString(conn, requests); err != nil {
+				subT.Fatalf("unable to write the requests: %v", err)
+			}
+
+			r := bufio.NewReader(conn)
+			for i := 0; i < 3; i++ {
+				res, err := http.ReadResponse(r, nil)
+				if err != nil {
+					subT.Fatalf("unable to read response %d: %v", i, err)
+				}
+				body, _ := io.ReadAll(res.Body)
+				if expected := fmt.Sprintf("/%d", i); string(body) != expected {
+					subT.Errorf("response %d = %q, want %q", i, body, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_DispatchSlowHandler(t *testing.T) {
+	// With a single event loop, a slow handler that runs inline holds up every other connection, so only the models
+	// that run handlers off the event loop are expected to answer the fast request in the meantime
+	for _, tC := range dispatchModels[1:] {
+		t.Run(tC.desc, func(subT *testing.T) {
+			release := make(chan struct{})
+			var once sync.Once
+			defer once.Do(func() { close(release) })
+
+			addr := startEngine(subT, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					<-release
+				}
+				w.Write([]byte(r.URL.Path))
+			}), core.WithDispatch(tC.model, tC.workers))
+
+			slow, err := net.Dial("tcp", addr)
+			if err != nil {
+				subT.Fatalf("unable to connect to the engine: %v", err)
+			}
+			defer slow.Close()
+			if _, err := io.WriteString(slow, "GET /slow HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"); err != nil {
+				subT.Fatalf("unable to write the slow request: %v", err)
+			}
+
+			fast, err := net.Dial("tcp", addr)
+			if err != nil {
+				subT.Fatalf("unable to connect to the engine: %v", err)
+			}
+			defer fast.Close()
+			_ = fast.SetDeadline(time.Now().Add(2 * time.Second))
+			if _, err := io.WriteString(fast, "GET /fast HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"); err != nil {
+				subT.Fatalf("unable to write the fast request: %v", err)
+			}
+			if _, err := http.ReadResponse(bufio.NewReader(fast), nil); err != nil {
+				subT.Fatalf("fast request wasn't answered while the slow one was running: %v", err)
+			}
+
+			once.Do(func() { close(release) })
+			_ = slow.SetDeadline(time.Now().Add(2 * time.Second))
+			if _, err := http.ReadResponse(bufio.NewReader(slow), nil); err != nil {
+				subT.Fatalf("slow request wasn't answered once released: %v", err)
+			}
+		})
+	}
+}
+
+func TestEngine_DispatchWorkerPoolBacklog(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	defer once.Do(func() { close(release) })
+
+	const workers = 1
+	started := make(chan struct{}, 3*workers+1)
+	e, addr := startEngineLoops(t, 1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.Write([]byte(r.URL.Path))
+	}), core.WithDispatch(core.DispatchWorkerPool, workers))
+
+	// More slow connections than there are workers to serve them have to wait, but not on the event loop
+	var conns []net.Conn
+	for i := 0; i < 3*workers+1; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("unable to connect to the engine: %v", err)
+		}
+		defer conn.Close()
+		if _, err := io.WriteString(conn, "GET /slow HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"); err != nil {
+			t.Fatalf("unable to write the slow request: %v", err)
+		}
+		conns = append(conns, conn)
+	}
+	for i := 0; i < workers; i++ {
+		<-started
+	}
+	// Gives the event loop the time to read the requests that have to wait for a worker
+	time.Sleep(50 * time.Millisecond)
+
+	fast, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to connect to the engine: %v", err)
+	}
+	defer fast.Close()
+	if _, err := io.WriteString(fast, "GET /fast HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"); err != nil {
+		t.Fatalf("unable to write the fast request: %v", err)
+	}
+
+	// The event loop opens the fast connection while every worker is busy
+	opened := func() bool {
+		for _, info := range e.Connections() {
+			if info.RemoteAddr.String() == fast.LocalAddr().String() {
+				return true
+			}
+		}
+		return false
+	}
+	for start := time.Now(); !opened(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("the event loop didn't open a connection while the workers were busy")
+		}
+	}
+
+	once.Do(func() { close(release) })
+	_ = fast.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := http.ReadResponse(bufio.NewReader(fast), nil); err != nil {
+		t.Fatalf("fast request wasn't answered: %v", err)
+	}
+	for i, conn := range conns {
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+			t.Fatalf("slow request %d wasn't answered: %v", i, err)
+		}
+	}
+}
+
+func TestEngine_DispatchClose(t *testing.T) {
+	for _, tC := range dispatchModels[1:] {
+		for _, size := range []int{2, 4 << 20} {
+			t.Run(fmt.Sprintf("%s with %d bytes", tC.desc, size), func(subT *testing.T) {
+				body := make([]byte, size)
+				addr := startEngine(subT, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write(body)
+				}), core.WithDispatch(tC.model, tC.workers), core.WithDisableKeepAlive())
+
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					subT.Fatalf("unable to connect to the engine: %v", err)
+				}
+				defer conn.Close()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+				if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"); err != nil {
+					subT.Fatalf("unable to write the request: %v", err)
+				}
+
+				r := bufio.NewReader(conn)
+				res, err := http.ReadResponse(r, nil)
+				if err != nil {
+					subT.Fatalf("unable to read the response: %v", err)
+				}
+				got, err := io.ReadAll(res.Body)
+				if err != nil || len(got) != len(body) {
+					subT.Fatalf("read %d bytes of the response body with error %v, want %d", len(got), err, len(body))
+				}
+
+				// Large responses are drained until the client hangs up instead of being closed right away
+				if size < core.DrainThreshold {
+					if _, err := r.ReadByte(); err != io.EOF {
+						subT.Errorf("read after the response = %v, want %v", err, io.EOF)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkEngine_Dispatch compares the latency of fast requests under each dispatch model while other connections
+// keep a slow handler busy, on a single event loop.
+func BenchmarkEngine_Dispatch(b *testing.B) {
+	for _, bC := range dispatchModels {
+		b.Run(bC.desc, func(subB *testing.B) {
+			addr := startEngine(subB, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					time.Sleep(10 * time.Millisecond)
+				}
+				w.Write([]byte("ok"))
+			}), core.WithDispatch(bC.model, bC.workers))
+
+			var fast, slow latencyReport
+			for i := 0; i < subB.N; i++ {
+				var wg sync.WaitGroup
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					fast = loadTest{
+						addr:     addr,
+						request:  "GET /fast HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n",
+						clients:  32,
+						rate:     5000,
+						duration: time.Second,
+					}.run()
+				}()
+				go func() {
+					defer wg.Done()
+					slow = loadTest{
+						addr:     addr,
+						request:  "GET /slow HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n",
+						clients:  4,
+						rate:     100,
+						duration: time.Second,
+					}.run()
+				}()
+				wg.Wait()
+			}
+
+			subB.ReportMetric(float64(fast.P50.Microseconds()), "fast-p50-µs")
+			subB.ReportMetric(float64(fast.P99.Microseconds()), "fast-p99-µs")
+			subB.ReportMetric(float64(slow.P99.Microseconds()), "slow-p99-µs")
+		})
+	}
+}
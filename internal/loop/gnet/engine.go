@@ -1,46 +1,109 @@
 package gnet
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/panjf2000/gnet"
-	internalHttp "github.com/probably-not/server-scratch/internal/http"
-	"github.com/tidwall/evio"
+	"github.com/probably-not/server-scratch/internal/loop/core"
 )
 
 type Engine struct {
-	ctx         context.Context
-	httpHandler http.Handler
+	ctx      context.Context
+	core     *core.Handler
+	dispatch *dispatcher
 	*gnet.EventServer
 	binding string
 	loops   int
 	port    int
 }
 
-func NewEngine(ctx context.Context, loops, port int, httpHandler http.Handler) *Engine {
+func NewEngine(ctx context.Context, loops, port int, httpHandler http.Handler, opts ...core.Option) *Engine {
 	handler := Engine{
 		ctx:         ctx,
 		loops:       loops,
 		port:        port,
-		httpHandler: httpHandler,
+		core:        core.NewHandler(ctx, httpHandler, opts...),
 		EventServer: &gnet.EventServer{},
 	}
+	handler.dispatch = newDispatcher(ctx, handler.core)
 
 	return &handler
 }
 
 func (e *Engine) ListenAndServe() error {
-	return gnet.Serve(e, fmt.Sprintf("tcp://%s:%d", e.binding, e.port), gnet.WithNumEventLoop(e.loops), gnet.WithLoadBalancing(gnet.RoundRobin))
+	ln, err := e.core.Config().PreboundListener()
+	if err != nil {
+		return err
+	}
+
+	if ln != nil {
+		// gnet can't adopt an existing listener, so its connections are served without the event loops
+		e.core.LogServerEvent(core.EventServerStart, "gnet", e.port, 0)
+		err = e.core.Serve(ln)
+		e.core.LogServerEvent(core.EventServerStop, "gnet", e.port, 0)
+		return err
+	}
+
+	// gnet listens on a single address per server, so every binding gets a server of its own
+	for _, binding := range e.core.Config().Bindings {
+		go func(port int) {
+			if err := e.serve(port); err != nil {
+				e.core.LogServerError("gnet", err)
+			}
+		}(binding.Port)
+	}
+
+	return e.serve(e.port)
+}
+
+func (e *Engine) serve(port int) error {
+	return gnet.Serve(e, fmt.Sprintf("tcp://%s:%d", e.binding, port), gnet.WithNumEventLoop(e.loops), gnet.WithLoadBalancing(gnet.RoundRobin), gnet.WithTicker(true))
+}
+
+// Stats returns a snapshot of the engine's counters.
+func (e *Engine) Stats() core.Stats {
+	return e.core.Stats()
+}
+
+// Connections returns a snapshot of the metadata of the engine's active connections.
+func (e *Engine) Connections() []core.ConnInfo {
+	return e.core.Connections()
+}
+
+// Exchanges returns the request/response exchanges recorded by the engine, if recording is enabled.
+func (e *Engine) Exchanges() []core.Exchange {
+	return e.core.Exchanges()
+}
+
+// Pause stops the engine from accepting new connections until Resume is called, see core.Handler.Pause.
+func (e *Engine) Pause() {
+	e.core.Pause()
+}
+
+// Resume makes a paused engine accept new connections again.
+func (e *Engine) Resume() {
+	e.core.Resume()
 }
 
 // OnInitComplete fires on server up (one time)
 func (e *Engine) OnInitComplete(server gnet.Server) gnet.Action {
-	fmt.Println("gnet server started with", server.NumEventLoop, "event loops on address", e.port)
+	e.core.LogServerEvent(core.EventServerStart, "gnet", e.serverPort(server), server.NumEventLoop)
+
+	if linger := e.core.Config().Linger; linger >= 0 {
+		if err := setListenerLinger(server, linger); err != nil {
+			e.core.LogServerError("gnet", err)
+		}
+	}
+
+	if queueLen := e.core.Config().TCPFastOpenQueue; queueLen > 0 {
+		if err := setListenerFastOpen(server, queueLen); err != nil {
+			e.core.LogServerError("gnet", err)
+		}
+	}
 
 	select {
 	case <-e.ctx.Done():
@@ -50,84 +113,78 @@ func (e *Engine) OnInitComplete(server gnet.Server) gnet.Action {
 	}
 }
 
+// OnShutdown fires on server down (one time)
+func (e *Engine) OnShutdown(server gnet.Server) {
+	e.core.LogServerEvent(core.EventServerStop, "gnet", e.serverPort(server), server.NumEventLoop)
+}
+
+// serverPort returns the port that the server listens on, which is one of the bindings' ports for their servers.
+func (e *Engine) serverPort(server gnet.Server) int {
+	if addr, ok := server.Addr.(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return e.port
+}
+
 // OnOpened fires on opening new connections (per connection)
 func (e *Engine) OnOpened(c gnet.Conn) ([]byte, gnet.Action) {
-	c.SetContext(&evio.InputStream{})
+	e.core.LoopOpened(c)
+	if !e.dispatch.inline() {
+		return nil, toAction(e.dispatch.opened(c))
+	}
 
-	select {
-	case <-e.ctx.Done():
-		return nil, gnet.Close
-	default:
-		return nil, gnet.None
+	wake := func() {
+		_ = c.Wake()
 	}
+	return nil, toAction(e.core.Opened(c, wake))
 }
 
 // OnClosed fires on closing connections (per connection)
 func (e *Engine) OnClosed(c gnet.Conn, err error) gnet.Action {
-	if err != nil {
-		fmt.Println("connection between", c.LocalAddr(), "and", c.RemoteAddr(), "has been closed with error value", err)
-	}
-
-	select {
-	case <-e.ctx.Done():
-		return gnet.Shutdown
-	default:
-		return gnet.None
+	e.core.LoopClosed(c)
+	if !e.dispatch.inline() {
+		// The core closes the connection once its goroutine is done with it
+		e.dispatch.closed(c, err)
+		select {
+		case <-e.ctx.Done():
+			return gnet.Shutdown
+		default:
+			return gnet.None
+		}
 	}
+	return toAction(e.core.Closed(c, err))
 }
 
 // React fires on data being sent to a connection (per connection, per data frame read)
 func (e *Engine) React(in []byte, c gnet.Conn) ([]byte, gnet.Action) {
-	if len(in) == 0 {
+	if !e.dispatch.inline() {
+		e.dispatch.react(c, in)
 		return nil, gnet.None
 	}
 
-	stream := c.Context().(*evio.InputStream)
-	data := stream.Begin(in)
-
-	complete, err := internalHttp.IsRequestComplete(data)
-	if err != nil {
-		fmt.Println("Uh oh, there was an error checking completeness?", err)
-		return nil, gnet.Close
-	}
-
-	stream.End(data)
-	if !complete {
-		return nil, gnet.None
-	}
+	out, action := e.core.Data(c, in)
 
-	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
-	if err != nil {
-		fmt.Println("Uh oh, there was an error creating the request?", err)
-		return nil, gnet.Close
-	}
-
-	res := internalHttp.NewResponseWriter()
-	e.httpHandler.ServeHTTP(res, req)
-
-	buf := bytes.NewBuffer(nil)
-	err = res.WriteToBuf(buf)
-	if err != nil {
-		fmt.Println("Uh oh, there was an error writing the response?", err)
-		return nil, gnet.Close
-	}
-
-	select {
-	case <-e.ctx.Done():
-		return buf.Bytes(), gnet.Close
-	default:
-		// Reset the connection context to an empty input stream once we have completed a full request in order to
-		// ensure that the next request starts empty.
-		c.SetContext(&evio.InputStream{})
-		return buf.Bytes(), gnet.None
+	// gnet buffers whatever the socket doesn't take and flushes it once the socket is writable again, except when the
+	// connection is closed, where it only tries once. Large responses are drained before closing instead of cut short.
+	if action == core.Close && len(out) >= core.DrainThreshold {
+		e.core.Drain(c)
+		return out, gnet.None
 	}
+	return out, toAction(action)
 }
 
 func (e *Engine) Tick() (delay time.Duration, action gnet.Action) {
-	select {
-	case <-e.ctx.Done():
-		return time.Second, gnet.Shutdown
+	delay, a := e.core.Tick()
+	return delay, toAction(a)
+}
+
+func toAction(action core.Action) gnet.Action {
+	switch action {
+	case core.Close:
+		return gnet.Close
+	case core.Shutdown:
+		return gnet.Shutdown
 	default:
-		return time.Second, gnet.None
+		return gnet.None
 	}
 }
@@ -0,0 +1,127 @@
+package gnet
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+func TestEngine_SlowReaderGetsTheWholeResponse(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 16<<20)
+
+	addr := startEngine(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}), core.WithMaxConnLifetime(time.Nanosecond))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to connect to the engine: %v", err)
+	}
+	defer conn.Close()
+
+	// The connection outlives its lifetime right away, so its first response closes it
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n")); err != nil {
+		t.Fatalf("unable to write the request: %v", err)
+	}
+
+	// Not reading for a while fills up the socket buffers, so the engine can't write the response in one go
+	time.Sleep(500 * time.Millisecond)
+
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("unable to read the response: %v", err)
+	}
+
+	got, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unable to read the response body after %d bytes: %v", len(got), err)
+	}
+	if len(got) != len(body) {
+		t.Errorf("response body is %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestEngine_LoopStats(t *testing.T) {
+	const loops, conns = 4, 40
+
+	e, addr := startEngineLoops(t, loops, nil, core.WithLoopStats())
+
+	// The engine's first connection is the one that startEngineLoops made to wait for it to be up
+	for i := 1; i < conns; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("unable to connect to the engine: %v", err)
+		}
+
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+			t.Fatalf("unable to read the response: %v", err)
+		}
+		conn.Close()
+	}
+
+	// The connections are accepted by a single reactor that hands them to the loops in turn
+	stats := e.Stats()
+	if len(stats.LoopConnections) != loops {
+		t.Fatalf("LoopConnections = %v, want %d loops", stats.LoopConnections, loops)
+	}
+	for loop, n := range stats.LoopConnections {
+		if n != conns/loops {
+			t.Errorf("LoopConnections = %v, want %d connections on loop %d", stats.LoopConnections, conns/loops, loop)
+		}
+	}
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		active := uint64(0)
+		for _, n := range e.Stats().LoopActiveConnections {
+			active += n
+		}
+		if active == 0 {
+			return
+		}
+	}
+	t.Errorf("LoopActiveConnections = %v, want none once the connections are closed", e.Stats().LoopActiveConnections)
+}
+
+func TestEngine_PauseResume(t *testing.T) {
+	e, addr := startEngineLoops(t, 1, nil)
+
+	// get sends a request on a new connection, and returns the error of reading its response
+	get := func() error {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("unable to connect to the engine: %v", err)
+		}
+		defer conn.Close()
+
+		_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		return err
+	}
+
+	if err := get(); err != nil {
+		t.Fatalf("unable to read the response before pausing: %v", err)
+	}
+
+	e.Pause()
+	if err := get(); err == nil {
+		t.Errorf("got a response while paused, want the connection closed")
+	}
+
+	e.Resume()
+	if err := get(); err != nil {
+		t.Errorf("unable to read the response after resuming: %v", err)
+	}
+	if paused := e.Stats().PausedConnections; paused != 1 {
+		t.Errorf("PausedConnections = %d, want 1", paused)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package gnet
+
+import (
+	"errors"
+
+	"github.com/panjf2000/gnet"
+)
+
+func setListenerFastOpen(server gnet.Server, queueLen int) error {
+	return errors.New("TCP Fast Open is not supported by the gnet engine on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package gnet
+
+import (
+	"syscall"
+
+	"github.com/panjf2000/gnet"
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+// setListenerFastOpen enables TCP Fast Open on the listening socket.
+func setListenerFastOpen(server gnet.Server, queueLen int) error {
+	fd, err := server.DupFd()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	return core.SetTCPFastOpen(fd, queueLen)
+}
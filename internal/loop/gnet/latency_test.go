@@ -0,0 +1,247 @@
+package gnet
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+// loadTest drives a fixed amount of keep-alive clients at a combined target rate of requests per second.
+// Every request is timed from when it was scheduled to be sent rather than from when it was actually sent, so that a
+// stalled event loop shows up in the latency of all of the requests queued behind it instead of hiding them.
+type loadTest struct {
+	addr     string
+	request  string
+	clients  int
+	rate     int
+	duration time.Duration
+}
+
+// latencyReport holds the latency percentiles of the requests of a loadTest.
+type latencyReport struct {
+	P50, P99, P999 time.Duration
+	Max            time.Duration
+	Requests       int
+	Errors         int
+}
+
+func (r latencyReport) String() string {
+	return fmt.Sprintf("%d requests (%d errors): p50 %v, p99 %v, p999 %v, max %v", r.Requests, r.Errors, r.P50, r.P99, r.P999, r.Max)
+}
+
+func (lt loadTest) run() latencyReport {
+	interval := time.Duration(int64(time.Second) * int64(lt.clients) / int64(lt.rate))
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		errors    int
+		wg        sync.WaitGroup
+	)
+	for i := 0; i < lt.clients; i++ {
+		wg.Add(1)
+		// The clients are spread across the interval, so that they don't all send their requests at once
+		offset := interval * time.Duration(i) / time.Duration(lt.clients)
+		go func() {
+			defer wg.Done()
+			got, errs := lt.client(offset, interval)
+
+			mu.Lock()
+			latencies = append(latencies, got...)
+			errors += errs
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return newLatencyReport(latencies, errors)
+}
+
+func (lt loadTest) client(offset, interval time.Duration) ([]time.Duration, int) {
+	conn, err := net.Dial("tcp", lt.addr)
+	if err != nil {
+		return nil, 1
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	var latencies []time.Duration
+	start := time.Now().Add(offset)
+	for scheduled := start; scheduled.Sub(start) < lt.duration; scheduled = scheduled.Add(interval) {
+		time.Sleep(time.Until(scheduled))
+
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.WriteString(conn, lt.request); err != nil {
+			return latencies, 1
+		}
+
+		res, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return latencies, 1
+		}
+		_, err = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if err != nil {
+			return latencies, 1
+		}
+		latencies = append(latencies, time.Since(scheduled))
+	}
+	return latencies, 0
+}
+
+func newLatencyReport(latencies []time.Duration, errors int) latencyReport {
+	report := latencyReport{Requests: len(latencies), Errors: errors}
+	if len(latencies) == 0 {
+		return report
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.P50 = percentile(latencies, 0.5)
+	report.P99 = percentile(latencies, 0.99)
+	report.P999 = percentile(latencies, 0.999)
+	report.Max = latencies[len(latencies)-1]
+	return report
+}
+
+// percentile returns the nearest rank percentile p (between 0 and 1) of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// startEngine serves the handler on a single loop gnet engine on a free port until the test is done, and returns its
+// address.
+func startEngine(tb testing.TB, handler http.Handler, opts ...core.Option) string {
+	tb.Helper()
+
+	_, addr := startEngineLoops(tb, 1, handler, opts...)
+	return addr
+}
+
+// startEngineLoops is startEngine with the amount of loops, which also returns the engine for the tests that control
+// it or look at its stats.
+func startEngineLoops(tb testing.TB, loops int, handler http.Handler, opts ...core.Option) (*Engine, string) {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("unable to find a free port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts = append([]core.Option{core.WithLogger(core.NewJSONLogger(io.Discard))}, opts...)
+	e := NewEngine(ctx, loops, port, handler, opts...)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- e.ListenAndServe()
+	}()
+	tb.Cleanup(func() {
+		cancel()
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			tb.Errorf("engine didn't shut down")
+		}
+	})
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return e, addr
+		}
+	}
+	tb.Fatalf("unable to connect to the engine: %v", err)
+	return nil, ""
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 1000)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	testCases := []struct {
+		desc     string
+		p        float64
+		expected time.Duration
+	}{
+		{desc: "p50", p: 0.5, expected: 500 * time.Millisecond},
+		{desc: "p99", p: 0.99, expected: 990 * time.Millisecond},
+		{desc: "p999", p: 0.999, expected: 999 * time.Millisecond},
+		{desc: "p0", p: 0, expected: time.Millisecond},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(subT *testing.T) {
+			if got := percentile(latencies, tC.p); got != tC.expected {
+				subT.Errorf("percentile(%v) = %v, want %v", tC.p, got, tC.expected)
+			}
+		})
+	}
+}
+
+// TestEngine_TailLatency only logs the latency percentiles of a trivial handler, since wall clock latencies depend too
+// much on the machine (and on the race detector) to fail on. BenchmarkEngine_TailLatency is the one to compare them with.
+func TestEngine_TailLatency(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the load test in short mode")
+	}
+
+	addr := startEngine(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	report := loadTest{
+		addr:     addr,
+		request:  "GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n",
+		clients:  16,
+		rate:     2000,
+		duration: time.Second,
+	}.run()
+	t.Log(report)
+
+	if report.Errors > 0 {
+		t.Errorf("%d clients failed", report.Errors)
+	}
+}
+
+// BenchmarkEngine_TailLatency reports the latency percentiles of a trivial handler under a fixed load, for comparing
+// tail latencies across changes with benchstat. Every iteration runs the whole load.
+func BenchmarkEngine_TailLatency(b *testing.B) {
+	addr := startEngine(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	var reports []latencyReport
+	for i := 0; i < b.N; i++ {
+		reports = append(reports, loadTest{
+			addr:     addr,
+			request:  "GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n",
+			clients:  64,
+			rate:     20000,
+			duration: time.Second,
+		}.run())
+	}
+
+	last := reports[len(reports)-1]
+	b.ReportMetric(float64(last.P50.Microseconds()), "p50-µs")
+	b.ReportMetric(float64(last.P99.Microseconds()), "p99-µs")
+	b.ReportMetric(float64(last.P999.Microseconds()), "p999-µs")
+}
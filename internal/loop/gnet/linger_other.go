@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package gnet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/panjf2000/gnet"
+)
+
+func setListenerLinger(server gnet.Server, d time.Duration) error {
+	return errors.New("SO_LINGER is not supported by the gnet engine on this platform")
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package gnet
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/panjf2000/gnet"
+	"github.com/probably-not/server-scratch/internal/loop/core"
+)
+
+// setListenerLinger sets SO_LINGER on the listening socket, which is inherited by every socket accepted from it.
+func setListenerLinger(server gnet.Server, d time.Duration) error {
+	fd, err := server.DupFd()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	return syscall.SetsockoptLinger(fd, syscall.SOL_SOCKET, syscall.SO_LINGER, &syscall.Linger{
+		Onoff:  1,
+		Linger: int32(core.LingerSeconds(d)),
+	})
+}
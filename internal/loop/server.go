@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/probably-not/server-scratch/internal/loop/core"
 	"github.com/probably-not/server-scratch/internal/loop/evio"
 	"github.com/probably-not/server-scratch/internal/loop/gnet"
 	"github.com/probably-not/server-scratch/internal/loop/stdlib"
@@ -14,15 +15,21 @@ type Server struct {
 	engine Engine
 }
 
-func NewServer(ctx context.Context, engineType EngineType, port, loops int, handler http.Handler) (*Server, error) {
+// NewServer creates a Server backed by the given engine type and configured with the given options.
+// It returns an error wrapping core.ErrInvalidConfig when the options are inconsistent.
+func NewServer(ctx context.Context, engineType EngineType, port, loops int, handler http.Handler, opts ...core.Option) (*Server, error) {
+	if err := core.NewConfig(opts...).Validate(); err != nil {
+		return nil, err
+	}
+
 	var engine Engine
 	switch engineType {
 	case Evio:
-		engine = evio.NewEngine(ctx, loops, port, handler)
+		engine = evio.NewEngine(ctx, loops, port, handler, opts...)
 	case Gnet:
-		engine = gnet.NewEngine(ctx, loops, port, handler)
+		engine = gnet.NewEngine(ctx, loops, port, handler, opts...)
 	case Stdlib:
-		engine = stdlib.NewStdlib(port, handler)
+		engine = stdlib.NewStdlib(port, handler, opts...)
 	case UnknownEngineType:
 		return nil, ErrUnknownEngineType
 	default:
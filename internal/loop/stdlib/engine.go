@@ -1,21 +1,126 @@
 package stdlib
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"syscall"
+
+	internalHttp "github.com/probably-not/server-scratch/internal/http"
+	"github.com/probably-not/server-scratch/internal/loop/core"
 )
 
 type Stdlib struct {
 	*http.Server
+	config        core.Config
+	port          int
+	fastOpenQueue int
 }
 
-func NewStdlib(port int, handler http.Handler) *Stdlib {
-	fmt.Println("stdlib server started on address", port)
+func NewStdlib(port int, handler http.Handler, opts ...core.Option) *Stdlib {
+	// Like the event loop engines, a nil handler answers everything with a 404 instead of falling back to the DefaultServeMux
+	if handler == nil {
+		handler = http.NotFoundHandler()
+	}
+
+	cfg := core.NewConfig(opts...)
+	if cfg.DebugPrefix != "" {
+		handler = internalHttp.Debug(cfg.DebugPrefix, handler)
+	}
+	handler = core.RouteBindings(handler, cfg.Bindings)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: handler,
+	}
+
+	if cfg.Linger >= 0 {
+		server.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state != http.StateNew {
+				return
+			}
+
+			if err := core.ApplyLinger(conn, cfg.Linger); err != nil {
+				cfg.LogServerError("stdlib", fmt.Errorf("unable to set SO_LINGER on the connection from %v: %w", conn.RemoteAddr(), err))
+			}
+		}
+	}
+
+	if cfg.DisableKeepAlive {
+		server.SetKeepAlivesEnabled(false)
+	}
 
 	return &Stdlib{
-		Server: &http.Server{
-			Addr:    fmt.Sprintf(":%d", port),
-			Handler: handler,
-		},
+		Server:        server,
+		config:        cfg,
+		port:          port,
+		fastOpenQueue: cfg.TCPFastOpenQueue,
+	}
+}
+
+// ListenAndServe listens on the server's address and serves requests on it, enabling
+// TCP Fast Open on the listener when it was configured. When a pre-bound listener was
+// configured, it serves on it instead.
+func (s *Stdlib) ListenAndServe() error {
+	ln, err := s.config.PreboundListener()
+	if err != nil {
+		return err
+	}
+
+	if ln != nil {
+		return s.serve(ln)
+	}
+
+	if err := s.serveBindings(); err != nil {
+		return err
+	}
+
+	var lc net.ListenConfig
+	if s.fastOpenQueue > 0 {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			return c.Control(func(fd uintptr) {
+				if err := core.SetTCPFastOpen(int(fd), s.fastOpenQueue); err != nil {
+					s.config.LogServerError("stdlib", fmt.Errorf("unable to enable TCP Fast Open on the listener: %w", err))
+				}
+			})
+		}
+	}
+
+	// The listener is bound here rather than by http.Server.ListenAndServe, so that the server is only logged as
+	// started once it is actually listening
+	ln, err = lc.Listen(context.Background(), "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(ln)
+}
+
+// serve serves requests on the listener, logging the server's start and stop records around it like the event loop
+// engines do.
+func (s *Stdlib) serve(ln net.Listener) error {
+	s.config.LogServerEvent(core.EventServerStart, "stdlib", s.port, 0)
+	err := s.Serve(ln)
+	s.config.LogServerEvent(core.EventServerStop, "stdlib", s.port, 0)
+	return err
+}
+
+// serveBindings listens on the ports of the bindings and serves them alongside the server's own address, with the
+// requests routed to the bindings' handlers by RouteBindings.
+func (s *Stdlib) serveBindings() error {
+	for _, binding := range s.config.Bindings {
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", binding.Port))
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			// Shutting the server down closes the bindings' listeners as well, which isn't worth reporting
+			if err := s.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.config.LogServerError("stdlib", fmt.Errorf("stopped serving on %v: %w", ln.Addr(), err))
+			}
+		}()
 	}
+	return nil
 }